@@ -0,0 +1,233 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scopeUserRead  = "user:read"
+	scopeUserWrite = "user:write"
+	scopeUsersRead = "users:read"
+)
+
+var validScopes = map[string]bool{
+	scopeUserRead:  true,
+	scopeUserWrite: true,
+	scopeUsersRead: true,
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type apiKeyResponse struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createAPIKeyResponse struct {
+	Key string `json:"key"`
+	apiKeyResponse
+}
+
+func newAPIKeyResponse(apiKey *db.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.ScopeList(),
+		ExpiresAt:  apiKey.ExpiresAt,
+		RevokedAt:  apiKey.RevokedAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+func (s *Server) createAPIKey(c *gin.Context) {
+	var apiKeyReq createAPIKeyRequest
+
+	if err := c.ShouldBindJSON(&apiKeyReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	for _, scope := range apiKeyReq.Scopes {
+		if !validScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": "Incorrect parameters sent in request",
+			})
+			return
+		}
+	}
+
+	if apiKeyReq.ExpiresAt != nil && apiKeyReq.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userReq, _ := c.Keys["currentUser"]
+	currentUser, _ := userReq.(*db.User)
+
+	if !currentUser.ServiceAccount {
+		c.JSON(http.StatusForbidden, gin.H{
+			"name":    "Forbidden",
+			"message": "Only service accounts can create API keys",
+		})
+		return
+	}
+
+	if len(apiKeyReq.Scopes) == 0 {
+		apiKeyReq.Scopes = []string{scopeUserRead, scopeUserWrite}
+	}
+
+	key, prefix, err := util.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	apiKeyParams := db.CreateAPIKeyParams{
+		UserID:    currentUser.ID,
+		Name:      apiKeyReq.Name,
+		Prefix:    prefix,
+		KeyHash:   util.HashAPIKey(key),
+		Scopes:    apiKeyReq.Scopes,
+		ExpiresAt: apiKeyReq.ExpiresAt,
+	}
+
+	ctx := c.Request.Context()
+
+	var apiKey *db.APIKey
+	err = s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		apiKey, err = tx.CreateAPIKey(ctx, apiKeyParams)
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionAPIKeyCreate, currentUser)
+		_, auditParams.After = auditDiff(nil, map[string]any{
+			"name":       apiKey.Name,
+			"prefix":     apiKey.Prefix,
+			"scopes":     apiKey.ScopeList(),
+			"expires_at": apiKey.ExpiresAt,
+		})
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	apiKeyRes := &createAPIKeyResponse{
+		Key:            key,
+		apiKeyResponse: newAPIKeyResponse(apiKey),
+	}
+
+	c.JSON(http.StatusCreated, apiKeyRes)
+}
+
+type getAPIKeysResponse struct {
+	APIKeys []apiKeyResponse `json:"api_keys"`
+}
+
+func (s *Server) getAPIKeys(c *gin.Context) {
+	userReq, _ := c.Keys["currentUser"]
+	currentUser, _ := userReq.(*db.User)
+
+	apiKeys, err := s.DbConnector.GetAPIKeys(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	apiKeysRes := &getAPIKeysResponse{
+		APIKeys: []apiKeyResponse{},
+	}
+	for i := range apiKeys {
+		apiKeysRes.APIKeys = append(apiKeysRes.APIKeys, newAPIKeyResponse(&apiKeys[i]))
+	}
+
+	c.JSON(http.StatusOK, apiKeysRes)
+}
+
+type revokeAPIKeyRequest struct {
+	Prefix string `uri:"prefix" binding:"required"`
+}
+
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	var revokeReq revokeAPIKeyRequest
+
+	if err := c.ShouldBindUri(&revokeReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userReq, _ := c.Keys["currentUser"]
+	currentUser, _ := userReq.(*db.User)
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.RevokeAPIKey(ctx, currentUser.ID, revokeReq.Prefix); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionAPIKeyRevoke, currentUser)
+		auditParams.Before, _ = auditDiff(map[string]any{
+			"prefix": revokeReq.Prefix,
+		}, nil)
+
+		_, err := tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
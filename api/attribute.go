@@ -0,0 +1,330 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+)
+
+// attributeFilterPrefix prefixes the query parameters filtering users by attribute, as in
+// attr.department=sales
+const attributeFilterPrefix = "attr."
+
+// invalidAttributesError rejects attributes which do not follow their definitions
+type invalidAttributesError struct {
+	err error
+}
+
+func (e *invalidAttributesError) Error() string {
+	return e.err.Error()
+}
+
+// checkAttributes validates the attributes set for the user with userID, which is zero for
+// users being created, returning them as they are stored
+func checkAttributes(ctx context.Context, tx db.DBConnector, userID uint, attributes db.Attributes) (db.Attributes, error) {
+	definitions, err := tx.GetAttributeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	validated, err := db.ValidateAttributes(definitions, attributes)
+	if err != nil {
+		return nil, &invalidAttributesError{err: err}
+	}
+
+	for _, definition := range definitions {
+		value, ok := validated[definition.Name]
+		if !definition.Unique || !ok {
+			continue
+		}
+
+		taken, err := tx.IsAttributeValueTaken(ctx, definition.Name, value, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if taken {
+			return nil, &db.BadInputError{
+				Err: fmt.Errorf("An user with the provided %s already exists", definition.Name),
+			}
+		}
+	}
+
+	return validated, nil
+}
+
+// definedAttributes keeps the attributes which are still defined, leaving private ones out
+// unless showPrivate is set
+func definedAttributes(definitions []db.AttributeDefinition, attributes db.Attributes, showPrivate bool) db.Attributes {
+	defined := db.Attributes{}
+	for _, definition := range definitions {
+		value, ok := attributes[definition.Name]
+		if ok && (showPrivate || definition.Visibility == db.AttributeVisibilityPublic) {
+			defined[definition.Name] = value
+		}
+	}
+
+	return defined
+}
+
+// showsPrivateAttributes reports whether the private attributes of user are shown to the
+// current user of c, which is the case for the user itself and for the admins of the
+// organization of the request
+func showsPrivateAttributes(c *gin.Context, user *db.User) bool {
+	currentUser, ok := c.Keys["currentUser"].(*db.User)
+	if !ok {
+		return false
+	}
+
+	return currentUser.ID == user.ID || isAdminOf(currentUser, requestTenant(c.Request.Context()))
+}
+
+// loadAttributeDefinitions reads the attribute definitions, unless none of users holds attributes
+func (s *Server) loadAttributeDefinitions(ctx context.Context, users ...*db.User) ([]db.AttributeDefinition, error) {
+	for _, user := range users {
+		if len(user.Attributes) > 0 {
+			return s.DbConnector.GetAttributeDefinitions(ctx)
+		}
+	}
+
+	return nil, nil
+}
+
+// attributeFilters parses the attr.<name> query parameters of the request into attribute values
+func (s *Server) attributeFilters(c *gin.Context) (db.Attributes, error) {
+	filters := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, attributeFilterPrefix); ok && name != "" {
+			filters[name] = values[len(values)-1]
+		}
+	}
+
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	definitions, err := s.DbConnector.GetAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]*db.AttributeDefinition{}
+	for i := range definitions {
+		byName[definitions[i].Name] = &definitions[i]
+	}
+
+	attributes := db.Attributes{}
+	for name, text := range filters {
+		definition, ok := byName[name]
+		if !ok {
+			return nil, &invalidAttributesError{err: fmt.Errorf("Attribute %s is not defined", name)}
+		}
+
+		value, err := definition.ParseAttributeValue(text)
+		if err != nil {
+			return nil, &invalidAttributesError{err: err}
+		}
+
+		attributes[name] = value
+	}
+
+	return attributes, nil
+}
+
+type createAttributeDefinitionRequest struct {
+	Name       string `json:"name" binding:"required,attributeName"`
+	Type       string `json:"type" binding:"required,oneof=string number boolean date"`
+	Required   bool   `json:"required"`
+	Unique     bool   `json:"unique"`
+	Pattern    string `json:"pattern"`
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private"`
+}
+
+type attributeDefinitionResponse struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Required   bool      `json:"required"`
+	Unique     bool      `json:"unique"`
+	Pattern    string    `json:"pattern,omitempty"`
+	Visibility string    `json:"visibility"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newAttributeDefinitionResponse(definition *db.AttributeDefinition) attributeDefinitionResponse {
+	return attributeDefinitionResponse{
+		Name:       definition.Name,
+		Type:       definition.Type,
+		Required:   definition.Required,
+		Unique:     definition.Unique,
+		Pattern:    definition.Pattern,
+		Visibility: definition.Visibility,
+		CreatedAt:  definition.CreatedAt,
+	}
+}
+
+// auditAttributeDefinition serializes definition for the audit log
+func auditAttributeDefinition(definition *db.AttributeDefinition) string {
+	data, _ := json.Marshal(newAttributeDefinitionResponse(definition))
+
+	return string(data)
+}
+
+// createAttributeDefinition declares a new custom attribute. Attributes are private unless
+// stated otherwise. Users stored before a required attribute is declared only have to set it
+// the next time their attributes change
+func (s *Server) createAttributeDefinition(c *gin.Context) {
+	var definitionReq createAttributeDefinitionRequest
+
+	if err := c.ShouldBindJSON(&definitionReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if definitionReq.Pattern != "" {
+		if definitionReq.Type != db.AttributeTypeString && definitionReq.Type != db.AttributeTypeDate {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": "Only string and date attributes can have a pattern",
+			})
+			return
+		}
+
+		if err := db.CheckAttributePattern(definitionReq.Pattern); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": fmt.Sprintf("Invalid pattern: %v", err),
+			})
+			return
+		}
+	}
+
+	if definitionReq.Visibility == "" {
+		definitionReq.Visibility = db.AttributeVisibilityPrivate
+	}
+
+	ctx := c.Request.Context()
+
+	var definition *db.AttributeDefinition
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		definition, err = tx.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+			Name:       definitionReq.Name,
+			Type:       definitionReq.Type,
+			Required:   definitionReq.Required,
+			Unique:     definitionReq.Unique,
+			Pattern:    definitionReq.Pattern,
+			Visibility: definitionReq.Visibility,
+		})
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionAttributeCreate, nil)
+		auditParams.After = auditAttributeDefinition(definition)
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAttributeDefinitionResponse(definition))
+}
+
+type getAttributeDefinitionsResponse struct {
+	Attributes []attributeDefinitionResponse `json:"attributes"`
+}
+
+func (s *Server) getAttributeDefinitions(c *gin.Context) {
+	definitions, err := s.DbConnector.GetAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	definitionsRes := &getAttributeDefinitionsResponse{
+		Attributes: []attributeDefinitionResponse{},
+	}
+
+	for i := range definitions {
+		definitionsRes.Attributes = append(definitionsRes.Attributes, newAttributeDefinitionResponse(&definitions[i]))
+	}
+
+	c.JSON(http.StatusOK, definitionsRes)
+}
+
+type deleteAttributeDefinitionRequest struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+// deleteAttributeDefinition removes a custom attribute along with the values users hold for it
+func (s *Server) deleteAttributeDefinition(c *gin.Context) {
+	var definitionReq deleteAttributeDefinitionRequest
+
+	if err := c.ShouldBindUri(&definitionReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.DeleteAttributeDefinition(ctx, definitionReq.Name); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionAttributeDelete, nil)
+		before, _ := json.Marshal(map[string]string{"name": definitionReq.Name})
+		auditParams.Before = string(before)
+
+		_, err := tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
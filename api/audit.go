@@ -0,0 +1,400 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditActionUserCreate           = "user.create"
+	auditActionServiceAccountCreate = "service_account.create"
+	auditActionUserUpdate           = "user.update"
+	auditActionUserDelete           = "user.delete"
+	auditActionUserRestore          = "user.restore"
+	auditActionUserPurge            = "user.purge"
+	auditActionUserExport           = "user.export"
+	auditActionUserErase            = "user.erase"
+	auditActionUserLogin            = "user.login"
+	auditActionUserImpersonate      = "user.impersonate"
+	auditActionImpersonationEnd     = "user.impersonation_end"
+	auditActionAPIKeyCreate         = "api_key.create"
+	auditActionAPIKeyRevoke         = "api_key.revoke"
+	auditActionAttributeCreate      = "attribute.create"
+	auditActionAttributeDelete      = "attribute.delete"
+	auditActionGroupCreate          = "group.create"
+	auditActionGroupMemberAdd       = "group.member_add"
+	auditActionGroupMemberRemove    = "group.member_remove"
+	auditActionOrganizationCreate   = "organization.create"
+	auditActionUserOrgAdmin         = "user.org_admin"
+	auditActionInvitationCreate     = "invitation.create"
+	auditActionInvitationResend     = "invitation.resend"
+	auditActionInvitationRevoke     = "invitation.revoke"
+	auditActionInvitationAccept     = "invitation.accept"
+	auditActionRegistrationApprove  = "registration.approve"
+	auditActionRegistrationReject   = "registration.reject"
+	auditActionRegistrationExpire   = "registration.expire"
+	auditActionUserNameChange       = "user.user_name_change"
+	auditActionPhoneChange          = "user.phone_change"
+)
+
+const (
+	redactedValue        = "[REDACTED]"
+	defaultAuditPageSize = 50
+	auditExportBatchSize = 500
+)
+
+// auditSecretFields are never written to the audit log. A change to one of them is recorded
+// with both its values redacted
+var auditSecretFields = map[string]bool{
+	"password":    true,
+	"login_token": true,
+	"key_hash":    true,
+}
+
+// auditUserFields returns the fields of user tracked by the audit log
+func auditUserFields(user *db.User) map[string]any {
+	fields := map[string]any{
+		"full_name":       user.FullName,
+		"phone":           user.Phone,
+		"user_name":       user.UserName,
+		"password":        user.Password,
+		"login_token":     user.LoginToken,
+		"admin":           user.Admin,
+		"org_admin":       user.OrgAdmin,
+		"service_account": user.ServiceAccount,
+	}
+
+	// Attributes are only tracked once the user holds some, as most users never do
+	if len(user.Attributes) > 0 {
+		fields["attributes"] = user.Attributes
+	}
+
+	return fields
+}
+
+// auditDiff keeps only the fields which differ between before and after, either of which
+// may be nil, and serializes each side to JSON. Secret fields are redacted
+func auditDiff(before map[string]any, after map[string]any) (string, string) {
+	beforeDiff := map[string]any{}
+	afterDiff := map[string]any{}
+
+	for field, value := range before {
+		if afterValue, ok := after[field]; !ok || !reflect.DeepEqual(value, afterValue) {
+			beforeDiff[field] = value
+		}
+	}
+
+	for field, value := range after {
+		if beforeValue, ok := before[field]; !ok || !reflect.DeepEqual(value, beforeValue) {
+			afterDiff[field] = value
+		}
+	}
+
+	encode := func(diff map[string]any, side map[string]any) string {
+		if side == nil {
+			return ""
+		}
+
+		for field := range diff {
+			if auditSecretFields[field] {
+				diff[field] = redactedValue
+			}
+		}
+
+		data, _ := json.Marshal(diff)
+
+		return string(data)
+	}
+
+	return encode(beforeDiff, before), encode(afterDiff, after)
+}
+
+// newAuditEvent describes action being taken on target, which may be nil, by the current
+// user of the request
+func newAuditEvent(c *gin.Context, action string, target *db.User) db.CreateAuditEventParams {
+	auditParams := db.CreateAuditEventParams{
+		Action:    action,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if actor, ok := c.Keys["currentUser"].(*db.User); ok {
+		actorID := actor.ID
+		auditParams.ActorID = &actorID
+		auditParams.ActorUserName = actor.UserName
+	}
+
+	if impersonator, ok := c.Keys["impersonator"].(*db.User); ok {
+		impersonatorID := impersonator.ID
+		auditParams.ImpersonatorID = &impersonatorID
+		auditParams.ImpersonatorUserName = impersonator.UserName
+	}
+
+	if target != nil {
+		targetID := target.ID
+		auditParams.TargetID = &targetID
+		auditParams.TargetUserName = target.UserName
+	}
+
+	return auditParams
+}
+
+type getAuditEventsRequest struct {
+	Actor  string     `form:"actor"`
+	Target string     `form:"target"`
+	Action string     `form:"action"`
+	Since  *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int        `form:"limit" binding:"omitempty,min=1"`
+	Cursor uint       `form:"cursor"`
+	Format string     `form:"format" binding:"omitempty,oneof=json csv"`
+}
+
+type auditEventResponse struct {
+	ID                   uint            `json:"id"`
+	CreatedAt            time.Time       `json:"created_at"`
+	Action               string          `json:"action"`
+	ActorID              *uint           `json:"actor_id"`
+	ActorUserName        string          `json:"actor_user_name"`
+	ImpersonatorUserName string          `json:"impersonator_user_name,omitempty"`
+	TargetID             *uint           `json:"target_id"`
+	TargetUserName       string          `json:"target_user_name"`
+	IP                   string          `json:"ip"`
+	UserAgent            string          `json:"user_agent"`
+	Before               json.RawMessage `json:"before"`
+	After                json.RawMessage `json:"after"`
+	PrevHash             string          `json:"prev_hash"`
+	Hash                 string          `json:"hash"`
+}
+
+type getAuditEventsResponse struct {
+	Events     []auditEventResponse `json:"events"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+func newAuditEventResponse(stored *db.AuditEvent) auditEventResponse {
+	auditEvent := stored.Resolved()
+
+	rawJSON := func(value string) json.RawMessage {
+		if value == "" {
+			return json.RawMessage("null")
+		}
+
+		return json.RawMessage(value)
+	}
+
+	return auditEventResponse{
+		ID:                   auditEvent.ID,
+		CreatedAt:            auditEvent.CreatedAt,
+		Action:               auditEvent.Action,
+		ActorID:              auditEvent.ActorID,
+		ActorUserName:        auditEvent.ActorUserName,
+		ImpersonatorUserName: auditEvent.ImpersonatorUserName,
+		TargetID:             auditEvent.TargetID,
+		TargetUserName:       auditEvent.TargetUserName,
+		IP:                   auditEvent.IP,
+		UserAgent:            auditEvent.UserAgent,
+		Before:               rawJSON(auditEvent.Before),
+		After:                rawJSON(auditEvent.After),
+		PrevHash:             auditEvent.PrevHash,
+		Hash:                 auditEvent.Hash,
+	}
+}
+
+// getAuditEvents lists audit events from the newest to the oldest. With format=csv every
+// matching event is exported at once instead of a single page
+func (s *Server) getAuditEvents(c *gin.Context) {
+	var auditReq getAuditEventsRequest
+
+	if err := c.ShouldBindQuery(&auditReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	pageSize := auditReq.Limit
+	if pageSize == 0 {
+		pageSize = defaultAuditPageSize
+	}
+
+	if pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": fmt.Sprintf("Page size cannot be greater than %d", maxPageSize),
+		})
+		return
+	}
+
+	auditParams := db.GetAuditEventsParams{
+		ActorUserName:  auditReq.Actor,
+		TargetUserName: auditReq.Target,
+		Action:         auditReq.Action,
+		Since:          auditReq.Since,
+		Until:          auditReq.Until,
+		BeforeID:       auditReq.Cursor,
+		Limit:          pageSize + 1,
+	}
+
+	if auditReq.Format == "csv" {
+		auditParams.Limit = auditExportBatchSize
+	}
+
+	auditEvents, err := s.DbConnector.GetAuditEvents(c.Request.Context(), auditParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	if auditReq.Format == "csv" {
+		s.exportAuditEvents(c, auditParams, auditEvents)
+		return
+	}
+
+	auditRes := &getAuditEventsResponse{
+		Events: []auditEventResponse{},
+	}
+
+	if len(auditEvents) > pageSize {
+		auditEvents = auditEvents[:pageSize]
+		auditRes.NextCursor = strconv.FormatUint(uint64(auditEvents[pageSize-1].ID), 10)
+
+		c.Header("Link", paginationLinks(c.Request.URL, pageSize, auditRes.NextCursor, ""))
+	}
+
+	for i := range auditEvents {
+		auditRes.Events = append(auditRes.Events, newAuditEventResponse(&auditEvents[i]))
+	}
+
+	c.JSON(http.StatusOK, auditRes)
+}
+
+var auditCSVHeader = []string{
+	"id",
+	"created_at",
+	"action",
+	"actor_id",
+	"actor_user_name",
+	"impersonator_user_name",
+	"target_id",
+	"target_user_name",
+	"ip",
+	"user_agent",
+	"before",
+	"after",
+	"prev_hash",
+	"hash",
+}
+
+// csvSafe keeps spreadsheet applications from evaluating user provided values as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func csvID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// exportAuditEvents streams the first batch of audit events followed by every other event
+// matching auditParams as CSV
+func (s *Server) exportAuditEvents(c *gin.Context, auditParams db.GetAuditEventsParams, auditEvents []db.AuditEvent) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="audit_events.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(auditCSVHeader)
+
+	for len(auditEvents) > 0 {
+		for i := range auditEvents {
+			auditEvent := auditEvents[i].Resolved()
+
+			writer.Write([]string{
+				strconv.FormatUint(uint64(auditEvent.ID), 10),
+				auditEvent.CreatedAt.UTC().Format(time.RFC3339Nano),
+				csvSafe(auditEvent.Action),
+				csvID(auditEvent.ActorID),
+				csvSafe(auditEvent.ActorUserName),
+				csvSafe(auditEvent.ImpersonatorUserName),
+				csvID(auditEvent.TargetID),
+				csvSafe(auditEvent.TargetUserName),
+				csvSafe(auditEvent.IP),
+				csvSafe(auditEvent.UserAgent),
+				csvSafe(auditEvent.Before),
+				csvSafe(auditEvent.After),
+				auditEvent.PrevHash,
+				auditEvent.Hash,
+			})
+		}
+
+		if len(auditEvents) < auditParams.Limit {
+			break
+		}
+
+		auditParams.BeforeID = auditEvents[len(auditEvents)-1].ID
+
+		var err error
+		auditEvents, err = s.DbConnector.GetAuditEvents(c.Request.Context(), auditParams)
+		if err != nil {
+			// The response is already on its way, so the export can only be cut short
+			log.Printf("Cannot export audit events: %v\n", err)
+			break
+		}
+	}
+
+	writer.Flush()
+}
+
+type verifyAuditChainResponse struct {
+	Valid     bool   `json:"valid"`
+	Verified  int    `json:"verified"`
+	Unchained int    `json:"unchained"`
+	BrokenAt  *uint  `json:"broken_at,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	LastHash  string `json:"last_hash"`
+}
+
+// verifyAuditChain walks the whole audit log checking that no event was altered or removed
+func (s *Server) verifyAuditChain(c *gin.Context) {
+	report, err := db.VerifyAuditChain(c.Request.Context(), s.DbConnector)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	verifyRes := &verifyAuditChainResponse{
+		Valid:     report.Valid(),
+		Verified:  report.Verified,
+		Unchained: report.Unchained,
+		BrokenAt:  report.BrokenAt,
+		Reason:    report.Reason,
+		LastHash:  report.LastHash,
+	}
+
+	c.JSON(http.StatusOK, verifyRes)
+}
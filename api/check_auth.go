@@ -1,17 +1,131 @@
 package api
 
 import (
+	"crypto/subtle"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/ericbg27/RegistryAPI/util"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	bearerAuthScheme = "Bearer"
+	apiKeyAuthScheme = "ApiKey"
+)
+
 func (s *Server) checkAuth(c *gin.Context) {
 	tokenString := c.GetHeader("Authorization")
 
 	tokenParts := strings.Split(tokenString, " ")
-	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+	if len(tokenParts) != 2 {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	switch tokenParts[0] {
+	case bearerAuthScheme:
+		s.checkBearerAuth(c, tokenParts[1])
+	case apiKeyAuthScheme:
+		s.checkAPIKeyAuth(c, tokenParts[1])
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+	}
+}
+
+func (s *Server) checkBearerAuth(c *gin.Context, tokenString string) {
+	payload, err := s.Maker.VerifyToken(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	// Usernames are only unique within an organization, so the user is looked up in the one the
+	// token was issued for
+	ctx := db.WithTenant(c.Request.Context(), tenantOrDefault(payload.TenantID))
+
+	user, err := s.DbConnector.GetUser(ctx, payload.Username)
+	if err != nil {
+		// Tokens issued before the user was renamed or deleted name nobody anymore
+		if _, ok := err.(*db.NotFoundError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		c.Abort()
+		return
+	}
+
+	if payload.Impersonator != "" {
+		s.checkImpersonation(c, tokenString, payload, user)
+		return
+	}
+
+	if user.LoginToken != tokenString {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	if !s.enterTenant(c, user) {
+		return
+	}
+
+	c.Set("tokenPayload", tokenString)
+	c.Set("currentUser", user)
+	c.Next()
+}
+
+func (s *Server) checkImpersonation(c *gin.Context, tokenString string, payload *token.Payload, user *db.User) {
+	ctx := db.WithTenant(c.Request.Context(), tenantOrDefault(payload.ImpersonatorTenantID))
+
+	admin, err := s.DbConnector.GetUser(ctx, payload.Impersonator)
+	if err != nil {
+		if _, ok := err.(*db.NotFoundError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		c.Abort()
+		return
+	}
+
+	if !isAdminOf(admin, tenantOrDefault(user.OrganizationID)) || user.Admin || (user.OrgAdmin && !admin.Admin) {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"name":    "Unauthorized",
 			"message": "User is not authorized to access this resource",
@@ -20,9 +134,53 @@ func (s *Server) checkAuth(c *gin.Context) {
 		return
 	}
 
-	token := tokenParts[1]
-	payload, err := s.Maker.VerifyToken(token)
+	// Impersonations can be ended before their tokens expire, so each token is checked against the
+	// impersonation it was issued for
+	impersonation, err := s.DbConnector.GetImpersonation(c.Request.Context(), payload.ImpersonationID)
 	if err != nil {
+		if _, ok := err.(*db.NotFoundError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		c.Abort()
+		return
+	}
+
+	if impersonation.AdminID != admin.ID || impersonation.UserID != user.ID || !impersonation.Active() {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	if !s.enterTenant(c, user) {
+		return
+	}
+
+	log.Printf("Admin %s impersonating user %s: %s %s\n", admin.UserName, user.UserName, c.Request.Method, c.Request.URL.Path)
+
+	c.Header(impersonatedByHeader, admin.UserName)
+	c.Set("impersonator", admin)
+	c.Set("impersonation", impersonation)
+	c.Set("tokenPayload", tokenString)
+	c.Set("currentUser", user)
+	c.Next()
+}
+
+func (s *Server) checkAPIKeyAuth(c *gin.Context, key string) {
+	prefix, ok := util.ParseAPIKeyPrefix(key)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"name":    "Unauthorized",
 			"message": "User is not authorized to access this resource",
@@ -31,8 +189,48 @@ func (s *Server) checkAuth(c *gin.Context) {
 		return
 	}
 
-	user, err := s.DbConnector.GetUser(payload.Username)
+	apiKey, err := s.DbConnector.GetAPIKey(c.Request.Context(), prefix)
 	if err != nil {
+		if _, ok := err.(*db.NotFoundError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		c.Abort()
+		return
+	}
+
+	hashMatches := subtle.ConstantTimeCompare([]byte(util.HashAPIKey(key)), []byte(apiKey.KeyHash)) == 1
+	expired := apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)
+	if !hashMatches || expired || apiKey.RevokedAt != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": "User is not authorized to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	// Keys are unique across organizations, so their user is looked up in all of them
+	user, err := s.DbConnector.GetUserByID(db.WithTenant(c.Request.Context(), 0), apiKey.UserID)
+	if err != nil {
+		if _, ok := err.(*db.NotFoundError); ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"name":    "InternalServerError",
 			"message": "Unexpected server error. Try again later",
@@ -41,7 +239,7 @@ func (s *Server) checkAuth(c *gin.Context) {
 		return
 	}
 
-	if user.LoginToken != token {
+	if !user.ServiceAccount {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"name":    "Unauthorized",
 			"message": "User is not authorized to access this resource",
@@ -50,7 +248,20 @@ func (s *Server) checkAuth(c *gin.Context) {
 		return
 	}
 
-	c.Set("tokenPayload", token)
+	if !s.enterTenant(c, user) {
+		return
+	}
+
+	if err = s.DbConnector.TouchAPIKey(c.Request.Context(), apiKey.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("apiKey", apiKey)
 	c.Set("currentUser", user)
 	c.Next()
 }
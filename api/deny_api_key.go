@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) denyAPIKey(c *gin.Context) {
+	if _, ok := c.Keys["apiKey"]; ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"name":    "Forbidden",
+			"message": "API key is not allowed to access this resource",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
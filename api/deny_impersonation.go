@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) denyImpersonation(c *gin.Context) {
+	if _, ok := c.Keys["impersonator"]; ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"name":    "Forbidden",
+			"message": "Operation is not allowed while impersonating an user",
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
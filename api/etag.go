@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errIfMatchRequired = errors.New("The If-Match header is required. Get the user and send its ETag")
+	errUserModified    = errors.New("The user was modified since it was read. Get it again and retry")
+)
+
+// userETag returns the entity tag of the representation of user returned by getUser, which
+// shows the given attributes. Attributes change along with their definitions without bumping
+// the version of the user, so a digest of them is part of the tag. Private attributes are only
+// part of the representation shown to the user and to admins, which gets a tag of its own
+func userETag(user *db.User, attributes db.Attributes, showPrivate bool) string {
+	tag := fmt.Sprint(user.Version)
+	if len(attributes) > 0 {
+		// Attributes hold JSON values, and maps are encoded with sorted keys
+		data, _ := json.Marshal(attributes)
+		digest := sha256.Sum256(data)
+		tag += "-" + hex.EncodeToString(digest[:8])
+	}
+
+	if showPrivate {
+		return fmt.Sprintf(`"%s"`, tag)
+	}
+
+	return fmt.Sprintf(`"%s-public"`, tag)
+}
+
+// respondVersionConflict answers with 409 Conflict when err reports that the user was updated
+// by another request meanwhile, and reports whether it did. Stale If-Match headers are caught
+// before updating and answered with 412 Precondition Failed instead
+func respondVersionConflict(c *gin.Context, err error) bool {
+	if _, ok := err.(*db.VersionConflictError); !ok {
+		return false
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"name":    "Conflict",
+		"message": errUserModified.Error(),
+	})
+
+	return true
+}
+
+// parseETags splits the entity tags listed by an If-Match or If-None-Match header
+func parseETags(header string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// ifMatch reports whether the If-Match header lists etag. Weak tags never match, as If-Match
+// compares tags strongly
+func ifMatch(header string, etag string) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifNoneMatch reports whether the If-None-Match header does not list etag, in which case the
+// representation has to be sent. Tags are compared weakly
+func ifNoneMatch(header string, etag string) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+)
+
+type exportProfile struct {
+	ID             uint          `json:"id"`
+	FullName       string        `json:"full_name"`
+	Phone          string        `json:"phone"`
+	UserName       string        `json:"user_name"`
+	Admin          bool          `json:"admin"`
+	ServiceAccount bool          `json:"service_account"`
+	Attributes     db.Attributes `json:"attributes"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// exportSession is a session an admin opened on the account by impersonating the user
+type exportSession struct {
+	ID        uint      `json:"id"`
+	AdminID   uint      `json:"admin_id"`
+	Reason    string    `json:"reason"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type userExport struct {
+	ExportedAt   time.Time              `json:"exported_at"`
+	Profile      exportProfile          `json:"profile"`
+	Sessions     []exportSession        `json:"sessions"`
+	APIKeys      []apiKeyResponse       `json:"api_keys"`
+	LoginHistory []loginAttemptResponse `json:"login_history"`
+	AuditEvents  []auditEventResponse   `json:"audit_events"`
+}
+
+type getUserExportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=json zip"`
+}
+
+// collectUserExport gathers every piece of personal data kept about user
+func (s *Server) collectUserExport(ctx context.Context, user *db.User) (*userExport, error) {
+	export := &userExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: exportProfile{
+			ID:             user.ID,
+			FullName:       user.FullName,
+			Phone:          user.Phone,
+			UserName:       user.UserName,
+			Admin:          user.Admin,
+			ServiceAccount: user.ServiceAccount,
+			Attributes:     user.Attributes,
+			CreatedAt:      user.CreatedAt,
+			UpdatedAt:      user.UpdatedAt,
+		},
+		Sessions:     []exportSession{},
+		APIKeys:      []apiKeyResponse{},
+		LoginHistory: []loginAttemptResponse{},
+		AuditEvents:  []auditEventResponse{},
+	}
+
+	impersonations, err := s.DbConnector.GetImpersonations(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, impersonation := range impersonations {
+		export.Sessions = append(export.Sessions, exportSession{
+			ID:        impersonation.ID,
+			AdminID:   impersonation.AdminID,
+			Reason:    impersonation.Reason,
+			StartedAt: impersonation.CreatedAt,
+			ExpiresAt: impersonation.ExpiresAt,
+		})
+	}
+
+	apiKeys, err := s.DbConnector.GetAPIKeys(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range apiKeys {
+		export.APIKeys = append(export.APIKeys, newAPIKeyResponse(&apiKeys[i]))
+	}
+
+	loginAttempts, err := s.DbConnector.GetLoginAttempts(ctx, db.GetLoginAttemptsParams{
+		UserID: user.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range loginAttempts {
+		export.LoginHistory = append(export.LoginHistory, newLoginAttemptResponse(&loginAttempts[i]))
+	}
+
+	auditParams := db.GetAuditEventsParams{
+		UserID: user.ID,
+		Limit:  auditExportBatchSize,
+	}
+
+	for {
+		auditEvents, err := s.DbConnector.GetAuditEvents(ctx, auditParams)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range auditEvents {
+			export.AuditEvents = append(export.AuditEvents, newAuditEventResponse(&auditEvents[i]))
+		}
+
+		if len(auditEvents) < auditParams.Limit {
+			break
+		}
+
+		auditParams.BeforeID = auditEvents[len(auditEvents)-1].ID
+	}
+
+	return export, nil
+}
+
+// writeExportZip writes each section of export as its own JSON file of a ZIP archive
+func writeExportZip(w http.ResponseWriter, export *userExport) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{name: "profile.json", content: export.Profile},
+		{name: "sessions.json", content: export.Sessions},
+		{name: "api_keys.json", content: export.APIKeys},
+		{name: "login_history.json", content: export.LoginHistory},
+		{name: "audit_events.json", content: export.AuditEvents},
+	}
+
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(file.content); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// getUserExport exports the personal data kept about the current user, either as a single
+// JSON document or, with format=zip, as a ZIP archive with one JSON file per section
+func (s *Server) getUserExport(c *gin.Context) {
+	var exportReq getUserExportRequest
+
+	if err := c.ShouldBindQuery(&exportReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user := c.Keys["currentUser"].(*db.User)
+
+	export, err := s.collectUserExport(ctx, user)
+	if err == nil {
+		_, err = s.DbConnector.CreateAuditEvent(ctx, newAuditEvent(c, auditActionUserExport, user))
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	if exportReq.Format == "zip" {
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="user_export.zip"`)
+		c.Status(http.StatusOK)
+
+		if err := writeExportZip(c.Writer, export); err != nil {
+			// The response is already on its way, so the archive can only be cut short
+			log.Printf("Cannot export data of user %d: %v\n", user.ID, err)
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="user_export.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+type eraseUserRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// eraseUser anonymizes the current user in place. The password is asked again since the
+// erasure cannot be undone
+func (s *Server) eraseUser(c *gin.Context) {
+	var eraseReq eraseUserRequest
+
+	if err := c.ShouldBindJSON(&eraseReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user := c.Keys["currentUser"].(*db.User)
+
+	if !util.ComparePassword(user.Password, eraseReq.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"name":    "Unauthorized",
+			"message": errWrongPassword.Error(),
+		})
+		return
+	}
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		erased, err := tx.EraseUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// The audit log is append-only, so the event only names the erased identity
+		auditParams := newAuditEvent(c, auditActionUserErase, erased)
+		auditParams.ActorUserName = erased.UserName
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
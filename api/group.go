@@ -0,0 +1,394 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidGroupMember = errors.New("Either user_name or group must be sent in request")
+
+// groupsOption lists in the token the groups the user with userID belongs to
+func groupsOption(ctx context.Context, tx db.DBConnector, userID uint) (token.PayloadOption, error) {
+	groups, err := tx.GetUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+
+	return token.WithGroups(names), nil
+}
+
+type groupResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newGroupResponse(group *db.Group) groupResponse {
+	return groupResponse{
+		Name:        group.Name,
+		Description: group.Description,
+		CreatedAt:   group.CreatedAt,
+	}
+}
+
+type getGroupsResponse struct {
+	Groups []groupResponse `json:"groups"`
+}
+
+func newGetGroupsResponse(groups []db.Group) *getGroupsResponse {
+	groupsRes := &getGroupsResponse{
+		Groups: []groupResponse{},
+	}
+
+	for i := range groups {
+		groupsRes.Groups = append(groupsRes.Groups, newGroupResponse(&groups[i]))
+	}
+
+	return groupsRes
+}
+
+type createGroupRequest struct {
+	Name        string `json:"name" binding:"required,groupName"`
+	Description string `json:"description"`
+}
+
+func (s *Server) createGroup(c *gin.Context) {
+	var groupReq createGroupRequest
+
+	if err := c.ShouldBindJSON(&groupReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var group *db.Group
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		group, err = tx.CreateGroup(ctx, db.CreateGroupParams{
+			Name:        groupReq.Name,
+			Description: groupReq.Description,
+		})
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionGroupCreate, nil)
+		_, auditParams.After = auditDiff(nil, map[string]any{
+			"name":        group.Name,
+			"description": group.Description,
+		})
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newGroupResponse(group))
+}
+
+func (s *Server) getGroups(c *gin.Context) {
+	groups, err := s.DbConnector.GetGroups(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newGetGroupsResponse(groups))
+}
+
+type groupURIRequest struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+type groupMemberUserResponse struct {
+	ID       uint   `json:"id"`
+	UserName string `json:"user_name"`
+	FullName string `json:"full_name"`
+}
+
+type getGroupMembersResponse struct {
+	Users  []groupMemberUserResponse `json:"users"`
+	Groups []groupResponse           `json:"groups"`
+}
+
+// getGroupMembers lists the users and groups placed directly in a group
+func (s *Server) getGroupMembers(c *gin.Context) {
+	var uriReq groupURIRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	group, err := s.DbConnector.GetGroup(ctx, uriReq.Name)
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	members, err := s.DbConnector.GetGroupMembers(ctx, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	membersRes := &getGroupMembersResponse{
+		Users:  []groupMemberUserResponse{},
+		Groups: newGetGroupsResponse(members.Groups).Groups,
+	}
+
+	for _, user := range members.Users {
+		membersRes.Users = append(membersRes.Users, groupMemberUserResponse{
+			ID:       user.ID,
+			UserName: user.UserName,
+			FullName: user.FullName,
+		})
+	}
+
+	c.JSON(http.StatusOK, membersRes)
+}
+
+// groupMemberRequest names the member of a group, which is either a user or a nested group
+type groupMemberRequest struct {
+	UserName string `json:"user_name"`
+	Group    string `json:"group"`
+}
+
+// changeGroupMember resolves the group and the member named in the request and passes them to
+// apply, recording action in the audit log
+func (s *Server) changeGroupMember(c *gin.Context, action string, apply func(ctx context.Context, tx db.DBConnector, memberParams db.GroupMemberParams) error) {
+	var uriReq groupURIRequest
+	var memberReq groupMemberRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&memberReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if (memberReq.UserName == "") == (memberReq.Group == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errInvalidGroupMember.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		group, err := tx.GetGroup(ctx, uriReq.Name)
+		if err != nil {
+			return err
+		}
+
+		memberParams := db.GroupMemberParams{
+			GroupID: group.ID,
+		}
+		change := map[string]any{
+			"group": group.Name,
+		}
+
+		var target *db.User
+		if memberReq.UserName != "" {
+			target, err = tx.GetUser(ctx, memberReq.UserName)
+			if err != nil {
+				return err
+			}
+
+			memberParams.UserID = target.ID
+			change["user_name"] = target.UserName
+		} else {
+			memberGroup, err := tx.GetGroup(ctx, memberReq.Group)
+			if err != nil {
+				return err
+			}
+
+			memberParams.MemberGroupID = memberGroup.ID
+			change["member_group"] = memberGroup.Name
+		}
+
+		if err := apply(ctx, tx, memberParams); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, action, target)
+		if action == auditActionGroupMemberAdd {
+			_, auditParams.After = auditDiff(nil, change)
+		} else {
+			auditParams.Before, _ = auditDiff(change, nil)
+		}
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// addGroupMember places a user or a group in a group. Tokens issued before list the groups the
+// user belonged to back then, so the change applies to tokens issued from now on
+func (s *Server) addGroupMember(c *gin.Context) {
+	s.changeGroupMember(c, auditActionGroupMemberAdd, func(ctx context.Context, tx db.DBConnector, memberParams db.GroupMemberParams) error {
+		return tx.AddGroupMember(ctx, memberParams)
+	})
+}
+
+func (s *Server) removeGroupMember(c *gin.Context) {
+	s.changeGroupMember(c, auditActionGroupMemberRemove, func(ctx context.Context, tx db.DBConnector, memberParams db.GroupMemberParams) error {
+		return tx.RemoveGroupMember(ctx, memberParams)
+	})
+}
+
+// getCurrentUserGroups lists the groups the current user belongs to, directly or through nested
+// groups
+func (s *Server) getCurrentUserGroups(c *gin.Context) {
+	userReq, _ := c.Keys["currentUser"]
+	currentUser, _ := userReq.(*db.User)
+
+	groups, err := s.DbConnector.GetUserGroups(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newGetGroupsResponse(groups))
+}
+
+type getUserGroupsRequest struct {
+	UserName string `uri:"username" binding:"required"`
+}
+
+func (s *Server) getUserGroups(c *gin.Context) {
+	var uriReq getUserGroupsRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := s.DbConnector.GetUser(ctx, uriReq.UserName)
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	groups, err := s.DbConnector.GetUserGroups(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newGetGroupsResponse(groups))
+}
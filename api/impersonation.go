@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/gin-gonic/gin"
+)
+
+const impersonatedByHeader = "X-Impersonated-By"
+
+var (
+	errImpersonatingAdmin = errors.New("Admin users cannot be impersonated")
+	errNotImpersonating   = errors.New("The current token was not issued for an impersonation")
+)
+
+type impersonateUserURIRequest struct {
+	UserName string `uri:"username" binding:"required"`
+}
+
+type impersonateUserRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type impersonateUserResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Server) impersonateUser(c *gin.Context) {
+	var uriReq impersonateUserURIRequest
+	var impersonateReq impersonateUserRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&impersonateReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userReq, _ := c.Keys["currentUser"]
+	admin, _ := userReq.(*db.User)
+
+	duration := s.Config.ImpersonationTokenDuration
+	if duration == 0 {
+		duration = s.Config.AccessTokenDuration
+	}
+
+	ctx := c.Request.Context()
+
+	var impersonationToken string
+	var impersonation *db.Impersonation
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		user, err := tx.GetUser(ctx, uriReq.UserName)
+		if err != nil {
+			return err
+		}
+
+		// Org admins cannot impersonate each other, only global admins can
+		if user.Admin || (user.OrgAdmin && !admin.Admin) || user.ID == admin.ID {
+			return errImpersonatingAdmin
+		}
+
+		impersonationParams := db.CreateImpersonationParams{
+			AdminID:   admin.ID,
+			UserID:    user.ID,
+			Reason:    impersonateReq.Reason,
+			ExpiresAt: time.Now().Add(duration),
+		}
+
+		impersonation, err = tx.CreateImpersonation(ctx, impersonationParams)
+		if err != nil {
+			return err
+		}
+
+		groups, err := groupsOption(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// The token names its impersonation, so that it stops being accepted once it is ended
+		impersonator := token.WithImpersonator(admin.UserName, tenantOrDefault(admin.OrganizationID), impersonation.ID)
+
+		impersonationToken, err = s.Maker.CreateToken(user.UserName, duration, tenantOption(user), impersonator, groups)
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserImpersonate, user)
+		_, auditParams.After = auditDiff(nil, map[string]any{
+			"reason":     impersonation.Reason,
+			"expires_at": impersonation.ExpiresAt,
+		})
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, errImpersonatingAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"name":    "Forbidden",
+				"message": errImpersonatingAdmin.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	log.Printf("Admin %s started impersonating user %s: %s\n", admin.UserName, uriReq.UserName, impersonateReq.Reason)
+
+	impersonateRes := impersonateUserResponse{
+		Token:     impersonationToken,
+		ExpiresAt: impersonation.ExpiresAt,
+	}
+
+	c.JSON(http.StatusOK, impersonateRes)
+}
+
+type endImpersonationRequest struct {
+	UserName string `uri:"username" binding:"required"`
+	ID       uint   `uri:"id" binding:"required"`
+}
+
+// endImpersonation ends the impersonation the current token was issued for, letting the admin
+// sign out of the impersonated session
+func (s *Server) endImpersonation(c *gin.Context) {
+	impersonationReq, ok := c.Keys["impersonation"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errNotImpersonating.Error(),
+		})
+		return
+	}
+
+	impersonation, _ := impersonationReq.(*db.Impersonation)
+	currentUser := c.Keys["currentUser"].(*db.User)
+
+	s.closeImpersonation(c, impersonation, currentUser)
+}
+
+// revokeImpersonation lets admins end any impersonation of the users they administer
+func (s *Server) revokeImpersonation(c *gin.Context) {
+	var endReq endImpersonationRequest
+
+	if err := c.ShouldBindUri(&endReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	user, err := s.DbConnector.GetUser(ctx, endReq.UserName)
+	if err != nil {
+		s.impersonationError(c, err)
+		return
+	}
+
+	impersonation, err := s.DbConnector.GetImpersonation(ctx, endReq.ID)
+	if err != nil {
+		s.impersonationError(c, err)
+		return
+	}
+
+	// Impersonations are only reachable through the user they impersonate, which has to be in the
+	// organization of the request
+	if impersonation.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{
+			"name":    "NotFound",
+			"message": "Could not find an impersonation with the provided parameters",
+		})
+		return
+	}
+
+	s.closeImpersonation(c, impersonation, user)
+}
+
+// closeImpersonation ends impersonation of user and records who ended it
+func (s *Server) closeImpersonation(c *gin.Context, impersonation *db.Impersonation, user *db.User) {
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.EndImpersonation(ctx, impersonation.ID); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionImpersonationEnd, user)
+		auditParams.Before, _ = auditDiff(map[string]any{
+			"impersonation_id": impersonation.ID,
+		}, nil)
+
+		_, err := tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		s.impersonationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+func (s *Server) impersonationError(c *gin.Context, err error) {
+	notFoundErr, ok := err.(*db.NotFoundError)
+	if ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"name":    "NotFound",
+			"message": notFoundErr.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"name":    "InternalServerError",
+		"message": "Unexpected server error. Try again later",
+	})
+}
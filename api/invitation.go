@@ -0,0 +1,505 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/notify"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultInvitationDuration = 7 * 24 * time.Hour
+
+var (
+	errInvalidInvitation       = errors.New("The invitation code is invalid or has expired")
+	errInvitationClosed        = errors.New("The invitation was already accepted or revoked")
+	errInvitationFullName      = errors.New("A full name is required to create the user")
+	errInvitationWrongPassword = errors.New("Wrong password for the existing user")
+)
+
+type invitationURIRequest struct {
+	ID uint `uri:"id" binding:"required,min=1"`
+}
+
+type createInvitationRequest struct {
+	FullName string `json:"full_name"`
+	Phone    string `json:"phone" binding:"required,isPhone"`
+	OrgAdmin bool   `json:"org_admin"`
+}
+
+// acceptInvitationRequest names the account joining through the invitation. When no user with
+// UserName exists one is created with the phone of the invitation, otherwise Password must be
+// the password of the existing user
+type acceptInvitationRequest struct {
+	Code       string        `json:"code" binding:"required"`
+	UserName   string        `json:"user_name" binding:"required,alphanum,min=6"`
+	Password   string        `json:"password" binding:"required,min=6,validPassword"`
+	FullName   string        `json:"full_name"`
+	Attributes db.Attributes `json:"attributes"`
+}
+
+type invitationResponse struct {
+	ID         uint       `json:"id"`
+	FullName   string     `json:"full_name,omitempty"`
+	Phone      string     `json:"phone"`
+	OrgAdmin   bool       `json:"org_admin"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+func newInvitationResponse(invitation *db.Invitation, now time.Time) invitationResponse {
+	return invitationResponse{
+		ID:         invitation.ID,
+		FullName:   invitation.FullName,
+		Phone:      invitation.Phone,
+		OrgAdmin:   invitation.OrgAdmin,
+		Status:     invitation.Status(now),
+		CreatedAt:  invitation.CreatedAt,
+		ExpiresAt:  invitation.ExpiresAt,
+		AcceptedAt: invitation.AcceptedAt,
+	}
+}
+
+// sentInvitationResponse tells whether the invitation reached the Sender. Undelivered
+// invitations stay pending and can be resent
+type sentInvitationResponse struct {
+	invitationResponse
+	Delivered bool `json:"delivered"`
+}
+
+type getInvitationsResponse struct {
+	Invitations []invitationResponse `json:"invitations"`
+}
+
+// auditInvitationFields returns the fields of invitation tracked by the audit log
+func auditInvitationFields(invitation *db.Invitation) map[string]any {
+	return map[string]any{
+		"invitation_id": invitation.ID,
+		"full_name":     invitation.FullName,
+		"phone":         invitation.Phone,
+		"org_admin":     invitation.OrgAdmin,
+		"expires_at":    invitation.ExpiresAt,
+	}
+}
+
+// newInvitationCode creates the code of an invitation, which expires after the configured
+// duration. Codes carry their expiry in seconds, so the returned time is truncated to match
+func (s *Server) newInvitationCode() (string, time.Time, error) {
+	duration := s.Config.InvitationDuration
+	if duration == 0 {
+		duration = defaultInvitationDuration
+	}
+
+	expiresAt := time.Now().Add(duration).Truncate(time.Second)
+
+	code, err := util.NewInvitationCode(s.invitationKey, expiresAt)
+
+	return code, expiresAt, err
+}
+
+// sendInvitation delivers code to the invitee, reporting whether it was delivered
+func (s *Server) sendInvitation(ctx context.Context, invitation *db.Invitation, inviter *db.User, code string) bool {
+	notification := notify.Notification{
+		Phone:   invitation.Phone,
+		Subject: "You are invited to join the registry",
+		Body: fmt.Sprintf("%s invited you to join. Accept the invitation with the code %s before %s",
+			inviter.UserName, code, invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+	}
+
+	if err := s.Sender.Send(ctx, notification); err != nil {
+		log.Printf("Cannot deliver invitation %d: %v\n", invitation.ID, err)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) createInvitation(c *gin.Context) {
+	var invitationReq createInvitationRequest
+
+	if err := c.ShouldBindJSON(&invitationReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userReq, _ := c.Keys["currentUser"]
+	inviter, _ := userReq.(*db.User)
+
+	code, expiresAt, err := s.newInvitationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var invitation *db.Invitation
+	err = s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		invitation, err = tx.CreateInvitation(ctx, db.CreateInvitationParams{
+			InviterID: &inviter.ID,
+			FullName:  invitationReq.FullName,
+			Phone:     invitationReq.Phone,
+			OrgAdmin:  invitationReq.OrgAdmin,
+			CodeHash:  util.HashInvitationCode(code),
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionInvitationCreate, nil)
+		auditParams.InvitationID = &invitation.ID
+		_, auditParams.After = auditDiff(nil, auditInvitationFields(invitation))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, sentInvitationResponse{
+		invitationResponse: newInvitationResponse(invitation, time.Now()),
+		Delivered:          s.sendInvitation(ctx, invitation, inviter, code),
+	})
+}
+
+func (s *Server) getInvitations(c *gin.Context) {
+	invitations, err := s.DbConnector.GetInvitations(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	invitationsRes := &getInvitationsResponse{
+		Invitations: []invitationResponse{},
+	}
+
+	now := time.Now()
+	for i := range invitations {
+		invitationsRes.Invitations = append(invitationsRes.Invitations, newInvitationResponse(&invitations[i], now))
+	}
+
+	c.JSON(http.StatusOK, invitationsRes)
+}
+
+// resendInvitation sends a pending invitation again with a new code and expiry. The previous
+// code stops working
+func (s *Server) resendInvitation(c *gin.Context) {
+	var uriReq invitationURIRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userReq, _ := c.Keys["currentUser"]
+	inviter, _ := userReq.(*db.User)
+
+	code, expiresAt, err := s.newInvitationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var invitation *db.Invitation
+	err = s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		invitation, err = tx.GetInvitation(ctx, uriReq.ID)
+		if err != nil {
+			return err
+		}
+
+		if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+			return errInvitationClosed
+		}
+
+		if err := tx.RenewInvitation(ctx, invitation.ID, util.HashInvitationCode(code), expiresAt); err != nil {
+			return err
+		}
+
+		renewed := *invitation
+		renewed.ExpiresAt = expiresAt
+
+		auditParams := newAuditEvent(c, auditActionInvitationResend, nil)
+		auditParams.InvitationID = &invitation.ID
+		auditParams.Before, auditParams.After = auditDiff(auditInvitationFields(invitation), auditInvitationFields(&renewed))
+
+		invitation = &renewed
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		s.invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sentInvitationResponse{
+		invitationResponse: newInvitationResponse(invitation, time.Now()),
+		Delivered:          s.sendInvitation(ctx, invitation, inviter, code),
+	})
+}
+
+func (s *Server) revokeInvitation(c *gin.Context) {
+	var uriReq invitationURIRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		invitation, err := tx.GetInvitation(ctx, uriReq.ID)
+		if err != nil {
+			return err
+		}
+
+		if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+			return errInvitationClosed
+		}
+
+		if err := tx.RevokeInvitation(ctx, invitation.ID); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionInvitationRevoke, nil)
+		auditParams.InvitationID = &invitation.ID
+		auditParams.Before, _ = auditDiff(auditInvitationFields(invitation), nil)
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		s.invitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// invitationError answers a request managing an existing invitation which failed with err
+func (s *Server) invitationError(c *gin.Context, err error) {
+	notFoundErr, ok := err.(*db.NotFoundError)
+	if ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"name":    "NotFound",
+			"message": notFoundErr.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, errInvitationClosed) {
+		c.JSON(http.StatusConflict, gin.H{
+			"name":    "Conflict",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"name":    "InternalServerError",
+		"message": "Unexpected server error. Try again later",
+	})
+}
+
+// acceptInvitation lets the invitee join the organization of the invitation, either creating
+// a new user or linking an existing one of the same organization, and grants the role the
+// invitation was created with
+func (s *Server) acceptInvitation(c *gin.Context) {
+	var acceptReq acceptInvitationRequest
+
+	if err := c.ShouldBindJSON(&acceptReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if err := util.VerifyInvitationCode(s.invitationKey, acceptReq.Code, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InvalidInvitation",
+			"message": errInvalidInvitation.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	created := false
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		// Codes are unique across organizations, the invitation tells which one is being joined
+		invitation, err := tx.GetInvitationByCode(db.WithTenant(ctx, 0), util.HashInvitationCode(acceptReq.Code))
+		if err != nil {
+			if _, ok := err.(*db.NotFoundError); ok {
+				return errInvalidInvitation
+			}
+
+			return err
+		}
+
+		if invitation.Status(time.Now()) != db.InvitationPending {
+			return errInvalidInvitation
+		}
+
+		tenantCtx := db.WithTenant(ctx, invitation.OrganizationID)
+
+		var before map[string]any
+		user, err := tx.GetUser(tenantCtx, acceptReq.UserName)
+		switch err.(type) {
+		case nil:
+			if !util.ComparePassword(user.Password, acceptReq.Password) {
+				return errInvitationWrongPassword
+			}
+
+			before = auditUserFields(user)
+		case *db.NotFoundError:
+			fullName := acceptReq.FullName
+			if fullName == "" {
+				fullName = invitation.FullName
+			}
+
+			if fullName == "" {
+				return errInvitationFullName
+			}
+
+			if s.Blocklist.Blocks(acceptReq.UserName) {
+				return errUserNameNotAllowed
+			}
+
+			attributes, err := checkAttributes(tenantCtx, tx, 0, acceptReq.Attributes)
+			if err != nil {
+				return err
+			}
+
+			user, err = tx.CreateUser(tenantCtx, db.CreateUserParams{
+				FullName:   fullName,
+				Phone:      invitation.Phone,
+				UserName:   acceptReq.UserName,
+				Password:   acceptReq.Password,
+				Attributes: attributes,
+			})
+			if err != nil {
+				return err
+			}
+
+			created = true
+		default:
+			return err
+		}
+
+		if invitation.OrgAdmin && !user.OrgAdmin {
+			if err := tx.SetOrgAdmin(tenantCtx, user.ID, true); err != nil {
+				return err
+			}
+
+			user.OrgAdmin = true
+		}
+
+		if err := tx.AcceptInvitation(tenantCtx, invitation.ID, user.ID); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionInvitationAccept, user)
+		auditParams.Before, auditParams.After = auditDiff(before, auditUserFields(user))
+
+		_, err = tx.CreateAuditEvent(tenantCtx, auditParams)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidInvitation) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "InvalidInvitation",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, errInvitationWrongPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, errInvitationFullName) || errors.Is(err, errUserNameNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		attributesErr, ok := err.(*invalidAttributesError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": attributesErr.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	if created {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Invitation accepted and user created successfully",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation accepted successfully",
+	})
+}
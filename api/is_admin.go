@@ -7,7 +7,21 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// isAdmin lets global admins and the org admins of the organization of the request through
 func (s *Server) isAdmin(c *gin.Context) {
+	s.requireAdmin(c, func(user *db.User) bool {
+		return isAdminOf(user, requestTenant(c.Request.Context()))
+	})
+}
+
+// isGlobalAdmin only lets global admins through, for resources shared by every organization
+func (s *Server) isGlobalAdmin(c *gin.Context) {
+	s.requireAdmin(c, func(user *db.User) bool {
+		return user.Admin
+	})
+}
+
+func (s *Server) requireAdmin(c *gin.Context, allowed func(user *db.User) bool) {
 	userReq, ok := c.Keys["currentUser"]
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -28,7 +42,7 @@ func (s *Server) isAdmin(c *gin.Context) {
 		return
 	}
 
-	if !user.Admin {
+	if !allowed(user) {
 		c.JSON(http.StatusForbidden, gin.H{
 			"name":    "Forbidden",
 			"message": "User is not allowed to access this resource",
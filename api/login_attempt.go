@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/geoip"
+	"github.com/ericbg27/RegistryAPI/notify"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	loginFailureUnknownUser   = "unknown_user"
+	loginFailureWrongPassword = "wrong_password"
+
+	loginFailureRegistrationNotApproved = "registration_not_approved"
+)
+
+const defaultLoginAttemptsPageSize = 20
+
+// newLoginAttempt describes a login attempt for userName made by the request. user is nil
+// when no such user exists
+func (s *Server) newLoginAttempt(c *gin.Context, userName string, user *db.User) db.CreateLoginAttemptParams {
+	loginParams := db.CreateLoginAttemptParams{
+		UserName:  userName,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if user != nil {
+		userID := user.ID
+		loginParams.UserID = &userID
+	}
+
+	if location, ok := s.Locator.Lookup(loginParams.IP); ok {
+		loginParams.Country = location.Country
+		loginParams.Region = location.Region
+		loginParams.City = location.City
+	}
+
+	return loginParams
+}
+
+// isNewDevice tells whether a user who already logged in before never did so with userAgent.
+// The first login of a user is not considered to come from a new device
+func isNewDevice(ctx context.Context, dbConnector db.DBConnector, userID uint, userAgent string) (bool, error) {
+	success := true
+
+	known, err := dbConnector.GetLoginAttempts(ctx, db.GetLoginAttemptsParams{
+		UserID:    userID,
+		Success:   &success,
+		UserAgent: &userAgent,
+		Limit:     1,
+	})
+	if err != nil || len(known) > 0 {
+		return false, err
+	}
+
+	previous, err := dbConnector.GetLoginAttempts(ctx, db.GetLoginAttemptsParams{
+		UserID:  userID,
+		Success: &success,
+		Limit:   1,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(previous) > 0, nil
+}
+
+// recordFailedLogin stores a failed login attempt. The login already failed, so errors are
+// only logged
+func (s *Server) recordFailedLogin(c *gin.Context, userName string, user *db.User, reason string) {
+	loginParams := s.newLoginAttempt(c, userName, user)
+	loginParams.FailureReason = reason
+
+	if _, err := s.DbConnector.CreateLoginAttempt(c.Request.Context(), loginParams); err != nil {
+		log.Printf("Cannot record failed login of %s: %v\n", userName, err)
+	}
+}
+
+// notifyNewDevice warns user about a login from a device they never used before
+func (s *Server) notifyNewDevice(ctx context.Context, user *db.User, loginAttempt *db.LoginAttempt) {
+	device := loginAttempt.UserAgent
+	if device == "" {
+		device = "an unknown device"
+	}
+
+	origin := loginAttempt.IP
+	location := geoip.Location{
+		Country: loginAttempt.Country,
+		Region:  loginAttempt.Region,
+		City:    loginAttempt.City,
+	}
+
+	if place := location.String(); place != "" {
+		origin = fmt.Sprintf("%s (%s)", loginAttempt.IP, place)
+	}
+
+	notification := notify.Notification{
+		UserName: user.UserName,
+		Phone:    user.Phone,
+		Subject:  "New login to your account",
+		Body: fmt.Sprintf("Your account was accessed from %s at %s from %s. If this was not you, change your password",
+			device, loginAttempt.CreatedAt.UTC().Format(time.RFC1123), origin),
+	}
+
+	if err := s.Sender.Send(ctx, notification); err != nil {
+		log.Printf("Cannot notify %s of a login from a new device: %v\n", user.UserName, err)
+	}
+}
+
+type getLoginAttemptsRequest struct {
+	Limit  int  `form:"limit" binding:"omitempty,min=1"`
+	Cursor uint `form:"cursor"`
+}
+
+type loginAttemptResponse struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"user_agent"`
+	Country       string    `json:"country,omitempty"`
+	Region        string    `json:"region,omitempty"`
+	City          string    `json:"city,omitempty"`
+	NewDevice     bool      `json:"new_device"`
+}
+
+func newLoginAttemptResponse(loginAttempt *db.LoginAttempt) loginAttemptResponse {
+	return loginAttemptResponse{
+		ID:            loginAttempt.ID,
+		CreatedAt:     loginAttempt.CreatedAt,
+		Success:       loginAttempt.Success,
+		FailureReason: loginAttempt.FailureReason,
+		IP:            loginAttempt.IP,
+		UserAgent:     loginAttempt.UserAgent,
+		Country:       loginAttempt.Country,
+		Region:        loginAttempt.Region,
+		City:          loginAttempt.City,
+		NewDevice:     loginAttempt.NewDevice,
+	}
+}
+
+type getLoginAttemptsResponse struct {
+	Logins     []loginAttemptResponse `json:"logins"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// getLoginAttempts lists the login attempts of the current user from the newest to the oldest
+func (s *Server) getLoginAttempts(c *gin.Context) {
+	var loginReq getLoginAttemptsRequest
+
+	if err := c.ShouldBindQuery(&loginReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	pageSize := loginReq.Limit
+	if pageSize == 0 {
+		pageSize = defaultLoginAttemptsPageSize
+	}
+
+	if pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": fmt.Sprintf("Page size cannot be greater than %d", maxPageSize),
+		})
+		return
+	}
+
+	user := c.Keys["currentUser"].(*db.User)
+
+	loginAttempts, err := s.DbConnector.GetLoginAttempts(c.Request.Context(), db.GetLoginAttemptsParams{
+		UserID:   user.ID,
+		BeforeID: loginReq.Cursor,
+		Limit:    pageSize + 1,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	loginRes := &getLoginAttemptsResponse{
+		Logins: []loginAttemptResponse{},
+	}
+
+	if len(loginAttempts) > pageSize {
+		loginAttempts = loginAttempts[:pageSize]
+		loginRes.NextCursor = strconv.FormatUint(uint64(loginAttempts[pageSize-1].ID), 10)
+
+		c.Header("Link", paginationLinks(c.Request.URL, pageSize, loginRes.NextCursor, ""))
+	}
+
+	for i := range loginAttempts {
+		loginRes.Logins = append(loginRes.Logins, newLoginAttemptResponse(&loginAttempts[i]))
+	}
+
+	c.JSON(http.StatusOK, loginRes)
+}
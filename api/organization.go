@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/gin-gonic/gin"
+)
+
+// tenantOrDefault maps the zero organization, found in tokens issued before organizations
+// existed, to the default organization
+func tenantOrDefault(organizationID uint) uint {
+	if organizationID == 0 {
+		return db.DefaultOrganizationID
+	}
+
+	return organizationID
+}
+
+// requestTenant returns the organization the request is scoped to
+func requestTenant(ctx context.Context) uint {
+	return tenantOrDefault(db.TenantFromContext(ctx))
+}
+
+// isAdminOf reports whether user administers the organization with organizationID. Global admins
+// administer every organization and org admins only their own
+func isAdminOf(user *db.User, organizationID uint) bool {
+	return user.Admin || (user.OrgAdmin && tenantOrDefault(user.OrganizationID) == organizationID)
+}
+
+// tenantOption places the token in the organization of user
+func tenantOption(user *db.User) token.PayloadOption {
+	return token.WithTenant(tenantOrDefault(user.OrganizationID))
+}
+
+// withOrganization scopes the request to the organization named in the route or, on routes
+// without one, to the default organization
+func (s *Server) withOrganization(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	organizationID := db.DefaultOrganizationID
+	if name := c.Param("org"); name != "" {
+		organization, err := s.DbConnector.GetOrganization(ctx, name)
+		if err != nil {
+			notFoundErr, ok := err.(*db.NotFoundError)
+			if ok {
+				c.JSON(http.StatusNotFound, gin.H{
+					"name":    "NotFound",
+					"message": notFoundErr.Error(),
+				})
+				c.Abort()
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"name":    "InternalServerError",
+				"message": "Unexpected server error. Try again later",
+			})
+			c.Abort()
+			return
+		}
+
+		organizationID = organization.ID
+	}
+
+	c.Request = c.Request.WithContext(db.WithTenant(ctx, organizationID))
+	c.Next()
+}
+
+// enterTenant lets the authenticated user into the organization of the request. Only global
+// admins reach organizations other than their own
+func (s *Server) enterTenant(c *gin.Context, user *db.User) bool {
+	if user.Admin || tenantOrDefault(user.OrganizationID) == requestTenant(c.Request.Context()) {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"name":    "Forbidden",
+		"message": "User is not allowed to access this resource",
+	})
+	c.Abort()
+
+	return false
+}
+
+type organizationResponse struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newOrganizationResponse(organization *db.Organization) organizationResponse {
+	return organizationResponse{
+		Name:        organization.Name,
+		DisplayName: organization.DisplayName,
+		CreatedAt:   organization.CreatedAt,
+	}
+}
+
+type getOrganizationsResponse struct {
+	Organizations []organizationResponse `json:"organizations"`
+}
+
+type createOrganizationRequest struct {
+	Name        string `json:"name" binding:"required,organizationName"`
+	DisplayName string `json:"display_name"`
+}
+
+func (s *Server) createOrganization(c *gin.Context) {
+	var organizationReq createOrganizationRequest
+
+	if err := c.ShouldBindJSON(&organizationReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var organization *db.Organization
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		organization, err = tx.CreateOrganization(ctx, db.CreateOrganizationParams{
+			Name:        organizationReq.Name,
+			DisplayName: organizationReq.DisplayName,
+		})
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionOrganizationCreate, nil)
+		_, auditParams.After = auditDiff(nil, map[string]any{
+			"name":         organization.Name,
+			"display_name": organization.DisplayName,
+		})
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newOrganizationResponse(organization))
+}
+
+func (s *Server) getOrganizations(c *gin.Context) {
+	organizations, err := s.DbConnector.GetOrganizations(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	organizationsRes := &getOrganizationsResponse{
+		Organizations: []organizationResponse{},
+	}
+
+	for i := range organizations {
+		organizationsRes.Organizations = append(organizationsRes.Organizations, newOrganizationResponse(&organizations[i]))
+	}
+
+	c.JSON(http.StatusOK, organizationsRes)
+}
+
+type setOrgAdminURIRequest struct {
+	UserName string `uri:"username" binding:"required"`
+}
+
+type setOrgAdminRequest struct {
+	OrgAdmin *bool `json:"org_admin" binding:"required"`
+}
+
+// setOrgAdmin grants or revokes the right of a user to administer the organization of the
+// request. Org admins manage the users, groups and attributes of their organization only
+func (s *Server) setOrgAdmin(c *gin.Context) {
+	var uriReq setOrgAdminURIRequest
+	var orgAdminReq setOrgAdminRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&orgAdminReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		user, err := tx.GetUser(ctx, uriReq.UserName)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.SetOrgAdmin(ctx, user.ID, *orgAdminReq.OrgAdmin); err != nil {
+			return err
+		}
+
+		updatedUser := *user
+		updatedUser.OrgAdmin = *orgAdminReq.OrgAdmin
+
+		auditParams := newAuditEvent(c, auditActionUserOrgAdmin, user)
+		auditParams.Before, auditParams.After = auditDiff(auditUserFields(user), auditUserFields(&updatedUser))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
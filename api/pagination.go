@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// paginationLinks builds an RFC 8288 Link header pointing to the pages around the current
+// one. The links repeat the request URL, replacing only its pagination parameters
+func paginationLinks(requestURL *url.URL, pageSize int, nextCursor string, prevCursor string) string {
+	links := []string{}
+
+	pageLink := func(cursor string, rel string) string {
+		query := requestURL.Query()
+		query.Del("page")
+		query.Del("offset")
+		query.Set("limit", strconv.Itoa(pageSize))
+		query.Set("cursor", cursor)
+
+		link := url.URL{
+			Path:     requestURL.Path,
+			RawQuery: query.Encode(),
+		}
+
+		return fmt.Sprintf(`<%s>; rel="%s"`, link.String(), rel)
+	}
+
+	if nextCursor != "" {
+		links = append(links, pageLink(nextCursor, "next"))
+	}
+
+	if prevCursor != "" {
+		links = append(links, pageLink(prevCursor, "prev"))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/notify"
+	"github.com/gin-gonic/gin"
+)
+
+// expiredRegistrationReason is the reason given to registrations nobody reviewed in time
+const expiredRegistrationReason = "The registration was not reviewed in time"
+
+var (
+	errRegistrationNotApproved = errors.New("The registration of the user has not been approved")
+	errRegistrationNotPending  = errors.New("The registration of the user is not pending approval")
+)
+
+type registrationURIRequest struct {
+	ID uint `uri:"id" binding:"required,min=1"`
+}
+
+type rejectRegistrationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type registrationResponse struct {
+	ID        uint      `json:"id"`
+	FullName  string    `json:"full_name"`
+	Phone     string    `json:"phone"`
+	UserName  string    `json:"user_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type getRegistrationsResponse struct {
+	Registrations []registrationResponse `json:"registrations"`
+}
+
+// auditRegistrationFields returns the registration fields of user tracked by the audit log
+func auditRegistrationFields(user *db.User) map[string]any {
+	return map[string]any{
+		"registration_status": user.RegistrationStatus,
+		"registration_reason": user.RegistrationReason,
+	}
+}
+
+// notifyRegistrationDecision tells user whether their registration was approved
+func (s *Server) notifyRegistrationDecision(ctx context.Context, user *db.User) {
+	notification := notify.Notification{
+		UserName: user.UserName,
+		Phone:    user.Phone,
+		Subject:  "Your registration was approved",
+		Body:     "You can now log in to your account",
+	}
+
+	if user.RegistrationStatus == db.RegistrationRejected {
+		notification.Subject = "Your registration was rejected"
+		notification.Body = fmt.Sprintf("Reason: %s", user.RegistrationReason)
+	}
+
+	if err := s.Sender.Send(ctx, notification); err != nil {
+		log.Printf("Cannot notify %s of the decision on their registration: %v\n", user.UserName, err)
+	}
+}
+
+func (s *Server) getRegistrations(c *gin.Context) {
+	users, err := s.DbConnector.GetPendingRegistrations(c.Request.Context(), time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	registrationsRes := &getRegistrationsResponse{
+		Registrations: []registrationResponse{},
+	}
+
+	for _, user := range users {
+		registrationsRes.Registrations = append(registrationsRes.Registrations, registrationResponse{
+			ID:        user.ID,
+			FullName:  user.FullName,
+			Phone:     user.Phone,
+			UserName:  user.UserName,
+			CreatedAt: user.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, registrationsRes)
+}
+
+func (s *Server) approveRegistration(c *gin.Context) {
+	s.decideRegistration(c, auditActionRegistrationApprove, func(ctx context.Context, tx db.DBConnector, user *db.User) error {
+		user.RegistrationStatus = db.RegistrationActive
+
+		return tx.ApproveRegistration(ctx, user.ID)
+	})
+}
+
+func (s *Server) rejectRegistration(c *gin.Context) {
+	var rejectReq rejectRegistrationRequest
+
+	if err := c.ShouldBindJSON(&rejectReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	s.decideRegistration(c, auditActionRegistrationReject, func(ctx context.Context, tx db.DBConnector, user *db.User) error {
+		user.RegistrationStatus = db.RegistrationRejected
+		user.RegistrationReason = rejectReq.Reason
+
+		return tx.RejectRegistration(ctx, user.ID, rejectReq.Reason)
+	})
+}
+
+// decideRegistration applies decide to the pending registration named in the route, records
+// the decision and lets the user know about it
+func (s *Server) decideRegistration(c *gin.Context, action string, decide func(ctx context.Context, tx db.DBConnector, user *db.User) error) {
+	var uriReq registrationURIRequest
+
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var decided db.User
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		user, err := tx.GetUserByID(ctx, uriReq.ID)
+		if err != nil {
+			return err
+		}
+
+		if user.RegistrationStatus != db.RegistrationPending {
+			return errRegistrationNotPending
+		}
+
+		decided = *user
+		if err := decide(ctx, tx, &decided); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, action, user)
+		auditParams.Before, auditParams.After = auditDiff(auditRegistrationFields(user), auditRegistrationFields(&decided))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, errRegistrationNotPending) {
+			c.JSON(http.StatusConflict, gin.H{
+				"name":    "Conflict",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	s.notifyRegistrationDecision(ctx, &decided)
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+// ExpireRegistrations rejects the registrations of every organization still pending since before
+// registeredBefore, returning how many were rejected
+func (s *Server) ExpireRegistrations(ctx context.Context, registeredBefore time.Time) (int, error) {
+	users, err := s.DbConnector.GetPendingRegistrations(db.WithTenant(ctx, 0), registeredBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range users {
+		user := &users[i]
+
+		// The registration and its audit event belong to the organization of the user
+		tenantCtx := db.WithTenant(ctx, user.OrganizationID)
+
+		err := s.DbConnector.WithTx(tenantCtx, func(tx db.DBConnector) error {
+			if err := tx.RejectRegistration(tenantCtx, user.ID, expiredRegistrationReason); err != nil {
+				return err
+			}
+
+			rejected := *user
+			rejected.RegistrationStatus = db.RegistrationRejected
+			rejected.RegistrationReason = expiredRegistrationReason
+
+			targetID := user.ID
+			auditParams := db.CreateAuditEventParams{
+				Action:         auditActionRegistrationExpire,
+				TargetID:       &targetID,
+				TargetUserName: user.UserName,
+			}
+			auditParams.Before, auditParams.After = auditDiff(auditRegistrationFields(user), auditRegistrationFields(&rejected))
+
+			_, err := tx.CreateAuditEvent(tenantCtx, auditParams)
+			return err
+		})
+		if err != nil {
+			// Registrations decided on in the meantime are no longer pending
+			if _, ok := err.(*db.NotFoundError); ok {
+				continue
+			}
+
+			return expired, err
+		}
+
+		user.RegistrationStatus = db.RegistrationRejected
+		user.RegistrationReason = expiredRegistrationReason
+		s.notifyRegistrationDecision(ctx, user)
+
+		expired++
+	}
+
+	return expired, nil
+}
+
+// RunRegistrationExpiry rejects the registrations left pending longer than ttl. It runs right
+// away and then once every interval, until ctx is done
+func (s *Server) RunRegistrationExpiry(ctx context.Context, ttl time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.ExpireRegistrations(ctx, time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("Cannot expire pending registrations: %v\n", err)
+		} else if expired > 0 {
+			log.Printf("Rejected %d registration(s) pending for more than %s\n", expired, ttl)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
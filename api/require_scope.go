@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+)
+
+// requireScope only lets API key authenticated requests through when the key grants the given scope.
+// Token authenticated requests are not restricted by scopes
+func (s *Server) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKeyReq, ok := c.Keys["apiKey"]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		apiKey, ok := apiKeyReq.(*db.APIKey)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": "User is not authorized to access this resource",
+			})
+			c.Abort()
+			return
+		}
+
+		for _, grantedScope := range apiKey.ScopeList() {
+			if grantedScope == scope {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"name":    "Forbidden",
+			"message": "API key is not allowed to access this resource",
+		})
+		c.Abort()
+	}
+}
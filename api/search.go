@@ -0,0 +1,139 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"unicode"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultSearchLimit = 10
+
+type searchUsersRequest struct {
+	Query string `form:"q" binding:"required,min=2,max=100"`
+	Limit int    `form:"limit" binding:"omitempty,min=1"`
+}
+
+// highlight marks the characters in [Start, End) of a field as matching the search. Offsets
+// count Unicode code points, not bytes
+type highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type searchUserResponse struct {
+	FullName   string                 `json:"full_name"`
+	Phone      string                 `json:"phone"`
+	UserName   string                 `json:"user_name"`
+	Rank       float64                `json:"rank"`
+	Highlights map[string][]highlight `json:"highlights"`
+}
+
+type searchUsersResponse struct {
+	Users []*searchUserResponse `json:"users"`
+}
+
+func lowerRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+
+	return runes
+}
+
+// highlightTerms finds the case insensitive occurrences of terms in text, merging the ones
+// that overlap. Fuzzy matches which do not contain any term are not highlighted
+func highlightTerms(text string, terms []string) []highlight {
+	runes := lowerRunes(text)
+
+	matched := make([]bool, len(runes))
+	for _, term := range terms {
+		termRunes := lowerRunes(term)
+		if len(termRunes) == 0 {
+			continue
+		}
+
+		for start := 0; start+len(termRunes) <= len(runes); start++ {
+			if string(runes[start:start+len(termRunes)]) == string(termRunes) {
+				for i := start; i < start+len(termRunes); i++ {
+					matched[i] = true
+				}
+			}
+		}
+	}
+
+	highlights := []highlight{}
+	for i := 0; i < len(matched); i++ {
+		if !matched[i] {
+			continue
+		}
+
+		start := i
+		for i < len(matched) && matched[i] {
+			i++
+		}
+
+		highlights = append(highlights, highlight{Start: start, End: i})
+	}
+
+	return highlights
+}
+
+func (s *Server) searchUsers(c *gin.Context) {
+	var searchReq searchUsersRequest
+
+	if err := c.ShouldBindQuery(&searchReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if searchReq.Limit == 0 {
+		searchReq.Limit = defaultSearchLimit
+	}
+
+	if searchReq.Limit > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": fmt.Sprintf("Page size cannot be greater than %d", maxPageSize),
+		})
+		return
+	}
+
+	results, err := s.DbConnector.SearchUsers(c.Request.Context(), db.SearchUsersParams{
+		Query: searchReq.Query,
+		Limit: searchReq.Limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	terms := db.SearchTerms(searchReq.Query)
+
+	searchRes := &searchUsersResponse{
+		Users: []*searchUserResponse{},
+	}
+	for _, result := range results {
+		searchRes.Users = append(searchRes.Users, &searchUserResponse{
+			FullName: result.FullName,
+			Phone:    result.Phone,
+			UserName: result.UserName,
+			Rank:     result.Rank,
+			Highlights: map[string][]highlight{
+				"full_name": highlightTerms(result.FullName, terms),
+				"user_name": highlightTerms(result.UserName, terms),
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, searchRes)
+}
@@ -4,7 +4,10 @@ import (
 	"net/http"
 
 	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/geoip"
+	"github.com/ericbg27/RegistryAPI/notify"
 	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/ericbg27/RegistryAPI/username"
 	"github.com/ericbg27/RegistryAPI/util"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -16,13 +19,47 @@ type Server struct {
 	DbConnector db.DBConnector
 	Router      *gin.Engine
 	Maker       token.Maker
+	Locator     geoip.Locator
+	Sender      notify.Sender
+	Blocklist   *username.Blocklist
+
+	// Keys derived from the token symmetric key for invitation codes and phone verification codes
+	invitationKey        []byte
+	phoneVerificationKey []byte
 }
 
+// NewServer creates the server. Logins are located with the GeoIP database in the config, if
+// any, and notifications are logged until another Sender is set. Usernames are checked against
+// the default blocklist, extended with the rules of the blocklist file in the config, if any
 func NewServer(dbConnector db.DBConnector, config util.Config, maker token.Maker) (server *Server, err error) {
 	server = &Server{
 		DbConnector: dbConnector,
 		Config:      config,
 		Maker:       maker,
+		Locator:     geoip.NoopLocator{},
+		Sender:      notify.LogSender{},
+		Blocklist:   username.DefaultBlocklist(),
+	}
+
+	if server.invitationKey, err = util.DeriveKey(config.TokenSymmetricKey, util.InvitationKeyPurpose); err != nil {
+		return nil, err
+	}
+
+	if server.phoneVerificationKey, err = util.DeriveKey(config.TokenSymmetricKey, util.PhoneVerificationKeyPurpose); err != nil {
+		return nil, err
+	}
+
+	if config.GeoIPDatabase != "" {
+		server.Locator, err = geoip.NewDatabaseLocator(config.GeoIPDatabase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.UserNameBlocklist != "" {
+		if err = server.Blocklist.Load(config.UserNameBlocklist); err != nil {
+			return nil, err
+		}
 	}
 
 	server.setupRouter()
@@ -36,25 +73,102 @@ func (s *Server) setupRouter() {
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("isPhone", isPhone)
 		v.RegisterValidation("validPassword", validPassword)
+		v.RegisterValidation("sortableUserField", sortableUserField)
+		v.RegisterValidation("attributeName", attributeName)
+		v.RegisterValidation("groupName", groupName)
+		v.RegisterValidation("organizationName", organizationName)
 	}
 
 	v1 := s.Router.Group("/v1")
 	{
 		v1.GET("/", s.healthCheck)
 
-		v1User := v1.Group("/user")
+		v1Orgs := v1.Group("/orgs")
 		{
-			v1User.GET("/", s.checkAuth, s.getUser)
-			v1User.PUT("/", s.checkAuth, s.updateUser)
-			v1User.DELETE("/", s.checkAuth, s.deleteUser)
-			v1User.POST("/", s.createUser)
-			v1User.POST("/login", s.loginUser)
+			v1Orgs.GET("/", s.checkAuth, s.requireScope(scopeUsersRead), s.isGlobalAdmin, s.getOrganizations)
+			v1Orgs.POST("/", s.checkAuth, s.denyAPIKey, s.isGlobalAdmin, s.createOrganization)
 		}
 
-		v1Users := v1.Group("/users")
-		{
-			v1Users.GET("/", s.checkAuth, s.isAdmin, s.getUsers)
-		}
+		// Invitation codes name the organization being joined
+		v1.POST("/invitations/accept", s.acceptInvitation)
+
+		v1.GET("/audit", s.checkAuth, s.denyAPIKey, s.isGlobalAdmin, s.getAuditEvents)
+		v1.GET("/audit/verify", s.checkAuth, s.denyAPIKey, s.isGlobalAdmin, s.verifyAuditChain)
+	}
+
+	// Routes without an organization are served for the default one
+	s.setupTenantRoutes(v1.Group("", s.withOrganization))
+	s.setupTenantRoutes(v1.Group("/orgs/:org", s.withOrganization))
+}
+
+// setupTenantRoutes registers the routes serving the data of a single organization
+func (s *Server) setupTenantRoutes(tenant *gin.RouterGroup) {
+	v1User := tenant.Group("/user")
+	{
+		v1User.GET("/", s.checkAuth, s.requireScope(scopeUserRead), s.getUser)
+		v1User.PUT("/", s.checkAuth, s.requireScope(scopeUserWrite), s.updateUser)
+		v1User.PATCH("/", s.checkAuth, s.requireScope(scopeUserWrite), s.patchUser)
+		v1User.DELETE("/", s.checkAuth, s.denyImpersonation, s.requireScope(scopeUserWrite), s.deleteUser)
+		v1User.POST("/", s.createUser)
+		v1User.GET("/available", s.checkUserNameAvailability)
+		v1User.POST("/login", s.loginUser)
+		v1User.GET("/logins", s.checkAuth, s.requireScope(scopeUserRead), s.getLoginAttempts)
+		v1User.GET("/groups", s.checkAuth, s.requireScope(scopeUserRead), s.getCurrentUserGroups)
+		v1User.GET("/export", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.getUserExport)
+		v1User.POST("/erase", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.eraseUser)
+		v1User.PUT("/user-name", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.changeUserName)
+		v1User.POST("/phone/verify", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.verifyPhone)
+		v1User.GET("/history", s.checkAuth, s.requireScope(scopeUserRead), s.getUserChanges)
+		v1User.DELETE("/impersonation", s.checkAuth, s.endImpersonation)
+
+		v1User.POST("/api-keys", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.createAPIKey)
+		v1User.GET("/api-keys", s.checkAuth, s.denyAPIKey, s.getAPIKeys)
+		v1User.DELETE("/api-keys/:prefix", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.revokeAPIKey)
+	}
+
+	v1Users := tenant.Group("/users")
+	{
+		v1Users.GET("/", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getUsers)
+		v1Users.GET("/search", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.searchUsers)
+		v1Users.GET("/deleted", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getDeletedUsers)
+		v1Users.POST("/deleted/:id/restore", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.restoreUser)
+		v1Users.DELETE("/deleted/:id", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.purgeUser)
+		v1Users.POST("/service-accounts", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.createServiceAccount)
+		v1Users.POST("/:username/impersonate", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.impersonateUser)
+		v1Users.DELETE("/:username/impersonations/:id", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.revokeImpersonation)
+		v1Users.GET("/:username/groups", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getUserGroups)
+		v1Users.PUT("/:username/org-admin", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.setOrgAdmin)
+	}
+
+	v1Attributes := tenant.Group("/attributes")
+	{
+		v1Attributes.GET("/", s.checkAuth, s.requireScope(scopeUserRead), s.getAttributeDefinitions)
+		v1Attributes.POST("/", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.createAttributeDefinition)
+		v1Attributes.DELETE("/:name", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.deleteAttributeDefinition)
+	}
+
+	v1Groups := tenant.Group("/groups")
+	{
+		v1Groups.GET("/", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getGroups)
+		v1Groups.POST("/", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.createGroup)
+		v1Groups.GET("/:name/members", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getGroupMembers)
+		v1Groups.POST("/:name/members", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.addGroupMember)
+		v1Groups.DELETE("/:name/members", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.removeGroupMember)
+	}
+
+	v1Registrations := tenant.Group("/registrations")
+	{
+		v1Registrations.GET("/", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getRegistrations)
+		v1Registrations.POST("/:id/approve", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.approveRegistration)
+		v1Registrations.POST("/:id/reject", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.rejectRegistration)
+	}
+
+	v1Invitations := tenant.Group("/invitations")
+	{
+		v1Invitations.GET("/", s.checkAuth, s.requireScope(scopeUsersRead), s.isAdmin, s.getInvitations)
+		v1Invitations.POST("/", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.createInvitation)
+		v1Invitations.POST("/:id/resend", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.resendInvitation)
+		v1Invitations.DELETE("/:id", s.checkAuth, s.denyAPIKey, s.denyImpersonation, s.isAdmin, s.revokeInvitation)
 	}
 }
 
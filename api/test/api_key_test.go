@@ -0,0 +1,650 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const apiKeyStr = "ApiKey "
+
+func TestCreateAPIKey(t *testing.T) {
+	serviceUser := db.User{
+		FullName:       "Batch Job",
+		Phone:          "91234567",
+		UserName:       "batchjob",
+		Password:       "secret",
+		LoginToken:     "tokenservice",
+		ServiceAccount: true,
+	}
+	serviceUser.ID = 1
+
+	regularUser := db.User{
+		FullName:   "Test User",
+		Phone:      "91234568",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "tokenregular",
+	}
+	regularUser.ID = 2
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	serviceTokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  serviceUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	regularTokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  regularUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"name":   "nightly",
+				"scopes": []string{"user:read"},
+			},
+			token: serviceUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "api_key.create", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, serviceUser.UserName, auditParams.ActorUserName)
+					require.Contains(t, auditParams.After, `"name":"nightly"`)
+					require.NotContains(t, auditParams.After, "key_hash")
+				})
+
+				maker.
+					EXPECT().
+					VerifyToken(serviceUser.LoginToken).
+					Times(1).
+					Return(serviceTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, apiKeyParams db.CreateAPIKeyParams) (*db.APIKey, error) {
+						require.Equal(t, serviceUser.ID, apiKeyParams.UserID)
+						require.Equal(t, "nightly", apiKeyParams.Name)
+						require.Equal(t, []string{"user:read"}, apiKeyParams.Scopes)
+						require.NotEmpty(t, apiKeyParams.Prefix)
+						require.NotEmpty(t, apiKeyParams.KeyHash)
+
+						return &db.APIKey{
+							UserID:  apiKeyParams.UserID,
+							Name:    apiKeyParams.Name,
+							Prefix:  apiKeyParams.Prefix,
+							KeyHash: apiKeyParams.KeyHash,
+							Scopes:  "user:read",
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				data, err := ioutil.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var bodyData map[string]any
+				err = json.Unmarshal(data, &bodyData)
+				require.NoError(t, err)
+
+				key, ok := bodyData["key"].(string)
+				require.Equal(t, true, ok)
+
+				prefix, ok := util.ParseAPIKeyPrefix(key)
+				require.Equal(t, true, ok)
+				require.Equal(t, prefix, bodyData["prefix"])
+			},
+		},
+		{
+			name: "Non Service Account",
+			body: gin.H{
+				"name": "nightly",
+			},
+			token: regularUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(regularUser.LoginToken).
+					Times(1).
+					Return(regularTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(regularUser.UserName)).
+					Times(1).
+					Return(&regularUser, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "Only service accounts can create API keys", http.StatusForbidden)
+			},
+		},
+		{
+			name: "Invalid Scope",
+			body: gin.H{
+				"name":   "nightly",
+				"scopes": []string{"admin"},
+			},
+			token: serviceUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(serviceUser.LoginToken).
+					Times(1).
+					Return(serviceTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Expiry In The Past",
+			body: gin.H{
+				"name":       "nightly",
+				"expires_at": now.Add(-time.Hour),
+			},
+			token: serviceUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(serviceUser.LoginToken).
+					Times(1).
+					Return(serviceTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/v1/user/api-keys"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+tc.token)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	serviceUser := db.User{
+		FullName:       "Batch Job",
+		Phone:          "91234567",
+		UserName:       "batchjob",
+		Password:       "secret",
+		LoginToken:     "tokenservice",
+		ServiceAccount: true,
+	}
+	serviceUser.ID = 1
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	tokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  serviceUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		prefix        string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			prefix: "abcdef012345",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "api_key.revoke", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, `{"prefix":"abcdef012345"}`, auditParams.Before)
+				})
+
+				maker.
+					EXPECT().
+					VerifyToken(serviceUser.LoginToken).
+					Times(1).
+					Return(tokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Eq(serviceUser.ID), gomock.Eq("abcdef012345")).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Not Found",
+			prefix: "abcdef543210",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				maker.
+					EXPECT().
+					VerifyToken(serviceUser.LoginToken).
+					Times(1).
+					Return(tokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					RevokeAPIKey(gomock.Any(), gomock.Eq(serviceUser.ID), gomock.Eq("abcdef543210")).
+					Times(1).
+					Return(&db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			url := "/v1/user/api-keys/" + tc.prefix
+			request, err := http.NewRequest(http.MethodDelete, url, nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+serviceUser.LoginToken)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	serviceUser := db.User{
+		FullName:       "Batch Job",
+		Phone:          "91234567",
+		UserName:       "batchjob",
+		Password:       "secret",
+		ServiceAccount: true,
+	}
+	serviceUser.ID = 1
+
+	key, prefix, err := util.GenerateAPIKey()
+	require.NoError(t, err)
+
+	newAPIKey := func(scopes string) *db.APIKey {
+		apiKey := &db.APIKey{
+			UserID:  serviceUser.ID,
+			Name:    "nightly",
+			Prefix:  prefix,
+			KeyHash: util.HashAPIKey(key),
+			Scopes:  scopes,
+		}
+		apiKey.ID = 3
+
+		return apiKey
+	}
+
+	past := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		key           string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(newAPIKey("user:read"), nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(serviceUser.ID)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(uint(3))).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(serviceUser.UserName)).
+					Times(1).
+					Return(&serviceUser, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Malformed Key",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    "rk_123",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+		{
+			name:   "Wrong Secret",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    key[:len(key)-4] + "0000",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(newAPIKey("user:read"), nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+		{
+			name:   "Revoked Key",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				apiKey := newAPIKey("user:read")
+				apiKey.RevokedAt = &past
+
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(apiKey, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+		{
+			name:   "Expired Key",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				apiKey := newAPIKey("user:read")
+				apiKey.ExpiresAt = &past
+
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(apiKey, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+		{
+			name:   "Missing Scope",
+			method: http.MethodGet,
+			url:    "/v1/user/?user_name=" + serviceUser.UserName,
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(newAPIKey("user:write"), nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(serviceUser.ID)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(uint(3))).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "API key is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Attribute Definitions Missing Scope",
+			method: http.MethodGet,
+			url:    "/v1/attributes/",
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(newAPIKey("user:write"), nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(serviceUser.ID)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(uint(3))).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					GetAttributeDefinitions(gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "API key is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Key Management Denied",
+			method: http.MethodGet,
+			url:    "/v1/user/api-keys",
+			key:    key,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetAPIKey(gomock.Any(), gomock.Eq(prefix)).
+					Times(1).
+					Return(newAPIKey("user:read user:write"), nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(serviceUser.ID)).
+					Times(1).
+					Return(&serviceUser, nil)
+
+				dbConnector.
+					EXPECT().
+					TouchAPIKey(gomock.Any(), gomock.Eq(uint(3))).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					GetAPIKeys(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "API key is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", apiKeyStr+tc.key)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeDefinitionEndpoints(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+	adminUser.ID = 1
+
+	nonAdminUser := db.User{
+		FullName:   "Non Admin",
+		Phone:      "91234568",
+		UserName:   "nonadminuser",
+		Password:   "secretnonadmin",
+		LoginToken: "tokennonadmin",
+	}
+	nonAdminUser.ID = 2
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker, user *db.User) {
+		uuidToken, err := uuid.NewRandom()
+		require.NoError(t, err)
+
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(user.LoginToken)).
+			Times(1).
+			Return(&token.Payload{
+				ID:        uuidToken,
+				Username:  user.UserName,
+				IssuedAt:  time.Now(),
+				ExpiredAt: time.Now().Add(time.Hour),
+			}, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+			Times(1).
+			Return(user, nil)
+	}
+
+	department := db.AttributeDefinition{
+		ID:         1,
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Unique:     true,
+		Visibility: db.AttributeVisibilityPublic,
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Create OK",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name":   "birthdate",
+				"type":   "date",
+				"unique": false,
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "attribute.create", func(auditParams db.CreateAuditEventParams) {
+					require.Contains(t, auditParams.After, `"name":"birthdate"`)
+				})
+
+				dbConnector.
+					EXPECT().
+					CreateAttributeDefinition(gomock.Any(), gomock.Eq(db.CreateAttributeDefinitionParams{
+						Name:       "birthdate",
+						Type:       db.AttributeTypeDate,
+						Visibility: db.AttributeVisibilityPrivate,
+					})).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, definitionParams db.CreateAttributeDefinitionParams) (*db.AttributeDefinition, error) {
+						return &db.AttributeDefinition{
+							ID:         2,
+							Name:       definitionParams.Name,
+							Type:       definitionParams.Type,
+							Visibility: definitionParams.Visibility,
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, "birthdate", bodyData["name"])
+				require.Equal(t, "private", bodyData["visibility"])
+			},
+		},
+		{
+			name:   "Create Already Exists",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name": "department",
+				"type": "string",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateAttributeDefinition(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, &db.BadInputError{
+						Err: fmt.Errorf("An attribute with the provided name already exists"),
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "AlreadyExists", "An attribute with the provided name already exists", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Bad Name",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name": "Cost-Center",
+				"type": "string",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Pattern On Number",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name":    "level",
+				"type":    "number",
+				"pattern": "[0-9]+",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Only string and date attributes can have a pattern", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Invalid Pattern",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name":    "locale",
+				"type":    "string",
+				"pattern": "[a-z",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Contains(t, recorder.Body.String(), "Invalid pattern")
+			},
+		},
+		{
+			name:   "Create Not Admin",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name": "department",
+				"type": "string",
+			},
+			token: nonAdminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &nonAdminUser)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "List OK",
+			method: http.MethodGet,
+			url:    "/v1/attributes/",
+			token:  nonAdminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &nonAdminUser)
+				stubAttributeDefinitions(dbConnector, department)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Attributes []struct {
+						Name   string `json:"name"`
+						Unique bool   `json:"unique"`
+					} `json:"attributes"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Len(t, bodyData.Attributes, 1)
+				require.Equal(t, "department", bodyData.Attributes[0].Name)
+				require.True(t, bodyData.Attributes[0].Unique)
+			},
+		},
+		{
+			name:   "Delete OK",
+			method: http.MethodDelete,
+			url:    "/v1/attributes/department",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "attribute.delete", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, `{"name":"department"}`, auditParams.Before)
+				})
+
+				dbConnector.
+					EXPECT().
+					DeleteAttributeDefinition(gomock.Any(), gomock.Eq("department")).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Delete Not Found",
+			method: http.MethodDelete,
+			url:    "/v1/attributes/missing",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					DeleteAttributeDefinition(gomock.Any(), gomock.Eq("missing")).
+					Times(1).
+					Return(&db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "List Users By Attribute",
+			method: http.MethodGet,
+			url:    "/v1/users/?attr.department=sales",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubAttributeDefinitions(dbConnector, department)
+				stubAttributeDefinitions(dbConnector, department)
+
+				listed := nonAdminUser
+				listed.Attributes = db.Attributes{"department": "sales", "removed": "value"}
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, getUsersParams db.GetUsersParams) ([]db.User, error) {
+						require.Equal(t, db.Attributes{"department": "sales"}, getUsersParams.Attributes)
+
+						return []db.User{listed}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Users []struct {
+						UserName   string         `json:"user_name"`
+						Attributes map[string]any `json:"attributes"`
+					} `json:"users"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Len(t, bodyData.Users, 1)
+				require.Equal(t, map[string]any{"department": "sales"}, bodyData.Users[0].Attributes)
+			},
+		},
+		{
+			name:   "List Users By Undefined Attribute",
+			method: http.MethodGet,
+			url:    "/v1/users/?attr.locale=en",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser)
+				stubAttributeDefinitions(dbConnector, department)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Attribute locale is not defined", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+
+			recorder := serveJSON(t, server.Router, tc.method, tc.url, tc.body, bearerStr+tc.token)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUserAttributesInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	ctx := context.Background()
+	for _, definitionParams := range []db.CreateAttributeDefinitionParams{
+		{Name: "birthdate", Type: db.AttributeTypeDate, Required: true, Visibility: db.AttributeVisibilityPrivate},
+		{Name: "employee_id", Type: db.AttributeTypeString, Unique: true, Pattern: "E[0-9]{4}", Visibility: db.AttributeVisibilityPublic},
+	} {
+		_, err := connector.CreateAttributeDefinition(ctx, definitionParams)
+		require.NoError(t, err)
+	}
+
+	newUser := func(suffix string, attributes map[string]any) map[string]any {
+		return map[string]any{
+			"full_name":  "Test User",
+			"phone":      "9998999" + suffix,
+			"user_name":  "testuser" + suffix,
+			"password":   "secret",
+			"attributes": attributes,
+		}
+	}
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", newUser("0", map[string]any{"employee_id": "E0001"}), "")
+	validateErrorResponse(t, recorder, "BadRequest", "Attribute birthdate is required", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", newUser("0", map[string]any{"birthdate": "1990-05-17", "employee_id": "1"}), "")
+	validateErrorResponse(t, recorder, "BadRequest", "Attribute employee_id does not match the pattern E[0-9]{4}", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", newUser("0", map[string]any{"birthdate": "1990-05-17", "employee_id": "E0001"}), "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", newUser("1", map[string]any{"birthdate": "1991-01-02", "employee_id": "E0001"}), "")
+	validateErrorResponse(t, recorder, "AlreadyExists", "An user with the provided employee_id already exists", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", newUser("1", map[string]any{"birthdate": "1991-01-02", "employee_id": "E0002"}), "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	login := func(userName string) string {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var loginRes map[string]string
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+		return bearerStr + loginRes["token"]
+	}
+
+	getAttributes := func(userName string, authorization string) map[string]any {
+		recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name="+userName, nil, authorization)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var userRes struct {
+			Attributes map[string]any `json:"attributes"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &userRes))
+
+		return userRes.Attributes
+	}
+
+	authorization := login("testuser0")
+
+	// Private attributes are only shown to the user
+	require.Equal(t, map[string]any{"birthdate": "1990-05-17", "employee_id": "E0001"}, getAttributes("testuser0", authorization))
+	require.Equal(t, map[string]any{"employee_id": "E0002"}, getAttributes("testuser1", authorization))
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name":  "Test User",
+		"phone":      "99989990",
+		"attributes": map[string]any{"birthdate": "1990-05-17", "employee_id": "E0002"},
+	}, authorization)
+	validateErrorResponse(t, recorder, "AlreadyExists", "An user with the provided employee_id already exists", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name":  "Test User",
+		"phone":      "99989990",
+		"attributes": map[string]any{"birthdate": "1990-05-18", "employee_id": "E0001"},
+	}, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// Omitted attributes are left as they are
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name": "Updated User",
+		"phone":     "99989990",
+	}, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, map[string]any{"birthdate": "1990-05-18", "employee_id": "E0001"}, getAttributes("testuser0", authorization))
+
+	require.NoError(t, connector.DeleteAttributeDefinition(ctx, "employee_id"))
+	require.Equal(t, map[string]any{"birthdate": "1990-05-18"}, getAttributes("testuser0", authorization))
+}
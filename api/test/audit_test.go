@@ -0,0 +1,374 @@
+package api_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuditEvents(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+	adminUser.ID = 1
+
+	uuidAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	adminTokenPayload := &token.Payload{
+		ID:        uuidAdminToken,
+		Username:  adminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	nonAdminUser := db.User{
+		FullName:   "Non Admin",
+		Phone:      "91234568",
+		UserName:   "nonadminuser",
+		Password:   "secretnonadmin",
+		LoginToken: "tokennonadmin",
+	}
+	nonAdminUser.ID = 2
+
+	uuidNonAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	nonAdminTokenPayload := &token.Payload{
+		ID:        uuidNonAdminToken,
+		Username:  nonAdminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	auditEvents := []db.AuditEvent{}
+	for i := 3; i > 0; i-- {
+		auditEvents = append(auditEvents, db.AuditEvent{
+			ID:             uint(i),
+			CreatedAt:      now,
+			Action:         "user.update",
+			ActorID:        &adminUser.ID,
+			ActorUserName:  adminUser.UserName,
+			TargetID:       &nonAdminUser.ID,
+			TargetUserName: "personal:1",
+			IP:             "192.0.2.1",
+			UserAgent:      "=cmd|' /C calc'!A0",
+			Before:         `{"full_name":"personal:2"}`,
+			After:          `{"full_name":"Updated"}`,
+			Personal: map[string]string{
+				"personal:1": `"nonadminuser"`,
+				"personal:2": `"Non Admin"`,
+			},
+		})
+	}
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker, user *db.User, payload *token.Payload) {
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(user.LoginToken)).
+			Times(1).
+			Return(payload, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+			Times(1).
+			Return(user, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?actor=adminuser&action=user.update&limit=2&cursor=10",
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetAuditEvents(gomock.Any(), gomock.Eq(db.GetAuditEventsParams{
+						ActorUserName: adminUser.UserName,
+						Action:        "user.update",
+						BeforeID:      10,
+						Limit:         3,
+					})).
+					Times(1).
+					Return(auditEvents, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Events []struct {
+						ID             uint           `json:"id"`
+						Action         string         `json:"action"`
+						TargetUserName string         `json:"target_user_name"`
+						Before         map[string]any `json:"before"`
+					} `json:"events"`
+					NextCursor string `json:"next_cursor"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+
+				require.Equal(t, 2, len(bodyData.Events))
+				require.Equal(t, uint(3), bodyData.Events[0].ID)
+				require.Equal(t, nonAdminUser.UserName, bodyData.Events[0].TargetUserName)
+				require.Equal(t, "Non Admin", bodyData.Events[0].Before["full_name"])
+				require.Equal(t, "2", bodyData.NextCursor)
+				require.Contains(t, recorder.Header().Get("Link"), "cursor=2")
+			},
+		},
+		{
+			name:  "CSV Export",
+			query: "?format=csv",
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetAuditEvents(gomock.Any(), gomock.Eq(db.GetAuditEventsParams{
+						Limit: 500,
+					})).
+					Times(1).
+					Return(auditEvents, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+
+				records, err := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+				require.NoError(t, err)
+
+				require.Equal(t, 4, len(records))
+				require.Equal(t, "id", records[0][0])
+				require.Equal(t, "3", records[1][0])
+				require.Equal(t, adminUser.UserName, records[1][4])
+				require.Equal(t, nonAdminUser.UserName, records[1][7])
+				require.Equal(t, `{"full_name":"Non Admin"}`, records[1][10])
+				require.Equal(t, "'=cmd|' /C calc'!A0", records[1][9])
+			},
+		},
+		{
+			name:  "Page Too Large",
+			query: "?limit=101",
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Page size cannot be greater than 100", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Invalid Format",
+			query: "?format=xml",
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Non Admin",
+			token: nonAdminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &nonAdminUser, nonAdminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetAuditEvents(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/v1/audit"+tc.query, nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+tc.token)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+
+	uuidAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	adminTokenPayload := &token.Payload{
+		ID:        uuidAdminToken,
+		Username:  adminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	chain := func() []db.AuditEvent {
+		auditEvents := []db.AuditEvent{}
+
+		prevHash := ""
+		for i, action := range []string{"user.create", "user.login", "user.update"} {
+			auditEvent := db.AuditEvent{
+				ID:        uint(i + 1),
+				CreatedAt: now,
+				Action:    action,
+				PrevHash:  prevHash,
+			}
+			auditEvent.Hash = auditEvent.ComputeHash()
+			prevHash = auditEvent.Hash
+
+			auditEvents = append(auditEvents, auditEvent)
+		}
+
+		return auditEvents
+	}
+
+	testCases := []struct {
+		name          string
+		auditEvents   func() []db.AuditEvent
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "Valid",
+			auditEvents: chain,
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, true, bodyData["valid"])
+				require.Equal(t, float64(3), bodyData["verified"])
+				require.Equal(t, chain()[2].Hash, bodyData["last_hash"])
+				require.NotContains(t, bodyData, "broken_at")
+			},
+		},
+		{
+			name: "Tampered",
+			auditEvents: func() []db.AuditEvent {
+				auditEvents := chain()
+				auditEvents[1].Action = "user.delete"
+
+				return auditEvents
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, false, bodyData["valid"])
+				require.Equal(t, float64(2), bodyData["broken_at"])
+				require.Equal(t, "Event does not match its hash", bodyData["reason"])
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(adminUser.LoginToken)).
+				Times(1).
+				Return(adminTokenPayload, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+				Times(1).
+				Return(&adminUser, nil)
+
+			dbConnector.
+				EXPECT().
+				GetAuditEvents(gomock.Any(), gomock.Eq(db.GetAuditEventsParams{
+					Ascending: true,
+					Limit:     500,
+				})).
+				Times(1).
+				Return(tc.auditEvents(), nil)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/v1/audit/verify", nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+adminUser.LoginToken)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeletedUsers(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+
+	uuidAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	adminTokenPayload := &token.Payload{
+		ID:        uuidAdminToken,
+		Username:  adminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	nonAdminUser := db.User{
+		FullName:   "Non Admin",
+		Phone:      "91234568",
+		UserName:   "nonadminuser",
+		Password:   "secretnonadmin",
+		LoginToken: "tokennonadmin",
+	}
+
+	uuidNonAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	nonAdminTokenPayload := &token.Payload{
+		ID:        uuidNonAdminToken,
+		Username:  nonAdminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	deletedUser := db.User{
+		FullName: "Deleted User",
+		Phone:    "99989990",
+		UserName: "deleteduser",
+	}
+	deletedUser.ID = 7
+	deletedUser.DeletedAt.Time = now
+	deletedUser.DeletedAt.Valid = true
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker, user *db.User, payload *token.Payload) {
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(user.LoginToken)).
+			Times(1).
+			Return(payload, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+			Times(1).
+			Return(user, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "List Deleted",
+			method: http.MethodGet,
+			url:    "/v1/users/deleted?page=0&offset=2&deleted=exclude",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Eq(db.GetUsersParams{
+						PageIndex: 0,
+						Offset:    2,
+						Deleted:   db.DeletedOnly,
+					})).
+					Times(1).
+					Return([]db.User{deletedUser}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Users []map[string]any `json:"users"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, 1, len(bodyData.Users))
+				require.Equal(t, float64(deletedUser.ID), bodyData.Users[0]["id"])
+				require.NotNil(t, bodyData.Users[0]["deleted_at"])
+			},
+		},
+		{
+			name:   "List Deleted Non Admin",
+			method: http.MethodGet,
+			url:    "/v1/users/deleted",
+			token:  nonAdminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &nonAdminUser, nonAdminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Restore",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/v1/users/deleted/%d/restore", deletedUser.ID),
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(deletedUser.ID)).
+					Times(1).
+					Return(&deletedUser, nil)
+
+				expectAuditEvent(t, dbConnector, "user.restore", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, deletedUser.UserName, auditParams.TargetUserName)
+				})
+
+				dbConnector.
+					EXPECT().
+					RestoreUser(gomock.Any(), gomock.Eq(deletedUser.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Restore Not Found",
+			method: http.MethodPost,
+			url:    "/v1/users/deleted/8/restore",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					RestoreUser(gomock.Any(), gomock.Eq(uint(8))).
+					Times(1).
+					Return(&db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Restore Conflict",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/v1/users/deleted/%d/restore", deletedUser.ID),
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					RestoreUser(gomock.Any(), gomock.Eq(deletedUser.ID)).
+					Times(1).
+					Return(&db.BadInputError{Err: fmt.Errorf("An user with the provided username already exists")})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "AlreadyExists", "An user with the provided username already exists", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Restore Invalid ID",
+			method: http.MethodPost,
+			url:    "/v1/users/deleted/abc/restore",
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					RestoreUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Purge",
+			method: http.MethodDelete,
+			url:    fmt.Sprintf("/v1/users/deleted/%d", deletedUser.ID),
+			token:  adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &adminUser, adminTokenPayload)
+
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "user.purge", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, adminUser.UserName, auditParams.ActorUserName)
+					require.Equal(t, deletedUser.ID, *auditParams.TargetID)
+				})
+
+				dbConnector.
+					EXPECT().
+					PurgeUser(gomock.Any(), gomock.Eq(deletedUser.ID)).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Purge Non Admin",
+			method: http.MethodDelete,
+			url:    fmt.Sprintf("/v1/users/deleted/%d", deletedUser.ID),
+			token:  nonAdminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker, &nonAdminUser, nonAdminTokenPayload)
+
+				dbConnector.
+					EXPECT().
+					PurgeUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+tc.token)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// serveWithHeaders serves a request like serveJSON, setting headers on it as well
+func serveWithHeaders(t *testing.T, server http.Handler, method string, url string, body any, headers map[string]string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+func TestUpdateUserIfMatch(t *testing.T) {
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "99989992",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "token",
+		Version:    3,
+	}
+	user.ID = 1
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	tokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  user.UserName,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(time.Hour),
+	}
+
+	updateParams := db.UpdateUserParams{
+		ID:         user.ID,
+		FullName:   "Updated User",
+		Phone:      user.Phone,
+		Password:   user.Password,
+		LoginToken: user.LoginToken,
+		Version:    user.Version,
+	}
+
+	testCases := []struct {
+		name           string
+		ifMatch        string
+		requireIfMatch bool
+		buildStubs     func(dbConnector *mockdb.MockDBConnector)
+		checkResponse  func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:    "OK",
+			ifMatch: `"3"`,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				expectAuditEvent(t, dbConnector, "user.update", nil)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), updateParams).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.Equal(t, `"4"`, recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:    "Any Version",
+			ifMatch: "*",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				expectAuditEvent(t, dbConnector, "user.update", nil)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), updateParams).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:    "Stale Version",
+			ifMatch: `"1", "2"`,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "PreconditionFailed", "The user was modified since it was read. Get it again and retry", http.StatusPreconditionFailed)
+			},
+		},
+		{
+			name:    "Weak Tag",
+			ifMatch: `W/"3"`,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+			},
+		},
+		{
+			name:    "Concurrent Update",
+			ifMatch: `"3"`,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), updateParams).
+					Times(1).
+					Return(&db.VersionConflictError{})
+
+				dbConnector.
+					EXPECT().
+					CreateAuditEvent(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Conflict", "The user was modified since it was read. Get it again and retry", http.StatusConflict)
+			},
+		},
+		{
+			name: "Without If-Match",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				expectAuditEvent(t, dbConnector, "user.update", nil)
+
+				// The version the user was read at by authentication is used
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), updateParams).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:           "If-Match Required",
+			requireIfMatch: true,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "PreconditionRequired", "The If-Match header is required. Get the user and send its ETag", http.StatusPreconditionRequired)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			maker.
+				EXPECT().
+				VerifyToken(user.LoginToken).
+				Times(1).
+				Return(tokenPayload, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+				Times(1).
+				Return(&user, nil)
+
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+			server.Config.RequireIfMatch = tc.requireIfMatch
+
+			headers := map[string]string{
+				"Authorization": bearerStr + user.LoginToken,
+			}
+			if tc.ifMatch != "" {
+				headers["If-Match"] = tc.ifMatch
+			}
+
+			recorder := serveWithHeaders(t, server.Router, http.MethodPut, "/v1/user/", gin.H{
+				"full_name": "Updated User",
+				"phone":     user.Phone,
+			}, headers)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUserETagInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	for _, userName := range []string{"testuser", "otheruser"} {
+		phone := "99989992"
+		if userName == "otheruser" {
+			phone = "99989993"
+		}
+
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+			"full_name": "Test User",
+			"phone":     phone,
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusCreated, recorder.Code)
+	}
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	authorization := "Bearer " + loginRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	etag := recorder.Header().Get("ETag")
+	require.Equal(t, `"1"`, etag)
+
+	// Other users get the representation without private attributes, which has a tag of its own
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=otheruser", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"1-public"`, recorder.Header().Get("ETag"))
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, map[string]string{
+		"Authorization": authorization,
+		"If-None-Match": `W/` + etag,
+	})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+	require.Empty(t, recorder.Body.String())
+
+	// Two clients update the user after reading it at the same version
+	update := func(fullName string) *httptest.ResponseRecorder {
+		return serveWithHeaders(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+			"full_name": fullName,
+			"phone":     "99989992",
+		}, map[string]string{
+			"Authorization": authorization,
+			"If-Match":      etag,
+		})
+	}
+
+	recorder = update("First Client")
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	recorder = update("Second Client")
+	validateErrorResponse(t, recorder, "PreconditionFailed", "The user was modified since it was read. Get it again and retry", http.StatusPreconditionFailed)
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, map[string]string{
+		"Authorization": authorization,
+		"If-None-Match": etag,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	var userRes map[string]any
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &userRes))
+	require.Equal(t, "First Client", userRes["full_name"])
+}
+
+func TestUserETagAttributesInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	ctx := context.Background()
+	_, err = connector.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Visibility: db.AttributeVisibilityPublic,
+	})
+	require.NoError(t, err)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name":  "Test User",
+		"phone":      "99989992",
+		"user_name":  "testuser",
+		"password":   "secret",
+		"attributes": map[string]any{"department": "sales"},
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	authorization := loginInMemory(t, server.Router, "testuser", "secret")
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	etag := recorder.Header().Get("ETag")
+	require.Regexp(t, `^"1-[0-9a-f]{16}"$`, etag)
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name":  "Test User",
+		"phone":      "99989992",
+		"attributes": map[string]any{"department": "support"},
+	}, map[string]string{
+		"Authorization": authorization,
+		"If-Match":      etag,
+	})
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	updatedETag := recorder.Header().Get("ETag")
+	require.Regexp(t, `^"2-[0-9a-f]{16}"$`, updatedETag)
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, map[string]string{
+		"Authorization": authorization,
+		"If-None-Match": updatedETag,
+	})
+	require.Equal(t, http.StatusNotModified, recorder.Code)
+
+	// Deleting the definition changes the representation without updating the user
+	require.NoError(t, connector.DeleteAttributeDefinition(ctx, "department"))
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, map[string]string{
+		"Authorization": authorization,
+		"If-None-Match": updatedETag,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, `"2"`, recorder.Header().Get("ETag"))
+
+	recorder = serveWithHeaders(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name": "Updated User",
+		"phone":     "99989992",
+	}, map[string]string{
+		"Authorization": authorization,
+		"If-Match":      updatedETag,
+	})
+	validateErrorResponse(t, recorder, "PreconditionFailed", "The user was modified since it was read. Get it again and retry", http.StatusPreconditionFailed)
+}
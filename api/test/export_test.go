@@ -0,0 +1,312 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEraseUser(t *testing.T) {
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "99989992",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "token",
+	}
+	user.ID = 5
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	tokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  user.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(user.LoginToken)).
+			Times(1).
+			Return(tokenPayload, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+			Times(1).
+			Return(&user, nil)
+	}
+
+	erased := user
+	erased.FullName = db.ErasedFullName
+	erased.Phone = db.ErasedIdentity(user.ID)
+	erased.UserName = db.ErasedIdentity(user.ID)
+	erased.Password = ""
+	erased.LoginToken = ""
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"password": "secret",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					EraseUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(&erased, nil)
+
+				expectAuditEvent(t, dbConnector, "user.erase", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, "erased-5", auditParams.ActorUserName)
+					require.Equal(t, "erased-5", auditParams.TargetUserName)
+					require.Equal(t, user.ID, *auditParams.TargetID)
+					require.Empty(t, auditParams.Before)
+					require.Empty(t, auditParams.After)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name: "Wrong Password",
+			body: gin.H{
+				"password": "wrongpassword",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+
+				dbConnector.
+					EXPECT().
+					EraseUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "Wrong password sent in request", http.StatusUnauthorized)
+			},
+		},
+		{
+			name: "BadRequest",
+			body: gin.H{},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+
+				dbConnector.
+					EXPECT().
+					EraseUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Internal Error",
+			body: gin.H{
+				"password": "secret",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					EraseUser(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil, fmt.Errorf("Error executing query"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "InternalServerError", "Unexpected server error. Try again later", http.StatusInternalServerError)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+
+			recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/erase", tc.body, bearerStr+user.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetUserExportFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := db.User{
+		UserName:   "testuser123",
+		LoginToken: "token",
+	}
+
+	dbConnector := mockdb.NewMockDBConnector(ctrl)
+	maker := mocktoken.NewMockMaker(ctrl)
+
+	maker.
+		EXPECT().
+		VerifyToken(gomock.Eq(user.LoginToken)).
+		Times(1).
+		Return(&token.Payload{Username: user.UserName, ExpiredAt: time.Now().Add(time.Hour)}, nil)
+
+	dbConnector.
+		EXPECT().
+		GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+		Times(1).
+		Return(&user, nil)
+
+	dbConnector.
+		EXPECT().
+		GetImpersonations(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return(nil, fmt.Errorf("Error executing query"))
+
+	dbConnector.
+		EXPECT().
+		CreateAuditEvent(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := NewTestServer(t, dbConnector, maker)
+
+	recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/user/export", nil, bearerStr+user.LoginToken)
+	validateErrorResponse(t, recorder, "InternalServerError", "Unexpected server error. Try again later", http.StatusInternalServerError)
+}
+
+func TestUserExportAndErasureInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	server := NewTestServer(t, db.NewMemoryConnector(), maker)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	authorization := bearerStr + loginRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/export", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Content-Disposition"), "user_export.json")
+
+	var export struct {
+		Profile struct {
+			UserName string `json:"user_name"`
+			Phone    string `json:"phone"`
+		} `json:"profile"`
+		Sessions     []any `json:"sessions"`
+		APIKeys      []any `json:"api_keys"`
+		LoginHistory []any `json:"login_history"`
+		AuditEvents  []struct {
+			Action string `json:"action"`
+		} `json:"audit_events"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &export))
+	require.Equal(t, "testuser", export.Profile.UserName)
+	require.Equal(t, "99989992", export.Profile.Phone)
+	require.Empty(t, export.Sessions)
+	require.Empty(t, export.APIKeys)
+	require.Len(t, export.LoginHistory, 1)
+	require.Len(t, export.AuditEvents, 2)
+	require.Equal(t, "user.login", export.AuditEvents[0].Action)
+	require.Equal(t, "user.create", export.AuditEvents[1].Action)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/export?format=zip", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/zip", recorder.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+
+		files[file.Name], err = io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+	}
+
+	require.Len(t, files, 5)
+	require.Contains(t, string(files["profile.json"]), `"user_name": "testuser"`)
+	require.Contains(t, string(files["audit_events.json"]), "user.export")
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/export?format=xml", nil, authorization)
+	validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/erase", map[string]any{
+		"password": "secret",
+	}, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// The account can no longer be used
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/export", nil, authorization)
+	require.NotEqual(t, http.StatusOK, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// The username and phone are free again
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+}
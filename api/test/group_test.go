@@ -0,0 +1,426 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupEndpoints(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+	adminUser.ID = 1
+
+	user := db.User{
+		FullName: "Test User",
+		Phone:    "91234568",
+		UserName: "testuser",
+	}
+	user.ID = 2
+
+	engineering := db.Group{ID: 1, Name: "engineering", Description: "Engineers"}
+	backend := db.Group{ID: 2, Name: "backend"}
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+		uuidToken, err := uuid.NewRandom()
+		require.NoError(t, err)
+
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(adminUser.LoginToken)).
+			Times(1).
+			Return(&token.Payload{
+				ID:        uuidToken,
+				Username:  adminUser.UserName,
+				IssuedAt:  time.Now(),
+				ExpiredAt: time.Now().Add(time.Hour),
+			}, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+			Times(1).
+			Return(&adminUser, nil)
+	}
+
+	stubGroup := func(dbConnector *mockdb.MockDBConnector, group db.Group) {
+		dbConnector.
+			EXPECT().
+			GetGroup(gomock.Any(), gomock.Eq(group.Name)).
+			Times(1).
+			Return(&group, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Create OK",
+			method: http.MethodPost,
+			url:    "/v1/groups/",
+			body: gin.H{
+				"name":        "engineering",
+				"description": "Engineers",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "group.create", func(auditParams db.CreateAuditEventParams) {
+					require.Contains(t, auditParams.After, `"name":"engineering"`)
+				})
+
+				dbConnector.
+					EXPECT().
+					CreateGroup(gomock.Any(), gomock.Eq(db.CreateGroupParams{Name: "engineering", Description: "Engineers"})).
+					Times(1).
+					Return(&engineering, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, "engineering", bodyData["name"])
+				require.Equal(t, "Engineers", bodyData["description"])
+			},
+		},
+		{
+			name:   "Create Already Exists",
+			method: http.MethodPost,
+			url:    "/v1/groups/",
+			body: gin.H{
+				"name": "engineering",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateGroup(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, &db.BadInputError{
+						Err: fmt.Errorf("A group with the provided name already exists"),
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "AlreadyExists", "A group with the provided name already exists", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Bad Name",
+			method: http.MethodPost,
+			url:    "/v1/groups/",
+			body: gin.H{
+				"name": "Engineering Team",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					CreateGroup(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "List OK",
+			method: http.MethodGet,
+			url:    "/v1/groups/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetGroups(gomock.Any()).
+					Times(1).
+					Return([]db.Group{backend, engineering}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `["backend","engineering"]`, groupNamesJSON(t, recorder))
+			},
+		},
+		{
+			name:   "Add User OK",
+			method: http.MethodPost,
+			url:    "/v1/groups/engineering/members",
+			body: gin.H{
+				"user_name": user.UserName,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubGroup(dbConnector, engineering)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					AddGroupMember(gomock.Any(), gomock.Eq(db.GroupMemberParams{GroupID: engineering.ID, UserID: user.ID})).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "group.member_add", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, user.UserName, auditParams.TargetUserName)
+					require.JSONEq(t, `{"group":"engineering","user_name":"testuser"}`, auditParams.After)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Add Group Cycle",
+			method: http.MethodPost,
+			url:    "/v1/groups/backend/members",
+			body: gin.H{
+				"group": engineering.Name,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubGroup(dbConnector, backend)
+				stubGroup(dbConnector, engineering)
+
+				dbConnector.
+					EXPECT().
+					AddGroupMember(gomock.Any(), gomock.Eq(db.GroupMemberParams{GroupID: backend.ID, MemberGroupID: engineering.ID})).
+					Times(1).
+					Return(&db.BadInputError{
+						Err: fmt.Errorf("A group cannot contain itself"),
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "A group cannot contain itself", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Add Both Members",
+			method: http.MethodPost,
+			url:    "/v1/groups/engineering/members",
+			body: gin.H{
+				"user_name": user.UserName,
+				"group":     backend.Name,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Either user_name or group must be sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Add To Missing Group",
+			method: http.MethodPost,
+			url:    "/v1/groups/missing/members",
+			body: gin.H{
+				"user_name": user.UserName,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetGroup(gomock.Any(), gomock.Eq("missing")).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Remove Group OK",
+			method: http.MethodDelete,
+			url:    "/v1/groups/engineering/members",
+			body: gin.H{
+				"group": backend.Name,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubGroup(dbConnector, engineering)
+				stubGroup(dbConnector, backend)
+
+				dbConnector.
+					EXPECT().
+					RemoveGroupMember(gomock.Any(), gomock.Eq(db.GroupMemberParams{GroupID: engineering.ID, MemberGroupID: backend.ID})).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "group.member_remove", func(auditParams db.CreateAuditEventParams) {
+					require.Nil(t, auditParams.TargetID)
+					require.JSONEq(t, `{"group":"engineering","member_group":"backend"}`, auditParams.Before)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Members OK",
+			method: http.MethodGet,
+			url:    "/v1/groups/engineering/members",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubGroup(dbConnector, engineering)
+
+				dbConnector.
+					EXPECT().
+					GetGroupMembers(gomock.Any(), gomock.Eq(engineering.ID)).
+					Times(1).
+					Return(&db.GroupMembers{Users: []db.User{user}, Groups: []db.Group{backend}}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Users []struct {
+						UserName string `json:"user_name"`
+					} `json:"users"`
+					Groups []struct {
+						Name string `json:"name"`
+					} `json:"groups"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Len(t, bodyData.Users, 1)
+				require.Equal(t, user.UserName, bodyData.Users[0].UserName)
+				require.Len(t, bodyData.Groups, 1)
+				require.Equal(t, backend.Name, bodyData.Groups[0].Name)
+			},
+		},
+		{
+			name:   "User Groups OK",
+			method: http.MethodGet,
+			url:    "/v1/users/testuser/groups",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.Group{backend, engineering}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, `["backend","engineering"]`, groupNamesJSON(t, recorder))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			authenticate(dbConnector, maker)
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+
+			recorder := serveJSON(t, server.Router, tc.method, tc.url, tc.body, bearerStr+adminUser.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+// groupNamesJSON returns the names of the groups listed in the response as a JSON array
+func groupNamesJSON(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var bodyData struct {
+		Groups []struct {
+			Name string `json:"name"`
+		} `json:"groups"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+
+	names := []string{}
+	for _, group := range bodyData.Groups {
+		names = append(names, group.Name)
+	}
+
+	data, err := json.Marshal(names)
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestUserGroupsInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	ctx := context.Background()
+
+	user, err := connector.GetUser(ctx, "testuser")
+	require.NoError(t, err)
+
+	company, err := connector.CreateGroup(ctx, db.CreateGroupParams{Name: "company"})
+	require.NoError(t, err)
+	engineering, err := connector.CreateGroup(ctx, db.CreateGroupParams{Name: "engineering"})
+	require.NoError(t, err)
+
+	require.NoError(t, connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: company.ID, MemberGroupID: engineering.ID}))
+	require.NoError(t, connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: engineering.ID, UserID: user.ID}))
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	// Groups reached through nested groups are listed in the token as well
+	payload, err := maker.VerifyToken(loginRes["token"])
+	require.NoError(t, err)
+	require.Equal(t, []string{"company", "engineering"}, payload.Groups)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/groups", nil, bearerStr+loginRes["token"])
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `["company","engineering"]`, groupNamesJSON(t, recorder))
+}
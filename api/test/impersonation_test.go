@@ -0,0 +1,702 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonateUser(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+	adminUser.ID = 1
+
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "91234568",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "tokenuser",
+	}
+	user.ID = 2
+
+	otherAdmin := db.User{
+		FullName: "Other Admin",
+		Phone:    "91234569",
+		UserName: "otheradmin",
+		Password: "secretadmin",
+		Admin:    true,
+	}
+	otherAdmin.ID = 3
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	adminTokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  adminUser.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	userTokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  user.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		userName      string
+		body          gin.H
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			userName: user.UserName,
+			body: gin.H{
+				"reason": "Ticket 42",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				expectAuditEvent(t, dbConnector, "user.impersonate", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, adminUser.UserName, auditParams.ActorUserName)
+					require.Equal(t, user.UserName, auditParams.TargetUserName)
+					require.Contains(t, auditParams.After, `"reason":"Ticket 42"`)
+				})
+
+				maker.
+					EXPECT().
+					VerifyToken(adminUser.LoginToken).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.Group{{Name: "support"}}, nil)
+
+				maker.
+					EXPECT().
+					CreateToken(gomock.Eq(user.UserName), gomock.Eq(15*time.Minute), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(username string, duration time.Duration, options ...token.PayloadOption) (string, error) {
+						payload, err := token.NewPayload(username, duration, options...)
+						require.NoError(t, err)
+						require.Equal(t, db.DefaultOrganizationID, payload.TenantID)
+						require.Equal(t, adminUser.UserName, payload.Impersonator)
+						require.Equal(t, db.DefaultOrganizationID, payload.ImpersonatorTenantID)
+						require.Equal(t, []string{"support"}, payload.Groups)
+
+						return "impersonationtoken", nil
+					})
+
+				dbConnector.
+					EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, impersonationParams db.CreateImpersonationParams) (*db.Impersonation, error) {
+						require.Equal(t, adminUser.ID, impersonationParams.AdminID)
+						require.Equal(t, user.ID, impersonationParams.UserID)
+						require.Equal(t, "Ticket 42", impersonationParams.Reason)
+
+						return &db.Impersonation{
+							AdminID:   impersonationParams.AdminID,
+							UserID:    impersonationParams.UserID,
+							Reason:    impersonationParams.Reason,
+							ExpiresAt: impersonationParams.ExpiresAt,
+						}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				data, err := ioutil.ReadAll(recorder.Body)
+				require.NoError(t, err)
+
+				var bodyData map[string]any
+				err = json.Unmarshal(data, &bodyData)
+				require.NoError(t, err)
+
+				require.Equal(t, "impersonationtoken", bodyData["token"])
+			},
+		},
+		{
+			name:     "Missing Reason",
+			userName: user.UserName,
+			body:     gin.H{},
+			token:    adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(adminUser.LoginToken).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				maker.
+					EXPECT().
+					CreateToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:     "Impersonating Admin",
+			userName: otherAdmin.UserName,
+			body: gin.H{
+				"reason": "Ticket 42",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(adminUser.LoginToken).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(otherAdmin.UserName)).
+					Times(1).
+					Return(&otherAdmin, nil)
+
+				maker.
+					EXPECT().
+					CreateToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "Admin users cannot be impersonated", http.StatusForbidden)
+			},
+		},
+		{
+			name:     "Non Admin User Token",
+			userName: "otheruser123",
+			body: gin.H{
+				"reason": "Ticket 42",
+			},
+			token: user.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(user.LoginToken).
+					Times(1).
+					Return(userTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := "/v1/users/" + tc.userName + "/impersonate"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+tc.token)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestImpersonatedRequest(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+	adminUser.ID = 1
+
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "91234568",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "tokenuser",
+	}
+	user.ID = 2
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	impersonationToken := "impersonationtoken"
+	impersonationPayload := &token.Payload{
+		ID:              uuidToken,
+		Username:        user.UserName,
+		Impersonator:    adminUser.UserName,
+		ImpersonationID: 5,
+		IssuedAt:        now,
+		ExpiredAt:       now.Add(time.Hour),
+	}
+
+	impersonation := db.Impersonation{
+		AdminID:   adminUser.ID,
+		UserID:    user.ID,
+		Reason:    "Support ticket",
+		ExpiresAt: now.Add(time.Hour),
+	}
+	impersonation.ID = 5
+
+	stubImpersonation := func(dbConnector *mockdb.MockDBConnector, impersonation db.Impersonation) {
+		dbConnector.
+			EXPECT().
+			GetImpersonation(gomock.Any(), impersonation.ID).
+			Times(1).
+			Return(&impersonation, nil)
+	}
+
+	// Impersonated org admins administer nothing, starting other impersonations included
+	orgAdmin := user
+	orgAdmin.OrgAdmin = true
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Read As User",
+			method: http.MethodGet,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(2).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubImpersonation(dbConnector, impersonation)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, adminUser.UserName, recorder.Header().Get("X-Impersonated-By"))
+			},
+		},
+		{
+			name:   "Update As User",
+			method: http.MethodPut,
+			body: gin.H{
+				"full_name": "Updated User",
+				"phone":     user.Phone,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubImpersonation(dbConnector, impersonation)
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "user.update", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, user.UserName, auditParams.ActorUserName)
+					require.Equal(t, adminUser.UserName, auditParams.ImpersonatorUserName)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Delete Forbidden",
+			method: http.MethodDelete,
+			body: gin.H{
+				"user_name": user.UserName,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubImpersonation(dbConnector, impersonation)
+
+				dbConnector.
+					EXPECT().
+					DeleteUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "Operation is not allowed while impersonating an user", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Chained Impersonation Forbidden",
+			method: http.MethodPost,
+			url:    "/v1/users/otheruser/impersonate",
+			body: gin.H{
+				"reason": "Support ticket",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&orgAdmin, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubImpersonation(dbConnector, impersonation)
+
+				dbConnector.
+					EXPECT().
+					CreateImpersonation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "Operation is not allowed while impersonating an user", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Define Attribute Forbidden",
+			method: http.MethodPost,
+			url:    "/v1/attributes/",
+			body: gin.H{
+				"name":       "department",
+				"type":       "string",
+				"visibility": "public",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&orgAdmin, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				stubImpersonation(dbConnector, impersonation)
+
+				dbConnector.
+					EXPECT().
+					CreateAttributeDefinition(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "Operation is not allowed while impersonating an user", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Impersonator No Longer Admin",
+			method: http.MethodGet,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				demotedAdmin := adminUser
+				demotedAdmin.Admin = false
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&demotedAdmin, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+		{
+			name:   "Ended Impersonation",
+			method: http.MethodGet,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(impersonationToken).
+					Times(1).
+					Return(impersonationPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				ended := impersonation
+				ended.EndedAt = &now
+				stubImpersonation(dbConnector, ended)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Unauthorized", "User is not authorized to access this resource", http.StatusUnauthorized)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := tc.url
+			if url == "" {
+				url = "/v1/user/?user_name=" + user.UserName
+			}
+
+			request, err := http.NewRequest(tc.method, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+impersonationToken)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestEndImpersonationInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	for i, userName := range []string{"adminuser", "testuser"} {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+			"full_name": "Test User",
+			"phone":     fmt.Sprintf("9998999%d", i),
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusCreated, recorder.Code)
+	}
+
+	admin, err := connector.GetUser(context.Background(), "adminuser")
+	require.NoError(t, err)
+	require.NoError(t, connector.SetOrgAdmin(context.Background(), admin.ID, true))
+
+	adminAuthorization := loginInMemory(t, server.Router, "adminuser", "secret")
+
+	impersonate := func() string {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/users/testuser/impersonate", map[string]any{
+			"reason": "Support ticket",
+		}, adminAuthorization)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var impersonateRes map[string]any
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &impersonateRes))
+
+		return bearerStr + impersonateRes["token"].(string)
+	}
+
+	authorization := impersonate()
+
+	recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// The admin signs out of the impersonated session, which stops accepting the token
+	recorder = serveJSON(t, server.Router, http.MethodDelete, "/v1/user/impersonation", nil, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	// Admins revoke impersonations as well
+	authorization = impersonate()
+
+	user, err := connector.GetUser(context.Background(), "testuser")
+	require.NoError(t, err)
+
+	impersonations, err := connector.GetImpersonations(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, impersonations, 2)
+
+	recorder = serveJSON(t, server.Router, http.MethodDelete, fmt.Sprintf("/v1/users/testuser/impersonations/%d", impersonations[1].ID), nil, adminAuthorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodDelete, fmt.Sprintf("/v1/users/testuser/impersonations/%d", impersonations[1].ID), nil, adminAuthorization)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// A token which is not an impersonation has none to end
+	recorder = serveJSON(t, server.Router, http.MethodDelete, "/v1/user/impersonation", nil, adminAuthorization)
+	validateErrorResponse(t, recorder, "BadRequest", "The current token was not issued for an impersonation", http.StatusBadRequest)
+}
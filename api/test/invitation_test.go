@@ -0,0 +1,511 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/notify"
+	mocknotify "github.com/ericbg27/RegistryAPI/notify/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var invitationCodeRegexp = regexp.MustCompile(`inv_[0-9a-f_]+`)
+
+func TestInvitationEndpoints(t *testing.T) {
+	orgAdminUser := db.User{
+		FullName:       "Org Admin",
+		Phone:          "91234568",
+		UserName:       "orgadmin",
+		LoginToken:     "tokenorgadmin",
+		OrgAdmin:       true,
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	orgAdminUser.ID = 2
+
+	user := db.User{
+		FullName:       "Test User",
+		Phone:          "91234569",
+		UserName:       "testuser",
+		LoginToken:     "tokenuser",
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	user.ID = 3
+
+	acceptedAt := time.Now()
+	invitation := db.Invitation{
+		ID:             1,
+		OrganizationID: db.DefaultOrganizationID,
+		Phone:          "99999990",
+		OrgAdmin:       true,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		actor         db.User
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Create OK",
+			actor:  orgAdminUser,
+			method: http.MethodPost,
+			url:    "/v1/invitations/",
+			body: gin.H{
+				"phone":     "99999990",
+				"org_admin": true,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateInvitation(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, invitationParams db.CreateInvitationParams) (*db.Invitation, error) {
+						require.Equal(t, orgAdminUser.ID, *invitationParams.InviterID)
+						require.Equal(t, "99999990", invitationParams.Phone)
+						require.True(t, invitationParams.OrgAdmin)
+						require.WithinDuration(t, time.Now().Add(7*24*time.Hour), invitationParams.ExpiresAt, time.Minute)
+
+						created := invitation
+						created.ExpiresAt = invitationParams.ExpiresAt
+
+						return &created, nil
+					})
+
+				expectAuditEvent(t, dbConnector, "invitation.create", func(auditParams db.CreateAuditEventParams) {
+					require.Contains(t, auditParams.After, `"phone":"99999990"`)
+				})
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, notification notify.Notification) error {
+						require.Equal(t, "99999990", notification.Phone)
+						require.Regexp(t, invitationCodeRegexp, notification.Body)
+
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, "pending", bodyData["status"])
+				require.Equal(t, true, bodyData["delivered"])
+			},
+		},
+		{
+			name:   "Create Not Delivered",
+			actor:  orgAdminUser,
+			method: http.MethodPost,
+			url:    "/v1/invitations/",
+			body: gin.H{
+				"phone": "99999990",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateInvitation(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&invitation, nil)
+
+				expectAuditEvent(t, dbConnector, "invitation.create", nil)
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errors.New("provider unavailable"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, false, bodyData["delivered"])
+			},
+		},
+		{
+			name:   "Create Bad Phone",
+			actor:  orgAdminUser,
+			method: http.MethodPost,
+			url:    "/v1/invitations/",
+			body: gin.H{
+				"phone": "123",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				dbConnector.
+					EXPECT().
+					CreateInvitation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Not Admin",
+			actor:  user,
+			method: http.MethodPost,
+			url:    "/v1/invitations/",
+			body: gin.H{
+				"phone": "99999990",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				dbConnector.
+					EXPECT().
+					CreateInvitation(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Resend Accepted",
+			actor:  orgAdminUser,
+			method: http.MethodPost,
+			url:    "/v1/invitations/1/resend",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				accepted := invitation
+				accepted.AcceptedAt = &acceptedAt
+
+				dbConnector.
+					EXPECT().
+					GetInvitation(gomock.Any(), gomock.Eq(uint(1))).
+					Times(1).
+					Return(&accepted, nil)
+
+				dbConnector.
+					EXPECT().
+					RenewInvitation(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Conflict", "The invitation was already accepted or revoked", http.StatusConflict)
+			},
+		},
+		{
+			name:   "Revoke OK",
+			actor:  orgAdminUser,
+			method: http.MethodDelete,
+			url:    "/v1/invitations/1",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetInvitation(gomock.Any(), gomock.Eq(uint(1))).
+					Times(1).
+					Return(&invitation, nil)
+
+				dbConnector.
+					EXPECT().
+					RevokeInvitation(gomock.Any(), gomock.Eq(uint(1))).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "invitation.revoke", nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Revoke Not Found",
+			actor:  orgAdminUser,
+			method: http.MethodDelete,
+			url:    "/v1/invitations/9",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetInvitation(gomock.Any(), gomock.Eq(uint(9))).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "Accept Forged Code",
+			method: http.MethodPost,
+			url:    "/v1/invitations/accept",
+			body: gin.H{
+				"code":      "inv_4102444800_00112233445566778899aabbccddeeff_00",
+				"user_name": "newuser",
+				"password":  "secret",
+				"full_name": "New User",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				dbConnector.
+					EXPECT().
+					GetInvitationByCode(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "InvalidInvitation", "The invitation code is invalid or has expired", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			sender := mocknotify.NewMockSender(ctrl)
+
+			uuidToken, err := uuid.NewRandom()
+			require.NoError(t, err)
+
+			actor := tc.actor
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(actor.LoginToken)).
+				AnyTimes().
+				Return(&token.Payload{
+					ID:        uuidToken,
+					Username:  actor.UserName,
+					TenantID:  actor.OrganizationID,
+					IssuedAt:  time.Now(),
+					ExpiredAt: time.Now().Add(time.Hour),
+				}, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(actor.UserName)).
+				AnyTimes().
+				Return(&actor, nil)
+
+			tc.buildStubs(dbConnector, sender)
+
+			server := NewTestServer(t, dbConnector, maker)
+			server.Sender = sender
+
+			recorder := serveJSON(t, server.Router, tc.method, tc.url, tc.body, bearerStr+actor.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestInvitationCodeKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dbConnector := mockdb.NewMockDBConnector(ctrl)
+	dbConnector.
+		EXPECT().
+		GetInvitationByCode(gomock.Any(), gomock.Any()).
+		Times(0)
+
+	server := NewTestServer(t, dbConnector, mocktoken.NewMockMaker(ctrl))
+
+	// Codes are signed with a key derived for invitations, not with the token key itself
+	code, err := util.NewInvitationCode([]byte(server.Config.TokenSymmetricKey), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/invitations/accept", map[string]any{
+		"code":      code,
+		"user_name": "newuser",
+		"password":  "secret",
+	}, "")
+	validateErrorResponse(t, recorder, "InvalidInvitation", "The invitation code is invalid or has expired", http.StatusBadRequest)
+}
+
+// recordingSender keeps the notifications it is asked to deliver
+type recordingSender struct {
+	notifications []notify.Notification
+}
+
+func (sender *recordingSender) Send(ctx context.Context, notification notify.Notification) error {
+	sender.notifications = append(sender.notifications, notification)
+
+	return nil
+}
+
+// lastCode returns the invitation code of the last notification sent
+func (sender *recordingSender) lastCode(t *testing.T) string {
+	require.NotEmpty(t, sender.notifications)
+
+	code := invitationCodeRegexp.FindString(sender.notifications[len(sender.notifications)-1].Body)
+	require.NotEmpty(t, code)
+
+	return code
+}
+
+func TestInvitationsInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	sender := &recordingSender{}
+	server.Sender = sender
+
+	acme, err := connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(t, err)
+	acmeCtx := db.WithTenant(context.Background(), acme.ID)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/", map[string]any{
+		"full_name": "Acme Admin",
+		"phone":     "99989990",
+		"user_name": "acmeadmin",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	admin, err := connector.GetUser(acmeCtx, "acmeadmin")
+	require.NoError(t, err)
+	require.NoError(t, connector.SetOrgAdmin(acmeCtx, admin.ID, true))
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/login", map[string]any{
+		"user_name": "acmeadmin",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+	authorization := bearerStr + loginRes["token"]
+
+	invite := func(body map[string]any) uint {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/invitations/", body, authorization)
+		require.Equal(t, http.StatusCreated, recorder.Code)
+
+		var invitationRes struct {
+			ID uint `json:"id"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &invitationRes))
+
+		return invitationRes.ID
+	}
+
+	accept := func(code string, userName string) *httptest.ResponseRecorder {
+		return serveJSON(t, server.Router, http.MethodPost, "/v1/invitations/accept", map[string]any{
+			"code":      code,
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+	}
+
+	// A new user is created in the organization of the invitation, with the preassigned role
+	invite(map[string]any{"full_name": "Invited User", "phone": "99989991", "org_admin": true})
+	code := sender.lastCode(t)
+
+	recorder = accept(code, "inviteduser")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	invited, err := connector.GetUser(acmeCtx, "inviteduser")
+	require.NoError(t, err)
+	require.True(t, invited.OrgAdmin)
+	require.Equal(t, "99989991", invited.Phone)
+
+	_, err = connector.GetUser(db.WithTenant(context.Background(), db.DefaultOrganizationID), "inviteduser")
+	require.IsType(t, &db.NotFoundError{}, err)
+
+	recorder = accept(code, "otheruser")
+	validateErrorResponse(t, recorder, "InvalidInvitation", "The invitation code is invalid or has expired", http.StatusBadRequest)
+
+	// Resending replaces the code
+	id := invite(map[string]any{"phone": "99989992", "org_admin": true})
+	staleCode := sender.lastCode(t)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, fmt.Sprintf("/v1/orgs/acme/invitations/%d/resend", id), nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	code = sender.lastCode(t)
+	require.NotEqual(t, staleCode, code)
+
+	recorder = accept(staleCode, "acmeadmin")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// Existing users of the organization are linked once they prove who they are
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/invitations/accept", map[string]any{
+		"code":      code,
+		"user_name": "inviteduser",
+		"password":  "wrongsecret",
+	}, "")
+	validateErrorResponse(t, recorder, "Unauthorized", "Wrong password for the existing user", http.StatusUnauthorized)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/", map[string]any{
+		"full_name": "Acme User",
+		"phone":     "99989993",
+		"user_name": "acmeuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = accept(code, "acmeuser")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	linked, err := connector.GetUser(acmeCtx, "acmeuser")
+	require.NoError(t, err)
+	require.True(t, linked.OrgAdmin)
+
+	// Revoked invitations cannot be accepted
+	id = invite(map[string]any{"full_name": "Revoked User", "phone": "99989994"})
+	code = sender.lastCode(t)
+
+	recorder = serveJSON(t, server.Router, http.MethodDelete, fmt.Sprintf("/v1/orgs/acme/invitations/%d", id), nil, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = accept(code, "revokeduser")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/orgs/acme/invitations/", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var invitationsRes struct {
+		Invitations []struct {
+			Status string `json:"status"`
+		} `json:"invitations"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &invitationsRes))
+	require.Len(t, invitationsRes.Invitations, 3)
+	require.Equal(t, "accepted", invitationsRes.Invitations[0].Status)
+	require.Equal(t, "accepted", invitationsRes.Invitations[1].Status)
+	require.Equal(t, "revoked", invitationsRes.Invitations[2].Status)
+
+	// Other organizations do not see them
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/invitations/", nil, authorization)
+	validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+}
@@ -0,0 +1,307 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/geoip"
+	"github.com/ericbg27/RegistryAPI/notify"
+	mocknotify "github.com/ericbg27/RegistryAPI/notify/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLoginAttempts(t *testing.T) {
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "99989992",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "token",
+	}
+	user.ID = 1
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	tokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  user.UserName,
+		IssuedAt:  now,
+		ExpiredAt: now.Add(time.Hour),
+	}
+
+	loginAttempts := []db.LoginAttempt{}
+	for i := 3; i > 0; i-- {
+		loginAttempts = append(loginAttempts, db.LoginAttempt{
+			ID:        uint(i),
+			CreatedAt: now,
+			UserID:    &user.ID,
+			UserName:  user.UserName,
+			Success:   true,
+			IP:        "192.0.2.10",
+			UserAgent: "Test Agent",
+			Country:   "US",
+			City:      "San Francisco",
+			NewDevice: i == 3,
+		})
+	}
+
+	authenticate := func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+		maker.
+			EXPECT().
+			VerifyToken(gomock.Eq(user.LoginToken)).
+			Times(1).
+			Return(tokenPayload, nil)
+
+		dbConnector.
+			EXPECT().
+			GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+			Times(1).
+			Return(&user, nil)
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		token         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "?limit=2&cursor=10",
+			token: user.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+
+				dbConnector.
+					EXPECT().
+					GetLoginAttempts(gomock.Any(), gomock.Eq(db.GetLoginAttemptsParams{
+						UserID:   user.ID,
+						BeforeID: 10,
+						Limit:    3,
+					})).
+					Times(1).
+					Return(loginAttempts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, `</v1/user/logins?cursor=2&limit=2>; rel="next"`, recorder.Header().Get("Link"))
+
+				var loginRes map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+				require.Equal(t, "2", loginRes["next_cursor"])
+
+				logins := loginRes["logins"].([]any)
+				require.Len(t, logins, 2)
+
+				login := logins[0].(map[string]any)
+				require.Equal(t, float64(3), login["id"])
+				require.Equal(t, true, login["success"])
+				require.Equal(t, true, login["new_device"])
+				require.Equal(t, "San Francisco", login["city"])
+				require.Equal(t, "US", login["country"])
+				require.NotContains(t, login, "region")
+				require.NotContains(t, login, "failure_reason")
+			},
+		},
+		{
+			name:  "Page Size Too Large",
+			query: "?limit=101",
+			token: user.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+
+				dbConnector.
+					EXPECT().
+					GetLoginAttempts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Page size cannot be greater than 100", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Internal Error",
+			token: user.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				authenticate(dbConnector, maker)
+
+				dbConnector.
+					EXPECT().
+					GetLoginAttempts(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, fmt.Errorf("Error executing query"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "InternalServerError", "Unexpected server error. Try again later", http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "Unauthorized",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					GetLoginAttempts(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/v1/user/logins"+tc.query, nil)
+			require.NoError(t, err)
+
+			if tc.token != "" {
+				request.Header.Set("Authorization", bearerStr+tc.token)
+			}
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestLoginHistoryInMemory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	server := NewTestServer(t, db.NewMemoryConnector(), maker)
+
+	server.Locator, err = geoip.ReadDatabase(strings.NewReader("192.0.2.0/24,US,California,San Francisco\n"))
+	require.NoError(t, err)
+
+	sender := mocknotify.NewMockSender(ctrl)
+	server.Sender = sender
+
+	login := func(userName string, password string, userAgent string, remoteAddr string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(map[string]any{
+			"user_name": userName,
+			"password":  password,
+		})
+		require.NoError(t, err)
+
+		request, err := http.NewRequest(http.MethodPost, "/v1/user/login", bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("User-Agent", userAgent)
+		request.RemoteAddr = remoteAddr
+
+		recorder := httptest.NewRecorder()
+		server.Router.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	// Neither the first login nor another login from the same device notify the user
+	sender.EXPECT().Send(gomock.Any(), gomock.Any()).Times(0)
+
+	require.Equal(t, http.StatusOK, login("testuser", "secret", "Phone", "198.51.100.1:1234").Code)
+	require.Equal(t, http.StatusOK, login("testuser", "secret", "Phone", "198.51.100.1:1234").Code)
+	require.Equal(t, http.StatusUnauthorized, login("testuser", "wrong", "Laptop", "192.0.2.10:1234").Code)
+	require.Equal(t, http.StatusNotFound, login("unknownuser", "secret", "Laptop", "192.0.2.10:1234").Code)
+
+	sender.
+		EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, notification notify.Notification) error {
+			require.Equal(t, "testuser", notification.UserName)
+			require.Equal(t, "99989992", notification.Phone)
+			require.Contains(t, notification.Body, "Laptop")
+			require.Contains(t, notification.Body, "192.0.2.10 (San Francisco, California, US)")
+
+			return nil
+		})
+
+	recorder = login("testuser", "secret", "Laptop", "192.0.2.10:1234")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	authorization := "Bearer " + loginRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/logins?limit=3", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var historyRes struct {
+		Logins []struct {
+			ID            uint   `json:"id"`
+			Success       bool   `json:"success"`
+			FailureReason string `json:"failure_reason"`
+			IP            string `json:"ip"`
+			UserAgent     string `json:"user_agent"`
+			City          string `json:"city"`
+			NewDevice     bool   `json:"new_device"`
+		} `json:"logins"`
+		NextCursor string `json:"next_cursor"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &historyRes))
+	require.Len(t, historyRes.Logins, 3)
+	require.NotEmpty(t, historyRes.NextCursor)
+
+	require.True(t, historyRes.Logins[0].Success)
+	require.True(t, historyRes.Logins[0].NewDevice)
+	require.Equal(t, "San Francisco", historyRes.Logins[0].City)
+
+	require.False(t, historyRes.Logins[1].Success)
+	require.Equal(t, "wrong_password", historyRes.Logins[1].FailureReason)
+	require.Equal(t, "Laptop", historyRes.Logins[1].UserAgent)
+
+	require.True(t, historyRes.Logins[2].Success)
+	require.False(t, historyRes.Logins[2].NewDevice)
+	require.Empty(t, historyRes.Logins[2].City)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/logins?limit=3&cursor="+historyRes.NextCursor, nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	historyRes.NextCursor = ""
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &historyRes))
+	require.Len(t, historyRes.Logins, 1)
+	require.Empty(t, historyRes.NextCursor)
+	require.Equal(t, "Phone", historyRes.Logins[0].UserAgent)
+	require.False(t, historyRes.Logins[0].NewDevice)
+}
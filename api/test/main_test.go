@@ -1,6 +1,7 @@
 package api_test
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http/httptest"
@@ -10,9 +11,11 @@ import (
 
 	"github.com/ericbg27/RegistryAPI/api"
 	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
 	"github.com/ericbg27/RegistryAPI/token"
 	"github.com/ericbg27/RegistryAPI/util"
 	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,6 +31,26 @@ func NewTestServer(t *testing.T, dbConnector db.DBConnector, maker token.Maker)
 	return server
 }
 
+// stubTx makes the mocked connector run transactional work against itself
+func stubTx(dbConnector *mockdb.MockDBConnector, times int) {
+	dbConnector.
+		EXPECT().
+		WithTx(gomock.Any(), gomock.Any()).
+		Times(times).
+		DoAndReturn(func(ctx context.Context, fn func(tx db.DBConnector) error) error {
+			return fn(dbConnector)
+		})
+}
+
+// stubAttributeDefinitions makes the mocked connector declare definitions as the custom attributes
+func stubAttributeDefinitions(dbConnector *mockdb.MockDBConnector, definitions ...db.AttributeDefinition) {
+	dbConnector.
+		EXPECT().
+		GetAttributeDefinitions(gomock.Any()).
+		Times(1).
+		Return(definitions, nil)
+}
+
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 
@@ -58,3 +81,23 @@ func validateErrorResponse(t *testing.T, recorder *httptest.ResponseRecorder, ex
 	require.Equal(t, ok, true)
 	require.Equal(t, expectedMessage, message)
 }
+
+// expectAuditEvent expects a single audit event for action to be written, which check may
+// further inspect
+func expectAuditEvent(t *testing.T, dbConnector *mockdb.MockDBConnector, action string, check func(auditParams db.CreateAuditEventParams)) {
+	dbConnector.
+		EXPECT().
+		CreateAuditEvent(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, auditParams db.CreateAuditEventParams) (*db.AuditEvent, error) {
+			require.Equal(t, action, auditParams.Action)
+
+			if check != nil {
+				check(auditParams)
+			}
+
+			return &db.AuditEvent{
+				Action: auditParams.Action,
+			}, nil
+		})
+}
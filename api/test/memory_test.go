@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/token"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/stretchr/testify/require"
+)
+
+func serveJSON(t *testing.T, server http.Handler, method string, url string, body any, authorization string) *httptest.ResponseRecorder {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+
+	return recorder
+}
+
+// loginInMemory logs userName in, returning the Authorization header carrying its token
+func loginInMemory(t *testing.T, server http.Handler, userName string, password string) string {
+	recorder := serveJSON(t, server, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": userName,
+		"password":  password,
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	return bearerStr + loginRes["token"]
+}
+
+func TestUserLifecycleInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	user := map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", user, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", user, "")
+	validateErrorResponse(t, recorder, "AlreadyExists", "An user with the provided phone number already exists", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	authorization := "Bearer " + loginRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name": "Updated User",
+		"phone":     "99989993",
+	}, authorization)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var userRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &userRes))
+	require.Equal(t, "Updated User", userRes["full_name"])
+	require.Equal(t, "99989992", userRes["phone"])
+
+	recorder = serveJSON(t, server.Router, http.MethodDelete, "/v1/user/", map[string]any{
+		"user_name": "testuser",
+	}, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	validateErrorResponse(t, recorder, "NotFound", "Could not find an user with the provided parameters", http.StatusNotFound)
+
+	auditEvents, err := connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{})
+	require.NoError(t, err)
+
+	actions := []string{}
+	for _, auditEvent := range auditEvents {
+		actions = append(actions, auditEvent.Action)
+	}
+	require.Equal(t, []string{"user.delete", "user.update", "user.login", "user.create"}, actions)
+}
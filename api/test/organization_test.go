@@ -0,0 +1,493 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationEndpoints(t *testing.T) {
+	adminUser := db.User{
+		FullName:       "Admin",
+		Phone:          "91234567",
+		UserName:       "adminuser",
+		LoginToken:     "tokenadmin",
+		Admin:          true,
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	adminUser.ID = 1
+
+	orgAdminUser := db.User{
+		FullName:       "Org Admin",
+		Phone:          "91234568",
+		UserName:       "orgadmin",
+		LoginToken:     "tokenorgadmin",
+		OrgAdmin:       true,
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	orgAdminUser.ID = 2
+
+	user := db.User{
+		FullName:       "Test User",
+		Phone:          "91234569",
+		UserName:       "testuser",
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	user.ID = 3
+
+	acme := db.Organization{ID: 2, Name: "acme", DisplayName: "Acme"}
+
+	testCases := []struct {
+		name          string
+		actor         db.User
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "Create OK",
+			actor:  adminUser,
+			method: http.MethodPost,
+			url:    "/v1/orgs/",
+			body: gin.H{
+				"name":         "acme",
+				"display_name": "Acme",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Eq(db.CreateOrganizationParams{Name: "acme", DisplayName: "Acme"})).
+					Times(1).
+					Return(&acme, nil)
+
+				expectAuditEvent(t, dbConnector, "organization.create", func(auditParams db.CreateAuditEventParams) {
+					require.JSONEq(t, `{"name":"acme","display_name":"Acme"}`, auditParams.After)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusCreated, recorder.Code)
+
+				var bodyData map[string]any
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Equal(t, "acme", bodyData["name"])
+				require.Equal(t, "Acme", bodyData["display_name"])
+			},
+		},
+		{
+			name:   "Create Already Exists",
+			actor:  adminUser,
+			method: http.MethodPost,
+			url:    "/v1/orgs/",
+			body: gin.H{
+				"name": "acme",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, &db.BadInputError{
+						Err: fmt.Errorf("An organization with the provided name already exists"),
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "AlreadyExists", "An organization with the provided name already exists", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Bad Name",
+			actor:  adminUser,
+			method: http.MethodPost,
+			url:    "/v1/orgs/",
+			body: gin.H{
+				"name": "Acme Inc",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Create Org Admin",
+			actor:  orgAdminUser,
+			method: http.MethodPost,
+			url:    "/v1/orgs/",
+			body: gin.H{
+				"name": "acme",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					CreateOrganization(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "List OK",
+			actor:  adminUser,
+			method: http.MethodGet,
+			url:    "/v1/orgs/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetOrganizations(gomock.Any()).
+					Times(1).
+					Return([]db.Organization{acme, {ID: db.DefaultOrganizationID, Name: "default"}}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData struct {
+					Organizations []struct {
+						Name string `json:"name"`
+					} `json:"organizations"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &bodyData))
+				require.Len(t, bodyData.Organizations, 2)
+				require.Equal(t, "acme", bodyData.Organizations[0].Name)
+			},
+		},
+		{
+			name:   "Set Org Admin OK",
+			actor:  orgAdminUser,
+			method: http.MethodPut,
+			url:    "/v1/users/testuser/org-admin",
+			body: gin.H{
+				"org_admin": true,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					SetOrgAdmin(gomock.Any(), gomock.Eq(user.ID), gomock.Eq(true)).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "user.org_admin", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, user.UserName, auditParams.TargetUserName)
+					require.JSONEq(t, `{"org_admin":false}`, auditParams.Before)
+					require.JSONEq(t, `{"org_admin":true}`, auditParams.After)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Set Org Admin Missing Flag",
+			actor:  orgAdminUser,
+			method: http.MethodPut,
+			url:    "/v1/users/testuser/org-admin",
+			body:   gin.H{},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Org Admin Of Other Organization",
+			actor:  orgAdminUser,
+			method: http.MethodGet,
+			url:    "/v1/orgs/acme/groups/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetOrganization(gomock.Any(), gomock.Eq(acme.Name)).
+					Times(1).
+					Return(&acme, nil)
+
+				dbConnector.
+					EXPECT().
+					GetGroups(gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+		{
+			name:   "Global Admin Of Other Organization",
+			actor:  adminUser,
+			method: http.MethodGet,
+			url:    "/v1/orgs/acme/groups/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetOrganization(gomock.Any(), gomock.Eq(acme.Name)).
+					Times(1).
+					Return(&acme, nil)
+
+				dbConnector.
+					EXPECT().
+					GetGroups(gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context) ([]db.Group, error) {
+						require.Equal(t, acme.ID, db.TenantFromContext(ctx))
+
+						return []db.Group{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Missing Organization",
+			actor:  adminUser,
+			method: http.MethodGet,
+			url:    "/v1/orgs/missing/groups/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetOrganization(gomock.Any(), gomock.Eq("missing")).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			uuidToken, err := uuid.NewRandom()
+			require.NoError(t, err)
+
+			actor := tc.actor
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(actor.LoginToken)).
+				AnyTimes().
+				Return(&token.Payload{
+					ID:        uuidToken,
+					Username:  actor.UserName,
+					TenantID:  actor.OrganizationID,
+					IssuedAt:  time.Now(),
+					ExpiredAt: time.Now().Add(time.Hour),
+				}, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(actor.UserName)).
+				AnyTimes().
+				Return(&actor, nil)
+
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+
+			recorder := serveJSON(t, server.Router, tc.method, tc.url, tc.body, bearerStr+actor.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestTenantsInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	acme, err := connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(t, err)
+
+	user := map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}
+
+	// The same username and phone may be registered once in every organization
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", user, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/", user, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/", user, "")
+	validateErrorResponse(t, recorder, "AlreadyExists", "An user with the provided phone number already exists", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/missing/user/", user, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	login := func(url string) string {
+		recorder := serveJSON(t, server.Router, http.MethodPost, url, map[string]any{
+			"user_name": "testuser",
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var loginRes map[string]string
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+		return bearerStr + loginRes["token"]
+	}
+
+	acmeAuthorization := login("/v1/orgs/acme/user/login")
+	defaultAuthorization := login("/v1/user/login")
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/orgs/acme/user/", map[string]any{
+		"full_name": "Acme User",
+		"phone":     "99989992",
+	}, acmeAuthorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, defaultAuthorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var userRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &userRes))
+	require.Equal(t, "Test User", userRes["full_name"])
+
+	// Users only reach the organization they belong to
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/?user_name=testuser", nil, acmeAuthorization)
+	validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+
+	// Org admins administer their own organization only
+	acmeUser, err := connector.GetUser(db.WithTenant(context.Background(), acme.ID), "testuser")
+	require.NoError(t, err)
+	require.NoError(t, connector.SetOrgAdmin(context.Background(), acmeUser.ID, true))
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/orgs/acme/users/", nil, acmeAuthorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var usersRes struct {
+		Users []struct {
+			FullName string `json:"full_name"`
+		} `json:"users"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &usersRes))
+	require.Len(t, usersRes.Users, 1)
+	require.Equal(t, "Acme User", usersRes.Users[0].FullName)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/users/", nil, defaultAuthorization)
+	validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/orgs/", nil, acmeAuthorization)
+	validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+}
+
+func TestOrgAdminInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	acme, err := connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(t, err)
+	acmeCtx := db.WithTenant(context.Background(), acme.ID)
+
+	_, err = connector.CreateAttributeDefinition(acmeCtx, db.CreateAttributeDefinitionParams{
+		Name:       "birthdate",
+		Type:       db.AttributeTypeDate,
+		Visibility: db.AttributeVisibilityPrivate,
+	})
+	require.NoError(t, err)
+
+	for i, userName := range []string{"acmeadmin", "acmeuser", "otheruser"} {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/", map[string]any{
+			"full_name":  "Acme User",
+			"phone":      fmt.Sprintf("9998999%d", i),
+			"user_name":  userName,
+			"password":   "secret",
+			"attributes": map[string]any{"birthdate": "1990-05-17"},
+		}, "")
+		require.Equal(t, http.StatusCreated, recorder.Code)
+	}
+
+	admin, err := connector.GetUser(acmeCtx, "acmeadmin")
+	require.NoError(t, err)
+	require.NoError(t, connector.SetOrgAdmin(acmeCtx, admin.ID, true))
+
+	login := func(userName string) string {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/orgs/acme/user/login", map[string]any{
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var loginRes map[string]string
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+		return bearerStr + loginRes["token"]
+	}
+
+	getAttributes := func(authorization string) map[string]any {
+		recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/orgs/acme/user/?user_name=acmeuser", nil, authorization)
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var userRes struct {
+			Attributes map[string]any `json:"attributes"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &userRes))
+
+		return userRes.Attributes
+	}
+
+	adminAuthorization := login("acmeadmin")
+	otherAuthorization := login("otheruser")
+
+	// Org admins see private attributes and delete users like global admins do
+	require.Equal(t, map[string]any{"birthdate": "1990-05-17"}, getAttributes(adminAuthorization))
+	require.Empty(t, getAttributes(otherAuthorization))
+
+	recorder := serveJSON(t, server.Router, http.MethodDelete, "/v1/orgs/acme/user/", map[string]any{
+		"user_name": "acmeuser",
+	}, otherAuthorization)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodDelete, "/v1/orgs/acme/user/", map[string]any{
+		"user_name": "acmeuser",
+	}, adminAuthorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+}
@@ -0,0 +1,400 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/notify"
+	mocknotify "github.com/ericbg27/RegistryAPI/notify/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrationEndpoints(t *testing.T) {
+	adminUser := db.User{
+		FullName:       "Admin",
+		Phone:          "91234567",
+		UserName:       "adminuser",
+		LoginToken:     "tokenadmin",
+		Admin:          true,
+		OrganizationID: db.DefaultOrganizationID,
+	}
+	adminUser.ID = 1
+
+	pendingUser := db.User{
+		FullName:           "Pending User",
+		Phone:              "91234569",
+		UserName:           "pendinguser",
+		Password:           "secret",
+		OrganizationID:     db.DefaultOrganizationID,
+		RegistrationStatus: db.RegistrationPending,
+	}
+	pendingUser.ID = 3
+
+	activeUser := pendingUser
+	activeUser.RegistrationStatus = db.RegistrationActive
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "List OK",
+			method: http.MethodGet,
+			url:    "/v1/registrations/",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				dbConnector.
+					EXPECT().
+					GetPendingRegistrations(gomock.Any(), gomock.Eq(time.Time{})).
+					Times(1).
+					Return([]db.User{pendingUser}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var registrationsRes struct {
+					Registrations []struct {
+						ID       uint   `json:"id"`
+						UserName string `json:"user_name"`
+					} `json:"registrations"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &registrationsRes))
+				require.Len(t, registrationsRes.Registrations, 1)
+				require.Equal(t, pendingUser.UserName, registrationsRes.Registrations[0].UserName)
+			},
+		},
+		{
+			name:   "Approve OK",
+			method: http.MethodPost,
+			url:    "/v1/registrations/3/approve",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(pendingUser.ID)).
+					Times(1).
+					Return(&pendingUser, nil)
+
+				dbConnector.
+					EXPECT().
+					ApproveRegistration(gomock.Any(), gomock.Eq(pendingUser.ID)).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "registration.approve", func(auditParams db.CreateAuditEventParams) {
+					require.JSONEq(t, `{"registration_status":"pending"}`, auditParams.Before)
+					require.JSONEq(t, `{"registration_status":"active"}`, auditParams.After)
+				})
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, notification notify.Notification) error {
+						require.Equal(t, pendingUser.UserName, notification.UserName)
+						require.Equal(t, "Your registration was approved", notification.Subject)
+
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Approve Not Pending",
+			method: http.MethodPost,
+			url:    "/v1/registrations/3/approve",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(pendingUser.ID)).
+					Times(1).
+					Return(&activeUser, nil)
+
+				dbConnector.
+					EXPECT().
+					ApproveRegistration(gomock.Any(), gomock.Any()).
+					Times(0)
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Conflict", "The registration of the user is not pending approval", http.StatusConflict)
+			},
+		},
+		{
+			name:   "Reject OK",
+			method: http.MethodPost,
+			url:    "/v1/registrations/3/reject",
+			body: gin.H{
+				"reason": "Unknown applicant",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(pendingUser.ID)).
+					Times(1).
+					Return(&pendingUser, nil)
+
+				dbConnector.
+					EXPECT().
+					RejectRegistration(gomock.Any(), gomock.Eq(pendingUser.ID), gomock.Eq("Unknown applicant")).
+					Times(1).
+					Return(nil)
+
+				expectAuditEvent(t, dbConnector, "registration.reject", func(auditParams db.CreateAuditEventParams) {
+					require.JSONEq(t, `{"registration_status":"rejected","registration_reason":"Unknown applicant"}`, auditParams.After)
+				})
+
+				sender.
+					EXPECT().
+					Send(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, notification notify.Notification) error {
+						require.Equal(t, "Your registration was rejected", notification.Subject)
+						require.Equal(t, "Reason: Unknown applicant", notification.Body)
+
+						return nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:   "Reject Without Reason",
+			method: http.MethodPost,
+			url:    "/v1/registrations/3/reject",
+			body:   gin.H{},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				dbConnector.
+					EXPECT().
+					RejectRegistration(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:   "Reject Not Found",
+			method: http.MethodPost,
+			url:    "/v1/registrations/9/reject",
+			body: gin.H{
+				"reason": "Unknown applicant",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, sender *mocknotify.MockSender) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserByID(gomock.Any(), gomock.Eq(uint(9))).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+			sender := mocknotify.NewMockSender(ctrl)
+
+			uuidToken, err := uuid.NewRandom()
+			require.NoError(t, err)
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(adminUser.LoginToken)).
+				AnyTimes().
+				Return(&token.Payload{
+					ID:        uuidToken,
+					Username:  adminUser.UserName,
+					TenantID:  adminUser.OrganizationID,
+					IssuedAt:  time.Now(),
+					ExpiredAt: time.Now().Add(time.Hour),
+				}, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+				AnyTimes().
+				Return(&adminUser, nil)
+
+			tc.buildStubs(dbConnector, sender)
+
+			server := NewTestServer(t, dbConnector, maker)
+			server.Sender = sender
+
+			recorder := serveJSON(t, server.Router, tc.method, tc.url, tc.body, bearerStr+adminUser.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestRegistrationsInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+	server.Config.RegistrationApproval = true
+
+	sender := &recordingSender{}
+	server.Sender = sender
+
+	register := func(i int) {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+			"full_name": fmt.Sprintf("Test User %d", i),
+			"phone":     fmt.Sprintf("9998999%d", i),
+			"user_name": fmt.Sprintf("testuser%d", i),
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusAccepted, recorder.Code)
+	}
+
+	login := func(i int) *httptest.ResponseRecorder {
+		return serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+			"user_name": fmt.Sprintf("testuser%d", i),
+			"password":  "secret",
+		}, "")
+	}
+
+	for i := 0; i < 3; i++ {
+		register(i)
+	}
+
+	// Pending users cannot log in until an admin approves them
+	validateErrorResponse(t, login(0), "Forbidden", "The registration of the user has not been approved", http.StatusForbidden)
+
+	admin, err := connector.GetUser(context.Background(), "testuser0")
+	require.NoError(t, err)
+	require.NoError(t, connector.ApproveRegistration(context.Background(), admin.ID))
+	require.NoError(t, connector.SetOrgAdmin(context.Background(), admin.ID, true))
+
+	recorder := login(0)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+	authorization := bearerStr + loginRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/registrations/", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var registrationsRes struct {
+		Registrations []struct {
+			ID uint `json:"id"`
+		} `json:"registrations"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &registrationsRes))
+	require.Len(t, registrationsRes.Registrations, 2)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, fmt.Sprintf("/v1/registrations/%d/approve", registrationsRes.Registrations[0].ID), nil, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, "Your registration was approved", sender.notifications[len(sender.notifications)-1].Subject)
+
+	require.Equal(t, http.StatusOK, login(1).Code)
+
+	// Stale registrations are rejected and their users notified
+	expired, err := server.ExpireRegistrations(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, expired)
+
+	expired, err = server.ExpireRegistrations(context.Background(), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+	require.Equal(t, "testuser2", sender.notifications[len(sender.notifications)-1].UserName)
+	require.Equal(t, "Your registration was rejected", sender.notifications[len(sender.notifications)-1].Subject)
+
+	require.Equal(t, http.StatusNotFound, login(2).Code)
+
+	// The rejected username can be registered again
+	register(2)
+}
+
+func TestExpireRegistrationsTenant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pendingUser := db.User{
+		FullName:           "Pending User",
+		Phone:              "91234569",
+		UserName:           "pendinguser",
+		OrganizationID:     2,
+		RegistrationStatus: db.RegistrationPending,
+	}
+	pendingUser.ID = 3
+
+	dbConnector := mockdb.NewMockDBConnector(ctrl)
+	server := NewTestServer(t, dbConnector, mocktoken.NewMockMaker(ctrl))
+	server.Sender = &recordingSender{}
+
+	dbConnector.
+		EXPECT().
+		GetPendingRegistrations(gomock.Any(), gomock.Any()).
+		Times(1).
+		Return([]db.User{pendingUser}, nil)
+
+	stubTx(dbConnector, 1)
+
+	// The rejection and its audit event are both written to the organization of the user
+	dbConnector.
+		EXPECT().
+		RejectRegistration(gomock.Any(), gomock.Eq(pendingUser.ID), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, id uint, reason string) error {
+			require.Equal(t, pendingUser.OrganizationID, db.TenantFromContext(ctx))
+
+			return nil
+		})
+
+	dbConnector.
+		EXPECT().
+		CreateAuditEvent(gomock.Any(), gomock.Any()).
+		Times(1).
+		DoAndReturn(func(ctx context.Context, auditParams db.CreateAuditEventParams) (*db.AuditEvent, error) {
+			require.Equal(t, pendingUser.OrganizationID, db.TenantFromContext(ctx))
+			require.Equal(t, "registration.expire", auditParams.Action)
+
+			return &db.AuditEvent{}, nil
+		})
+
+	expired, err := server.ExpireRegistrations(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+}
@@ -0,0 +1,221 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type searchUsersBody struct {
+	Users []struct {
+		FullName   string  `json:"full_name"`
+		UserName   string  `json:"user_name"`
+		Rank       float64 `json:"rank"`
+		Highlights map[string][]struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		} `json:"highlights"`
+	} `json:"users"`
+}
+
+func TestSearchUsers(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+
+	nonAdminUser := db.User{
+		FullName:   "Non Admin",
+		Phone:      "91234568",
+		UserName:   "nonadminuser",
+		Password:   "secretnonadmin",
+		LoginToken: "tokennonadmin",
+	}
+
+	newPayload := func(userName string) *token.Payload {
+		tokenID, err := uuid.NewRandom()
+		require.NoError(t, err)
+
+		return &token.Payload{
+			ID:        tokenID,
+			Username:  userName,
+			IssuedAt:  time.Now(),
+			ExpiredAt: time.Now().Add(time.Hour),
+		}
+	}
+
+	results := []db.UserSearchResult{
+		{
+			User: db.User{FullName: "Jöhn Smith", Phone: "99999991", UserName: "jsmith"},
+			Rank: 0.9,
+		},
+		{
+			User: db.User{FullName: "Jon Smyth", Phone: "99999990", UserName: "jonsmyth"},
+			Rank: 0.4,
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		user          db.User
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: url.Values{"q": {"jöhn SMITH"}},
+			user:  adminUser,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				args := db.SearchUsersParams{
+					Query: "jöhn SMITH",
+					Limit: 10,
+				}
+
+				dbConnector.
+					EXPECT().
+					SearchUsers(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(results, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData searchUsersBody
+				err := json.Unmarshal(recorder.Body.Bytes(), &bodyData)
+				require.NoError(t, err)
+				require.Equal(t, 2, len(bodyData.Users))
+
+				first := bodyData.Users[0]
+				require.Equal(t, "Jöhn Smith", first.FullName)
+				require.Equal(t, 0.9, first.Rank)
+				require.Equal(t, 2, len(first.Highlights["full_name"]))
+				require.Equal(t, 0, first.Highlights["full_name"][0].Start)
+				require.Equal(t, 4, first.Highlights["full_name"][0].End)
+				require.Equal(t, 5, first.Highlights["full_name"][1].Start)
+				require.Equal(t, 10, first.Highlights["full_name"][1].End)
+				require.Equal(t, 1, len(first.Highlights["user_name"]))
+				require.Equal(t, 1, first.Highlights["user_name"][0].Start)
+				require.Equal(t, 6, first.Highlights["user_name"][0].End)
+
+				second := bodyData.Users[1]
+				require.Empty(t, second.Highlights["full_name"])
+				require.Empty(t, second.Highlights["user_name"])
+			},
+		},
+		{
+			name:  "Custom Limit",
+			query: url.Values{"q": {"smith"}, "limit": {"1"}},
+			user:  adminUser,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				args := db.SearchUsersParams{
+					Query: "smith",
+					Limit: 1,
+				}
+
+				dbConnector.
+					EXPECT().
+					SearchUsers(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(results[:1], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "Missing Query",
+			query: url.Values{},
+			user:  adminUser,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					SearchUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Limit Too Large",
+			query: url.Values{"q": {"smith"}, "limit": {"101"}},
+			user:  adminUser,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					SearchUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Page size cannot be greater than 100", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Non Admin User",
+			query: url.Values{"q": {"smith"}},
+			user:  nonAdminUser,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					SearchUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Forbidden", "User is not allowed to access this resource", http.StatusForbidden)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(tc.user.LoginToken)).
+				Times(1).
+				Return(newPayload(tc.user.UserName), nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(tc.user.UserName)).
+				Times(1).
+				Return(&tc.user, nil)
+
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/v1/users/search?"+tc.query.Encode(), nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+tc.user.LoginToken)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var verificationCodeRegexp = regexp.MustCompile(`\b\d{6}\b`)
+
+func TestChangeUserName(t *testing.T) {
+	user := db.User{
+		FullName:       "Test User",
+		Phone:          "99989992",
+		UserName:       "testuser123",
+		Password:       "secret",
+		LoginToken:     "token",
+		OrganizationID: db.DefaultOrganizationID,
+		Version:        3,
+	}
+	user.ID = 1
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		buildStubs    func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"user_name": "renamed123",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserChanges(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.UserChange{}, nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserName(gomock.Any(), gomock.Eq(user.ID), gomock.Eq("renamed123")).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					CreateUserChange(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, changeParams db.CreateUserChangeParams) (*db.UserChange, error) {
+						require.Equal(t, db.UserChangeUserName, changeParams.Field)
+						require.Equal(t, user.UserName, changeParams.OldValue)
+						require.Equal(t, "renamed123", changeParams.NewValue)
+						require.NotNil(t, changeParams.ReservedUntil)
+						require.True(t, changeParams.ReservedUntil.After(time.Now()))
+
+						return &db.UserChange{ID: 1}, nil
+					})
+
+				// The new token is stored along with the version check, so that the user never
+				// goes without a token
+				gomock.InOrder(
+					dbConnector.
+						EXPECT().
+						GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+						Times(1).
+						Return([]db.Group{}, nil),
+					maker.
+						EXPECT().
+						CreateToken(gomock.Eq("renamed123"), gomock.Any(), gomock.Any()).
+						Times(1).
+						Return("newtoken", nil),
+					dbConnector.
+						EXPECT().
+						UpdateUser(gomock.Any(), gomock.Eq(db.UpdateUserParams{
+							ID:         user.ID,
+							FullName:   user.FullName,
+							Phone:      user.Phone,
+							Password:   user.Password,
+							LoginToken: "newtoken",
+							Version:    user.Version,
+						})).
+						Times(1).
+						Return(nil),
+				)
+
+				expectAuditEvent(t, dbConnector, "user.user_name_change", func(auditParams db.CreateAuditEventParams) {
+					require.JSONEq(t, `{"user_name":"testuser123","login_token":"[REDACTED]"}`, auditParams.Before)
+					require.JSONEq(t, `{"user_name":"renamed123","login_token":"[REDACTED]"}`, auditParams.After)
+				})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var loginRes map[string]string
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+				require.Equal(t, "newtoken", loginRes["token"])
+			},
+		},
+		{
+			name: "Concurrent Update",
+			body: gin.H{
+				"user_name": "renamed123",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserChanges(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.UserChange{}, nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserName(gomock.Any(), gomock.Eq(user.ID), gomock.Eq("renamed123")).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					CreateUserChange(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.UserChange{ID: 1}, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.Group{}, nil)
+
+				// The token created for the renamed user is discarded along with the transaction
+				maker.
+					EXPECT().
+					CreateToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return("newtoken", nil)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&db.VersionConflictError{})
+
+				dbConnector.
+					EXPECT().
+					CreateAuditEvent(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Conflict", "The user was modified since it was read. Get it again and retry", http.StatusConflict)
+			},
+		},
+		{
+			name: "Cooldown",
+			body: gin.H{
+				"user_name": "renamed123",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserChanges(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.UserChange{{Field: db.UserChangeUserName, CreatedAt: time.Now().Add(-time.Hour)}}, nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserName(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "Conflict", "The username was changed too recently. Try again later", http.StatusConflict)
+			},
+		},
+		{
+			name: "Reserved",
+			body: gin.H{
+				"user_name": "formeruser",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserChanges(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.UserChange{}, nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserName(gomock.Any(), gomock.Eq(user.ID), gomock.Eq("formeruser")).
+					Times(1).
+					Return(&db.BadInputError{Err: fmt.Errorf("The provided username is reserved")})
+
+				dbConnector.
+					EXPECT().
+					CreateUserChange(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "AlreadyExists", "The provided username is reserved", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Same Username",
+			body: gin.H{
+				"user_name": user.UserName,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					WithTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The new username must differ from the current one", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Blocked Username",
+			body: gin.H{
+				"user_name": "sysadm1n",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					WithTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The provided username is not allowed", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Invalid Username",
+			body: gin.H{
+				"user_name": "bad name",
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					WithTx(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			uuidToken, err := uuid.NewRandom()
+			require.NoError(t, err)
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(user.LoginToken)).
+				AnyTimes().
+				Return(&token.Payload{
+					ID:        uuidToken,
+					Username:  user.UserName,
+					TenantID:  user.OrganizationID,
+					IssuedAt:  time.Now(),
+					ExpiredAt: time.Now().Add(time.Hour),
+				}, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+				AnyTimes().
+				Return(&user, nil)
+
+			tc.buildStubs(dbConnector, maker)
+
+			server := NewTestServer(t, dbConnector, maker)
+
+			recorder := serveJSON(t, server.Router, http.MethodPut, "/v1/user/user-name", tc.body, bearerStr+user.LoginToken)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestUserChangesInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	sender := &recordingSender{}
+	server.Sender = sender
+
+	createUser := func(userName string, phone string) {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+			"full_name": "Test User",
+			"phone":     phone,
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusCreated, recorder.Code)
+	}
+
+	login := func(userName string) string {
+		recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var loginRes map[string]string
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+		return "Bearer " + loginRes["token"]
+	}
+
+	createUser("testuser", "99989992")
+	authorization := login("testuser")
+
+	recorder := serveJSON(t, server.Router, http.MethodPut, "/v1/user/user-name", map[string]any{
+		"user_name": "renamed",
+	}, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var renameRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &renameRes))
+
+	// The token issued for the former username stops working
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/history", nil, authorization)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	authorization = "Bearer " + renameRes["token"]
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/user-name", map[string]any{
+		"user_name": "renamedagain",
+	}, authorization)
+	validateErrorResponse(t, recorder, "Conflict", "The username was changed too recently. Try again later", http.StatusConflict)
+
+	// Nobody else can take the former username while it is reserved
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Other User",
+		"phone":     "99989994",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	validateErrorResponse(t, recorder, "AlreadyExists", "The provided username is reserved", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPut, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989993",
+	}, authorization)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	require.Len(t, sender.notifications, 1)
+	require.Equal(t, "99989993", sender.notifications[0].Phone)
+
+	code := verificationCodeRegexp.FindString(sender.notifications[0].Body)
+	require.NotEmpty(t, code)
+
+	// The code is hashed with a key derived for phone verification, not with the token key itself
+	renamed, err := connector.GetUser(context.Background(), "renamed")
+	require.NoError(t, err)
+
+	verification, err := connector.GetPhoneVerification(context.Background(), renamed.ID)
+	require.NoError(t, err)
+	require.NotEqual(t, util.HashVerificationCode([]byte(server.Config.TokenSymmetricKey), code), verification.CodeHash)
+
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/phone/verify", map[string]any{
+		"code": wrongCode,
+	}, authorization)
+	validateErrorResponse(t, recorder, "BadRequest", "Wrong verification code", http.StatusBadRequest)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/phone/verify", map[string]any{
+		"code": code,
+	}, authorization)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	user, err := connector.GetUser(context.Background(), "renamed")
+	require.NoError(t, err)
+	require.Equal(t, "99989993", user.Phone)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/phone/verify", map[string]any{
+		"code": code,
+	}, authorization)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodGet, "/v1/user/history", nil, authorization)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var changesRes struct {
+		Changes []struct {
+			Field         string     `json:"field"`
+			OldValue      string     `json:"old_value"`
+			NewValue      string     `json:"new_value"`
+			ReservedUntil *time.Time `json:"reserved_until"`
+		} `json:"changes"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &changesRes))
+	require.Len(t, changesRes.Changes, 2)
+	require.Equal(t, "user_name", changesRes.Changes[0].Field)
+	require.Equal(t, "testuser", changesRes.Changes[0].OldValue)
+	require.NotNil(t, changesRes.Changes[0].ReservedUntil)
+	require.Equal(t, "phone", changesRes.Changes[1].Field)
+	require.Equal(t, "99989993", changesRes.Changes[1].NewValue)
+	require.Nil(t, changesRes.Changes[1].ReservedUntil)
+}
@@ -0,0 +1,172 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ericbg27/RegistryAPI/api"
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckUserNameAvailability(t *testing.T) {
+	testCases := []struct {
+		name       string
+		query      string
+		buildStubs func(dbConnector *mockdb.MockDBConnector)
+		available  bool
+		reason     string
+	}{
+		{
+			name:  "Available",
+			query: "?user_name=newuser1",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq("newuser1")).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+
+				dbConnector.
+					EXPECT().
+					IsUserNameReserved(gomock.Any(), gomock.Eq("newuser1"), gomock.Eq(uint(0))).
+					Times(1).
+					Return(false, nil)
+			},
+			available: true,
+		},
+		{
+			name:  "Taken",
+			query: "?user_name=testuser",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq("testuser")).
+					Times(1).
+					Return(&db.User{UserName: "testuser"}, nil)
+			},
+			reason: "An user with the provided username already exists",
+		},
+		{
+			name:  "Reserved",
+			query: "?user_name=formeruser",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq("formeruser")).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+
+				dbConnector.
+					EXPECT().
+					IsUserNameReserved(gomock.Any(), gomock.Eq("formeruser"), gomock.Eq(uint(0))).
+					Times(1).
+					Return(true, nil)
+			},
+			reason: "The provided username is reserved",
+		},
+		{
+			name:  "Blocked",
+			query: "?user_name=Adm1nistrator",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			reason: "The provided username is not allowed",
+		},
+		{
+			name:  "Invalid",
+			query: "?user_name=abc",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			reason: "The username must have at least 6 letters or digits",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, mocktoken.NewMockMaker(ctrl))
+
+			recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/user/available"+tc.query, nil, "")
+			require.Equal(t, http.StatusOK, recorder.Code)
+
+			var availabilityRes struct {
+				UserName  string `json:"user_name"`
+				Available bool   `json:"available"`
+				Reason    string `json:"reason"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &availabilityRes))
+			require.Equal(t, tc.available, availabilityRes.Available)
+			require.Equal(t, tc.reason, availabilityRes.Reason)
+		})
+	}
+
+	t.Run("Missing Username", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		server := NewTestServer(t, mockdb.NewMockDBConnector(ctrl), mocktoken.NewMockMaker(ctrl))
+
+		recorder := serveJSON(t, server.Router, http.MethodGet, "/v1/user/available", nil, "")
+		validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+	})
+}
+
+func TestUserNameBlocklistInMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("prefix:staff\nregex:crap\n"), 0o600))
+
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	server, err := api.NewServer(db.NewMemoryConnector(), util.Config{
+		TokenSymmetricKey: util.RandomString(32),
+		UserNameBlocklist: path,
+	}, maker)
+	require.NoError(t, err)
+
+	register := func(userName string) *httptest.ResponseRecorder {
+		return serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+			"full_name": "Test User",
+			"phone":     "99989992",
+			"user_name": userName,
+			"password":  "secret",
+		}, "")
+	}
+
+	for _, userName := range []string{"administrator", "SUPPORT", "5taffmember", "bigcrapname"} {
+		recorder := register(userName)
+		validateErrorResponse(t, recorder, "BadRequest", "The provided username is not allowed", http.StatusBadRequest)
+	}
+
+	recorder := register("testuser")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	_, err = api.NewServer(db.NewMemoryConnector(), util.Config{
+		UserNameBlocklist: filepath.Join(t.TempDir(), "missing.txt"),
+	}, maker)
+	require.Error(t, err)
+}
@@ -0,0 +1,340 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
+	"github.com/ericbg27/RegistryAPI/token"
+	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+func TestPatchUser(t *testing.T) {
+	user := db.User{
+		FullName:   "Test User",
+		Phone:      "99989992",
+		UserName:   "testuser123",
+		Password:   "secret",
+		LoginToken: "token",
+		Attributes: db.Attributes{"department": "sales", "team": "blue", "floor": float64(3)},
+		Version:    3,
+	}
+	user.ID = 1
+
+	department := db.AttributeDefinition{
+		ID:         1,
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Visibility: db.AttributeVisibilityPublic,
+	}
+
+	team := db.AttributeDefinition{
+		ID:         2,
+		Name:       "team",
+		Type:       db.AttributeTypeString,
+		Visibility: db.AttributeVisibilityPublic,
+	}
+
+	uuidToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	tokenPayload := &token.Payload{
+		ID:        uuidToken,
+		Username:  user.UserName,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(time.Hour),
+	}
+
+	testCases := []struct {
+		name          string
+		body          string
+		contentType   string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:        "OK",
+			body:        `{"full_name": "Patched User"}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				expectAuditEvent(t, dbConnector, "user.update", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, `{"full_name":"Test User"}`, auditParams.Before)
+					require.Equal(t, `{"full_name":"Patched User"}`, auditParams.After)
+				})
+
+				// The phone and the attributes left out of the patch are kept
+				arg := db.UpdateUserParams{
+					ID:         user.ID,
+					FullName:   "Patched User",
+					Phone:      user.Phone,
+					Password:   user.Password,
+					LoginToken: user.LoginToken,
+					Version:    user.Version,
+				}
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), arg).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserAttributes(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.Regexp(t, `^"4-[0-9a-f]{16}"$`, recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:        "Merge Attributes",
+			body:        `{"attributes": {"department": "support", "team": null}}`,
+			contentType: "application/json",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				// The definitions are read for the current attributes, and again to check the
+				// merged ones. The floor, which is no longer defined, is dropped
+				stubTx(dbConnector, 1)
+				stubAttributeDefinitions(dbConnector, department, team)
+				stubAttributeDefinitions(dbConnector, department, team)
+				expectAuditEvent(t, dbConnector, "user.update", nil)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					SetUserAttributes(gomock.Any(), user.ID, db.Attributes{"department": "support"}).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+			},
+		},
+		{
+			name:        "Unchanged",
+			body:        `{"full_name": "Test User", "attributes": {"team": "blue"}}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				dbConnector.
+					EXPECT().
+					WithTx(gomock.Any(), gomock.Any()).
+					Times(0)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+
+				dbConnector.
+					EXPECT().
+					CreateAuditEvent(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNoContent, recorder.Code)
+				require.Regexp(t, `^"3-[0-9a-f]{16}"$`, recorder.Header().Get("ETag"))
+			},
+		},
+		{
+			name:        "Remove Full Name",
+			body:        `{"full_name": null}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The full_name must be a string", http.StatusBadRequest)
+			},
+		},
+		{
+			name:        "Invalid Phone",
+			body:        `{"full_name": "Patched User", "phone": "9999999"}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The phone must be a valid phone number", http.StatusBadRequest)
+			},
+		},
+		{
+			name:        "Username",
+			body:        `{"user_name": "renamed123"}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The user_name is changed with PUT /v1/user/user-name", http.StatusBadRequest)
+			},
+		},
+		{
+			name:        "Read Only Field",
+			body:        `{"password": "newsecret"}`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubAttributeDefinitions(dbConnector, department, team)
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The password cannot be changed", http.StatusBadRequest)
+			},
+		},
+		{
+			name:        "Not An Object",
+			body:        `["full_name"]`,
+			contentType: mergePatchContentType,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The merge patch must be a JSON object", http.StatusBadRequest)
+			},
+		},
+		{
+			name:        "Unsupported Content Type",
+			body:        `{"full_name": "Patched User"}`,
+			contentType: "text/plain",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "UnsupportedMediaType", "Send the merge patch as application/merge-patch+json", http.StatusUnsupportedMediaType)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			maker.
+				EXPECT().
+				VerifyToken(user.LoginToken).
+				Times(1).
+				Return(tokenPayload, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+				Times(1).
+				Return(&user, nil)
+
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPatch, "/v1/user/", strings.NewReader(tc.body))
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+user.LoginToken)
+			request.Header.Set("Content-Type", tc.contentType)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestPatchUserInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+	server.Sender = &recordingSender{}
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Test User",
+		"phone":     "99989992",
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/user/login", map[string]any{
+		"user_name": "testuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var loginRes map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &loginRes))
+
+	authorization := "Bearer " + loginRes["token"]
+
+	patch := func(body map[string]any) *httptest.ResponseRecorder {
+		return serveWithHeaders(t, server.Router, http.MethodPatch, "/v1/user/", body, map[string]string{
+			"Authorization": authorization,
+			"Content-Type":  mergePatchContentType,
+		})
+	}
+
+	recorder = patch(map[string]any{"full_name": "Patched User"})
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+
+	// Changing only the phone keeps the full name, and the phone waits for its verification
+	recorder = patch(map[string]any{"phone": "99989993"})
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+
+	user, err := connector.GetUser(context.Background(), "testuser")
+	require.NoError(t, err)
+	require.Equal(t, "Patched User", user.FullName)
+	require.Equal(t, "99989992", user.Phone)
+	require.Equal(t, uint(3), user.Version)
+}
@@ -2,6 +2,7 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,6 +16,7 @@ import (
 	mockdb "github.com/ericbg27/RegistryAPI/db/mock"
 	"github.com/ericbg27/RegistryAPI/token"
 	mocktoken "github.com/ericbg27/RegistryAPI/token/mock"
+	"github.com/ericbg27/RegistryAPI/util"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
@@ -46,16 +48,28 @@ func TestCreateUser(t *testing.T) {
 				"password":  user.Password,
 			},
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubAttributeDefinitions(dbConnector)
+
+				expectAuditEvent(t, dbConnector, "user.create", func(auditParams db.CreateAuditEventParams) {
+					require.Nil(t, auditParams.ActorID)
+					require.Equal(t, user.UserName, auditParams.TargetUserName)
+					require.Empty(t, auditParams.Before)
+					require.Contains(t, auditParams.After, `"password":"[REDACTED]"`)
+					require.NotContains(t, auditParams.After, user.Password)
+				})
+
 				arg := db.CreateUserParams{
-					FullName: user.FullName,
-					Phone:    user.Phone,
-					UserName: user.UserName,
-					Password: user.Password,
+					FullName:   user.FullName,
+					Phone:      user.Phone,
+					UserName:   user.UserName,
+					Password:   user.Password,
+					Attributes: db.Attributes{},
 				}
 
 				dbConnector.
 					EXPECT().
-					CreateUser(gomock.Eq(arg)).
+					CreateUser(gomock.Any(), gomock.Eq(arg)).
 					Times(1).
 					Return(&user, nil)
 			},
@@ -87,7 +101,7 @@ func TestCreateUser(t *testing.T) {
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
 				dbConnector.
 					EXPECT().
-					CreateUser(gomock.Any()).
+					CreateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -103,16 +117,20 @@ func TestCreateUser(t *testing.T) {
 				"password":  user.Password,
 			},
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubAttributeDefinitions(dbConnector)
+
 				arg := db.CreateUserParams{
-					FullName: user.FullName,
-					Phone:    user.Phone,
-					UserName: user.UserName,
-					Password: user.Password,
+					FullName:   user.FullName,
+					Phone:      user.Phone,
+					UserName:   user.UserName,
+					Password:   user.Password,
+					Attributes: db.Attributes{},
 				}
 
 				dbConnector.
 					EXPECT().
-					CreateUser(arg).
+					CreateUser(gomock.Any(), arg).
 					Times(1).
 					Return(nil, &db.BadInputError{
 						Err: fmt.Errorf("An user with the provided information already exists"),
@@ -131,16 +149,20 @@ func TestCreateUser(t *testing.T) {
 				"password":  user.Password,
 			},
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				stubTx(dbConnector, 1)
+				stubAttributeDefinitions(dbConnector)
+
 				arg := db.CreateUserParams{
-					FullName: user.FullName,
-					Phone:    user.Phone,
-					UserName: user.UserName,
-					Password: user.Password,
+					FullName:   user.FullName,
+					Phone:      user.Phone,
+					UserName:   user.UserName,
+					Password:   user.Password,
+					Attributes: db.Attributes{},
 				}
 
 				dbConnector.
 					EXPECT().
-					CreateUser(arg).
+					CreateUser(gomock.Any(), arg).
 					Times(1).
 					Return(nil, fmt.Errorf("Error executing query"))
 			},
@@ -159,7 +181,7 @@ func TestCreateUser(t *testing.T) {
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
 				dbConnector.
 					EXPECT().
-					CreateUser(gomock.Any()).
+					CreateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -177,7 +199,7 @@ func TestCreateUser(t *testing.T) {
 			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
 				dbConnector.
 					EXPECT().
-					CreateUser(gomock.Any()).
+					CreateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -261,7 +283,7 @@ func TestGetUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(2).
 					Return(&user, nil)
 			},
@@ -310,7 +332,7 @@ func TestGetUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Any()).
+					GetUser(gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(&user, nil)
 			},
@@ -333,7 +355,7 @@ func TestGetUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 			},
@@ -356,7 +378,7 @@ func TestGetUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Any()).
+					GetUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -401,6 +423,15 @@ func TestGetUser(t *testing.T) {
 	}
 }
 
+type getUsersPageBody struct {
+	Users []struct {
+		UserName string `json:"user_name"`
+	} `json:"users"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Total      *int64 `json:"total"`
+}
+
 func TestGetUsers(t *testing.T) {
 	adminUser := db.User{
 		FullName:   "Admin",
@@ -445,6 +476,8 @@ func TestGetUsers(t *testing.T) {
 		ExpiredAt: expiredAt,
 	}
 
+	createdAfter := now.Add(-time.Hour).Truncate(time.Second).UTC()
+
 	users := []db.User{}
 
 	for i := 0; i < 5; i++ {
@@ -481,7 +514,7 @@ func TestGetUsers(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(adminUser.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
 					Times(1).
 					Return(&adminUser, nil)
 
@@ -498,7 +531,7 @@ func TestGetUsers(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUsers(gomock.Eq(args)).
+					GetUsers(gomock.Any(), gomock.Eq(args)).
 					Times(1).
 					Return(users[minIndex:maxIndex], nil)
 			},
@@ -547,6 +580,119 @@ func TestGetUsers(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "Filters And Sorting",
+			body: gin.H{
+				"offset":        2,
+				"user_name":     "test",
+				"full_name":     "Test User",
+				"phone":         "99989990",
+				"admin":         false,
+				"created_after": createdAfter.Format(time.RFC3339),
+				"deleted":       "include",
+				"sort_by":       "created_at",
+				"order":         "desc",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(gomock.Eq(adminUser.LoginToken)).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				admin := false
+				args := db.GetUsersParams{
+					Offset:         3,
+					UserNamePrefix: "test",
+					FullNamePrefix: "Test User",
+					Phone:          "99989990",
+					Admin:          &admin,
+					CreatedAfter:   &createdAfter,
+					Deleted:        db.DeletedInclude,
+					SortBy:         "created_at",
+					SortDesc:       true,
+				}
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(users[:1], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData getUsersPageBody
+				err := json.Unmarshal(recorder.Body.Bytes(), &bodyData)
+				require.NoError(t, err)
+				require.Equal(t, 1, len(bodyData.Users))
+				require.Equal(t, users[0].UserName, bodyData.Users[0].UserName)
+			},
+		},
+		{
+			name: "Invalid Sort Field",
+			body: gin.H{
+				"sort_by": "password",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(gomock.Eq(adminUser.LoginToken)).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
+		{
+			name: "Invalid Order",
+			body: gin.H{
+				"sort_by": "user_name",
+				"order":   "sideways",
+			},
+			token: adminUser.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				maker.
+					EXPECT().
+					VerifyToken(gomock.Eq(adminUser.LoginToken)).
+					Times(1).
+					Return(adminTokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+					Times(1).
+					Return(&adminUser, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
+			},
+		},
 		{
 			name: "Non Admin User Token",
 			body: gin.H{
@@ -563,13 +709,13 @@ func TestGetUsers(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(nonAdminUser.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(nonAdminUser.UserName)).
 					Times(1).
 					Return(&nonAdminUser, nil)
 
 				dbConnector.
 					EXPECT().
-					GetUsers(gomock.Any).
+					GetUsers(gomock.Any(), gomock.Any).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -598,10 +744,7 @@ func TestGetUsers(t *testing.T) {
 
 			q := request.URL.Query()
 			for k, v := range tc.body {
-				value, ok := v.(int)
-				require.Equal(t, true, ok)
-
-				q.Add(k, strconv.Itoa(value))
+				q.Add(k, fmt.Sprint(v))
 			}
 
 			request.URL.RawQuery = q.Encode()
@@ -614,6 +757,219 @@ func TestGetUsers(t *testing.T) {
 	}
 }
 
+func TestGetUsersPagination(t *testing.T) {
+	adminUser := db.User{
+		FullName:   "Admin",
+		Phone:      "91234567",
+		UserName:   "adminuser",
+		Password:   "secretadmin",
+		LoginToken: "tokenadmin",
+		Admin:      true,
+	}
+
+	uuidAdminToken, err := uuid.NewRandom()
+	require.NoError(t, err)
+
+	adminTokenPayload := &token.Payload{
+		ID:        uuidAdminToken,
+		Username:  adminUser.UserName,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(time.Hour),
+	}
+
+	users := []db.User{}
+	for i := 0; i < 5; i++ {
+		user := db.User{
+			FullName: "Test User " + strconv.Itoa(i),
+			Phone:    "9998999" + strconv.Itoa(i),
+			UserName: "testuser" + strconv.Itoa(i),
+		}
+		user.ID = uint(i + 1)
+
+		users = append(users, user)
+	}
+
+	cursor := db.NewUsersCursor(users[1], "", false, false)
+	total := int64(len(users))
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(dbConnector *mockdb.MockDBConnector)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "First Page",
+			query: "limit=2&user_name=test",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				args := db.GetUsersParams{
+					Offset:         3,
+					UserNamePrefix: "test",
+				}
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(users[:3], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData getUsersPageBody
+				err := json.Unmarshal(recorder.Body.Bytes(), &bodyData)
+				require.NoError(t, err)
+				require.Equal(t, 2, len(bodyData.Users))
+				require.Equal(t, users[1].UserName, bodyData.Users[1].UserName)
+				require.Equal(t, cursor.Encode(), bodyData.NextCursor)
+				require.Empty(t, bodyData.PrevCursor)
+				require.Nil(t, bodyData.Total)
+
+				expectedLink := fmt.Sprintf(`</v1/users/?cursor=%s&limit=2&user_name=test>; rel="next"`, cursor.Encode())
+				require.Equal(t, expectedLink, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name:  "Last Page",
+			query: "limit=2&cursor=" + cursor.Encode(),
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				decoded, err := db.DecodeUsersCursor(cursor.Encode())
+				require.NoError(t, err)
+
+				args := db.GetUsersParams{
+					Offset: 3,
+					Cursor: decoded,
+				}
+
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Eq(args)).
+					Times(1).
+					Return(users[2:4], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData getUsersPageBody
+				err := json.Unmarshal(recorder.Body.Bytes(), &bodyData)
+				require.NoError(t, err)
+				require.Equal(t, 2, len(bodyData.Users))
+				require.Empty(t, bodyData.NextCursor)
+
+				prevCursor := db.NewUsersCursor(users[2], "", false, true).Encode()
+				require.Equal(t, prevCursor, bodyData.PrevCursor)
+
+				expectedLink := fmt.Sprintf(`</v1/users/?cursor=%s&limit=2>; rel="prev"`, prevCursor)
+				require.Equal(t, expectedLink, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name:  "With Total",
+			query: "limit=5&with_total=true",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(users, nil)
+
+				dbConnector.
+					EXPECT().
+					CountUsers(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(total, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var bodyData getUsersPageBody
+				err := json.Unmarshal(recorder.Body.Bytes(), &bodyData)
+				require.NoError(t, err)
+				require.Equal(t, len(users), len(bodyData.Users))
+				require.Equal(t, &total, bodyData.Total)
+				require.Empty(t, recorder.Header().Get("Link"))
+			},
+		},
+		{
+			name:  "Invalid Cursor",
+			query: "cursor=invalid",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Invalid pagination cursor", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Cursor Sort Mismatch",
+			query: "sort_by=phone&cursor=" + cursor.Encode(),
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, &db.BadInputError{Err: fmt.Errorf("The pagination cursor does not match the requested sort order")})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "The pagination cursor does not match the requested sort order", http.StatusBadRequest)
+			},
+		},
+		{
+			name:  "Page Size Too Large",
+			query: "limit=101",
+			buildStubs: func(dbConnector *mockdb.MockDBConnector) {
+				dbConnector.
+					EXPECT().
+					GetUsers(gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "BadRequest", "Page size cannot be greater than 100", http.StatusBadRequest)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dbConnector := mockdb.NewMockDBConnector(ctrl)
+			maker := mocktoken.NewMockMaker(ctrl)
+
+			maker.
+				EXPECT().
+				VerifyToken(gomock.Eq(adminUser.LoginToken)).
+				Times(1).
+				Return(adminTokenPayload, nil)
+
+			dbConnector.
+				EXPECT().
+				GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
+				Times(1).
+				Return(&adminUser, nil)
+
+			tc.buildStubs(dbConnector)
+
+			server := NewTestServer(t, dbConnector, maker)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/v1/users/?"+tc.query, nil)
+			require.NoError(t, err)
+
+			request.Header.Set("Authorization", bearerStr+adminUser.LoginToken)
+
+			server.Router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
 func TestLoginUser(t *testing.T) {
 	user := db.User{
 		FullName:   "Test User",
@@ -636,29 +992,61 @@ func TestLoginUser(t *testing.T) {
 				"password":  user.Password,
 			},
 			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					GetLoginAttempts(gomock.Any(), gomock.Any()).
+					Times(2).
+					Return([]db.LoginAttempt{}, nil)
+
+				dbConnector.
+					EXPECT().
+					CreateLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, loginParams db.CreateLoginAttemptParams) (*db.LoginAttempt, error) {
+						require.True(t, loginParams.Success)
+						require.False(t, loginParams.NewDevice)
+						require.Equal(t, user.UserName, loginParams.UserName)
+						require.NotNil(t, loginParams.UserID)
+						require.Empty(t, loginParams.FailureReason)
+
+						return &db.LoginAttempt{Success: true}, nil
+					})
+
+				expectAuditEvent(t, dbConnector, "user.login", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, user.UserName, auditParams.ActorUserName)
+					require.Equal(t, user.UserName, auditParams.TargetUserName)
+				})
+
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return([]db.Group{{Name: "backend"}, {Name: "engineering"}}, nil)
+
 				maker.
 					EXPECT().
-					CreateToken(gomock.Eq(user.UserName), gomock.Any()).
+					CreateToken(gomock.Eq(user.UserName), gomock.Any(), gomock.Any()).
 					Times(1).
-					Return(user.LoginToken, nil)
+					DoAndReturn(func(username string, duration time.Duration, options ...token.PayloadOption) (string, error) {
+						payload, err := token.NewPayload(username, duration, options...)
+						require.NoError(t, err)
+						require.Equal(t, db.DefaultOrganizationID, payload.TenantID)
+						require.Equal(t, []string{"backend", "engineering"}, payload.Groups)
+
+						return user.LoginToken, nil
+					})
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 
-				updateArgs := db.UpdateUserParams{
-					ID:         0,
-					FullName:   user.FullName,
-					Phone:      user.Phone,
-					Password:   user.Password,
-					LoginToken: user.LoginToken,
-				}
-
 				dbConnector.
 					EXPECT().
-					UpdateUser(updateArgs).
+					SetLoginToken(gomock.Any(), gomock.Eq(user.ID), gomock.Eq(user.LoginToken)).
 					Times(1).
 					Return(nil)
 			},
@@ -693,18 +1081,55 @@ func TestLoginUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Any).
+					GetUser(gomock.Any(), gomock.Any).
 					Times(0)
 
 				dbConnector.
 					EXPECT().
-					UpdateUser(gomock.Any).
+					UpdateUser(gomock.Any(), gomock.Any).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				validateErrorResponse(t, recorder, "BadRequest", "Incorrect parameters sent in request", http.StatusBadRequest)
 			},
 		},
+		{
+			name: "Token Update Fails",
+			body: gin.H{
+				"user_name": user.UserName,
+				"password":  user.Password,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUserGroups(gomock.Any(), gomock.Eq(user.ID)).
+					Times(1).
+					Return(nil, nil)
+
+				maker.
+					EXPECT().
+					CreateToken(gomock.Eq(user.UserName), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(user.LoginToken, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				dbConnector.
+					EXPECT().
+					SetLoginToken(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(fmt.Errorf("Error executing query"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				validateErrorResponse(t, recorder, "InternalServerError", "Unexpected server error. Try again later", http.StatusInternalServerError)
+			},
+		},
 		{
 			name: "WrongPassword",
 			body: gin.H{
@@ -712,6 +1137,20 @@ func TestLoginUser(t *testing.T) {
 				"password":  "wrongpassword",
 			},
 			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				dbConnector.
+					EXPECT().
+					CreateLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, loginParams db.CreateLoginAttemptParams) (*db.LoginAttempt, error) {
+						require.False(t, loginParams.Success)
+						require.Equal(t, "wrong_password", loginParams.FailureReason)
+						require.NotNil(t, loginParams.UserID)
+
+						return &db.LoginAttempt{}, nil
+					})
+
+				stubTx(dbConnector, 1)
+
 				maker.
 					EXPECT().
 					CreateToken(gomock.Any(), gomock.Any()).
@@ -719,7 +1158,7 @@ func TestLoginUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 			},
@@ -727,6 +1166,38 @@ func TestLoginUser(t *testing.T) {
 				validateErrorResponse(t, recorder, "Unauthorized", "Wrong password sent in request", http.StatusUnauthorized)
 			},
 		},
+		{
+			name: "User Not Found",
+			body: gin.H{
+				"user_name": "unknownuser",
+				"password":  user.Password,
+			},
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq("unknownuser")).
+					Times(1).
+					Return(nil, &db.NotFoundError{})
+
+				dbConnector.
+					EXPECT().
+					CreateLoginAttempt(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, loginParams db.CreateLoginAttemptParams) (*db.LoginAttempt, error) {
+						require.False(t, loginParams.Success)
+						require.Equal(t, "unknown_user", loginParams.FailureReason)
+						require.Equal(t, "unknownuser", loginParams.UserName)
+						require.Nil(t, loginParams.UserID)
+
+						return &db.LoginAttempt{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -792,10 +1263,17 @@ func TestUpdateUser(t *testing.T) {
 			name: "OK",
 			body: gin.H{
 				"full_name": "Test User",
-				"phone":     "99989993",
+				"phone":     user.Phone,
 			},
 			token: user.LoginToken,
 			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				expectAuditEvent(t, dbConnector, "user.update", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, `{"full_name":"Test user"}`, auditParams.Before)
+					require.Equal(t, `{"full_name":"Test User"}`, auditParams.After)
+				})
+
 				maker.
 					EXPECT().
 					VerifyToken(user.LoginToken).
@@ -804,28 +1282,92 @@ func TestUpdateUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 
 				arg := db.UpdateUserParams{
 					ID:         user.ID,
 					FullName:   "Test User",
-					Phone:      "99989993",
+					Phone:      user.Phone,
 					Password:   user.Password,
 					LoginToken: user.LoginToken,
 				}
 
 				dbConnector.
 					EXPECT().
-					UpdateUser(arg).
+					UpdateUser(gomock.Any(), arg).
 					Times(1).
 					Return(nil)
+
+				dbConnector.
+					EXPECT().
+					CreatePhoneVerification(gomock.Any(), gomock.Any()).
+					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusNoContent, recorder.Code)
 			},
 		},
+		{
+			name: "Phone Change",
+			body: gin.H{
+				"full_name": "Test User",
+				"phone":     "99989993",
+			},
+			token: user.LoginToken,
+			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				// The phone is kept until the new one is verified
+				expectAuditEvent(t, dbConnector, "user.update", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, `{"full_name":"Test user"}`, auditParams.Before)
+					require.Equal(t, `{"full_name":"Test User"}`, auditParams.After)
+				})
+
+				dbConnector.
+					EXPECT().
+					CreatePhoneVerification(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(ctx context.Context, verificationParams db.CreatePhoneVerificationParams) (*db.PhoneVerification, error) {
+						require.Equal(t, user.ID, verificationParams.UserID)
+						require.Equal(t, "99989993", verificationParams.Phone)
+						require.NotEmpty(t, verificationParams.CodeHash)
+						require.True(t, verificationParams.ExpiresAt.After(time.Now()))
+
+						return &db.PhoneVerification{ID: 1, UserID: user.ID, Phone: verificationParams.Phone}, nil
+					})
+
+				maker.
+					EXPECT().
+					VerifyToken(user.LoginToken).
+					Times(1).
+					Return(tokenPayload, nil)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
+					Times(1).
+					Return(&user, nil)
+
+				arg := db.UpdateUserParams{
+					ID:         user.ID,
+					FullName:   "Test User",
+					Phone:      user.Phone,
+					Password:   user.Password,
+					LoginToken: user.LoginToken,
+				}
+
+				dbConnector.
+					EXPECT().
+					UpdateUser(gomock.Any(), arg).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusAccepted, recorder.Code)
+			},
+		},
 		{
 			name: "Wrong Token",
 			body: gin.H{
@@ -842,13 +1384,13 @@ func TestUpdateUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 
 				dbConnector.
 					EXPECT().
-					UpdateUser(gomock.Any()).
+					UpdateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -871,12 +1413,12 @@ func TestUpdateUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Any()).
+					GetUser(gomock.Any(), gomock.Any()).
 					Times(0)
 
 				dbConnector.
 					EXPECT().
-					UpdateUser(gomock.Any()).
+					UpdateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -901,13 +1443,13 @@ func TestUpdateUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(user.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(user.UserName)).
 					Times(1).
 					Return(&user, nil)
 
 				dbConnector.
 					EXPECT().
-					UpdateUser(gomock.Any()).
+					UpdateUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -1003,6 +1545,21 @@ func TestDeleteUser(t *testing.T) {
 			},
 			token: adminUser.LoginToken,
 			buildStubs: func(dbConnector *mockdb.MockDBConnector, maker *mocktoken.MockMaker) {
+				stubTx(dbConnector, 1)
+
+				dbConnector.
+					EXPECT().
+					GetUser(gomock.Any(), gomock.Eq(nonAdminUser.UserName)).
+					Times(1).
+					Return(&nonAdminUser, nil)
+
+				expectAuditEvent(t, dbConnector, "user.delete", func(auditParams db.CreateAuditEventParams) {
+					require.Equal(t, adminUser.UserName, auditParams.ActorUserName)
+					require.Equal(t, nonAdminUser.UserName, auditParams.TargetUserName)
+					require.Contains(t, auditParams.Before, `"login_token":"[REDACTED]"`)
+					require.Empty(t, auditParams.After)
+				})
+
 				maker.
 					EXPECT().
 					VerifyToken(gomock.Eq(adminUser.LoginToken)).
@@ -1011,13 +1568,13 @@ func TestDeleteUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(adminUser.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
 					Times(1).
 					Return(&adminUser, nil)
 
 				dbConnector.
 					EXPECT().
-					DeleteUser(gomock.Eq(nonAdminUser.UserName)).
+					DeleteUser(gomock.Any(), gomock.Eq(nonAdminUser.UserName)).
 					Times(1).
 					Return(nil)
 			},
@@ -1038,13 +1595,13 @@ func TestDeleteUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(adminUser.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(adminUser.UserName)).
 					Times(1).
 					Return(&adminUser, nil)
 
 				dbConnector.
 					EXPECT().
-					DeleteUser(gomock.Any()).
+					DeleteUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -1066,13 +1623,13 @@ func TestDeleteUser(t *testing.T) {
 
 				dbConnector.
 					EXPECT().
-					GetUser(gomock.Eq(nonAdminUser.UserName)).
+					GetUser(gomock.Any(), gomock.Eq(nonAdminUser.UserName)).
 					Times(1).
 					Return(&nonAdminUser, nil)
 
 				dbConnector.
 					EXPECT().
-					DeleteUser(gomock.Any()).
+					DeleteUser(gomock.Any(), gomock.Any()).
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
@@ -1109,3 +1666,44 @@ func TestDeleteUser(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateServiceAccountBlockedNameInMemory(t *testing.T) {
+	maker, err := token.NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	connector := db.NewMemoryConnector()
+	server := NewTestServer(t, connector, maker)
+
+	recorder := serveJSON(t, server.Router, http.MethodPost, "/v1/user/", map[string]any{
+		"full_name": "Admin User",
+		"phone":     "99989990",
+		"user_name": "adminuser",
+		"password":  "secret",
+	}, "")
+	require.Equal(t, http.StatusCreated, recorder.Code)
+
+	admin, err := connector.GetUser(context.Background(), "adminuser")
+	require.NoError(t, err)
+	require.NoError(t, connector.SetOrgAdmin(context.Background(), admin.ID, true))
+
+	authorization := loginInMemory(t, server.Router, "adminuser", "secret")
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/users/service-accounts", map[string]any{
+		"full_name": "Deploy Bot",
+		"phone":     "99989991",
+		"user_name": "sysadm1n",
+		"password":  "secret",
+	}, authorization)
+	validateErrorResponse(t, recorder, "BadRequest", "The provided username is not allowed", http.StatusBadRequest)
+
+	_, err = connector.GetUser(context.Background(), "sysadm1n")
+	require.Error(t, err)
+
+	recorder = serveJSON(t, server.Router, http.MethodPost, "/v1/users/service-accounts", map[string]any{
+		"full_name": "Deploy Bot",
+		"phone":     "99989991",
+		"user_name": "deploybot",
+		"password":  "secret",
+	}, authorization)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+}
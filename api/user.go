@@ -1,6 +1,8 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -10,10 +12,11 @@ import (
 )
 
 type createUserRequest struct {
-	FullName string `json:"full_name" binding:"required"`
-	Phone    string `json:"phone" binding:"required,isPhone"`
-	UserName string `json:"user_name" binding:"required,alphanum,min=6"`
-	Password string `json:"password" binding:"required,min=6,validPassword"`
+	FullName   string        `json:"full_name" binding:"required"`
+	Phone      string        `json:"phone" binding:"required,isPhone"`
+	UserName   string        `json:"user_name" binding:"required,alphanum,min=6"`
+	Password   string        `json:"password" binding:"required,min=6,validPassword"`
+	Attributes db.Attributes `json:"attributes"`
 }
 
 func (s *Server) createUser(c *gin.Context) {
@@ -27,15 +30,52 @@ func (s *Server) createUser(c *gin.Context) {
 		return
 	}
 
+	if s.Blocklist.Blocks(userReq.UserName) {
+		c.JSON(http.StatusBadRequest, &gin.H{
+			"name":    "BadRequest",
+			"message": errUserNameNotAllowed.Error(),
+		})
+		return
+	}
+
 	var userParams = db.CreateUserParams{
-		FullName: userReq.FullName,
-		Phone:    userReq.Phone,
-		UserName: userReq.UserName,
-		Password: userReq.Password,
+		FullName:        userReq.FullName,
+		Phone:           userReq.Phone,
+		UserName:        userReq.UserName,
+		Password:        userReq.Password,
+		PendingApproval: s.Config.RegistrationApproval,
 	}
 
-	_, err := s.DbConnector.CreateUser(userParams)
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		attributes, err := checkAttributes(ctx, tx, 0, userReq.Attributes)
+		if err != nil {
+			return err
+		}
+		userParams.Attributes = attributes
+
+		user, err := tx.CreateUser(ctx, userParams)
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserCreate, user)
+		_, auditParams.After = auditDiff(nil, auditUserFields(user))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
 	if err != nil {
+		attributesErr, ok := err.(*invalidAttributesError)
+		if ok {
+			c.JSON(http.StatusBadRequest, &gin.H{
+				"name":    "BadRequest",
+				"message": attributesErr.Error(),
+			})
+			return
+		}
+
 		dbErr, ok := err.(*db.BadInputError)
 		if ok {
 			c.JSON(http.StatusBadRequest, &gin.H{
@@ -52,20 +92,107 @@ func (s *Server) createUser(c *gin.Context) {
 		return
 	}
 
+	// Registrations waiting for an admin are accepted but not active yet
+	if userParams.PendingApproval {
+		c.JSON(http.StatusAccepted, &gin.H{
+			"message": "User registered, pending approval",
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, &gin.H{
 		"message": "User created successfully",
 	})
 	return
 }
 
+func (s *Server) createServiceAccount(c *gin.Context) {
+	var userReq createUserRequest
+
+	if err := c.ShouldBindJSON(&userReq); err != nil {
+		c.JSON(http.StatusBadRequest, &gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	if s.Blocklist.Blocks(userReq.UserName) {
+		c.JSON(http.StatusBadRequest, &gin.H{
+			"name":    "BadRequest",
+			"message": errUserNameNotAllowed.Error(),
+		})
+		return
+	}
+
+	var userParams = db.CreateUserParams{
+		FullName:       userReq.FullName,
+		Phone:          userReq.Phone,
+		UserName:       userReq.UserName,
+		Password:       userReq.Password,
+		ServiceAccount: true,
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		attributes, err := checkAttributes(ctx, tx, 0, userReq.Attributes)
+		if err != nil {
+			return err
+		}
+		userParams.Attributes = attributes
+
+		user, err := tx.CreateUser(ctx, userParams)
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionServiceAccountCreate, user)
+		_, auditParams.After = auditDiff(nil, auditUserFields(user))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		attributesErr, ok := err.(*invalidAttributesError)
+		if ok {
+			c.JSON(http.StatusBadRequest, &gin.H{
+				"name":    "BadRequest",
+				"message": attributesErr.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, &gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, &gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &gin.H{
+		"message": "Service account created successfully",
+	})
+}
+
 type getUserRequest struct {
 	UserName string `form:"user_name" binding:"required"`
 }
 
 type getUserResponse struct {
-	FullName string `json:"full_name"`
-	Phone    string `json:"phone"`
-	UserName string `json:"user_name"`
+	FullName   string        `json:"full_name"`
+	Phone      string        `json:"phone"`
+	UserName   string        `json:"user_name"`
+	Attributes db.Attributes `json:"attributes,omitempty"`
 }
 
 func (s *Server) getUser(c *gin.Context) {
@@ -79,7 +206,7 @@ func (s *Server) getUser(c *gin.Context) {
 		return
 	}
 
-	user, err := s.DbConnector.GetUser(userReq.UserName)
+	user, err := s.DbConnector.GetUser(c.Request.Context(), userReq.UserName)
 	if err != nil {
 		notFoundErr, ok := err.(*db.NotFoundError)
 		if ok {
@@ -97,38 +224,96 @@ func (s *Server) getUser(c *gin.Context) {
 		return
 	}
 
+	showPrivate := showsPrivateAttributes(c, user)
+
+	definitions, err := s.loadAttributeDefinitions(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	attributes := definedAttributes(definitions, user.Attributes, showPrivate)
+
+	etag := userETag(user, attributes, showPrivate)
+	c.Header("ETag", etag)
+
+	if !ifNoneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	userRes := &getUserResponse{
-		FullName: user.FullName,
-		Phone:    user.Phone,
-		UserName: user.UserName,
+		FullName:   user.FullName,
+		Phone:      user.Phone,
+		UserName:   user.UserName,
+		Attributes: attributes,
 	}
 
 	c.JSON(http.StatusOK, userRes)
 }
 
 type getUsersRequest struct {
-	PageIndex int `form:"page"`
-	Offset    int `form:"offset"`
+	PageIndex     *int       `form:"page" binding:"omitempty,min=0"`
+	Offset        int        `form:"offset" binding:"omitempty,min=1"`
+	Limit         int        `form:"limit" binding:"omitempty,min=1"`
+	Cursor        string     `form:"cursor"`
+	WithTotal     bool       `form:"with_total"`
+	UserName      string     `form:"user_name"`
+	FullName      string     `form:"full_name"`
+	Phone         string     `form:"phone"`
+	Admin         *bool      `form:"admin"`
+	CreatedAfter  *time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore *time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedAfter  *time.Time `form:"updated_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedBefore *time.Time `form:"updated_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Deleted       string     `form:"deleted" binding:"omitempty,oneof=exclude include only"`
+	SortBy        string     `form:"sort_by" binding:"omitempty,sortableUserField"`
+	Order         string     `form:"order" binding:"omitempty,oneof=asc desc"`
 }
 
 type getUsersUserResponse struct {
-	FullName  string    `json:"full_name"`
-	Phone     string    `json:"phone"`
-	UserName  string    `json:"user_name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uint          `json:"id"`
+	FullName   string        `json:"full_name"`
+	Phone      string        `json:"phone"`
+	UserName   string        `json:"user_name"`
+	Admin      bool          `json:"admin"`
+	Attributes db.Attributes `json:"attributes,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	DeletedAt  *time.Time    `json:"deleted_at,omitempty"`
 }
 
 type getUsersResponse struct {
-	Users []*getUsersUserResponse `json:"users"`
+	Users      []*getUsersUserResponse `json:"users"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+	PrevCursor string                  `json:"prev_cursor,omitempty"`
+	Total      *int64                  `json:"total,omitempty"`
 }
 
-const minOffset = 5
+const (
+	minOffset   = 5
+	maxPageSize = 100
+)
 
 func (s *Server) getUsers(c *gin.Context) {
+	s.listUsers(c, "")
+}
+
+func (s *Server) getDeletedUsers(c *gin.Context) {
+	s.listUsers(c, db.DeletedOnly)
+}
+
+// listUsers lists users a page at a time. Pages are read with keyset pagination, following
+// the opaque cursors returned with each page, unless a page index is requested explicitly.
+// A non empty deleted filter takes precedence over the one in the request. Users are also
+// filtered by the attr.<name> query parameters, each matching one custom attribute
+func (s *Server) listUsers(c *gin.Context, deleted db.DeletedFilter) {
 	var usersReq getUsersRequest
 
-	if err := c.BindQuery(&usersReq); err != nil {
+	if err := c.ShouldBindQuery(&usersReq); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"name":    "BadRequest",
 			"message": "Incorrect parameters sent in request",
@@ -136,17 +321,95 @@ func (s *Server) getUsers(c *gin.Context) {
 		return
 	}
 
-	if usersReq.Offset == 0 {
-		usersReq.Offset = minOffset
+	if deleted != "" {
+		usersReq.Deleted = string(deleted)
+	}
+
+	pageSize := usersReq.Limit
+	if pageSize == 0 {
+		pageSize = usersReq.Offset
+	}
+
+	if pageSize == 0 {
+		pageSize = minOffset
+	}
+
+	if pageSize > maxPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": fmt.Sprintf("Page size cannot be greater than %d", maxPageSize),
+		})
+		return
+	}
+
+	attributes, err := s.attributeFilters(c)
+	if err != nil {
+		attributesErr, ok := err.(*invalidAttributesError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": attributesErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
 	}
 
 	getUsersParams := db.GetUsersParams{
-		PageIndex: usersReq.PageIndex,
-		Offset:    usersReq.Offset,
+		Offset:         pageSize,
+		UserNamePrefix: usersReq.UserName,
+		FullNamePrefix: usersReq.FullName,
+		Phone:          usersReq.Phone,
+		Admin:          usersReq.Admin,
+		CreatedAfter:   usersReq.CreatedAfter,
+		CreatedBefore:  usersReq.CreatedBefore,
+		UpdatedAfter:   usersReq.UpdatedAfter,
+		UpdatedBefore:  usersReq.UpdatedBefore,
+		Deleted:        db.DeletedFilter(usersReq.Deleted),
+		Attributes:     attributes,
+		SortBy:         usersReq.SortBy,
+		SortDesc:       usersReq.Order == "desc",
 	}
 
-	users, err := s.DbConnector.GetUsers(getUsersParams)
+	keyset := usersReq.PageIndex == nil || usersReq.Cursor != ""
+	if keyset {
+		if usersReq.Cursor != "" {
+			cursor, err := db.DecodeUsersCursor(usersReq.Cursor)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"name":    "BadRequest",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			getUsersParams.Cursor = cursor
+		}
+
+		// One extra user tells whether there are more users past this page
+		getUsersParams.Offset = pageSize + 1
+	} else {
+		getUsersParams.PageIndex = *usersReq.PageIndex
+	}
+
+	ctx := c.Request.Context()
+
+	users, err := s.DbConnector.GetUsers(ctx, getUsersParams)
 	if err != nil {
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"name":    "InternalServerError",
 			"message": "Unexpected server error. Try again later",
@@ -157,13 +420,77 @@ func (s *Server) getUsers(c *gin.Context) {
 	usersRes := &getUsersResponse{
 		Users: []*getUsersUserResponse{},
 	}
-	for _, user := range users {
+
+	if keyset {
+		backward := getUsersParams.Cursor != nil && getUsersParams.Cursor.Backward
+
+		hasMore := len(users) > pageSize
+		if hasMore && backward {
+			users = users[1:]
+		} else if hasMore {
+			users = users[:pageSize]
+		}
+
+		hasNext := (hasMore && !backward) || (getUsersParams.Cursor != nil && backward)
+		hasPrev := (hasMore && backward) || (getUsersParams.Cursor != nil && !backward)
+
+		if len(users) > 0 {
+			if hasNext {
+				usersRes.NextCursor = db.NewUsersCursor(users[len(users)-1], usersReq.SortBy, getUsersParams.SortDesc, false).Encode()
+			}
+
+			if hasPrev {
+				usersRes.PrevCursor = db.NewUsersCursor(users[0], usersReq.SortBy, getUsersParams.SortDesc, true).Encode()
+			}
+		}
+
+		if links := paginationLinks(c.Request.URL, pageSize, usersRes.NextCursor, usersRes.PrevCursor); links != "" {
+			c.Header("Link", links)
+		}
+	}
+
+	if usersReq.WithTotal {
+		total, err := s.DbConnector.CountUsers(ctx, getUsersParams)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"name":    "InternalServerError",
+				"message": "Unexpected server error. Try again later",
+			})
+			return
+		}
+
+		usersRes.Total = &total
+	}
+
+	listed := make([]*db.User, len(users))
+	for i := range users {
+		listed[i] = &users[i]
+	}
+
+	definitions, err := s.loadAttributeDefinitions(ctx, listed...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	for _, user := range listed {
 		userRes := &getUsersUserResponse{
-			FullName:  user.FullName,
-			Phone:     user.Phone,
-			UserName:  user.UserName,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:         user.ID,
+			FullName:   user.FullName,
+			Phone:      user.Phone,
+			UserName:   user.UserName,
+			Admin:      user.Admin,
+			Attributes: definedAttributes(definitions, user.Attributes, showsPrivateAttributes(c, user)),
+			CreatedAt:  user.CreatedAt,
+			UpdatedAt:  user.UpdatedAt,
+		}
+
+		if user.DeletedAt.Valid {
+			deletedAt := user.DeletedAt.Time
+			userRes.DeletedAt = &deletedAt
 		}
 
 		usersRes.Users = append(usersRes.Users, userRes)
@@ -172,6 +499,8 @@ func (s *Server) getUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, usersRes)
 }
 
+var errWrongPassword = errors.New("Wrong password sent in request")
+
 type loginUserRequest struct {
 	UserName string `json:"user_name" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -192,10 +521,67 @@ func (s *Server) loginUser(c *gin.Context) {
 		return
 	}
 
-	user, err := s.DbConnector.GetUser(loginReq.UserName)
+	ctx := c.Request.Context()
+
+	var (
+		token        string
+		user         *db.User
+		loginAttempt *db.LoginAttempt
+	)
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		var err error
+		user, err = tx.GetUser(ctx, loginReq.UserName)
+		if err != nil {
+			return err
+		}
+
+		if !util.ComparePassword(user.Password, loginReq.Password) {
+			return errWrongPassword
+		}
+
+		if !user.IsRegistrationApproved() {
+			return errRegistrationNotApproved
+		}
+
+		groups, err := groupsOption(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err = s.Maker.CreateToken(user.UserName, s.Config.AccessTokenDuration, tenantOption(user), groups)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.SetLoginToken(ctx, user.ID, token); err != nil {
+			return err
+		}
+
+		loginParams := s.newLoginAttempt(c, user.UserName, user)
+		loginParams.Success = true
+
+		loginParams.NewDevice, err = isNewDevice(ctx, tx, user.ID, loginParams.UserAgent)
+		if err != nil {
+			return err
+		}
+
+		loginAttempt, err = tx.CreateLoginAttempt(ctx, loginParams)
+		if err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserLogin, user)
+		auditParams.ActorID = auditParams.TargetID
+		auditParams.ActorUserName = user.UserName
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
 	if err != nil {
 		notFoundErr, ok := err.(*db.NotFoundError)
 		if ok {
+			s.recordFailedLogin(c, loginReq.UserName, nil, loginFailureUnknownUser)
+
 			c.JSON(http.StatusNotFound, gin.H{
 				"name":    "NotFound",
 				"message": notFoundErr.Error(),
@@ -203,39 +589,26 @@ func (s *Server) loginUser(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"name":    "InternalServerError",
-			"message": "Unexpected server error. Try again later",
-		})
-		return
-	}
+		if errors.Is(err, errWrongPassword) {
+			s.recordFailedLogin(c, loginReq.UserName, user, loginFailureWrongPassword)
 
-	if !util.ComparePassword(user.Password, loginReq.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"name":    "Unauthorized",
-			"message": "Wrong password sent in request",
-		})
-		return
-	}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"name":    "Unauthorized",
+				"message": errWrongPassword.Error(),
+			})
+			return
+		}
 
-	token, err := s.Maker.CreateToken(user.UserName, s.Config.AccessTokenDuration)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"name":    "InternalServerError",
-			"message": "Unexpected server error. Try again later",
-		})
-		return
-	}
+		if errors.Is(err, errRegistrationNotApproved) {
+			s.recordFailedLogin(c, loginReq.UserName, user, loginFailureRegistrationNotApproved)
 
-	updateParams := db.UpdateUserParams{
-		ID:         user.ID,
-		FullName:   user.FullName,
-		Phone:      user.Phone,
-		Password:   user.Password,
-		LoginToken: token,
-	}
+			c.JSON(http.StatusForbidden, gin.H{
+				"name":    "Forbidden",
+				"message": errRegistrationNotApproved.Error(),
+			})
+			return
+		}
 
-	if err = s.DbConnector.UpdateUser(updateParams); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"name":    "InternalServerError",
 			"message": "Unexpected server error. Try again later",
@@ -243,6 +616,10 @@ func (s *Server) loginUser(c *gin.Context) {
 		return
 	}
 
+	if loginAttempt.NewDevice {
+		s.notifyNewDevice(ctx, user, loginAttempt)
+	}
+
 	loginRes := loginUserResponse{
 		Token: token,
 	}
@@ -250,9 +627,12 @@ func (s *Server) loginUser(c *gin.Context) {
 	c.JSON(http.StatusOK, loginRes)
 }
 
+// updateUserRequest replaces the profile of the current user. The custom attributes are left
+// as they are when Attributes is omitted and replaced as a whole otherwise
 type updateUserRequest struct {
-	FullName string `json:"full_name"`
-	Phone    string `json:"phone" binding:"isPhone"`
+	FullName   string        `json:"full_name"`
+	Phone      string        `json:"phone" binding:"isPhone"`
+	Attributes db.Attributes `json:"attributes"`
 }
 
 func (s *Server) updateUser(c *gin.Context) {
@@ -284,15 +664,146 @@ func (s *Server) updateUser(c *gin.Context) {
 		return
 	}
 
+	if !s.checkUpdatePreconditions(c) {
+		return
+	}
+
+	definitions, err := s.loadAttributeDefinitions(c.Request.Context(), currentUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentAttributes := definedAttributes(definitions, currentUser.Attributes, true)
+
+	if !checkUserVersion(c, currentUser, currentAttributes) {
+		return
+	}
+
+	s.applyUserUpdate(c, currentUser, currentAttributes, updateUserParams)
+}
+
+// checkUpdatePreconditions responds with 428 Precondition Required and returns false when the
+// request has no If-Match header although it is required
+func (s *Server) checkUpdatePreconditions(c *gin.Context) bool {
+	if c.GetHeader("If-Match") == "" && s.Config.RequireIfMatch {
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"name":    "PreconditionRequired",
+			"message": errIfMatchRequired.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+// checkUserVersion responds with 412 Precondition Failed and returns false when the If-Match
+// header of the request does not match the current profile of user
+func checkUserVersion(c *gin.Context, user *db.User, attributes db.Attributes) bool {
+	ifMatchHeader := c.GetHeader("If-Match")
+	if ifMatchHeader != "" && !ifMatch(ifMatchHeader, userETag(user, attributes, true)) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"name":    "PreconditionFailed",
+			"message": errUserModified.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+// applyUserUpdate updates the profile of currentUser, whose defined attributes are
+// currentAttributes, to the one described by updateReq. The user is only updated while it is
+// at the version the client read, so that concurrent updates do not overwrite each other.
+// Without If-Match, the version read by checkAuth is used
+func (s *Server) applyUserUpdate(c *gin.Context, currentUser *db.User, currentAttributes db.Attributes, updateReq updateUserRequest) {
+	ctx := c.Request.Context()
+
 	updateParams := db.UpdateUserParams{
 		ID:         currentUser.ID,
-		FullName:   updateUserParams.FullName,
-		Phone:      updateUserParams.Phone,
+		FullName:   updateReq.FullName,
+		Phone:      currentUser.Phone,
 		Password:   currentUser.Password,
 		LoginToken: currentUser.LoginToken,
+		Version:    currentUser.Version,
 	}
 
-	if err := s.DbConnector.UpdateUser(updateParams); err != nil {
+	updatedUser := *currentUser
+	updatedUser.FullName = updateParams.FullName
+	updatedUser.Version = currentUser.Version + 1
+	updatedAttributes := currentAttributes
+
+	// A new phone only replaces the current one once the code sent to it is entered
+	var pending *pendingPhone
+	if updateReq.Phone != currentUser.Phone {
+		var err error
+		pending, err = newPendingPhone(updateReq.Phone)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"name":    "InternalServerError",
+				"message": "Unexpected server error. Try again later",
+			})
+			return
+		}
+	}
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.UpdateUser(ctx, updateParams); err != nil {
+			return err
+		}
+
+		if pending != nil {
+			if err := s.startPhoneVerification(ctx, tx, currentUser, pending); err != nil {
+				return err
+			}
+		}
+
+		if updateReq.Attributes != nil {
+			attributes, err := checkAttributes(ctx, tx, currentUser.ID, updateReq.Attributes)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.SetUserAttributes(ctx, currentUser.ID, attributes); err != nil {
+				return err
+			}
+
+			updatedUser.Attributes = attributes
+			updatedAttributes = attributes
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserUpdate, currentUser)
+		auditParams.Before, auditParams.After = auditDiff(auditUserFields(currentUser), auditUserFields(&updatedUser))
+
+		_, err := tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		if respondVersionConflict(c, err) {
+			return
+		}
+
+		attributesErr, ok := err.(*invalidAttributesError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": attributesErr.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"name":    "InternalServerError",
 			"message": "Unexpected server error. Try again later",
@@ -300,6 +811,17 @@ func (s *Server) updateUser(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", userETag(&updatedUser, updatedAttributes, true))
+
+	if pending != nil {
+		s.sendPhoneVerification(ctx, currentUser, pending)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "User updated, the new phone is pending verification",
+		})
+		return
+	}
+
 	c.JSON(http.StatusNoContent, gin.H{})
 }
 
@@ -321,7 +843,7 @@ func (s *Server) deleteUser(c *gin.Context) {
 	userReq, _ := c.Keys["currentUser"]
 	loggedUser, _ := userReq.(*db.User)
 
-	if !loggedUser.Admin && loggedUser.UserName != deleteUserReq.UserName {
+	if !isAdminOf(loggedUser, requestTenant(c.Request.Context())) && loggedUser.UserName != deleteUserReq.UserName {
 		c.JSON(http.StatusForbidden, gin.H{
 			"name":    "Forbidden",
 			"message": "User is not allowed to access this resource",
@@ -329,7 +851,130 @@ func (s *Server) deleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := s.DbConnector.DeleteUser(deleteUserReq.UserName); err != nil {
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		user, err := tx.GetUser(ctx, deleteUserReq.UserName)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.DeleteUser(ctx, deleteUserReq.UserName); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserDelete, user)
+		auditParams.Before, _ = auditDiff(auditUserFields(user), nil)
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+type deletedUserRequest struct {
+	ID uint `uri:"id" binding:"required,min=1"`
+}
+
+func (s *Server) restoreUser(c *gin.Context) {
+	var userReq deletedUserRequest
+
+	if err := c.ShouldBindUri(&userReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.RestoreUser(ctx, userReq.ID); err != nil {
+			return err
+		}
+
+		user, err := tx.GetUserByID(ctx, userReq.ID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateAuditEvent(ctx, newAuditEvent(c, auditActionUserRestore, user))
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User restored successfully",
+	})
+}
+
+func (s *Server) purgeUser(c *gin.Context) {
+	var userReq deletedUserRequest
+
+	if err := c.ShouldBindUri(&userReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		if err := tx.PurgeUser(ctx, userReq.ID); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserPurge, nil)
+		auditParams.TargetID = &userReq.ID
+
+		_, err := tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
 		notFoundErr, ok := err.(*db.NotFoundError)
 		if ok {
 			c.JSON(http.StatusNotFound, gin.H{
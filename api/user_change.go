@@ -0,0 +1,445 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/ericbg27/RegistryAPI/notify"
+	"github.com/ericbg27/RegistryAPI/util"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUserNameChangeCooldown = 30 * 24 * time.Hour
+	defaultUserNameReservation    = 90 * 24 * time.Hour
+	phoneVerificationDuration     = 15 * time.Minute
+	maxPhoneVerificationAttempts  = 5
+)
+
+var (
+	errSameUserName            = errors.New("The new username must differ from the current one")
+	errUserNameChangeCooldown  = errors.New("The username was changed too recently. Try again later")
+	errPhoneVerificationClosed = errors.New("The verification code has expired. Change the phone again to get a new one")
+	errWrongVerificationCode   = errors.New("Wrong verification code")
+)
+
+type changeUserNameRequest struct {
+	UserName string `json:"user_name" binding:"required,alphanum,min=6"`
+}
+
+type verifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,numeric,len=6"`
+}
+
+type userChangeResponse struct {
+	Field         string     `json:"field"`
+	OldValue      string     `json:"old_value"`
+	NewValue      string     `json:"new_value"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ReservedUntil *time.Time `json:"reserved_until,omitempty"`
+}
+
+type getUserChangesResponse struct {
+	Changes []userChangeResponse `json:"changes"`
+}
+
+// pendingPhone is a phone waiting for its owner to enter the code sent to it
+type pendingPhone struct {
+	phone string
+	code  string
+}
+
+// newPendingPhone creates the verification code to be sent to phone
+func newPendingPhone(phone string) (*pendingPhone, error) {
+	code, err := util.NewVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pendingPhone{
+		phone: phone,
+		code:  code,
+	}, nil
+}
+
+// startPhoneVerification stores the verification of the phone user is moving to
+func (s *Server) startPhoneVerification(ctx context.Context, tx db.DBConnector, user *db.User, pending *pendingPhone) error {
+	_, err := tx.CreatePhoneVerification(ctx, db.CreatePhoneVerificationParams{
+		UserID:    user.ID,
+		Phone:     pending.phone,
+		CodeHash:  util.HashVerificationCode(s.phoneVerificationKey, pending.code),
+		ExpiresAt: time.Now().Add(phoneVerificationDuration),
+	})
+
+	return err
+}
+
+// sendPhoneVerification sends the verification code to the phone user is moving to
+func (s *Server) sendPhoneVerification(ctx context.Context, user *db.User, pending *pendingPhone) {
+	notification := notify.Notification{
+		UserName: user.UserName,
+		Phone:    pending.phone,
+		Subject:  "Verify your new phone",
+		Body:     fmt.Sprintf("Your verification code is %s. It expires in %s", pending.code, phoneVerificationDuration),
+	}
+
+	if err := s.Sender.Send(ctx, notification); err != nil {
+		log.Printf("Cannot send the phone verification code of %s: %v\n", user.UserName, err)
+	}
+}
+
+// lastUserNameChange returns when the username of the user with userID was last changed, or
+// the zero time when it never was
+func lastUserNameChange(ctx context.Context, tx db.DBConnector, userID uint) (time.Time, error) {
+	changes, err := tx.GetUserChanges(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for i := len(changes) - 1; i >= 0; i-- {
+		if changes[i].Field == db.UserChangeUserName {
+			return changes[i].CreatedAt, nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *Server) changeUserName(c *gin.Context) {
+	var changeReq changeUserNameRequest
+
+	if err := c.ShouldBindJSON(&changeReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	user, ok := c.Keys["currentUser"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentUser, ok := user.(*db.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	if changeReq.UserName == currentUser.UserName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errSameUserName.Error(),
+		})
+		return
+	}
+
+	if s.Blocklist.Blocks(changeReq.UserName) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errUserNameNotAllowed.Error(),
+		})
+		return
+	}
+
+	cooldown := s.Config.UserNameChangeCooldown
+	if cooldown == 0 {
+		cooldown = defaultUserNameChangeCooldown
+	}
+
+	reservation := s.Config.UserNameReservation
+	if reservation == 0 {
+		reservation = defaultUserNameReservation
+	}
+
+	ctx := c.Request.Context()
+
+	var token string
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		lastChange, err := lastUserNameChange(ctx, tx, currentUser.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !lastChange.IsZero() && now.Before(lastChange.Add(cooldown)) {
+			return errUserNameChangeCooldown
+		}
+
+		if err := tx.SetUserName(ctx, currentUser.ID, changeReq.UserName); err != nil {
+			return err
+		}
+
+		// The former username stays with the user for a while, so that nobody can pose as them
+		reservedUntil := now.Add(reservation)
+		_, err = tx.CreateUserChange(ctx, db.CreateUserChangeParams{
+			UserID:        currentUser.ID,
+			Field:         db.UserChangeUserName,
+			OldValue:      currentUser.UserName,
+			NewValue:      changeReq.UserName,
+			ReservedUntil: &reservedUntil,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Tokens name the user, so the current one stops working along with the former username.
+		// The new token is only stored, and thus usable, when the user did not change meanwhile
+		renamedUser := *currentUser
+		renamedUser.UserName = changeReq.UserName
+
+		groups, err := groupsOption(ctx, tx, currentUser.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err = s.Maker.CreateToken(renamedUser.UserName, s.Config.AccessTokenDuration, tenantOption(&renamedUser), groups)
+		if err != nil {
+			return err
+		}
+		renamedUser.LoginToken = token
+
+		updateParams := db.UpdateUserParams{
+			ID:         currentUser.ID,
+			FullName:   currentUser.FullName,
+			Phone:      currentUser.Phone,
+			Password:   currentUser.Password,
+			LoginToken: token,
+			Version:    currentUser.Version,
+		}
+
+		if err := tx.UpdateUser(ctx, updateParams); err != nil {
+			return err
+		}
+
+		auditParams := newAuditEvent(c, auditActionUserNameChange, currentUser)
+		auditParams.Before, auditParams.After = auditDiff(auditUserFields(currentUser), auditUserFields(&renamedUser))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		if respondVersionConflict(c, err) {
+			return
+		}
+
+		if errors.Is(err, errUserNameChangeCooldown) {
+			c.JSON(http.StatusConflict, gin.H{
+				"name":    "Conflict",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, loginUserResponse{
+		Token: token,
+	})
+}
+
+func (s *Server) verifyPhone(c *gin.Context) {
+	var verifyReq verifyPhoneRequest
+
+	if err := c.ShouldBindJSON(&verifyReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	user, ok := c.Keys["currentUser"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentUser, ok := user.(*db.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Wrong codes are counted, so that transaction has to commit even though the phone is kept
+	wrongCode := false
+	err := s.DbConnector.WithTx(ctx, func(tx db.DBConnector) error {
+		verification, err := tx.GetPhoneVerification(ctx, currentUser.ID)
+		if err != nil {
+			return err
+		}
+
+		if verification.Attempts >= maxPhoneVerificationAttempts || !time.Now().Before(verification.ExpiresAt) {
+			return errPhoneVerificationClosed
+		}
+
+		if util.HashVerificationCode(s.phoneVerificationKey, verifyReq.Code) != verification.CodeHash {
+			wrongCode = true
+
+			return tx.FailPhoneVerification(ctx, verification.ID)
+		}
+
+		updateParams := db.UpdateUserParams{
+			ID:         currentUser.ID,
+			FullName:   currentUser.FullName,
+			Phone:      verification.Phone,
+			Password:   currentUser.Password,
+			LoginToken: currentUser.LoginToken,
+			Version:    currentUser.Version,
+		}
+
+		if err := tx.UpdateUser(ctx, updateParams); err != nil {
+			return err
+		}
+
+		if err := tx.CompletePhoneVerification(ctx, verification.ID); err != nil {
+			return err
+		}
+
+		_, err = tx.CreateUserChange(ctx, db.CreateUserChangeParams{
+			UserID:   currentUser.ID,
+			Field:    db.UserChangePhone,
+			OldValue: currentUser.Phone,
+			NewValue: verification.Phone,
+		})
+		if err != nil {
+			return err
+		}
+
+		verifiedUser := *currentUser
+		verifiedUser.Phone = verification.Phone
+
+		auditParams := newAuditEvent(c, auditActionPhoneChange, currentUser)
+		auditParams.Before, auditParams.After = auditDiff(auditUserFields(currentUser), auditUserFields(&verifiedUser))
+
+		_, err = tx.CreateAuditEvent(ctx, auditParams)
+		return err
+	})
+	if err != nil {
+		notFoundErr, ok := err.(*db.NotFoundError)
+		if ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"name":    "NotFound",
+				"message": notFoundErr.Error(),
+			})
+			return
+		}
+
+		if respondVersionConflict(c, err) {
+			return
+		}
+
+		if errors.Is(err, errPhoneVerificationClosed) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "BadRequest",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		dbErr, ok := err.(*db.BadInputError)
+		if ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"name":    "AlreadyExists",
+				"message": dbErr.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	if wrongCode {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errWrongVerificationCode.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, gin.H{})
+}
+
+func (s *Server) getUserChanges(c *gin.Context) {
+	user, ok := c.Keys["currentUser"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentUser, ok := user.(*db.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	changes, err := s.DbConnector.GetUserChanges(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	changesRes := &getUserChangesResponse{
+		Changes: []userChangeResponse{},
+	}
+
+	for _, change := range changes {
+		changesRes.Changes = append(changesRes.Changes, userChangeResponse{
+			Field:         change.Field,
+			OldValue:      change.OldValue,
+			NewValue:      change.NewValue,
+			CreatedAt:     change.CreatedAt,
+			ReservedUntil: change.ReservedUntil,
+		})
+	}
+
+	c.JSON(http.StatusOK, changesRes)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	errUserNameInvalid    = errors.New("The username must have at least 6 letters or digits")
+	errUserNameNotAllowed = errors.New("The provided username is not allowed")
+	errUserNameTaken      = errors.New("An user with the provided username already exists")
+	errUserNameReserved   = errors.New("The provided username is reserved")
+)
+
+type userNameAvailabilityRequest struct {
+	UserName string `form:"user_name" binding:"required"`
+}
+
+type userNameAvailabilityResponse struct {
+	UserName  string `json:"user_name"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// checkUserNameAvailability tells signup forms whether a username can be registered, and why
+// not when it cannot
+func (s *Server) checkUserNameAvailability(c *gin.Context) {
+	var availabilityReq userNameAvailabilityRequest
+
+	if err := c.ShouldBindQuery(&availabilityReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	userName := availabilityReq.UserName
+	availabilityRes := userNameAvailabilityResponse{
+		UserName: userName,
+	}
+
+	reason, err := s.userNameUnavailability(c, userName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	availabilityRes.Available = reason == ""
+	availabilityRes.Reason = reason
+
+	c.JSON(http.StatusOK, availabilityRes)
+}
+
+// userNameUnavailability returns why userName cannot be registered in the organization of the
+// request, or an empty reason when it can
+func (s *Server) userNameUnavailability(c *gin.Context, userName string) (string, error) {
+	// The same rules as the user_name of createUserRequest
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if v.Var(userName, "alphanum,min=6") != nil {
+			return errUserNameInvalid.Error(), nil
+		}
+	}
+
+	if s.Blocklist.Blocks(userName) {
+		return errUserNameNotAllowed.Error(), nil
+	}
+
+	ctx := c.Request.Context()
+
+	_, err := s.DbConnector.GetUser(ctx, userName)
+	switch err.(type) {
+	case nil:
+		return errUserNameTaken.Error(), nil
+	case *db.NotFoundError:
+	default:
+		return "", err
+	}
+
+	reserved, err := s.DbConnector.IsUserNameReserved(ctx, userName, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if reserved {
+		return errUserNameReserved.Error(), nil
+	}
+
+	return "", nil
+}
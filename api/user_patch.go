@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+var (
+	errPatchNotObject   = errors.New("The merge patch must be a JSON object")
+	errPatchContentType = fmt.Errorf("Send the merge patch as %s", mergePatchContentType)
+)
+
+// userPatchError reports a field of a merge patch which cannot be applied
+type userPatchError struct {
+	field   string
+	problem string
+}
+
+func (e *userPatchError) Error() string {
+	return fmt.Sprintf("The %s %s", e.field, e.problem)
+}
+
+// patchString decodes the new value of the string field of a merge patch. Such fields cannot
+// be removed, so null is refused like any other value which is not a string
+func patchString(field string, raw json.RawMessage) (string, error) {
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil || value == nil {
+		return "", &userPatchError{field: field, problem: "must be a string"}
+	}
+
+	return *value, nil
+}
+
+// patchAttributes merges the attributes of a merge patch into the defined attributes of a user.
+// Attributes set to null are removed, and setting the attributes themselves to null removes all
+// of them
+func patchAttributes(attributes db.Attributes, raw json.RawMessage) (db.Attributes, error) {
+	var patch map[string]any
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, &userPatchError{field: "attributes", problem: "must be an object"}
+	}
+
+	patched := db.Attributes{}
+	if patch == nil {
+		return patched, nil
+	}
+
+	for name, value := range attributes {
+		patched[name] = value
+	}
+
+	for name, value := range patch {
+		if value == nil {
+			delete(patched, name)
+			continue
+		}
+
+		patched[name] = value
+	}
+
+	return patched, nil
+}
+
+// applyUserPatch applies the merge patch to the profile of user, whose defined attributes are
+// attributes, validating each field it changes. Fields left out of the patch keep their current
+// value
+func applyUserPatch(user *db.User, attributes db.Attributes, patch map[string]json.RawMessage) (updateUserRequest, error) {
+	updateReq := updateUserRequest{
+		FullName: user.FullName,
+		Phone:    user.Phone,
+	}
+
+	v, _ := binding.Validator.Engine().(*validator.Validate)
+
+	// Fields are applied in order, so that the same patch is always refused for the same field
+	fields := make([]string, 0, len(patch))
+	for field := range patch {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		raw := patch[field]
+
+		var err error
+
+		switch field {
+		case "full_name":
+			if updateReq.FullName, err = patchString(field, raw); err != nil {
+				return updateReq, err
+			}
+
+			if updateReq.FullName == "" {
+				return updateReq, &userPatchError{field: field, problem: "cannot be empty"}
+			}
+		case "phone":
+			if updateReq.Phone, err = patchString(field, raw); err != nil {
+				return updateReq, err
+			}
+
+			if v != nil && v.Var(updateReq.Phone, "required,isPhone") != nil {
+				return updateReq, &userPatchError{field: field, problem: "must be a valid phone number"}
+			}
+		case "attributes":
+			if updateReq.Attributes, err = patchAttributes(attributes, raw); err != nil {
+				return updateReq, err
+			}
+		case "user_name":
+			return updateReq, &userPatchError{field: field, problem: "is changed with PUT /v1/user/user-name"}
+		default:
+			return updateReq, &userPatchError{field: field, problem: "cannot be changed"}
+		}
+	}
+
+	return updateReq, nil
+}
+
+// changesUser reports whether updateReq changes the profile of user, whose defined attributes
+// are attributes
+func changesUser(user *db.User, attributes db.Attributes, updateReq updateUserRequest) bool {
+	return updateReq.FullName != user.FullName ||
+		updateReq.Phone != user.Phone ||
+		(updateReq.Attributes != nil && !reflect.DeepEqual(updateReq.Attributes, attributes))
+}
+
+// patchUser partially updates the profile of the current user with a JSON merge patch, as
+// described by RFC 7396
+func (s *Server) patchUser(c *gin.Context) {
+	contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || (contentType != mergePatchContentType && contentType != binding.MIMEJSON) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"name":    "UnsupportedMediaType",
+			"message": errPatchContentType.Error(),
+		})
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": "Incorrect parameters sent in request",
+		})
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(data, &patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": errPatchNotObject.Error(),
+		})
+		return
+	}
+
+	user, ok := c.Keys["currentUser"]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentUser, ok := user.(*db.User)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	definitions, err := s.loadAttributeDefinitions(c.Request.Context(), currentUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"name":    "InternalServerError",
+			"message": "Unexpected server error. Try again later",
+		})
+		return
+	}
+
+	currentAttributes := definedAttributes(definitions, currentUser.Attributes, true)
+
+	updateReq, err := applyUserPatch(currentUser, currentAttributes, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"name":    "BadRequest",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !s.checkUpdatePreconditions(c) || !checkUserVersion(c, currentUser, currentAttributes) {
+		return
+	}
+
+	// A patch which changes nothing leaves the user at its version
+	if !changesUser(currentUser, currentAttributes, updateReq) {
+		c.Header("ETag", userETag(currentUser, currentAttributes, true))
+		c.JSON(http.StatusNoContent, gin.H{})
+		return
+	}
+
+	s.applyUserUpdate(c, currentUser, currentAttributes, updateReq)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"regexp"
 
+	"github.com/ericbg27/RegistryAPI/db"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -38,3 +39,39 @@ var validPassword validator.Func = func(fl validator.FieldLevel) bool {
 
 	return matched
 }
+
+var sortableUserField validator.Func = func(fl validator.FieldLevel) bool {
+	field, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	return db.IsSortableUserField(field)
+}
+
+var attributeName validator.Func = func(fl validator.FieldLevel) bool {
+	name, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	return db.IsValidAttributeName(name)
+}
+
+var groupName validator.Func = func(fl validator.FieldLevel) bool {
+	name, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	return db.IsValidGroupName(name)
+}
+
+var organizationName validator.Func = func(fl validator.FieldLevel) bool {
+	name, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+
+	return db.IsValidOrganizationName(name)
+}
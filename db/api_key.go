@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type APIKey struct {
+	gorm.Model
+	UserID     uint
+	Name       string
+	Prefix     string `gorm:"unique"`
+	KeyHash    string
+	Scopes     string
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// ScopeList returns the scopes granted to the key
+func (apiKey *APIKey) ScopeList() []string {
+	if apiKey.Scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(apiKey.Scopes, " ")
+}
+
+type CreateAPIKeyParams struct {
+	UserID    uint
+	Name      string
+	Prefix    string
+	KeyHash   string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+func (dbManager *DBManager) CreateAPIKey(ctx context.Context, apiKeyParams CreateAPIKeyParams) (*APIKey, error) {
+	apiKey := &APIKey{
+		UserID:    apiKeyParams.UserID,
+		Name:      apiKeyParams.Name,
+		Prefix:    apiKeyParams.Prefix,
+		KeyHash:   apiKeyParams.KeyHash,
+		Scopes:    strings.Join(apiKeyParams.Scopes, " "),
+		ExpiresAt: apiKeyParams.ExpiresAt,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Omit("RevokedAt", "LastUsedAt").Create(apiKey)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An API key with the provided prefix already exists"),
+			}
+		}
+
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+func (dbManager *DBManager) GetAPIKey(ctx context.Context, prefix string) (*APIKey, error) {
+	var apiKey APIKey
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("prefix = ?", prefix).First(&apiKey)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "API key",
+			}
+		}
+
+		return nil, err
+	}
+
+	return &apiKey, nil
+}
+
+func (dbManager *DBManager) GetAPIKeys(ctx context.Context, userID uint) ([]APIKey, error) {
+	var apiKeys []APIKey
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_id = ?", userID).Order("id").Find(&apiKeys)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+func (dbManager *DBManager) RevokeAPIKey(ctx context.Context, userID uint, prefix string) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&APIKey{}).Where("user_id = ? AND prefix = ? AND revoked_at IS NULL", userID, prefix).Update("revoked_at", time.Now())
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "API key",
+		}
+	}
+
+	return nil
+}
+
+func (dbManager *DBManager) TouchAPIKey(ctx context.Context, id uint) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", time.Now())
+
+	return result.Error
+}
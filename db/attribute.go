@@ -0,0 +1,374 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date"
+)
+
+const (
+	// AttributeVisibilityPublic attributes are shown to every user reading the profile
+	AttributeVisibilityPublic = "public"
+	// AttributeVisibilityPrivate attributes are only shown to the user and to admins
+	AttributeVisibilityPrivate = "private"
+)
+
+const attributeDateLayout = "2006-01-02"
+
+var attributeNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// IsValidAttributeName reports whether name can name an attribute: lowercase letters, digits
+// and underscores, starting with a letter
+func IsValidAttributeName(name string) bool {
+	return attributeNameRegexp.MatchString(name)
+}
+
+// Attributes holds the custom profile attributes of a user, keyed by attribute name. It is
+// stored as a JSON object
+type Attributes map[string]any
+
+func (attributes Attributes) Value() (driver.Value, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(map[string]any(attributes))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (attributes *Attributes) Scan(value any) error {
+	var data []byte
+
+	switch value := value.(type) {
+	case nil:
+		*attributes = Attributes{}
+		return nil
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	default:
+		return fmt.Errorf("Cannot scan %T into user attributes", value)
+	}
+
+	parsed := Attributes{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+
+	*attributes = parsed
+
+	return nil
+}
+
+func (attributes Attributes) clone() Attributes {
+	cloned := Attributes{}
+	for name, value := range attributes {
+		cloned[name] = value
+	}
+
+	return cloned
+}
+
+// sortedNames returns the attribute names in alphabetical order
+func (attributes Attributes) sortedNames() []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// AttributeDefinition declares a custom profile attribute. Pattern, when set, is a regular
+// expression string and date values must match as a whole. Unique values cannot be shared by
+// two users which were not deleted
+type AttributeDefinition struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Name           string `gorm:"unique"`
+	Type           string
+	Required       bool
+	Unique         bool
+	Pattern        string
+	Visibility     string
+	OrganizationID uint
+}
+
+type CreateAttributeDefinitionParams struct {
+	Name       string
+	Type       string
+	Required   bool
+	Unique     bool
+	Pattern    string
+	Visibility string
+}
+
+// CheckAttributePattern reports whether pattern can be used in an attribute definition
+func CheckAttributePattern(pattern string) error {
+	_, err := regexp.Compile(pattern)
+
+	return err
+}
+
+// normalizeValue checks that value is of the type of the attribute, returning it as it is
+// stored: numbers become float64, as they are once read back from JSON
+func (definition *AttributeDefinition) normalizeValue(value any) (any, error) {
+	var text string
+
+	switch definition.Type {
+	case AttributeTypeString, AttributeTypeDate:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("Attribute %s must be a %s", definition.Name, definition.Type)
+		}
+
+		if definition.Type == AttributeTypeDate {
+			if _, err := time.Parse(attributeDateLayout, str); err != nil {
+				return nil, fmt.Errorf("Attribute %s must be a date in the YYYY-MM-DD format", definition.Name)
+			}
+		}
+
+		text = str
+	case AttributeTypeNumber:
+		switch number := value.(type) {
+		case float64:
+			return number, nil
+		case int:
+			return float64(number), nil
+		case int64:
+			return float64(number), nil
+		}
+
+		return nil, fmt.Errorf("Attribute %s must be a number", definition.Name)
+	case AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("Attribute %s must be a boolean", definition.Name)
+		}
+
+		return value, nil
+	default:
+		return nil, fmt.Errorf("Attribute %s has an unknown type %s", definition.Name, definition.Type)
+	}
+
+	if definition.Pattern != "" {
+		matched, err := regexp.MatchString("^(?:"+definition.Pattern+")$", text)
+		if err != nil || !matched {
+			return nil, fmt.Errorf("Attribute %s does not match the pattern %s", definition.Name, definition.Pattern)
+		}
+	}
+
+	return text, nil
+}
+
+// ValidateAttributes checks attributes against their definitions, returning them as they are
+// stored. Attributes set to null are left out
+func ValidateAttributes(definitions []AttributeDefinition, attributes Attributes) (Attributes, error) {
+	byName := map[string]*AttributeDefinition{}
+	for i := range definitions {
+		byName[definitions[i].Name] = &definitions[i]
+	}
+
+	validated := Attributes{}
+	for _, name := range attributes.sortedNames() {
+		definition, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("Attribute %s is not defined", name)
+		}
+
+		if attributes[name] == nil {
+			continue
+		}
+
+		value, err := definition.normalizeValue(attributes[name])
+		if err != nil {
+			return nil, err
+		}
+
+		validated[name] = value
+	}
+
+	for _, definition := range definitions {
+		if _, ok := validated[definition.Name]; definition.Required && !ok {
+			return nil, fmt.Errorf("Attribute %s is required", definition.Name)
+		}
+	}
+
+	return validated, nil
+}
+
+// ParseAttributeValue parses the text form of a value of the attribute, as sent in query strings
+func (definition *AttributeDefinition) ParseAttributeValue(text string) (any, error) {
+	var value any = text
+
+	switch definition.Type {
+	case AttributeTypeNumber:
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Attribute %s must be a number", definition.Name)
+		}
+
+		value = number
+	case AttributeTypeBoolean:
+		switch text {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		default:
+			return nil, fmt.Errorf("Attribute %s must be true or false", definition.Name)
+		}
+	}
+
+	return definition.normalizeValue(value)
+}
+
+// attributeCondition returns the SQL condition matching users whose attribute name holds value.
+// Postgres uses JSONB containment, which the GIN index on attributes serves
+func (dbManager *DBManager) attributeCondition(name string, value any) (string, []any, error) {
+	if dbManager.db.Dialector.Name() == "postgres" {
+		contained, err := json.Marshal(map[string]any{name: value})
+		if err != nil {
+			return "", nil, err
+		}
+
+		return "attributes @> ?::jsonb", []any{string(contained)}, nil
+	}
+
+	return "json_extract(attributes, ?) = ?", []any{"$." + name, value}, nil
+}
+
+func (dbManager *DBManager) CreateAttributeDefinition(ctx context.Context, definitionParams CreateAttributeDefinitionParams) (*AttributeDefinition, error) {
+	definition := &AttributeDefinition{
+		Name:       definitionParams.Name,
+		Type:       definitionParams.Type,
+		Required:   definitionParams.Required,
+		Unique:     definitionParams.Unique,
+		Pattern:    definitionParams.Pattern,
+		Visibility: definitionParams.Visibility,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Create(definition)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An attribute with the provided name already exists"),
+			}
+		}
+
+		return nil, err
+	}
+
+	return definition, nil
+}
+
+func (dbManager *DBManager) GetAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error) {
+	var definitions []AttributeDefinition
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Order("name").Find(&definitions)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return definitions, nil
+}
+
+// DeleteAttributeDefinition removes the definition named name along with the values every
+// user, deleted ones included, holds for it
+func (dbManager *DBManager) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	return dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		result := conn.Where("name = ?", name).Delete(&AttributeDefinition{})
+
+		if err := result.Error; err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return &NotFoundError{
+				object: "attribute",
+			}
+		}
+
+		holders := conn.Unscoped().Model(&User{})
+		if dbManager.db.Dialector.Name() == "postgres" {
+			holders = holders.Where("jsonb_exists(attributes, ?)", name)
+			return holders.UpdateColumn("attributes", gorm.Expr("attributes - ?", name)).Error
+		}
+
+		holders = holders.Where("json_type(attributes, ?) IS NOT NULL", "$."+name)
+		return holders.UpdateColumn("attributes", gorm.Expr("json_remove(attributes, ?)", "$."+name)).Error
+	})
+}
+
+// IsAttributeValueTaken reports whether a user other than exceptUserID which was not deleted
+// holds value for the attribute name
+func (dbManager *DBManager) IsAttributeValueTaken(ctx context.Context, name string, value any, exceptUserID uint) (bool, error) {
+	var count int64
+
+	condition, args, err := dbManager.attributeCondition(name, value)
+	if err != nil {
+		return false, err
+	}
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id <> ?", exceptUserID).Where(condition, args...).Count(&count)
+
+	if err := result.Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// SetUserAttributes replaces the custom attributes of the user with id
+func (dbManager *DBManager) SetUserAttributes(ctx context.Context, id uint, attributes Attributes) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id = ?", id).Update("attributes", attributes)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,507 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLockID identifies the Postgres advisory lock serializing audit event writers
+const auditChainLockID = 7_303_832_541
+
+// auditPersonalRefPrefix starts the references audit events hold in place of personal data
+const auditPersonalRefPrefix = "personal:"
+
+// auditPersonalFields are the fields of the Before and After payloads holding personal data
+var auditPersonalFields = map[string]bool{
+	"full_name":  true,
+	"phone":      true,
+	"user_name":  true,
+	"attributes": true,
+}
+
+// AuditPersonalValue is a piece of personal data named by an audit event. Events refer to it
+// instead of holding it, so that it can be anonymized when the user it belongs to is erased
+// without altering the log. Value holds the JSON encoding of the data. Data about an invitee
+// belongs to their invitation until they accept it. Values belong to the organization the event
+// was written for
+type AuditPersonalValue struct {
+	ID             uint `gorm:"primaryKey"`
+	OrganizationID uint
+	UserID         *uint
+	InvitationID   *uint
+	Field          string
+	Value          string
+}
+
+func auditPersonalRef(id uint) string {
+	return auditPersonalRefPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// erasedPersonalValue returns the JSON encoded value replacing the personal data in field of
+// the erased user with id
+func erasedPersonalValue(field string, id uint) string {
+	var erased any
+	switch field {
+	case "full_name":
+		erased = ErasedFullName
+	case "attributes":
+		erased = Attributes{}
+	default:
+		erased = ErasedIdentity(id)
+	}
+
+	data, _ := json.Marshal(erased)
+
+	return string(data)
+}
+
+// detachPersonalData replaces the personal data named by auditParams with references to the
+// values store keeps apart from the event. Usernames belong to the user they name, while the
+// data in the payloads belongs to the target of the event or, without one, to the invitee of
+// its invitation
+func detachPersonalData(auditParams CreateAuditEventParams, store func(value *AuditPersonalValue) error) (CreateAuditEventParams, error) {
+	detach := func(userID *uint, invitationID *uint, field string, data []byte) (string, error) {
+		value := &AuditPersonalValue{
+			UserID:       userID,
+			InvitationID: invitationID,
+			Field:        field,
+			Value:        string(data),
+		}
+
+		if err := store(value); err != nil {
+			return "", err
+		}
+
+		return auditPersonalRef(value.ID), nil
+	}
+
+	detachUserName := func(userID *uint, userName *string) error {
+		if *userName == "" {
+			return nil
+		}
+
+		data, _ := json.Marshal(*userName)
+
+		ref, err := detach(userID, nil, "user_name", data)
+		*userName = ref
+
+		return err
+	}
+
+	detachPayload := func(payload *string) error {
+		var fields map[string]json.RawMessage
+		if *payload == "" || json.Unmarshal([]byte(*payload), &fields) != nil {
+			return nil
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			if auditPersonalFields[name] {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) == 0 {
+			return nil
+		}
+
+		// Values are stored in a stable order, so that the same event always gets the same references
+		sort.Strings(names)
+
+		invitationID := auditParams.InvitationID
+		if auditParams.TargetID != nil {
+			invitationID = nil
+		}
+
+		for _, name := range names {
+			ref, err := detach(auditParams.TargetID, invitationID, name, fields[name])
+			if err != nil {
+				return err
+			}
+
+			fields[name], _ = json.Marshal(ref)
+		}
+
+		data, err := json.Marshal(fields)
+		*payload = string(data)
+
+		return err
+	}
+
+	if err := detachUserName(auditParams.ActorID, &auditParams.ActorUserName); err != nil {
+		return auditParams, err
+	}
+
+	if err := detachUserName(auditParams.ImpersonatorID, &auditParams.ImpersonatorUserName); err != nil {
+		return auditParams, err
+	}
+
+	if err := detachUserName(auditParams.TargetID, &auditParams.TargetUserName); err != nil {
+		return auditParams, err
+	}
+
+	if err := detachPayload(&auditParams.Before); err != nil {
+		return auditParams, err
+	}
+
+	return auditParams, detachPayload(&auditParams.After)
+}
+
+// AuditEvent records an action taken on an account. Before and After hold JSON objects with
+// the fields the action changed. Audit events are never updated nor deleted.
+// Events are chained together: Hash covers the contents of the event along with PrevHash,
+// the hash of the event written right before it
+type AuditEvent struct {
+	ID                   uint `gorm:"primaryKey"`
+	CreatedAt            time.Time
+	Action               string
+	ActorID              *uint
+	ActorUserName        string
+	ImpersonatorUserName string
+	TargetID             *uint
+	TargetUserName       string
+	IP                   string
+	UserAgent            string
+	Before               string
+	After                string
+	PrevHash             string
+	Hash                 string
+
+	// Personal maps the references of the event to the JSON encoded personal data they stand for
+	Personal map[string]string `gorm:"-"`
+}
+
+// personalRefs returns the references to personal data held by the event
+func (auditEvent *AuditEvent) personalRefs() []string {
+	refs := []string{}
+	for _, value := range []string{auditEvent.ActorUserName, auditEvent.ImpersonatorUserName, auditEvent.TargetUserName} {
+		if strings.HasPrefix(value, auditPersonalRefPrefix) {
+			refs = append(refs, value)
+		}
+	}
+
+	for _, payload := range []string{auditEvent.Before, auditEvent.After} {
+		var fields map[string]json.RawMessage
+		if !strings.Contains(payload, auditPersonalRefPrefix) || json.Unmarshal([]byte(payload), &fields) != nil {
+			continue
+		}
+
+		for _, data := range fields {
+			var value string
+			if json.Unmarshal(data, &value) == nil && strings.HasPrefix(value, auditPersonalRefPrefix) {
+				refs = append(refs, value)
+			}
+		}
+	}
+
+	return refs
+}
+
+// Resolved returns a copy of the event where references are replaced by the personal data
+// they stand for. References to data which was not loaded are left as they are
+func (auditEvent *AuditEvent) Resolved() AuditEvent {
+	resolved := *auditEvent
+
+	resolveUserName := func(userName *string) {
+		var value string
+		if data, ok := auditEvent.Personal[*userName]; ok && json.Unmarshal([]byte(data), &value) == nil {
+			*userName = value
+		}
+	}
+
+	resolvePayload := func(payload *string) {
+		var fields map[string]json.RawMessage
+		if !strings.Contains(*payload, auditPersonalRefPrefix) || json.Unmarshal([]byte(*payload), &fields) != nil {
+			return
+		}
+
+		for name, data := range fields {
+			var ref string
+			if json.Unmarshal(data, &ref) != nil {
+				continue
+			}
+
+			if value, ok := auditEvent.Personal[ref]; ok {
+				fields[name] = json.RawMessage(value)
+			}
+		}
+
+		if data, err := json.Marshal(fields); err == nil {
+			*payload = string(data)
+		}
+	}
+
+	resolveUserName(&resolved.ActorUserName)
+	resolveUserName(&resolved.ImpersonatorUserName)
+	resolveUserName(&resolved.TargetUserName)
+	resolvePayload(&resolved.Before)
+	resolvePayload(&resolved.After)
+
+	return resolved
+}
+
+// ComputeHash returns the hex encoded SHA-256 hash of the event contents and PrevHash.
+// Fields are length prefixed, so that no two different events share their encoding
+func (auditEvent *AuditEvent) ComputeHash() string {
+	formatID := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+
+		return strconv.FormatUint(uint64(*id), 10)
+	}
+
+	digest := sha256.New()
+	for _, value := range []string{
+		auditEvent.PrevHash,
+		auditEvent.CreatedAt.UTC().Format(time.RFC3339Nano),
+		auditEvent.Action,
+		formatID(auditEvent.ActorID),
+		auditEvent.ActorUserName,
+		auditEvent.ImpersonatorUserName,
+		formatID(auditEvent.TargetID),
+		auditEvent.TargetUserName,
+		auditEvent.IP,
+		auditEvent.UserAgent,
+		auditEvent.Before,
+		auditEvent.After,
+	} {
+		fmt.Fprintf(digest, "%d:%s;", len(value), value)
+	}
+
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// newAuditEvent creates the event described by auditParams, chained to the event with prevHash.
+// Its creation time is truncated to the precision every supported database keeps
+func newAuditEvent(auditParams CreateAuditEventParams, prevHash string) *AuditEvent {
+	auditEvent := &AuditEvent{
+		CreatedAt:            time.Now().UTC().Truncate(time.Microsecond),
+		Action:               auditParams.Action,
+		ActorID:              auditParams.ActorID,
+		ActorUserName:        auditParams.ActorUserName,
+		ImpersonatorUserName: auditParams.ImpersonatorUserName,
+		TargetID:             auditParams.TargetID,
+		TargetUserName:       auditParams.TargetUserName,
+		IP:                   auditParams.IP,
+		UserAgent:            auditParams.UserAgent,
+		Before:               auditParams.Before,
+		After:                auditParams.After,
+		PrevHash:             prevHash,
+	}
+	auditEvent.Hash = auditEvent.ComputeHash()
+
+	return auditEvent
+}
+
+// CreateAuditEventParams describes a new audit event. ImpersonatorID and InvitationID are not
+// stored in the event, but tell whose personal data it names
+type CreateAuditEventParams struct {
+	Action               string
+	ActorID              *uint
+	ActorUserName        string
+	ImpersonatorID       *uint
+	ImpersonatorUserName string
+	TargetID             *uint
+	TargetUserName       string
+	InvitationID         *uint
+	IP                   string
+	UserAgent            string
+	Before               string
+	After                string
+}
+
+// GetAuditEventsParams filters audit events, which are listed from the newest to the oldest
+// unless Ascending is set. UserID keeps the events where the user with that ID is either the
+// actor or the target. BeforeID and AfterID only keep the events older or newer than the
+// event with that ID, continuing a listing. A zero Limit lists every matching event
+type GetAuditEventsParams struct {
+	UserID         uint
+	ActorUserName  string
+	TargetUserName string
+	Action         string
+	Since          *time.Time
+	Until          *time.Time
+	BeforeID       uint
+	AfterID        uint
+	Ascending      bool
+	Limit          int
+}
+
+// CreateAuditEvent appends an event to the audit log, chaining it to the latest event. Writers
+// are serialized so that concurrent events cannot both be chained to the same event
+func (dbManager *DBManager) CreateAuditEvent(ctx context.Context, auditParams CreateAuditEventParams) (*AuditEvent, error) {
+	var auditEvent *AuditEvent
+
+	err := dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		var latest []AuditEvent
+		if err := conn.Select("hash").Order("id DESC").Limit(1).Find(&latest).Error; err != nil {
+			return err
+		}
+
+		prevHash := ""
+		if len(latest) > 0 {
+			prevHash = latest[0].Hash
+		}
+
+		detached, err := detachPersonalData(auditParams, func(value *AuditPersonalValue) error {
+			sealed := *value
+
+			err := dbManager.createSealed(conn, "audit_personal_values", func(conn *gorm.DB) (uint, error) {
+				err := conn.Create(&sealed).Error
+
+				return sealed.ID, err
+			}, sealedColumn{name: "value", field: value.Field, value: &sealed.Value})
+
+			value.ID = sealed.ID
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		auditEvent = newAuditEvent(detached, prevHash)
+
+		return conn.Create(auditEvent).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return auditEvent, nil
+}
+
+func (dbManager *DBManager) GetAuditEvents(ctx context.Context, searchParams GetAuditEventsParams) ([]AuditEvent, error) {
+	var auditEvents []AuditEvent
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	query := conn
+
+	if searchParams.UserID != 0 {
+		query = query.Where("(actor_id = ? OR target_id = ?)", searchParams.UserID, searchParams.UserID)
+	}
+
+	if searchParams.ActorUserName != "" {
+		query = query.Where("actor_user_name = ? OR actor_user_name IN (?)", searchParams.ActorUserName, userNameRefs(conn, searchParams.ActorUserName))
+	}
+
+	if searchParams.TargetUserName != "" {
+		query = query.Where("target_user_name = ? OR target_user_name IN (?)", searchParams.TargetUserName, userNameRefs(conn, searchParams.TargetUserName))
+	}
+
+	if searchParams.Action != "" {
+		query = query.Where("action = ?", searchParams.Action)
+	}
+
+	if searchParams.Since != nil {
+		query = query.Where("created_at >= ?", *searchParams.Since)
+	}
+
+	if searchParams.Until != nil {
+		query = query.Where("created_at < ?", *searchParams.Until)
+	}
+
+	if searchParams.BeforeID != 0 {
+		query = query.Where("id < ?", searchParams.BeforeID)
+	}
+
+	if searchParams.AfterID != 0 {
+		query = query.Where("id > ?", searchParams.AfterID)
+	}
+
+	if searchParams.Limit > 0 {
+		query = query.Limit(searchParams.Limit)
+	}
+
+	order := "id DESC"
+	if searchParams.Ascending {
+		order = "id"
+	}
+
+	result := query.Order(order).Find(&auditEvents)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	if err := dbManager.loadPersonalValues(conn, auditEvents); err != nil {
+		return nil, err
+	}
+
+	return auditEvents, nil
+}
+
+// personalValuesConn returns a connection to the personal values of audit events, which are
+// read along with the log regardless of the organization they belong to
+func personalValuesConn(conn *gorm.DB) *gorm.DB {
+	return conn.Session(&gorm.Session{NewDB: true, Context: WithTenant(conn.Statement.Context, 0)})
+}
+
+// userNameRefs selects the references to the personal values holding userName. Events written
+// before personal data was kept apart hold the username itself
+func userNameRefs(conn *gorm.DB, userName string) *gorm.DB {
+	data, _ := json.Marshal(userName)
+
+	return personalValuesConn(conn).Model(&AuditPersonalValue{}).
+		Select("'"+auditPersonalRefPrefix+"' || id").
+		Where("field = ? AND value = ?", "user_name", string(data))
+}
+
+// loadPersonalValues fills the personal data referred to by auditEvents, which is encrypted
+// like the personal data of users
+func (dbManager *DBManager) loadPersonalValues(conn *gorm.DB, auditEvents []AuditEvent) error {
+	ids := []uint{}
+	for i := range auditEvents {
+		for _, ref := range auditEvents[i].personalRefs() {
+			if id, err := strconv.ParseUint(strings.TrimPrefix(ref, auditPersonalRefPrefix), 10, 0); err == nil {
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var values []AuditPersonalValue
+	if err := personalValuesConn(conn).Where("id IN ?", ids).Find(&values).Error; err != nil {
+		return err
+	}
+
+	personal := map[string]string{}
+	for _, value := range values {
+		data, err := dbManager.pii.Decrypt("audit_personal_values", value.ID, value.Field, value.Value)
+		if err != nil {
+			return err
+		}
+
+		personal[auditPersonalRef(value.ID)] = data
+	}
+
+	for i := range auditEvents {
+		auditEvents[i].Personal = personal
+	}
+
+	return nil
+}
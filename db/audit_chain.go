@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+)
+
+const auditVerifyBatchSize = 500
+
+// AuditChainReport is the outcome of walking the audit log chain. Events written before the
+// log was chained cannot be verified and are only counted. LastHash is the hash of the latest
+// verified event: keeping a copy of it elsewhere also makes dropping the newest events detectable
+type AuditChainReport struct {
+	Verified  int
+	Unchained int
+	BrokenAt  *uint
+	Reason    string
+	LastHash  string
+}
+
+// Valid reports whether the whole chain was verified without finding a break
+func (report *AuditChainReport) Valid() bool {
+	return report.BrokenAt == nil
+}
+
+func (report *AuditChainReport) breakAt(id uint, reason string) *AuditChainReport {
+	report.BrokenAt = &id
+	report.Reason = reason
+
+	return report
+}
+
+// VerifyAuditChain walks the audit log from the oldest event to the newest, checking that each
+// event matches its hash and links to the event before it. It stops at the first break
+func VerifyAuditChain(ctx context.Context, connector DBConnector) (*AuditChainReport, error) {
+	report := &AuditChainReport{}
+
+	var afterID uint
+	for {
+		auditEvents, err := connector.GetAuditEvents(ctx, GetAuditEventsParams{
+			AfterID:   afterID,
+			Ascending: true,
+			Limit:     auditVerifyBatchSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range auditEvents {
+			auditEvent := &auditEvents[i]
+
+			if auditEvent.Hash == "" {
+				if report.LastHash != "" {
+					return report.breakAt(auditEvent.ID, "Event is missing its hash"), nil
+				}
+
+				report.Unchained++
+				continue
+			}
+
+			if auditEvent.PrevHash != report.LastHash {
+				return report.breakAt(auditEvent.ID, "Event is not linked to the event before it"), nil
+			}
+
+			if auditEvent.ComputeHash() != auditEvent.Hash {
+				return report.breakAt(auditEvent.ID, "Event does not match its hash"), nil
+			}
+
+			report.Verified++
+			report.LastHash = auditEvent.Hash
+		}
+
+		if len(auditEvents) < auditVerifyBatchSize {
+			return report, nil
+		}
+
+		afterID = auditEvents[len(auditEvents)-1].ID
+	}
+}
@@ -1,24 +1,167 @@
 package db
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReadTimeout  = 5 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	maxTxAttempts       = 3
+)
 
 type DBConnector interface {
-	CreateUser(userParams CreateUserParams) (*User, error)
-	GetUser(userName string) (*User, error)
-	GetUsers(searchParams GetUsersParams) ([]User, error)
-	UpdateUser(updateParams UpdateUserParams) error
-	DeleteUser(userName string) error
+	CreateUser(ctx context.Context, userParams CreateUserParams) (*User, error)
+	GetUser(ctx context.Context, userName string) (*User, error)
+	GetUserByID(ctx context.Context, id uint) (*User, error)
+	GetUsers(ctx context.Context, searchParams GetUsersParams) ([]User, error)
+	CountUsers(ctx context.Context, searchParams GetUsersParams) (int64, error)
+	SearchUsers(ctx context.Context, searchParams SearchUsersParams) ([]UserSearchResult, error)
+	UpdateUser(ctx context.Context, updateParams UpdateUserParams) error
+	SetLoginToken(ctx context.Context, id uint, loginToken string) error
+	DeleteUser(ctx context.Context, userName string) error
+	RestoreUser(ctx context.Context, id uint) error
+	PurgeUser(ctx context.Context, id uint) error
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	EraseUser(ctx context.Context, id uint) (*User, error)
+
+	CreateAPIKey(ctx context.Context, apiKeyParams CreateAPIKeyParams) (*APIKey, error)
+	GetAPIKey(ctx context.Context, prefix string) (*APIKey, error)
+	GetAPIKeys(ctx context.Context, userID uint) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID uint, prefix string) error
+	TouchAPIKey(ctx context.Context, id uint) error
+
+	CreateImpersonation(ctx context.Context, impersonationParams CreateImpersonationParams) (*Impersonation, error)
+	GetImpersonations(ctx context.Context, userID uint) ([]Impersonation, error)
+	GetImpersonation(ctx context.Context, id uint) (*Impersonation, error)
+	EndImpersonation(ctx context.Context, id uint) error
+
+	CreateAuditEvent(ctx context.Context, auditParams CreateAuditEventParams) (*AuditEvent, error)
+	GetAuditEvents(ctx context.Context, searchParams GetAuditEventsParams) ([]AuditEvent, error)
+
+	CreateLoginAttempt(ctx context.Context, loginParams CreateLoginAttemptParams) (*LoginAttempt, error)
+	GetLoginAttempts(ctx context.Context, searchParams GetLoginAttemptsParams) ([]LoginAttempt, error)
+
+	CreateAttributeDefinition(ctx context.Context, definitionParams CreateAttributeDefinitionParams) (*AttributeDefinition, error)
+	GetAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error)
+	DeleteAttributeDefinition(ctx context.Context, name string) error
+	SetUserAttributes(ctx context.Context, id uint, attributes Attributes) error
+	IsAttributeValueTaken(ctx context.Context, name string, value any, exceptUserID uint) (bool, error)
+
+	CreateGroup(ctx context.Context, groupParams CreateGroupParams) (*Group, error)
+	GetGroup(ctx context.Context, name string) (*Group, error)
+	GetGroups(ctx context.Context) ([]Group, error)
+	AddGroupMember(ctx context.Context, memberParams GroupMemberParams) error
+	RemoveGroupMember(ctx context.Context, memberParams GroupMemberParams) error
+	GetGroupMembers(ctx context.Context, groupID uint) (*GroupMembers, error)
+	GetUserGroups(ctx context.Context, userID uint) ([]Group, error)
+
+	CreateOrganization(ctx context.Context, organizationParams CreateOrganizationParams) (*Organization, error)
+	GetOrganization(ctx context.Context, name string) (*Organization, error)
+	GetOrganizations(ctx context.Context) ([]Organization, error)
+	SetOrgAdmin(ctx context.Context, id uint, orgAdmin bool) error
+
+	CreateInvitation(ctx context.Context, invitationParams CreateInvitationParams) (*Invitation, error)
+	GetInvitation(ctx context.Context, id uint) (*Invitation, error)
+	GetInvitationByCode(ctx context.Context, codeHash string) (*Invitation, error)
+	GetInvitations(ctx context.Context) ([]Invitation, error)
+	RenewInvitation(ctx context.Context, id uint, codeHash string, expiresAt time.Time) error
+	RevokeInvitation(ctx context.Context, id uint) error
+	AcceptInvitation(ctx context.Context, id uint, userID uint) error
+
+	GetPendingRegistrations(ctx context.Context, registeredBefore time.Time) ([]User, error)
+	ApproveRegistration(ctx context.Context, id uint) error
+	RejectRegistration(ctx context.Context, id uint, reason string) error
+
+	SetUserName(ctx context.Context, id uint, userName string) error
+	IsUserNameReserved(ctx context.Context, userName string, exceptUserID uint) (bool, error)
+	CreateUserChange(ctx context.Context, changeParams CreateUserChangeParams) (*UserChange, error)
+	GetUserChanges(ctx context.Context, userID uint) ([]UserChange, error)
+	CreatePhoneVerification(ctx context.Context, verificationParams CreatePhoneVerificationParams) (*PhoneVerification, error)
+	GetPhoneVerification(ctx context.Context, userID uint) (*PhoneVerification, error)
+	FailPhoneVerification(ctx context.Context, id uint) error
+	CompletePhoneVerification(ctx context.Context, id uint) error
+
+	WithTx(ctx context.Context, fn func(tx DBConnector) error) error
+}
+
+// Timeouts bounds how long a single read or write operation may take.
+// Zero values fall back to the package defaults
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
 }
 
 type DBManager struct {
-	db *gorm.DB
+	db       *gorm.DB
+	timeouts Timeouts
+	pii      *PIICipher
+	inTx     bool
 }
 
 // NewDBManager creates the db manager using the provided DB connection
-func NewDBManager(db *gorm.DB) *DBManager {
-	db.AutoMigrate(&User{})
+func NewDBManager(db *gorm.DB, timeouts Timeouts) *DBManager {
+	if timeouts.Read == 0 {
+		timeouts.Read = defaultReadTimeout
+	}
+
+	if timeouts.Write == 0 {
+		timeouts.Write = defaultWriteTimeout
+	}
+
+	registerTenantScope(db)
 
 	return &DBManager{
-		db: db,
+		db:       db,
+		timeouts: timeouts,
 	}
 }
+
+// EnablePIIEncryption makes the manager encrypt personal data with piiCipher from now on.
+// Values already stored keep being readable and are re-encrypted by ReencryptPersonalData
+func (dbManager *DBManager) EnablePIIEncryption(piiCipher *PIICipher) {
+	dbManager.pii = piiCipher
+}
+
+func (dbManager *DBManager) readConn(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, dbManager.timeouts.Read)
+
+	return dbManager.db.WithContext(ctx), cancel
+}
+
+func (dbManager *DBManager) writeConn(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, dbManager.timeouts.Write)
+
+	return dbManager.db.WithContext(ctx), cancel
+}
+
+// WithTx runs fn as a single serializable unit of work. The whole function is retried
+// when the database aborts the transaction due to a serialization failure. Calls made
+// from inside a running transaction join it instead of opening a new one
+func (dbManager *DBManager) WithTx(ctx context.Context, fn func(tx DBConnector) error) error {
+	if dbManager.inTx {
+		return fn(dbManager)
+	}
+
+	var err error
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		err = dbManager.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(&DBManager{
+				db:       tx,
+				timeouts: dbManager.timeouts,
+				pii:      dbManager.pii,
+				inTx:     true,
+			})
+		}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+
+		if !IsSerializationFailureError(err) {
+			return err
+		}
+	}
+
+	return err
+}
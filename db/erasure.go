@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErasedFullName replaces the full name of erased users
+const ErasedFullName = "Erased User"
+
+// ErasedIdentity is the value replacing the username and phone of the erased user with id.
+// Usernames and phones cannot contain a dash, so it never clashes with a real user
+func ErasedIdentity(id uint) string {
+	return fmt.Sprintf("erased-%d", id)
+}
+
+// EraseUser anonymizes the personal data of a user in place. The user keeps its ID, so
+// audit events and other records referring to it stay valid, but its name, phone and username
+// are replaced, its credentials and custom attributes are cleared and its API keys, login
+// history, username and phone changes, phone verifications and accepted invitations are
+// removed. The personal data named by audit events is anonymized the same way
+func (dbManager *DBManager) EraseUser(ctx context.Context, id uint) (*User, error) {
+	var user User
+
+	err := dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		if err := conn.Where("id = ?", id).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &NotFoundError{
+					object: "user",
+				}
+			}
+
+			return err
+		}
+
+		// Failed logins of unknown usernames are only tied to the user by name, which other
+		// organizations may use as well
+		if err := conn.Where("organization_id = ?", user.OrganizationID).
+			Where("user_id = ? OR (user_id IS NULL AND user_name = ?)", id, user.UserName).
+			Delete(&LoginAttempt{}).Error; err != nil {
+			return err
+		}
+
+		if err := conn.Unscoped().Where("user_id = ?", id).Delete(&APIKey{}).Error; err != nil {
+			return err
+		}
+
+		if err := conn.Where("user_id = ?", id).Delete(&UserChange{}).Error; err != nil {
+			return err
+		}
+
+		if err := conn.Where("user_id = ?", id).Delete(&PhoneVerification{}).Error; err != nil {
+			return err
+		}
+
+		var invitationIDs []uint
+		if err := conn.Model(&Invitation{}).Where("user_id = ?", id).Pluck("id", &invitationIDs).Error; err != nil {
+			return err
+		}
+
+		if err := dbManager.eraseAuditPersonalValues(conn, &user, invitationIDs, true); err != nil {
+			return err
+		}
+
+		if err := conn.Where("user_id = ?", id).Delete(&Invitation{}).Error; err != nil {
+			return err
+		}
+
+		user.FullName = ErasedFullName
+		user.Phone = ErasedIdentity(id)
+		user.UserName = ErasedIdentity(id)
+		user.Password = ""
+		user.LoginToken = ""
+		user.Attributes = Attributes{}
+
+		sealed := user
+		if err := dbManager.sealUser(&sealed); err != nil {
+			return err
+		}
+
+		if err := conn.Model(&sealed).Select("FullName", "Phone", "PhoneIndex", "UserName", "Password", "LoginToken", "Attributes").Updates(&sealed).Error; err != nil {
+			return err
+		}
+
+		user.PhoneIndex = sealed.PhoneIndex
+		user.UpdatedAt = sealed.UpdatedAt
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// eraseAuditPersonalValues anonymizes the personal data of user named by audit events, along
+// with the data about the invitee of invitationIDs and, with byName, the username of user when
+// it was named by events about nobody in particular in its organization, such as failed logins
+func (dbManager *DBManager) eraseAuditPersonalValues(conn *gorm.DB, user *User, invitationIDs []uint, byName bool) error {
+	userName, _ := json.Marshal(user.UserName)
+
+	owned := conn.Where("user_id = ?", user.ID)
+	if byName {
+		owned = owned.Or("user_id IS NULL AND field = ? AND value = ?", "user_name", string(userName))
+	}
+	if len(invitationIDs) > 0 {
+		owned = owned.Or("invitation_id IN ?", invitationIDs)
+	}
+
+	var values []AuditPersonalValue
+	if err := conn.Where("organization_id = ?", user.OrganizationID).Where(owned).Find(&values).Error; err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		erased, err := dbManager.pii.Encrypt("audit_personal_values", value.ID, value.Field, erasedPersonalValue(value.Field, user.ID))
+		if err != nil {
+			return err
+		}
+
+		if err := conn.Model(&AuditPersonalValue{}).Where("id = ?", value.ID).Update("value", erased).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
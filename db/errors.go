@@ -1,18 +1,90 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
 )
 
 const (
-	UniqueViolationError = pq.ErrorCode("23505")
+	UniqueViolationError      = pq.ErrorCode("23505")
+	SerializationFailureError = pq.ErrorCode("40001")
+	DeadlockDetectedError     = pq.ErrorCode("40P01")
 )
 
+// sqlState extracts the SQLSTATE code of Postgres errors reported either by pgx or lib/pq
+func sqlState(err error) (pq.ErrorCode, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pq.ErrorCode(pgErr.Code), true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code, true
+	}
+
+	return "", false
+}
+
 func IsUniqueConstraintViolationError(err error) bool {
-	if pqErr, ok := err.(*pq.Error); ok {
-		return pqErr.Code == UniqueViolationError
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+
+	if code, ok := sqlState(err); ok {
+		return code == UniqueViolationError
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	return false
+}
+
+// ViolatedConstraint describes the constraint broken by a constraint violation error. Postgres
+// reports the constraint name (e.g. users_phone_key) and SQLite the columns involved (e.g. users.phone)
+func ViolatedConstraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.ConstraintName
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		message := sqliteErr.Error()
+		if index := strings.LastIndex(message, ": "); index != -1 {
+			return message[index+2:]
+		}
+
+		return message
+	}
+
+	return ""
+}
+
+// IsSerializationFailureError reports whether the transaction was aborted by the database
+// and can be safely retried
+func IsSerializationFailureError(err error) bool {
+	if code, ok := sqlState(err); ok {
+		return code == SerializationFailureError || code == DeadlockDetectedError
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
 	}
 
 	return false
@@ -33,3 +105,13 @@ type NotFoundError struct {
 func (n *NotFoundError) Error() string {
 	return fmt.Sprintf("Could not find an %s with the provided parameters", n.object)
 }
+
+// VersionConflictError reports that an object was modified after the version an update was
+// based on was read
+type VersionConflictError struct {
+	object string
+}
+
+func (v *VersionConflictError) Error() string {
+	return fmt.Sprintf("The %s was modified since it was read", v.object)
+}
@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var groupNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// IsValidGroupName reports whether name can name a group: lowercase letters, digits, dashes and
+// underscores, starting with a letter or a digit
+func IsValidGroupName(name string) bool {
+	return groupNameRegexp.MatchString(name)
+}
+
+type Group struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Name           string `gorm:"unique"`
+	Description    string
+	OrganizationID uint
+}
+
+// GroupMember places either a user or another group, but never both, in a group. Members of a
+// nested group are members of every group containing it
+type GroupMember struct {
+	ID            uint `gorm:"primaryKey"`
+	CreatedAt     time.Time
+	GroupID       uint
+	UserID        *uint
+	MemberGroupID *uint
+}
+
+type CreateGroupParams struct {
+	Name        string
+	Description string
+}
+
+// GroupMemberParams identifies a member of the group with GroupID, which is either the user
+// with UserID or the group with MemberGroupID
+type GroupMemberParams struct {
+	GroupID       uint
+	UserID        uint
+	MemberGroupID uint
+}
+
+// GroupMembers lists the direct members of a group
+type GroupMembers struct {
+	Users  []User
+	Groups []Group
+}
+
+// memberCondition returns the condition matching the membership described by memberParams
+func memberCondition(memberParams GroupMemberParams) (string, []any) {
+	if memberParams.UserID != 0 {
+		return "group_id = ? AND user_id = ?", []any{memberParams.GroupID, memberParams.UserID}
+	}
+
+	return "group_id = ? AND member_group_id = ?", []any{memberParams.GroupID, memberParams.MemberGroupID}
+}
+
+func (dbManager *DBManager) CreateGroup(ctx context.Context, groupParams CreateGroupParams) (*Group, error) {
+	group := &Group{
+		Name:        groupParams.Name,
+		Description: groupParams.Description,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Create(group)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("A group with the provided name already exists"),
+			}
+		}
+
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (dbManager *DBManager) GetGroup(ctx context.Context, name string) (*Group, error) {
+	var group Group
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("name = ?", name).First(&group)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "user group",
+			}
+		}
+
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (dbManager *DBManager) GetGroups(ctx context.Context) ([]Group, error) {
+	var groups []Group
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Order("name").Find(&groups)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// AddGroupMember adds a user or a group to a group. Groups cannot end up containing themselves,
+// directly or through nested groups
+func (dbManager *DBManager) AddGroupMember(ctx context.Context, memberParams GroupMemberParams) error {
+	return dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		member := &GroupMember{
+			GroupID: memberParams.GroupID,
+		}
+
+		if memberParams.UserID != 0 {
+			member.UserID = &memberParams.UserID
+		} else {
+			member.MemberGroupID = &memberParams.MemberGroupID
+
+			// The group and every group containing it, however deeply
+			var cycles int64
+			result := conn.Raw(`WITH RECURSIVE containers(id) AS (
+				SELECT CAST(? AS bigint)
+				UNION
+				SELECT group_members.group_id FROM group_members JOIN containers ON group_members.member_group_id = containers.id
+			) SELECT count(*) FROM containers WHERE id = ?`, memberParams.GroupID, memberParams.MemberGroupID).Scan(&cycles)
+
+			if err := result.Error; err != nil {
+				return err
+			}
+
+			if cycles > 0 {
+				return &BadInputError{
+					Err: fmt.Errorf("A group cannot contain itself"),
+				}
+			}
+		}
+
+		if err := conn.Create(member).Error; err != nil {
+			if IsUniqueConstraintViolationError(err) {
+				return &BadInputError{
+					Err: fmt.Errorf("The member already belongs to the group"),
+				}
+			}
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (dbManager *DBManager) RemoveGroupMember(ctx context.Context, memberParams GroupMemberParams) error {
+	condition, args := memberCondition(memberParams)
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Where(condition, args...).Delete(&GroupMember{})
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user group membership",
+		}
+	}
+
+	return nil
+}
+
+// GetGroupMembers returns the users which were not deleted and the groups placed directly in
+// the group with groupID
+func (dbManager *DBManager) GetGroupMembers(ctx context.Context, groupID uint) (*GroupMembers, error) {
+	members := &GroupMembers{}
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	memberIDs := func(column string) *gorm.DB {
+		return conn.Model(&GroupMember{}).Select(column).Where("group_id = ? AND "+column+" IS NOT NULL", groupID)
+	}
+
+	if err := conn.Where("id IN (?)", memberIDs("user_id")).Order("id").Find(&members.Users).Error; err != nil {
+		return nil, err
+	}
+
+	if err := dbManager.openUsers(members.Users); err != nil {
+		return nil, err
+	}
+
+	if err := conn.Where("id IN (?)", memberIDs("member_group_id")).Order("name").Find(&members.Groups).Error; err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetUserGroups returns every group the user with userID belongs to, either directly or through
+// nested groups, ordered by name
+func (dbManager *DBManager) GetUserGroups(ctx context.Context, userID uint) ([]Group, error) {
+	var groups []Group
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Raw(`WITH RECURSIVE member_of(id) AS (
+		SELECT group_id FROM group_members WHERE user_id = ?
+		UNION
+		SELECT group_members.group_id FROM group_members JOIN member_of ON group_members.member_group_id = member_of.id
+	) SELECT * FROM "groups" WHERE id IN (SELECT id FROM member_of) ORDER BY name`, userID).Scan(&groups)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
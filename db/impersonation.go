@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Impersonation struct {
+	gorm.Model
+	AdminID   uint
+	UserID    uint
+	Reason    string
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+// Active reports whether the tokens of the impersonation are still accepted
+func (impersonation *Impersonation) Active() bool {
+	return impersonation.EndedAt == nil && time.Now().Before(impersonation.ExpiresAt)
+}
+
+type CreateImpersonationParams struct {
+	AdminID   uint
+	UserID    uint
+	Reason    string
+	ExpiresAt time.Time
+}
+
+func (dbManager *DBManager) CreateImpersonation(ctx context.Context, impersonationParams CreateImpersonationParams) (*Impersonation, error) {
+	impersonation := &Impersonation{
+		AdminID:   impersonationParams.AdminID,
+		UserID:    impersonationParams.UserID,
+		Reason:    impersonationParams.Reason,
+		ExpiresAt: impersonationParams.ExpiresAt,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Omit("EndedAt").Create(impersonation)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return impersonation, nil
+}
+
+// GetImpersonations lists the impersonations of the user with userID from the oldest to the newest
+func (dbManager *DBManager) GetImpersonations(ctx context.Context, userID uint) ([]Impersonation, error) {
+	var impersonations []Impersonation
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_id = ?", userID).Order("id").Find(&impersonations)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return impersonations, nil
+}
+
+func (dbManager *DBManager) GetImpersonation(ctx context.Context, id uint) (*Impersonation, error) {
+	var impersonation Impersonation
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.First(&impersonation, id)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "impersonation",
+			}
+		}
+
+		return nil, err
+	}
+
+	return &impersonation, nil
+}
+
+// EndImpersonation ends the impersonation with id, so that its tokens stop being accepted
+func (dbManager *DBManager) EndImpersonation(ctx context.Context, id uint) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&Impersonation{}).Where("id = ? AND ended_at IS NULL", id).Update("ended_at", time.Now())
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "impersonation",
+		}
+	}
+
+	return nil
+}
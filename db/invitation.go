@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets the person reached at Phone join an organization, as one of its admins when
+// OrgAdmin is set. Only the hash of its code is stored, and sending the invitation again
+// replaces the code. FullName and Phone are encrypted like the personal data of users
+type Invitation struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID uint
+	InviterID      *uint
+	FullName       string
+	Phone          string
+	OrgAdmin       bool
+	CodeHash       string `gorm:"unique"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	UserID         *uint
+	RevokedAt      *time.Time
+}
+
+// Status returns whether the invitation is pending, accepted, revoked or expired at now
+func (invitation *Invitation) Status(now time.Time) string {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return InvitationAccepted
+	case invitation.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(invitation.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+type CreateInvitationParams struct {
+	InviterID *uint
+	FullName  string
+	Phone     string
+	OrgAdmin  bool
+	CodeHash  string
+	ExpiresAt time.Time
+}
+
+// openInvitation decrypts the personal data of a stored invitation
+func (dbManager *DBManager) openInvitation(invitation *Invitation) error {
+	var err error
+
+	if invitation.FullName, err = dbManager.pii.Decrypt("invitations", invitation.ID, "full_name", invitation.FullName); err != nil {
+		return err
+	}
+
+	invitation.Phone, err = dbManager.pii.Decrypt("invitations", invitation.ID, "phone", invitation.Phone)
+
+	return err
+}
+
+func (dbManager *DBManager) CreateInvitation(ctx context.Context, invitationParams CreateInvitationParams) (*Invitation, error) {
+	invitation := &Invitation{
+		InviterID: invitationParams.InviterID,
+		FullName:  invitationParams.FullName,
+		Phone:     invitationParams.Phone,
+		OrgAdmin:  invitationParams.OrgAdmin,
+		CodeHash:  invitationParams.CodeHash,
+		ExpiresAt: invitationParams.ExpiresAt,
+	}
+
+	// The personal data of the invitee is encrypted
+	sealed := *invitation
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	err := dbManager.createSealed(conn, "invitations", func(conn *gorm.DB) (uint, error) {
+		err := conn.Omit("AcceptedAt", "UserID", "RevokedAt").Create(&sealed).Error
+
+		return sealed.ID, err
+	}, sealedColumn{name: "full_name", field: "full_name", value: &sealed.FullName},
+		sealedColumn{name: "phone", field: "phone", value: &sealed.Phone})
+
+	if err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An invitation with the provided code already exists"),
+			}
+		}
+
+		return nil, err
+	}
+
+	invitation.ID = sealed.ID
+	invitation.CreatedAt = sealed.CreatedAt
+	invitation.UpdatedAt = sealed.UpdatedAt
+	invitation.OrganizationID = sealed.OrganizationID
+
+	return invitation, nil
+}
+
+func (dbManager *DBManager) getInvitation(ctx context.Context, query string, args ...any) (*Invitation, error) {
+	var invitation Invitation
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where(query, args...).First(&invitation)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "invitation",
+			}
+		}
+
+		return nil, err
+	}
+
+	if err := dbManager.openInvitation(&invitation); err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+func (dbManager *DBManager) GetInvitation(ctx context.Context, id uint) (*Invitation, error) {
+	return dbManager.getInvitation(ctx, "id = ?", id)
+}
+
+// GetInvitationByCode finds the invitation whose code hashes to codeHash
+func (dbManager *DBManager) GetInvitationByCode(ctx context.Context, codeHash string) (*Invitation, error) {
+	return dbManager.getInvitation(ctx, "code_hash = ?", codeHash)
+}
+
+func (dbManager *DBManager) GetInvitations(ctx context.Context) ([]Invitation, error) {
+	var invitations []Invitation
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Order("id").Find(&invitations)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	for i := range invitations {
+		if err := dbManager.openInvitation(&invitations[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return invitations, nil
+}
+
+// updatePendingInvitation applies values to the invitation with id, unless it was already
+// accepted or revoked
+func (dbManager *DBManager) updatePendingInvitation(ctx context.Context, id uint, values map[string]any) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&Invitation{}).Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).Updates(values)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return &BadInputError{
+				Err: fmt.Errorf("An invitation with the provided code already exists"),
+			}
+		}
+
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "invitation",
+		}
+	}
+
+	return nil
+}
+
+// RenewInvitation replaces the code of a pending invitation, invalidating the previous one
+func (dbManager *DBManager) RenewInvitation(ctx context.Context, id uint, codeHash string, expiresAt time.Time) error {
+	return dbManager.updatePendingInvitation(ctx, id, map[string]any{
+		"code_hash":  codeHash,
+		"expires_at": expiresAt,
+	})
+}
+
+func (dbManager *DBManager) RevokeInvitation(ctx context.Context, id uint) error {
+	return dbManager.updatePendingInvitation(ctx, id, map[string]any{
+		"revoked_at": time.Now(),
+	})
+}
+
+// AcceptInvitation records that the user with userID joined through a pending invitation
+func (dbManager *DBManager) AcceptInvitation(ctx context.Context, id uint, userID uint) error {
+	return dbManager.updatePendingInvitation(ctx, id, map[string]any{
+		"accepted_at": time.Now(),
+		"user_id":     userID,
+	})
+}
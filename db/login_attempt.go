@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempt records a successful or failed login to an organization. UserID is nil when no
+// user with UserName exists in it. NewDevice marks successful logins from a user agent the user
+// never logged in with before
+type LoginAttempt struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	OrganizationID uint
+	UserID         *uint
+	UserName       string
+	Success        bool
+	FailureReason  string
+	IP             string
+	UserAgent      string
+	Country        string
+	Region         string
+	City           string
+	NewDevice      bool
+}
+
+type CreateLoginAttemptParams struct {
+	UserID        *uint
+	UserName      string
+	Success       bool
+	FailureReason string
+	IP            string
+	UserAgent     string
+	Country       string
+	Region        string
+	City          string
+	NewDevice     bool
+}
+
+// GetLoginAttemptsParams filters the login attempts of a user, which are listed from the
+// newest to the oldest. Success and UserAgent only keep matching attempts when set and
+// BeforeID continues a listing. A zero Limit lists every matching attempt
+type GetLoginAttemptsParams struct {
+	UserID    uint
+	Success   *bool
+	UserAgent *string
+	BeforeID  uint
+	Limit     int
+}
+
+func (dbManager *DBManager) CreateLoginAttempt(ctx context.Context, loginParams CreateLoginAttemptParams) (*LoginAttempt, error) {
+	loginAttempt := &LoginAttempt{
+		CreatedAt:     time.Now().UTC().Truncate(time.Microsecond),
+		UserID:        loginParams.UserID,
+		UserName:      loginParams.UserName,
+		Success:       loginParams.Success,
+		FailureReason: loginParams.FailureReason,
+		IP:            loginParams.IP,
+		UserAgent:     loginParams.UserAgent,
+		Country:       loginParams.Country,
+		Region:        loginParams.Region,
+		City:          loginParams.City,
+		NewDevice:     loginParams.NewDevice,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Create(loginAttempt)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return loginAttempt, nil
+}
+
+func (dbManager *DBManager) GetLoginAttempts(ctx context.Context, searchParams GetLoginAttemptsParams) ([]LoginAttempt, error) {
+	var loginAttempts []LoginAttempt
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	query := conn.Where("user_id = ?", searchParams.UserID)
+
+	if searchParams.Success != nil {
+		query = query.Where("success = ?", *searchParams.Success)
+	}
+
+	if searchParams.UserAgent != nil {
+		query = query.Where("user_agent = ?", *searchParams.UserAgent)
+	}
+
+	if searchParams.BeforeID != 0 {
+		query = query.Where("id < ?", searchParams.BeforeID)
+	}
+
+	if searchParams.Limit > 0 {
+		query = query.Limit(searchParams.Limit)
+	}
+
+	result := query.Order("id DESC").Find(&loginAttempts)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return loginAttempts, nil
+}
@@ -0,0 +1,2089 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memoryStore holds the rows of every table kept by MemoryConnector
+type memoryStore struct {
+	users          map[uint]User
+	apiKeys        map[uint]APIKey
+	impersonations map[uint]Impersonation
+	auditEvents    map[uint]AuditEvent
+	auditPersonal  map[uint]AuditPersonalValue
+	loginAttempts  map[uint]LoginAttempt
+	attributeDefs  map[uint]AttributeDefinition
+	groups         map[uint]Group
+	groupMembers   map[uint]GroupMember
+	organizations  map[uint]Organization
+	invitations    map[uint]Invitation
+	userChanges    map[uint]UserChange
+	phoneVerifs    map[uint]PhoneVerification
+	lastID         map[string]uint
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:          map[uint]User{},
+		apiKeys:        map[uint]APIKey{},
+		impersonations: map[uint]Impersonation{},
+		auditEvents:    map[uint]AuditEvent{},
+		auditPersonal:  map[uint]AuditPersonalValue{},
+		loginAttempts:  map[uint]LoginAttempt{},
+		attributeDefs:  map[uint]AttributeDefinition{},
+		groups:         map[uint]Group{},
+		groupMembers:   map[uint]GroupMember{},
+		organizations:  map[uint]Organization{},
+		invitations:    map[uint]Invitation{},
+		userChanges:    map[uint]UserChange{},
+		phoneVerifs:    map[uint]PhoneVerification{},
+		lastID:         map[string]uint{},
+	}
+}
+
+func (store *memoryStore) clone() *memoryStore {
+	cloned := newMemoryStore()
+
+	for id, user := range store.users {
+		cloned.users[id] = user
+	}
+
+	for id, apiKey := range store.apiKeys {
+		cloned.apiKeys[id] = apiKey
+	}
+
+	for id, impersonation := range store.impersonations {
+		cloned.impersonations[id] = impersonation
+	}
+
+	for id, auditEvent := range store.auditEvents {
+		cloned.auditEvents[id] = auditEvent
+	}
+
+	for id, value := range store.auditPersonal {
+		cloned.auditPersonal[id] = value
+	}
+
+	for id, loginAttempt := range store.loginAttempts {
+		cloned.loginAttempts[id] = loginAttempt
+	}
+
+	for id, definition := range store.attributeDefs {
+		cloned.attributeDefs[id] = definition
+	}
+
+	for id, group := range store.groups {
+		cloned.groups[id] = group
+	}
+
+	for id, member := range store.groupMembers {
+		cloned.groupMembers[id] = member
+	}
+
+	for id, organization := range store.organizations {
+		cloned.organizations[id] = organization
+	}
+
+	for id, invitation := range store.invitations {
+		cloned.invitations[id] = invitation
+	}
+
+	for id, change := range store.userChanges {
+		cloned.userChanges[id] = change
+	}
+
+	for id, verification := range store.phoneVerifs {
+		cloned.phoneVerifs[id] = verification
+	}
+
+	for table, id := range store.lastID {
+		cloned.lastID[table] = id
+	}
+
+	return cloned
+}
+
+func (store *memoryStore) nextID(table string) uint {
+	store.lastID[table]++
+
+	return store.lastID[table]
+}
+
+// sortedIDs returns the keys of a table in insertion order
+func sortedIDs[T any](rows map[uint]T) []uint {
+	ids := make([]uint, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// inTenant reports whether a row of the organization with organizationID can be seen with ctx
+func inTenant(ctx context.Context, organizationID uint) bool {
+	tenant := TenantFromContext(ctx)
+
+	return tenant == 0 || tenant == organizationID
+}
+
+// MemoryConnector is a DBConnector keeping all data in memory. It follows the uniqueness,
+// soft delete and not found semantics of DBManager and is meant for hermetic tests.
+// Transactions are serialized: while WithTx runs every other call waits for it to finish
+type MemoryConnector struct {
+	mu    *sync.RWMutex
+	store *memoryStore
+	inTx  bool
+}
+
+// NewMemoryConnector creates an in-memory connector holding only the default organization
+func NewMemoryConnector() *MemoryConnector {
+	store := newMemoryStore()
+
+	now := time.Now()
+	store.organizations[DefaultOrganizationID] = Organization{
+		ID:          store.nextID("organizations"),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Name:        "default",
+		DisplayName: "Default",
+	}
+
+	return &MemoryConnector{
+		mu:    &sync.RWMutex{},
+		store: store,
+	}
+}
+
+// WithTx runs fn against a copy of the data, which replaces the current data only when fn succeeds
+func (connector *MemoryConnector) WithTx(ctx context.Context, fn func(tx DBConnector) error) error {
+	if connector.inTx {
+		return fn(connector)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	tx := &MemoryConnector{
+		mu:    &sync.RWMutex{},
+		store: connector.store.clone(),
+		inTx:  true,
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	connector.store = tx.store
+
+	return nil
+}
+
+func (connector *MemoryConnector) CreateUser(ctx context.Context, userParams CreateUserParams) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	organizationID := tenantOf(ctx)
+
+	// Unique constraints only take users of the same organization which were not deleted into
+	// account
+	for _, user := range connector.store.users {
+		if user.DeletedAt.Valid || user.OrganizationID != organizationID {
+			continue
+		}
+
+		if user.Phone == userParams.Phone {
+			return nil, duplicateUserError("phone")
+		}
+
+		if user.UserName == userParams.UserName {
+			return nil, duplicateUserError("user_name")
+		}
+	}
+
+	if connector.isUserNameReserved(organizationID, userParams.UserName, 0) {
+		return nil, errReservedUserName
+	}
+
+	now := time.Now()
+	user := User{
+		FullName:       userParams.FullName,
+		Phone:          userParams.Phone,
+		UserName:       userParams.UserName,
+		Password:       userParams.Password,
+		Admin:          false,
+		ServiceAccount: userParams.ServiceAccount,
+		Attributes:     userParams.Attributes.clone(),
+		OrganizationID: organizationID,
+
+		RegistrationStatus: registrationStatusOf(userParams),
+		Version:            1,
+	}
+	user.ID = connector.store.nextID("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	connector.store.users[user.ID] = user
+
+	return &user, nil
+}
+
+// findUser returns the first live user seen with ctx matching the filter
+func (connector *MemoryConnector) findUser(ctx context.Context, filter func(user User) bool) (*User, error) {
+	for _, id := range sortedIDs(connector.store.users) {
+		user := connector.store.users[id]
+		if !user.DeletedAt.Valid && inTenant(ctx, user.OrganizationID) && filter(user) {
+			return &user, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "user",
+	}
+}
+
+func (connector *MemoryConnector) GetUser(ctx context.Context, userName string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	return connector.findUser(ctx, func(user User) bool {
+		return user.UserName == userName
+	})
+}
+
+func (connector *MemoryConnector) GetUserByID(ctx context.Context, id uint) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	return connector.findUser(ctx, func(user User) bool {
+		return user.ID == id
+	})
+}
+
+// matchesUsersFilters reports whether user passes the filters of searchParams
+func matchesUsersFilters(user User, searchParams GetUsersParams) bool {
+	switch searchParams.Deleted {
+	case DeletedInclude:
+	case DeletedOnly:
+		if !user.DeletedAt.Valid {
+			return false
+		}
+	default:
+		if user.DeletedAt.Valid {
+			return false
+		}
+	}
+
+	admin := false
+	if searchParams.Admin != nil {
+		admin = *searchParams.Admin
+	}
+
+	if user.Admin != admin || !user.IsRegistrationApproved() {
+		return false
+	}
+
+	if !strings.HasPrefix(strings.ToLower(user.UserName), strings.ToLower(searchParams.UserNamePrefix)) {
+		return false
+	}
+
+	if !strings.HasPrefix(strings.ToLower(user.FullName), strings.ToLower(searchParams.FullNamePrefix)) {
+		return false
+	}
+
+	if searchParams.Phone != "" && user.Phone != searchParams.Phone {
+		return false
+	}
+
+	if searchParams.CreatedAfter != nil && user.CreatedAt.Before(*searchParams.CreatedAfter) {
+		return false
+	}
+
+	if searchParams.CreatedBefore != nil && user.CreatedAt.After(*searchParams.CreatedBefore) {
+		return false
+	}
+
+	if searchParams.UpdatedAfter != nil && user.UpdatedAt.Before(*searchParams.UpdatedAfter) {
+		return false
+	}
+
+	if searchParams.UpdatedBefore != nil && user.UpdatedAt.After(*searchParams.UpdatedBefore) {
+		return false
+	}
+
+	for name, value := range searchParams.Attributes {
+		if held, ok := user.Attributes[name]; !ok || held != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareUsers orders two users by a sortable field, returning a negative number when a
+// comes first. Users without a deletion time come first, as NULL values do in DBManager
+func compareUsers(a User, b User, field string) int {
+	switch field {
+	case "user_name":
+		return strings.Compare(a.UserName, b.UserName)
+	case "full_name":
+		return strings.Compare(a.FullName, b.FullName)
+	case "phone":
+		return strings.Compare(a.Phone, b.Phone)
+	case "admin":
+		if a.Admin == b.Admin {
+			return 0
+		} else if b.Admin {
+			return -1
+		}
+
+		return 1
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case "deleted_at":
+		if a.DeletedAt.Valid != b.DeletedAt.Valid {
+			if b.DeletedAt.Valid {
+				return -1
+			}
+
+			return 1
+		}
+
+		return a.DeletedAt.Time.Compare(b.DeletedAt.Time)
+	}
+
+	return 0
+}
+
+func (connector *MemoryConnector) GetUsers(ctx context.Context, searchParams GetUsersParams) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sortBy := searchParams.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	if !IsSortableUserField(sortBy) {
+		return nil, &BadInputError{
+			Err: fmt.Errorf("Users cannot be sorted by %s", sortBy),
+		}
+	}
+
+	if err := checkUsersCursor(sortBy, searchParams); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	users := []User{}
+	for _, id := range sortedIDs(connector.store.users) {
+		user := connector.store.users[id]
+		if inTenant(ctx, user.OrganizationID) && matchesUsersFilters(user, searchParams) {
+			users = append(users, user)
+		}
+	}
+
+	compare := func(a User, b User) int {
+		comparison := compareUsers(a, b, sortBy)
+		if comparison == 0 {
+			comparison = int(a.ID) - int(b.ID)
+		}
+
+		if searchParams.SortDesc {
+			return -comparison
+		}
+
+		return comparison
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return compare(users[i], users[j]) < 0
+	})
+
+	var page []User
+	if cursor := searchParams.Cursor; cursor != nil {
+		position := cursorUser(cursor)
+
+		if cursor.Backward {
+			end := 0
+			for end < len(users) && compare(users[end], position) < 0 {
+				end++
+			}
+
+			start := end - searchParams.Offset
+			if start < 0 {
+				start = 0
+			}
+
+			page = users[start:end]
+		} else {
+			start := 0
+			for start < len(users) && compare(users[start], position) <= 0 {
+				start++
+			}
+
+			end := start + searchParams.Offset
+			if end > len(users) {
+				end = len(users)
+			}
+
+			page = users[start:end]
+		}
+	} else {
+		start := searchParams.PageIndex * searchParams.Offset
+		if start > len(users) {
+			start = len(users)
+		}
+
+		end := start + searchParams.Offset
+		if end > len(users) {
+			end = len(users)
+		}
+
+		page = users[start:end]
+	}
+
+	for i := range page {
+		page[i].LoginToken = ""
+	}
+
+	return page, nil
+}
+
+// cursorUser builds a user holding the position stored in cursor, to compare users against it
+func cursorUser(cursor *UsersCursor) User {
+	user := User{}
+	user.ID = cursor.ID
+
+	switch value := cursor.Value.(type) {
+	case string:
+		switch cursor.SortBy {
+		case "user_name":
+			user.UserName = value
+		case "full_name":
+			user.FullName = value
+		case "phone":
+			user.Phone = value
+		}
+	case bool:
+		user.Admin = value
+	case time.Time:
+		switch cursor.SortBy {
+		case "created_at":
+			user.CreatedAt = value
+		case "updated_at":
+			user.UpdatedAt = value
+		case "deleted_at":
+			user.DeletedAt = gorm.DeletedAt{Time: value, Valid: true}
+		}
+	}
+
+	return user
+}
+
+func (connector *MemoryConnector) CountUsers(ctx context.Context, searchParams GetUsersParams) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	var count int64
+	for _, user := range connector.store.users {
+		if inTenant(ctx, user.OrganizationID) && matchesUsersFilters(user, searchParams) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (connector *MemoryConnector) SearchUsers(ctx context.Context, searchParams SearchUsersParams) ([]UserSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	users := []User{}
+	for _, id := range sortedIDs(connector.store.users) {
+		user := connector.store.users[id]
+		if !user.DeletedAt.Valid && !user.Admin && user.IsRegistrationApproved() && inTenant(ctx, user.OrganizationID) {
+			user.LoginToken = ""
+			users = append(users, user)
+		}
+	}
+
+	return rankUsers(users, SearchTerms(searchParams.Query), searchParams.Limit), nil
+}
+
+func (connector *MemoryConnector) UpdateUser(ctx context.Context, updateParams UpdateUserParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[updateParams.ID]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return nil
+	}
+
+	if user.Version != updateParams.Version {
+		return &VersionConflictError{
+			object: "user",
+		}
+	}
+
+	for id, other := range connector.store.users {
+		if id != user.ID && !other.DeletedAt.Valid && other.OrganizationID == user.OrganizationID && other.Phone == updateParams.Phone {
+			return duplicateUserError("phone")
+		}
+	}
+
+	user.FullName = updateParams.FullName
+	user.Phone = updateParams.Phone
+	user.Password = updateParams.Password
+	user.LoginToken = updateParams.LoginToken
+	user.UpdatedAt = time.Now()
+	user.Version++
+
+	connector.store.users[user.ID] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) SetLoginToken(ctx context.Context, id uint, loginToken string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	user.LoginToken = loginToken
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) DeleteUser(ctx context.Context, userName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for id, user := range connector.store.users {
+		if user.UserName == userName && !user.DeletedAt.Valid && inTenant(ctx, user.OrganizationID) {
+			user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			connector.store.users[id] = user
+		}
+	}
+
+	return nil
+}
+
+func (connector *MemoryConnector) RestoreUser(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || !user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	for _, other := range connector.store.users {
+		if other.DeletedAt.Valid || other.OrganizationID != user.OrganizationID {
+			continue
+		}
+
+		if other.Phone == user.Phone {
+			return duplicateUserError("phone")
+		}
+
+		if other.UserName == user.UserName {
+			return duplicateUserError("user_name")
+		}
+	}
+
+	user.DeletedAt = gorm.DeletedAt{}
+	connector.store.users[id] = user
+
+	return nil
+}
+
+// eraseAuditPersonalValues anonymizes the personal data of user named by audit events, along
+// with the data about the invitee of invitationIDs and, with byName, the username of user when
+// it was named by events about nobody in particular in its organization
+func (connector *MemoryConnector) eraseAuditPersonalValues(user *User, invitationIDs map[uint]bool, byName bool) {
+	userName, _ := json.Marshal(user.UserName)
+	for valueID, value := range connector.store.auditPersonal {
+		named := byName && value.UserID == nil && value.Field == "user_name" && value.Value == string(userName)
+		owned := isUserID(value.UserID, user.ID) || (value.InvitationID != nil && invitationIDs[*value.InvitationID]) || named
+		if value.OrganizationID == user.OrganizationID && owned {
+			value.Value = erasedPersonalValue(value.Field, user.ID)
+			connector.store.auditPersonal[valueID] = value
+		}
+	}
+}
+
+// purgeUser removes a user and, as the foreign key cascade would, its API keys, login history,
+// group memberships, username and phone changes and phone verifications. The personal data
+// named by audit events is anonymized as when erasing the user
+func (connector *MemoryConnector) purgeUser(id uint) {
+	user := connector.store.users[id]
+
+	invitationIDs := map[uint]bool{}
+	for invitationID, invitation := range connector.store.invitations {
+		if isUserID(invitation.UserID, id) {
+			invitationIDs[invitationID] = true
+		}
+	}
+
+	namesake := false
+	for otherID, other := range connector.store.users {
+		if otherID != id && other.OrganizationID == user.OrganizationID && other.UserName == user.UserName {
+			namesake = true
+		}
+	}
+
+	connector.eraseAuditPersonalValues(&user, invitationIDs, !namesake)
+
+	delete(connector.store.users, id)
+
+	for changeID, change := range connector.store.userChanges {
+		if change.UserID == id {
+			delete(connector.store.userChanges, changeID)
+		}
+	}
+
+	for verificationID, verification := range connector.store.phoneVerifs {
+		if verification.UserID == id {
+			delete(connector.store.phoneVerifs, verificationID)
+		}
+	}
+
+	for memberID, member := range connector.store.groupMembers {
+		if isUserID(member.UserID, id) {
+			delete(connector.store.groupMembers, memberID)
+		}
+	}
+
+	for apiKeyID, apiKey := range connector.store.apiKeys {
+		if apiKey.UserID == id {
+			delete(connector.store.apiKeys, apiKeyID)
+		}
+	}
+
+	for loginAttemptID, loginAttempt := range connector.store.loginAttempts {
+		if isUserID(loginAttempt.UserID, id) {
+			delete(connector.store.loginAttempts, loginAttemptID)
+		}
+	}
+
+	for invitationID, invitation := range connector.store.invitations {
+		if isUserID(invitation.InviterID, id) {
+			invitation.InviterID = nil
+		}
+
+		if isUserID(invitation.UserID, id) {
+			invitation.UserID = nil
+		}
+
+		connector.store.invitations[invitationID] = invitation
+	}
+}
+
+func (connector *MemoryConnector) PurgeUser(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || !user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	connector.purgeUser(id)
+
+	return nil
+}
+
+func (connector *MemoryConnector) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	var purged int64
+	for id, user := range connector.store.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(deletedBefore) && inTenant(ctx, user.OrganizationID) {
+			connector.purgeUser(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (connector *MemoryConnector) CreateAPIKey(ctx context.Context, apiKeyParams CreateAPIKeyParams) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for _, apiKey := range connector.store.apiKeys {
+		if apiKey.Prefix == apiKeyParams.Prefix {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An API key with the provided prefix already exists"),
+			}
+		}
+	}
+
+	now := time.Now()
+	apiKey := APIKey{
+		UserID:    apiKeyParams.UserID,
+		Name:      apiKeyParams.Name,
+		Prefix:    apiKeyParams.Prefix,
+		KeyHash:   apiKeyParams.KeyHash,
+		Scopes:    strings.Join(apiKeyParams.Scopes, " "),
+		ExpiresAt: apiKeyParams.ExpiresAt,
+	}
+	apiKey.ID = connector.store.nextID("api_keys")
+	apiKey.CreatedAt = now
+	apiKey.UpdatedAt = now
+
+	connector.store.apiKeys[apiKey.ID] = apiKey
+
+	return &apiKey, nil
+}
+
+func (connector *MemoryConnector) GetAPIKey(ctx context.Context, prefix string) (*APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	for _, id := range sortedIDs(connector.store.apiKeys) {
+		apiKey := connector.store.apiKeys[id]
+		if apiKey.Prefix == prefix && !apiKey.DeletedAt.Valid {
+			return &apiKey, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "API key",
+	}
+}
+
+func (connector *MemoryConnector) GetAPIKeys(ctx context.Context, userID uint) ([]APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	apiKeys := []APIKey{}
+	for _, id := range sortedIDs(connector.store.apiKeys) {
+		apiKey := connector.store.apiKeys[id]
+		if apiKey.UserID == userID && !apiKey.DeletedAt.Valid {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+
+	return apiKeys, nil
+}
+
+func (connector *MemoryConnector) RevokeAPIKey(ctx context.Context, userID uint, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for id, apiKey := range connector.store.apiKeys {
+		if apiKey.UserID == userID && apiKey.Prefix == prefix && apiKey.RevokedAt == nil && !apiKey.DeletedAt.Valid {
+			now := time.Now()
+			apiKey.RevokedAt = &now
+			apiKey.UpdatedAt = now
+			connector.store.apiKeys[id] = apiKey
+
+			return nil
+		}
+	}
+
+	return &NotFoundError{
+		object: "API key",
+	}
+}
+
+func (connector *MemoryConnector) TouchAPIKey(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	if apiKey, ok := connector.store.apiKeys[id]; ok && !apiKey.DeletedAt.Valid {
+		now := time.Now()
+		apiKey.LastUsedAt = &now
+		connector.store.apiKeys[id] = apiKey
+	}
+
+	return nil
+}
+
+func (connector *MemoryConnector) CreateImpersonation(ctx context.Context, impersonationParams CreateImpersonationParams) (*Impersonation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	now := time.Now()
+	impersonation := Impersonation{
+		AdminID:   impersonationParams.AdminID,
+		UserID:    impersonationParams.UserID,
+		Reason:    impersonationParams.Reason,
+		ExpiresAt: impersonationParams.ExpiresAt,
+	}
+	impersonation.ID = connector.store.nextID("impersonations")
+	impersonation.CreatedAt = now
+	impersonation.UpdatedAt = now
+
+	connector.store.impersonations[impersonation.ID] = impersonation
+
+	return &impersonation, nil
+}
+
+func (connector *MemoryConnector) GetImpersonations(ctx context.Context, userID uint) ([]Impersonation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	impersonations := []Impersonation{}
+	for _, id := range sortedIDs(connector.store.impersonations) {
+		if impersonation := connector.store.impersonations[id]; impersonation.UserID == userID {
+			impersonations = append(impersonations, impersonation)
+		}
+	}
+
+	return impersonations, nil
+}
+
+func (connector *MemoryConnector) GetImpersonation(ctx context.Context, id uint) (*Impersonation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	impersonation, ok := connector.store.impersonations[id]
+	if !ok {
+		return nil, &NotFoundError{
+			object: "impersonation",
+		}
+	}
+
+	return &impersonation, nil
+}
+
+func (connector *MemoryConnector) EndImpersonation(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	impersonation, ok := connector.store.impersonations[id]
+	if !ok || impersonation.EndedAt != nil {
+		return &NotFoundError{
+			object: "impersonation",
+		}
+	}
+
+	now := time.Now()
+	impersonation.EndedAt = &now
+	impersonation.UpdatedAt = now
+
+	connector.store.impersonations[id] = impersonation
+
+	return nil
+}
+
+// isUserID reports whether an optional user reference points to the user with id
+func isUserID(ref *uint, id uint) bool {
+	return ref != nil && *ref == id
+}
+
+func (connector *MemoryConnector) CreateAuditEvent(ctx context.Context, auditParams CreateAuditEventParams) (*AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	prevHash := ""
+	if ids := sortedIDs(connector.store.auditEvents); len(ids) > 0 {
+		prevHash = connector.store.auditEvents[ids[len(ids)-1]].Hash
+	}
+
+	detached, _ := detachPersonalData(auditParams, func(value *AuditPersonalValue) error {
+		value.ID = connector.store.nextID("audit_personal_values")
+		value.OrganizationID = tenantOf(ctx)
+		connector.store.auditPersonal[value.ID] = *value
+
+		return nil
+	})
+
+	auditEvent := *newAuditEvent(detached, prevHash)
+	auditEvent.ID = connector.store.nextID("audit_events")
+
+	connector.store.auditEvents[auditEvent.ID] = auditEvent
+
+	return &auditEvent, nil
+}
+
+func (connector *MemoryConnector) GetAuditEvents(ctx context.Context, searchParams GetAuditEventsParams) ([]AuditEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	ids := sortedIDs(connector.store.auditEvents)
+	if !searchParams.Ascending {
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	}
+
+	personal := map[string]string{}
+	for id, value := range connector.store.auditPersonal {
+		personal[auditPersonalRef(id)] = value.Value
+	}
+
+	auditEvents := []AuditEvent{}
+	for _, id := range ids {
+		auditEvent := connector.store.auditEvents[id]
+		auditEvent.Personal = personal
+		resolved := auditEvent.Resolved()
+
+		if searchParams.UserID != 0 && !isUserID(auditEvent.ActorID, searchParams.UserID) && !isUserID(auditEvent.TargetID, searchParams.UserID) {
+			continue
+		}
+
+		if searchParams.ActorUserName != "" && resolved.ActorUserName != searchParams.ActorUserName {
+			continue
+		}
+
+		if searchParams.TargetUserName != "" && resolved.TargetUserName != searchParams.TargetUserName {
+			continue
+		}
+
+		if searchParams.Action != "" && auditEvent.Action != searchParams.Action {
+			continue
+		}
+
+		if searchParams.Since != nil && auditEvent.CreatedAt.Before(*searchParams.Since) {
+			continue
+		}
+
+		if searchParams.Until != nil && !auditEvent.CreatedAt.Before(*searchParams.Until) {
+			continue
+		}
+
+		if searchParams.BeforeID != 0 && auditEvent.ID >= searchParams.BeforeID {
+			continue
+		}
+
+		if searchParams.AfterID != 0 && auditEvent.ID <= searchParams.AfterID {
+			continue
+		}
+
+		auditEvents = append(auditEvents, auditEvent)
+
+		if searchParams.Limit > 0 && len(auditEvents) == searchParams.Limit {
+			break
+		}
+	}
+
+	return auditEvents, nil
+}
+
+func (connector *MemoryConnector) CreateLoginAttempt(ctx context.Context, loginParams CreateLoginAttemptParams) (*LoginAttempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	loginAttempt := LoginAttempt{
+		ID:             connector.store.nextID("login_attempts"),
+		CreatedAt:      time.Now().UTC().Truncate(time.Microsecond),
+		OrganizationID: tenantOf(ctx),
+		UserID:         loginParams.UserID,
+		UserName:       loginParams.UserName,
+		Success:        loginParams.Success,
+		FailureReason:  loginParams.FailureReason,
+		IP:             loginParams.IP,
+		UserAgent:      loginParams.UserAgent,
+		Country:        loginParams.Country,
+		Region:         loginParams.Region,
+		City:           loginParams.City,
+		NewDevice:      loginParams.NewDevice,
+	}
+
+	connector.store.loginAttempts[loginAttempt.ID] = loginAttempt
+
+	return &loginAttempt, nil
+}
+
+func (connector *MemoryConnector) GetLoginAttempts(ctx context.Context, searchParams GetLoginAttemptsParams) ([]LoginAttempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	ids := sortedIDs(connector.store.loginAttempts)
+
+	loginAttempts := []LoginAttempt{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		loginAttempt := connector.store.loginAttempts[ids[i]]
+
+		if !isUserID(loginAttempt.UserID, searchParams.UserID) || !inTenant(ctx, loginAttempt.OrganizationID) {
+			continue
+		}
+
+		if searchParams.Success != nil && loginAttempt.Success != *searchParams.Success {
+			continue
+		}
+
+		if searchParams.UserAgent != nil && loginAttempt.UserAgent != *searchParams.UserAgent {
+			continue
+		}
+
+		if searchParams.BeforeID != 0 && loginAttempt.ID >= searchParams.BeforeID {
+			continue
+		}
+
+		loginAttempts = append(loginAttempts, loginAttempt)
+
+		if searchParams.Limit > 0 && len(loginAttempts) == searchParams.Limit {
+			break
+		}
+	}
+
+	return loginAttempts, nil
+}
+
+func (connector *MemoryConnector) EraseUser(ctx context.Context, id uint) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return nil, &NotFoundError{
+			object: "user",
+		}
+	}
+
+	for loginAttemptID, loginAttempt := range connector.store.loginAttempts {
+		named := loginAttempt.UserID == nil && loginAttempt.UserName == user.UserName
+		if loginAttempt.OrganizationID == user.OrganizationID && (isUserID(loginAttempt.UserID, id) || named) {
+			delete(connector.store.loginAttempts, loginAttemptID)
+		}
+	}
+
+	for apiKeyID, apiKey := range connector.store.apiKeys {
+		if apiKey.UserID == id {
+			delete(connector.store.apiKeys, apiKeyID)
+		}
+	}
+
+	for changeID, change := range connector.store.userChanges {
+		if change.UserID == id {
+			delete(connector.store.userChanges, changeID)
+		}
+	}
+
+	for verificationID, verification := range connector.store.phoneVerifs {
+		if verification.UserID == id {
+			delete(connector.store.phoneVerifs, verificationID)
+		}
+	}
+
+	invitationIDs := map[uint]bool{}
+	for invitationID, invitation := range connector.store.invitations {
+		if isUserID(invitation.UserID, id) && inTenant(ctx, invitation.OrganizationID) {
+			invitationIDs[invitationID] = true
+			delete(connector.store.invitations, invitationID)
+		}
+	}
+
+	connector.eraseAuditPersonalValues(&user, invitationIDs, true)
+
+	user.FullName = ErasedFullName
+	user.Phone = ErasedIdentity(id)
+	user.UserName = ErasedIdentity(id)
+	user.Password = ""
+	user.LoginToken = ""
+	user.Attributes = Attributes{}
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return &user, nil
+}
+
+func (connector *MemoryConnector) CreateAttributeDefinition(ctx context.Context, definitionParams CreateAttributeDefinitionParams) (*AttributeDefinition, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	organizationID := tenantOf(ctx)
+
+	for _, definition := range connector.store.attributeDefs {
+		if definition.Name == definitionParams.Name && definition.OrganizationID == organizationID {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An attribute with the provided name already exists"),
+			}
+		}
+	}
+
+	now := time.Now()
+	definition := AttributeDefinition{
+		ID:             connector.store.nextID("attribute_definitions"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Name:           definitionParams.Name,
+		Type:           definitionParams.Type,
+		Required:       definitionParams.Required,
+		Unique:         definitionParams.Unique,
+		Pattern:        definitionParams.Pattern,
+		Visibility:     definitionParams.Visibility,
+		OrganizationID: organizationID,
+	}
+
+	connector.store.attributeDefs[definition.ID] = definition
+
+	return &definition, nil
+}
+
+func (connector *MemoryConnector) GetAttributeDefinitions(ctx context.Context) ([]AttributeDefinition, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	definitions := []AttributeDefinition{}
+	for _, definition := range connector.store.attributeDefs {
+		if inTenant(ctx, definition.OrganizationID) {
+			definitions = append(definitions, definition)
+		}
+	}
+
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+
+	return definitions, nil
+}
+
+func (connector *MemoryConnector) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	found := false
+	for id, definition := range connector.store.attributeDefs {
+		if definition.Name == name && inTenant(ctx, definition.OrganizationID) {
+			delete(connector.store.attributeDefs, id)
+			found = true
+		}
+	}
+
+	if !found {
+		return &NotFoundError{
+			object: "attribute",
+		}
+	}
+
+	for id, user := range connector.store.users {
+		if _, ok := user.Attributes[name]; ok && inTenant(ctx, user.OrganizationID) {
+			user.Attributes = user.Attributes.clone()
+			delete(user.Attributes, name)
+			connector.store.users[id] = user
+		}
+	}
+
+	return nil
+}
+
+func (connector *MemoryConnector) SetUserAttributes(ctx context.Context, id uint, attributes Attributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	user.Attributes = attributes.clone()
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) IsAttributeValueTaken(ctx context.Context, name string, value any, exceptUserID uint) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	for id, user := range connector.store.users {
+		if held, ok := user.Attributes[name]; ok && held == value && id != exceptUserID && !user.DeletedAt.Valid && inTenant(ctx, user.OrganizationID) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (connector *MemoryConnector) CreateGroup(ctx context.Context, groupParams CreateGroupParams) (*Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	organizationID := tenantOf(ctx)
+
+	for _, group := range connector.store.groups {
+		if group.Name == groupParams.Name && group.OrganizationID == organizationID {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("A group with the provided name already exists"),
+			}
+		}
+	}
+
+	now := time.Now()
+	group := Group{
+		ID:             connector.store.nextID("groups"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Name:           groupParams.Name,
+		Description:    groupParams.Description,
+		OrganizationID: organizationID,
+	}
+
+	connector.store.groups[group.ID] = group
+
+	return &group, nil
+}
+
+func (connector *MemoryConnector) GetGroup(ctx context.Context, name string) (*Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	for _, group := range connector.store.groups {
+		if group.Name == name && inTenant(ctx, group.OrganizationID) {
+			return &group, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "user group",
+	}
+}
+
+// sortedGroups returns the groups with the given IDs ordered by name
+func (connector *MemoryConnector) sortedGroups(ids map[uint]bool) []Group {
+	groups := []Group{}
+	for id, group := range connector.store.groups {
+		if ids[id] {
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups
+}
+
+func (connector *MemoryConnector) GetGroups(ctx context.Context) ([]Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	ids := map[uint]bool{}
+	for id, group := range connector.store.groups {
+		if inTenant(ctx, group.OrganizationID) {
+			ids[id] = true
+		}
+	}
+
+	return connector.sortedGroups(ids), nil
+}
+
+// containingGroups returns the IDs of the groups containing, however deeply, any of the groups
+// in ids, which are included as well
+func (connector *MemoryConnector) containingGroups(ids map[uint]bool) map[uint]bool {
+	for added := true; added; {
+		added = false
+
+		for _, member := range connector.store.groupMembers {
+			if member.MemberGroupID != nil && ids[*member.MemberGroupID] && !ids[member.GroupID] {
+				ids[member.GroupID] = true
+				added = true
+			}
+		}
+	}
+
+	return ids
+}
+
+// isGroupMember reports whether member is the membership described by memberParams
+func isGroupMember(member GroupMember, memberParams GroupMemberParams) bool {
+	if member.GroupID != memberParams.GroupID {
+		return false
+	}
+
+	if memberParams.UserID != 0 {
+		return isUserID(member.UserID, memberParams.UserID)
+	}
+
+	return member.MemberGroupID != nil && *member.MemberGroupID == memberParams.MemberGroupID
+}
+
+func (connector *MemoryConnector) AddGroupMember(ctx context.Context, memberParams GroupMemberParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	member := GroupMember{
+		GroupID: memberParams.GroupID,
+	}
+
+	if memberParams.UserID != 0 {
+		member.UserID = &memberParams.UserID
+	} else {
+		member.MemberGroupID = &memberParams.MemberGroupID
+
+		if connector.containingGroups(map[uint]bool{memberParams.GroupID: true})[memberParams.MemberGroupID] {
+			return &BadInputError{
+				Err: fmt.Errorf("A group cannot contain itself"),
+			}
+		}
+	}
+
+	for _, existing := range connector.store.groupMembers {
+		if isGroupMember(existing, memberParams) {
+			return &BadInputError{
+				Err: fmt.Errorf("The member already belongs to the group"),
+			}
+		}
+	}
+
+	member.ID = connector.store.nextID("group_members")
+	member.CreatedAt = time.Now()
+
+	connector.store.groupMembers[member.ID] = member
+
+	return nil
+}
+
+func (connector *MemoryConnector) RemoveGroupMember(ctx context.Context, memberParams GroupMemberParams) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for id, member := range connector.store.groupMembers {
+		if isGroupMember(member, memberParams) {
+			delete(connector.store.groupMembers, id)
+			return nil
+		}
+	}
+
+	return &NotFoundError{
+		object: "user group membership",
+	}
+}
+
+func (connector *MemoryConnector) GetGroupMembers(ctx context.Context, groupID uint) (*GroupMembers, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	userIDs := map[uint]bool{}
+	groupIDs := map[uint]bool{}
+	for _, member := range connector.store.groupMembers {
+		if member.GroupID != groupID {
+			continue
+		}
+
+		if member.UserID != nil {
+			userIDs[*member.UserID] = true
+		} else {
+			groupIDs[*member.MemberGroupID] = true
+		}
+	}
+
+	members := &GroupMembers{
+		Users:  []User{},
+		Groups: connector.sortedGroups(groupIDs),
+	}
+
+	for _, id := range sortedIDs(connector.store.users) {
+		if user := connector.store.users[id]; userIDs[id] && !user.DeletedAt.Valid {
+			members.Users = append(members.Users, user)
+		}
+	}
+
+	return members, nil
+}
+
+func (connector *MemoryConnector) GetUserGroups(ctx context.Context, userID uint) ([]Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	groupIDs := map[uint]bool{}
+	for _, member := range connector.store.groupMembers {
+		if isUserID(member.UserID, userID) {
+			groupIDs[member.GroupID] = true
+		}
+	}
+
+	return connector.sortedGroups(connector.containingGroups(groupIDs)), nil
+}
+
+func (connector *MemoryConnector) CreateOrganization(ctx context.Context, organizationParams CreateOrganizationParams) (*Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for _, organization := range connector.store.organizations {
+		if organization.Name == organizationParams.Name {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An organization with the provided name already exists"),
+			}
+		}
+	}
+
+	now := time.Now()
+	organization := Organization{
+		ID:          connector.store.nextID("organizations"),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Name:        organizationParams.Name,
+		DisplayName: organizationParams.DisplayName,
+	}
+
+	connector.store.organizations[organization.ID] = organization
+
+	return &organization, nil
+}
+
+func (connector *MemoryConnector) GetOrganization(ctx context.Context, name string) (*Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	for _, organization := range connector.store.organizations {
+		if organization.Name == name {
+			return &organization, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "organization",
+	}
+}
+
+func (connector *MemoryConnector) GetOrganizations(ctx context.Context) ([]Organization, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	organizations := []Organization{}
+	for _, organization := range connector.store.organizations {
+		organizations = append(organizations, organization)
+	}
+
+	sort.Slice(organizations, func(i, j int) bool {
+		return organizations[i].Name < organizations[j].Name
+	})
+
+	return organizations, nil
+}
+
+func (connector *MemoryConnector) SetOrgAdmin(ctx context.Context, id uint, orgAdmin bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	user.OrgAdmin = orgAdmin
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) CreateInvitation(ctx context.Context, invitationParams CreateInvitationParams) (*Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	for _, invitation := range connector.store.invitations {
+		if invitation.CodeHash == invitationParams.CodeHash {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An invitation with the provided code already exists"),
+			}
+		}
+	}
+
+	now := time.Now()
+	invitation := Invitation{
+		ID:             connector.store.nextID("invitations"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		OrganizationID: tenantOf(ctx),
+		InviterID:      invitationParams.InviterID,
+		FullName:       invitationParams.FullName,
+		Phone:          invitationParams.Phone,
+		OrgAdmin:       invitationParams.OrgAdmin,
+		CodeHash:       invitationParams.CodeHash,
+		ExpiresAt:      invitationParams.ExpiresAt,
+	}
+
+	connector.store.invitations[invitation.ID] = invitation
+
+	return &invitation, nil
+}
+
+func (connector *MemoryConnector) findInvitation(ctx context.Context, filter func(invitation Invitation) bool) (*Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	for _, id := range sortedIDs(connector.store.invitations) {
+		invitation := connector.store.invitations[id]
+		if inTenant(ctx, invitation.OrganizationID) && filter(invitation) {
+			return &invitation, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "invitation",
+	}
+}
+
+func (connector *MemoryConnector) GetInvitation(ctx context.Context, id uint) (*Invitation, error) {
+	return connector.findInvitation(ctx, func(invitation Invitation) bool {
+		return invitation.ID == id
+	})
+}
+
+func (connector *MemoryConnector) GetInvitationByCode(ctx context.Context, codeHash string) (*Invitation, error) {
+	return connector.findInvitation(ctx, func(invitation Invitation) bool {
+		return invitation.CodeHash == codeHash
+	})
+}
+
+func (connector *MemoryConnector) GetInvitations(ctx context.Context) ([]Invitation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	invitations := []Invitation{}
+	for _, id := range sortedIDs(connector.store.invitations) {
+		if invitation := connector.store.invitations[id]; inTenant(ctx, invitation.OrganizationID) {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	return invitations, nil
+}
+
+// updatePendingInvitation applies update to the invitation with id, unless it was already
+// accepted or revoked
+func (connector *MemoryConnector) updatePendingInvitation(ctx context.Context, id uint, update func(invitation *Invitation) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	invitation, ok := connector.store.invitations[id]
+	if !ok || !inTenant(ctx, invitation.OrganizationID) || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return &NotFoundError{
+			object: "invitation",
+		}
+	}
+
+	if err := update(&invitation); err != nil {
+		return err
+	}
+	invitation.UpdatedAt = time.Now()
+
+	connector.store.invitations[id] = invitation
+
+	return nil
+}
+
+func (connector *MemoryConnector) RenewInvitation(ctx context.Context, id uint, codeHash string, expiresAt time.Time) error {
+	return connector.updatePendingInvitation(ctx, id, func(invitation *Invitation) error {
+		for otherID, other := range connector.store.invitations {
+			if otherID != id && other.CodeHash == codeHash {
+				return &BadInputError{
+					Err: fmt.Errorf("An invitation with the provided code already exists"),
+				}
+			}
+		}
+
+		invitation.CodeHash = codeHash
+		invitation.ExpiresAt = expiresAt
+
+		return nil
+	})
+}
+
+func (connector *MemoryConnector) RevokeInvitation(ctx context.Context, id uint) error {
+	return connector.updatePendingInvitation(ctx, id, func(invitation *Invitation) error {
+		now := time.Now()
+		invitation.RevokedAt = &now
+
+		return nil
+	})
+}
+
+func (connector *MemoryConnector) AcceptInvitation(ctx context.Context, id uint, userID uint) error {
+	return connector.updatePendingInvitation(ctx, id, func(invitation *Invitation) error {
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		invitation.UserID = &userID
+
+		return nil
+	})
+}
+
+func (connector *MemoryConnector) GetPendingRegistrations(ctx context.Context, registeredBefore time.Time) ([]User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	users := []User{}
+	for _, id := range sortedIDs(connector.store.users) {
+		user := connector.store.users[id]
+		if user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) || user.RegistrationStatus != RegistrationPending {
+			continue
+		}
+
+		if registeredBefore.IsZero() || user.CreatedAt.Before(registeredBefore) {
+			users = append(users, user)
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	return users, nil
+}
+
+// updatePendingRegistration applies update to the user with id, as long as its registration is
+// still pending
+func (connector *MemoryConnector) updatePendingRegistration(ctx context.Context, id uint, update func(user *User)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) || user.RegistrationStatus != RegistrationPending {
+		return &NotFoundError{
+			object: "pending registration",
+		}
+	}
+
+	update(&user)
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) ApproveRegistration(ctx context.Context, id uint) error {
+	return connector.updatePendingRegistration(ctx, id, func(user *User) {
+		user.RegistrationStatus = RegistrationActive
+	})
+}
+
+func (connector *MemoryConnector) RejectRegistration(ctx context.Context, id uint, reason string) error {
+	return connector.updatePendingRegistration(ctx, id, func(user *User) {
+		user.RegistrationStatus = RegistrationRejected
+		user.RegistrationReason = reason
+		user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	})
+}
+
+// isUserNameReserved reports whether userName is reserved in the organization with
+// organizationID to a user other than the one with exceptUserID
+func (connector *MemoryConnector) isUserNameReserved(organizationID uint, userName string, exceptUserID uint) bool {
+	now := time.Now()
+
+	for _, change := range connector.store.userChanges {
+		if change.OrganizationID != organizationID || change.Field != UserChangeUserName || change.UserID == exceptUserID {
+			continue
+		}
+
+		if change.OldValue == userName && change.ReservedUntil != nil && change.ReservedUntil.After(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (connector *MemoryConnector) IsUserNameReserved(ctx context.Context, userName string, exceptUserID uint) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	return connector.isUserNameReserved(tenantOf(ctx), userName, exceptUserID), nil
+}
+
+func (connector *MemoryConnector) SetUserName(ctx context.Context, id uint, userName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	user, ok := connector.store.users[id]
+	if !ok || user.DeletedAt.Valid || !inTenant(ctx, user.OrganizationID) {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	if connector.isUserNameReserved(user.OrganizationID, userName, id) {
+		return errReservedUserName
+	}
+
+	for otherID, other := range connector.store.users {
+		if otherID == id || other.DeletedAt.Valid || other.OrganizationID != user.OrganizationID {
+			continue
+		}
+
+		if other.UserName == userName {
+			return duplicateUserError("user_name")
+		}
+	}
+
+	user.UserName = userName
+	user.UpdatedAt = time.Now()
+
+	connector.store.users[id] = user
+
+	return nil
+}
+
+func (connector *MemoryConnector) CreateUserChange(ctx context.Context, changeParams CreateUserChangeParams) (*UserChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	change := UserChange{
+		ID:             connector.store.nextID("user_changes"),
+		CreatedAt:      time.Now(),
+		OrganizationID: tenantOf(ctx),
+		UserID:         changeParams.UserID,
+		Field:          changeParams.Field,
+		OldValue:       changeParams.OldValue,
+		NewValue:       changeParams.NewValue,
+		ReservedUntil:  changeParams.ReservedUntil,
+	}
+
+	connector.store.userChanges[change.ID] = change
+
+	return &change, nil
+}
+
+func (connector *MemoryConnector) GetUserChanges(ctx context.Context, userID uint) ([]UserChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	changes := []UserChange{}
+	for _, id := range sortedIDs(connector.store.userChanges) {
+		change := connector.store.userChanges[id]
+		if change.UserID == userID && inTenant(ctx, change.OrganizationID) {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (connector *MemoryConnector) CreatePhoneVerification(ctx context.Context, verificationParams CreatePhoneVerificationParams) (*PhoneVerification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	now := time.Now()
+	verification := PhoneVerification{
+		ID:             connector.store.nextID("phone_verifications"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		OrganizationID: tenantOf(ctx),
+		UserID:         verificationParams.UserID,
+		Phone:          verificationParams.Phone,
+		CodeHash:       verificationParams.CodeHash,
+		ExpiresAt:      verificationParams.ExpiresAt,
+	}
+
+	connector.store.phoneVerifs[verification.ID] = verification
+
+	return &verification, nil
+}
+
+func (connector *MemoryConnector) GetPhoneVerification(ctx context.Context, userID uint) (*PhoneVerification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	connector.mu.RLock()
+	defer connector.mu.RUnlock()
+
+	ids := sortedIDs(connector.store.phoneVerifs)
+	for i := len(ids) - 1; i >= 0; i-- {
+		verification := connector.store.phoneVerifs[ids[i]]
+		if verification.UserID == userID && verification.VerifiedAt == nil && inTenant(ctx, verification.OrganizationID) {
+			return &verification, nil
+		}
+	}
+
+	return nil, &NotFoundError{
+		object: "phone verification",
+	}
+}
+
+// updatePhoneVerification applies update to the phone verification with id. Only verifications
+// which were not completed are updated when pending is set
+func (connector *MemoryConnector) updatePhoneVerification(ctx context.Context, id uint, pending bool, update func(verification *PhoneVerification)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	connector.mu.Lock()
+	defer connector.mu.Unlock()
+
+	verification, ok := connector.store.phoneVerifs[id]
+	if !ok || !inTenant(ctx, verification.OrganizationID) {
+		if !pending {
+			return nil
+		}
+
+		return &NotFoundError{
+			object: "phone verification",
+		}
+	}
+
+	if pending && verification.VerifiedAt != nil {
+		return &NotFoundError{
+			object: "phone verification",
+		}
+	}
+
+	update(&verification)
+	verification.UpdatedAt = time.Now()
+
+	connector.store.phoneVerifs[id] = verification
+
+	return nil
+}
+
+func (connector *MemoryConnector) FailPhoneVerification(ctx context.Context, id uint) error {
+	return connector.updatePhoneVerification(ctx, id, false, func(verification *PhoneVerification) {
+		verification.Attempts++
+	})
+}
+
+func (connector *MemoryConnector) CompletePhoneVerification(ctx context.Context, id uint) error {
+	return connector.updatePhoneVerification(ctx, id, true, func(verification *PhoneVerification) {
+		now := time.Now()
+		verification.VerifiedAt = &now
+	})
+}
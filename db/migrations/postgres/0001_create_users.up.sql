@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    full_name text,
+    phone text UNIQUE,
+    user_name text UNIQUE,
+    password text,
+    login_token text,
+    admin boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_keys;
+
+ALTER TABLE users DROP COLUMN IF EXISTS service_account;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS impersonations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    admin_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    reason text,
+    expires_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_deleted_at ON impersonations (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations (user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_search_tsv;
+DROP INDEX IF EXISTS idx_users_user_name_trgm;
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
@@ -0,0 +1,5 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users USING gin (full_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_user_name_trgm ON users USING gin (user_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_search_tsv ON users USING gin (to_tsvector('simple', coalesce(full_name, '') || ' ' || coalesce(user_name, '')));
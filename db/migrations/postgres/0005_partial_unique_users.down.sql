@@ -0,0 +1,14 @@
+-- Deleted users clashing with another user would break the restored constraints. Only the
+-- most recent of them, unless a live user holds the value, is kept
+DELETE FROM users WHERE deleted_at IS NOT NULL AND EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.id <> users.id
+      AND (other.user_name = users.user_name OR other.phone = users.phone)
+      AND (other.deleted_at IS NULL OR other.id > users.id)
+);
+
+DROP INDEX IF EXISTS users_phone_key;
+DROP INDEX IF EXISTS users_user_name_key;
+
+ALTER TABLE users ADD CONSTRAINT users_phone_key UNIQUE (phone);
+ALTER TABLE users ADD CONSTRAINT users_user_name_key UNIQUE (user_name);
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_phone_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_user_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_key ON users (phone) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_user_name_key ON users (user_name) WHERE deleted_at IS NULL;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    action text NOT NULL,
+    actor_id bigint,
+    actor_user_name text,
+    impersonator_user_name text,
+    target_id bigint,
+    target_user_name text,
+    ip text,
+    user_agent text,
+    before text,
+    after text
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_user_name ON audit_events (actor_user_name);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_name ON audit_events (target_user_name);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- Audit events are append-only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1,3 @@
+-- Events written before chaining keep empty hashes and are reported as unchained
+ALTER TABLE audit_events ADD COLUMN prev_hash text;
+ALTER TABLE audit_events ADD COLUMN hash text;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint REFERENCES users (id) ON DELETE CASCADE,
+    user_name text NOT NULL,
+    success boolean NOT NULL DEFAULT false,
+    failure_reason text,
+    ip text,
+    user_agent text,
+    country text,
+    region text,
+    city text,
+    new_device boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_id ON login_attempts (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user_name ON login_attempts (user_name);
@@ -0,0 +1,7 @@
+-- Phones must be decrypted (see `pii reencrypt`) before reverting, or the restored constraint
+-- only applies to ciphertexts
+DROP INDEX IF EXISTS users_phone_index_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_key ON users (phone) WHERE deleted_at IS NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone_index;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS attribute_definitions;
+
+DROP INDEX IF EXISTS idx_users_attributes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_users_attributes ON users USING gin (attributes jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    name text NOT NULL UNIQUE,
+    type text NOT NULL,
+    required boolean NOT NULL DEFAULT false,
+    "unique" boolean NOT NULL DEFAULT false,
+    pattern text NOT NULL DEFAULT '',
+    visibility text NOT NULL
+);
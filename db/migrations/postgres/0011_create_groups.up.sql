@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS "groups" (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    name text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    group_id bigint NOT NULL REFERENCES "groups" (id) ON DELETE CASCADE,
+    user_id bigint REFERENCES users (id) ON DELETE CASCADE,
+    member_group_id bigint REFERENCES "groups" (id) ON DELETE CASCADE,
+    CHECK ((user_id IS NULL) <> (member_group_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_members_user_key ON group_members (group_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS group_members_member_group_key ON group_members (group_id, member_group_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_member_group_id ON group_members (member_group_id);
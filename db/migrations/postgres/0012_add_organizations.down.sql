@@ -0,0 +1,24 @@
+-- Names would clash across organizations once their uniqueness is global again, so only the
+-- default organization is kept
+DELETE FROM "groups" WHERE organization_id <> 1;
+DELETE FROM attribute_definitions WHERE organization_id <> 1;
+DELETE FROM users WHERE organization_id <> 1;
+
+DROP INDEX IF EXISTS groups_name_key;
+ALTER TABLE "groups" ADD CONSTRAINT groups_name_key UNIQUE (name);
+ALTER TABLE "groups" DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS attribute_definitions_name_key;
+ALTER TABLE attribute_definitions ADD CONSTRAINT attribute_definitions_name_key UNIQUE (name);
+ALTER TABLE attribute_definitions DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS users_user_name_key;
+DROP INDEX IF EXISTS users_phone_index_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_user_name_key ON users (user_name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_index_key ON users (phone_index) WHERE deleted_at IS NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS org_admin;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
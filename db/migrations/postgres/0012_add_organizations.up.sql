@@ -0,0 +1,31 @@
+-- Every row existing before organizations belongs to the default organization, with id 1
+CREATE TABLE IF NOT EXISTS organizations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    name text NOT NULL UNIQUE,
+    display_name text NOT NULL DEFAULT ''
+);
+
+INSERT INTO organizations (id, created_at, updated_at, name, display_name)
+VALUES (1, now(), now(), 'default', 'Default') ON CONFLICT DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), (SELECT max(id) FROM organizations));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_admin boolean NOT NULL DEFAULT false;
+
+-- Names and phones only have to be unique within an organization
+DROP INDEX IF EXISTS users_user_name_key;
+DROP INDEX IF EXISTS users_phone_index_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_user_name_key ON users (organization_id, user_name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_index_key ON users (organization_id, phone_index) WHERE deleted_at IS NULL;
+
+ALTER TABLE attribute_definitions ADD COLUMN IF NOT EXISTS organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE attribute_definitions DROP CONSTRAINT IF EXISTS attribute_definitions_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS attribute_definitions_name_key ON attribute_definitions (organization_id, name);
+
+ALTER TABLE "groups" ADD COLUMN IF NOT EXISTS organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE "groups" DROP CONSTRAINT IF EXISTS groups_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS groups_name_key ON "groups" (organization_id, name);
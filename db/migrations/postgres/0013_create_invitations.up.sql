@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    inviter_id bigint REFERENCES users (id) ON DELETE SET NULL,
+    full_name text NOT NULL DEFAULT '',
+    phone text NOT NULL,
+    org_admin boolean NOT NULL DEFAULT false,
+    code_hash text NOT NULL UNIQUE,
+    expires_at timestamptz NOT NULL,
+    accepted_at timestamptz,
+    user_id bigint REFERENCES users (id) ON DELETE SET NULL,
+    revoked_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
@@ -0,0 +1,5 @@
+-- Users registered before approvals existed are active
+ALTER TABLE users ADD COLUMN IF NOT EXISTS registration_status text NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS registration_reason text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_pending_registration ON users (created_at) WHERE registration_status = 'pending';
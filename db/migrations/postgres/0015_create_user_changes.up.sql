@@ -0,0 +1,29 @@
+-- Usernames given up stay reserved to their former owner until reserved_until
+CREATE TABLE IF NOT EXISTS user_changes (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    field text NOT NULL,
+    old_value text NOT NULL,
+    new_value text NOT NULL,
+    reserved_until timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_changes_user_id ON user_changes (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_changes_reserved ON user_changes (organization_id, old_value) WHERE reserved_until IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS phone_verifications (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phone text NOT NULL,
+    code_hash text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    verified_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone_verifications_user_id ON phone_verifications (user_id);
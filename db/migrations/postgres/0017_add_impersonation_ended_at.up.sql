@@ -0,0 +1,2 @@
+-- Ended impersonations stop accepting their tokens before they expire
+ALTER TABLE impersonations ADD COLUMN IF NOT EXISTS ended_at timestamptz;
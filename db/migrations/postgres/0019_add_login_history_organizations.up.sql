@@ -0,0 +1,4 @@
+-- Failed logins of unknown usernames and audit data about nobody in particular are only tied to
+-- a user by name, which is unique within an organization only
+ALTER TABLE login_attempts ADD COLUMN IF NOT EXISTS organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id);
+ALTER TABLE audit_personal_values ADD COLUMN IF NOT EXISTS organization_id bigint NOT NULL DEFAULT 1 REFERENCES organizations (id);
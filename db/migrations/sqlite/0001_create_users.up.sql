@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    full_name text,
+    phone text UNIQUE,
+    user_name text UNIQUE,
+    password text,
+    login_token text,
+    admin numeric NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
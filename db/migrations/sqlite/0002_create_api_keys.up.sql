@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN service_account numeric NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text,
+    prefix text UNIQUE,
+    key_hash text,
+    scopes text,
+    expires_at datetime,
+    revoked_at datetime,
+    last_used_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_deleted_at ON api_keys (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS impersonations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    admin_id integer NOT NULL,
+    user_id integer NOT NULL,
+    reason text,
+    expires_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonations_deleted_at ON impersonations (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations (user_id);
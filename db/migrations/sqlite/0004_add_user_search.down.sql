@@ -0,0 +1 @@
+-- Nothing to revert, see 0004_add_user_search.up.sql
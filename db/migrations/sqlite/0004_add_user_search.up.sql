@@ -0,0 +1,2 @@
+-- SQLite has no trigram or full-text support enabled, user search falls back to
+-- substring matching, so there is nothing to index. Kept to match the Postgres versions
@@ -0,0 +1,15 @@
+-- Deleted users clashing with another user would break the restored constraints. Only the
+-- most recent of them, unless a live user holds the value, is kept
+DELETE FROM users WHERE deleted_at IS NOT NULL AND EXISTS (
+    SELECT 1 FROM users other
+    WHERE other.id <> users.id
+      AND (other.user_name = users.user_name OR other.phone = users.phone)
+      AND (other.deleted_at IS NULL OR other.id > users.id)
+);
+
+-- Unique indexes enforce the same rules the original column constraints did
+DROP INDEX IF EXISTS users_phone_key;
+DROP INDEX IF EXISTS users_user_name_key;
+
+CREATE UNIQUE INDEX users_phone_key ON users (phone);
+CREATE UNIQUE INDEX users_user_name_key ON users (user_name);
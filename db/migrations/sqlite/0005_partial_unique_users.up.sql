@@ -0,0 +1,51 @@
+-- SQLite cannot drop column constraints, so users is rebuilt without them. Dropping users
+-- would cascade to api_keys, which is set aside and rebuilt around it
+CREATE TABLE users_rebuild (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    full_name text,
+    phone text,
+    user_name text,
+    password text,
+    login_token text,
+    admin numeric NOT NULL DEFAULT false,
+    service_account numeric NOT NULL DEFAULT false
+);
+
+INSERT INTO users_rebuild (id, created_at, updated_at, deleted_at, full_name, phone, user_name, password, login_token, admin, service_account)
+SELECT id, created_at, updated_at, deleted_at, full_name, phone, user_name, password, login_token, admin, service_account FROM users;
+
+CREATE TABLE api_keys_backup AS SELECT * FROM api_keys;
+
+DROP TABLE api_keys;
+DROP TABLE users;
+
+ALTER TABLE users_rebuild RENAME TO users;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX users_phone_key ON users (phone) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_user_name_key ON users (user_name) WHERE deleted_at IS NULL;
+
+CREATE TABLE api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text,
+    prefix text UNIQUE,
+    key_hash text,
+    scopes text,
+    expires_at datetime,
+    revoked_at datetime,
+    last_used_at datetime
+);
+
+INSERT INTO api_keys SELECT * FROM api_keys_backup;
+
+DROP TABLE api_keys_backup;
+
+CREATE INDEX idx_api_keys_deleted_at ON api_keys (deleted_at);
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
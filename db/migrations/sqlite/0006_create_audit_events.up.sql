@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    action text NOT NULL,
+    actor_id integer,
+    actor_user_name text,
+    impersonator_user_name text,
+    target_id integer,
+    target_user_name text,
+    ip text,
+    user_agent text,
+    before text,
+    after text
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_user_name ON audit_events (actor_user_name);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_name ON audit_events (target_user_name);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- Audit events are append-only
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
@@ -0,0 +1,7 @@
+-- Phones may be stored encrypted, so their uniqueness moves to a blind index. The index is
+-- keyed, so existing rows are indexed by the server before it starts serving
+ALTER TABLE users ADD COLUMN phone_index text;
+
+DROP INDEX IF EXISTS users_phone_key;
+
+CREATE UNIQUE INDEX users_phone_index_key ON users (phone_index) WHERE deleted_at IS NULL;
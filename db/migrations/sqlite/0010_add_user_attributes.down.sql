@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS attribute_definitions;
+
+ALTER TABLE users DROP COLUMN attributes;
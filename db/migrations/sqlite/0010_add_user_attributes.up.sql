@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN attributes text NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    name text NOT NULL UNIQUE,
+    type text NOT NULL,
+    required numeric NOT NULL DEFAULT false,
+    "unique" numeric NOT NULL DEFAULT false,
+    pattern text NOT NULL DEFAULT '',
+    visibility text NOT NULL
+);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS "groups" (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    name text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    group_id integer NOT NULL REFERENCES "groups" (id) ON DELETE CASCADE,
+    user_id integer REFERENCES users (id) ON DELETE CASCADE,
+    member_group_id integer REFERENCES "groups" (id) ON DELETE CASCADE,
+    CHECK ((user_id IS NULL) <> (member_group_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS group_members_user_key ON group_members (group_id, user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS group_members_member_group_key ON group_members (group_id, member_group_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id);
+CREATE INDEX IF NOT EXISTS idx_group_members_member_group_id ON group_members (member_group_id);
@@ -0,0 +1,87 @@
+-- Every row existing before organizations belongs to the default organization, with id 1
+CREATE TABLE IF NOT EXISTS organizations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    name text NOT NULL UNIQUE,
+    display_name text NOT NULL DEFAULT ''
+);
+
+INSERT OR IGNORE INTO organizations (id, created_at, updated_at, name, display_name)
+VALUES (1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'default', 'Default');
+
+-- SQLite cannot add a column referencing another table with a default other than NULL, nor
+-- drop such a column when reverting, so organizations are not foreign keys here
+ALTER TABLE users ADD COLUMN organization_id integer NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN org_admin numeric NOT NULL DEFAULT false;
+
+-- Names and phones only have to be unique within an organization
+DROP INDEX IF EXISTS users_user_name_key;
+DROP INDEX IF EXISTS users_phone_index_key;
+
+CREATE UNIQUE INDEX users_user_name_key ON users (organization_id, user_name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_phone_index_key ON users (organization_id, phone_index) WHERE deleted_at IS NULL;
+
+-- SQLite cannot drop column constraints, so attribute_definitions and groups are rebuilt
+-- without them. Dropping groups would cascade to group_members, which is set aside and rebuilt
+-- around it
+CREATE TABLE attribute_definitions_rebuild (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    name text NOT NULL,
+    type text NOT NULL,
+    required numeric NOT NULL DEFAULT false,
+    "unique" numeric NOT NULL DEFAULT false,
+    pattern text NOT NULL DEFAULT '',
+    visibility text NOT NULL,
+    organization_id integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO attribute_definitions_rebuild (id, created_at, updated_at, name, type, required, "unique", pattern, visibility)
+SELECT id, created_at, updated_at, name, type, required, "unique", pattern, visibility FROM attribute_definitions;
+
+DROP TABLE attribute_definitions;
+
+ALTER TABLE attribute_definitions_rebuild RENAME TO attribute_definitions;
+
+CREATE UNIQUE INDEX attribute_definitions_name_key ON attribute_definitions (organization_id, name);
+
+CREATE TABLE groups_rebuild (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    organization_id integer NOT NULL DEFAULT 1
+);
+
+INSERT INTO groups_rebuild (id, created_at, updated_at, name, description)
+SELECT id, created_at, updated_at, name, description FROM "groups";
+
+CREATE TABLE group_members_backup AS SELECT * FROM group_members;
+
+DROP TABLE group_members;
+DROP TABLE "groups";
+
+ALTER TABLE groups_rebuild RENAME TO "groups";
+
+CREATE UNIQUE INDEX groups_name_key ON "groups" (organization_id, name);
+
+CREATE TABLE group_members (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    group_id integer NOT NULL REFERENCES "groups" (id) ON DELETE CASCADE,
+    user_id integer REFERENCES users (id) ON DELETE CASCADE,
+    member_group_id integer REFERENCES "groups" (id) ON DELETE CASCADE,
+    CHECK ((user_id IS NULL) <> (member_group_id IS NULL))
+);
+
+INSERT INTO group_members SELECT * FROM group_members_backup;
+
+DROP TABLE group_members_backup;
+
+CREATE UNIQUE INDEX group_members_user_key ON group_members (group_id, user_id);
+CREATE UNIQUE INDEX group_members_member_group_key ON group_members (group_id, member_group_id);
+CREATE INDEX idx_group_members_user_id ON group_members (user_id);
+CREATE INDEX idx_group_members_member_group_id ON group_members (member_group_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    organization_id integer NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    inviter_id integer REFERENCES users (id) ON DELETE SET NULL,
+    full_name text NOT NULL DEFAULT '',
+    phone text NOT NULL,
+    org_admin numeric NOT NULL DEFAULT false,
+    code_hash text NOT NULL UNIQUE,
+    expires_at datetime NOT NULL,
+    accepted_at datetime,
+    user_id integer REFERENCES users (id) ON DELETE SET NULL,
+    revoked_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
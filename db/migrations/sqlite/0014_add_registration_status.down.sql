@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_pending_registration;
+
+ALTER TABLE users DROP COLUMN registration_reason;
+ALTER TABLE users DROP COLUMN registration_status;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS phone_verifications;
+DROP TABLE IF EXISTS user_changes;
@@ -0,0 +1,29 @@
+-- Usernames given up stay reserved to their former owner until reserved_until
+CREATE TABLE IF NOT EXISTS user_changes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    organization_id integer NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    field text NOT NULL,
+    old_value text NOT NULL,
+    new_value text NOT NULL,
+    reserved_until datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_changes_user_id ON user_changes (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_changes_reserved ON user_changes (organization_id, old_value) WHERE reserved_until IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS phone_verifications (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    organization_id integer NOT NULL DEFAULT 1 REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    phone text NOT NULL,
+    code_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    verified_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS idx_phone_verifications_user_id ON phone_verifications (user_id);
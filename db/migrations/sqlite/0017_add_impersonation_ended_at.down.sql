@@ -0,0 +1 @@
+ALTER TABLE impersonations DROP COLUMN ended_at;
@@ -0,0 +1,14 @@
+-- Audit events refer to the personal data they name instead of holding it, so that it can be
+-- anonymized when its user is erased without altering the append-only log. Data about an
+-- invitee belongs to their invitation until they accept it
+CREATE TABLE IF NOT EXISTS audit_personal_values (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    invitation_id integer,
+    field text NOT NULL,
+    value text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_personal_values_user_id ON audit_personal_values (user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_personal_values_invitation_id ON audit_personal_values (invitation_id);
+CREATE INDEX IF NOT EXISTS idx_audit_personal_values_value ON audit_personal_values (field, value);
@@ -0,0 +1,2 @@
+ALTER TABLE audit_personal_values DROP COLUMN organization_id;
+ALTER TABLE login_attempts DROP COLUMN organization_id;
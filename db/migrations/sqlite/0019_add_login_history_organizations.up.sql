@@ -0,0 +1,5 @@
+-- Failed logins of unknown usernames and audit data about nobody in particular are only tied to
+-- a user by name, which is unique within an organization only. As with users, organizations are
+-- not foreign keys here
+ALTER TABLE login_attempts ADD COLUMN organization_id integer NOT NULL DEFAULT 1;
+ALTER TABLE audit_personal_values ADD COLUMN organization_id integer NOT NULL DEFAULT 1;
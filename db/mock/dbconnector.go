@@ -5,7 +5,9 @@
 package mockdb
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	db "github.com/ericbg27/RegistryAPI/db"
 	gomock "github.com/golang/mock/gomock"
@@ -34,75 +36,895 @@ func (m *MockDBConnector) EXPECT() *MockDBConnectorMockRecorder {
 	return m.recorder
 }
 
+// AcceptInvitation mocks base method.
+func (m *MockDBConnector) AcceptInvitation(ctx context.Context, id, userID uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptInvitation", ctx, id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AcceptInvitation indicates an expected call of AcceptInvitation.
+func (mr *MockDBConnectorMockRecorder) AcceptInvitation(ctx, id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptInvitation", reflect.TypeOf((*MockDBConnector)(nil).AcceptInvitation), ctx, id, userID)
+}
+
+// AddGroupMember mocks base method.
+func (m *MockDBConnector) AddGroupMember(ctx context.Context, memberParams db.GroupMemberParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddGroupMember", ctx, memberParams)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddGroupMember indicates an expected call of AddGroupMember.
+func (mr *MockDBConnectorMockRecorder) AddGroupMember(ctx, memberParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddGroupMember", reflect.TypeOf((*MockDBConnector)(nil).AddGroupMember), ctx, memberParams)
+}
+
+// ApproveRegistration mocks base method.
+func (m *MockDBConnector) ApproveRegistration(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApproveRegistration", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ApproveRegistration indicates an expected call of ApproveRegistration.
+func (mr *MockDBConnectorMockRecorder) ApproveRegistration(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApproveRegistration", reflect.TypeOf((*MockDBConnector)(nil).ApproveRegistration), ctx, id)
+}
+
+// CompletePhoneVerification mocks base method.
+func (m *MockDBConnector) CompletePhoneVerification(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompletePhoneVerification", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompletePhoneVerification indicates an expected call of CompletePhoneVerification.
+func (mr *MockDBConnectorMockRecorder) CompletePhoneVerification(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompletePhoneVerification", reflect.TypeOf((*MockDBConnector)(nil).CompletePhoneVerification), ctx, id)
+}
+
+// CountUsers mocks base method.
+func (m *MockDBConnector) CountUsers(ctx context.Context, searchParams db.GetUsersParams) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUsers", ctx, searchParams)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUsers indicates an expected call of CountUsers.
+func (mr *MockDBConnectorMockRecorder) CountUsers(ctx, searchParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUsers", reflect.TypeOf((*MockDBConnector)(nil).CountUsers), ctx, searchParams)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockDBConnector) CreateAPIKey(ctx context.Context, apiKeyParams db.CreateAPIKeyParams) (*db.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, apiKeyParams)
+	ret0, _ := ret[0].(*db.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockDBConnectorMockRecorder) CreateAPIKey(ctx, apiKeyParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockDBConnector)(nil).CreateAPIKey), ctx, apiKeyParams)
+}
+
+// CreateAttributeDefinition mocks base method.
+func (m *MockDBConnector) CreateAttributeDefinition(ctx context.Context, definitionParams db.CreateAttributeDefinitionParams) (*db.AttributeDefinition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAttributeDefinition", ctx, definitionParams)
+	ret0, _ := ret[0].(*db.AttributeDefinition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAttributeDefinition indicates an expected call of CreateAttributeDefinition.
+func (mr *MockDBConnectorMockRecorder) CreateAttributeDefinition(ctx, definitionParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAttributeDefinition", reflect.TypeOf((*MockDBConnector)(nil).CreateAttributeDefinition), ctx, definitionParams)
+}
+
+// CreateAuditEvent mocks base method.
+func (m *MockDBConnector) CreateAuditEvent(ctx context.Context, auditParams db.CreateAuditEventParams) (*db.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAuditEvent", ctx, auditParams)
+	ret0, _ := ret[0].(*db.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAuditEvent indicates an expected call of CreateAuditEvent.
+func (mr *MockDBConnectorMockRecorder) CreateAuditEvent(ctx, auditParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAuditEvent", reflect.TypeOf((*MockDBConnector)(nil).CreateAuditEvent), ctx, auditParams)
+}
+
+// CreateGroup mocks base method.
+func (m *MockDBConnector) CreateGroup(ctx context.Context, groupParams db.CreateGroupParams) (*db.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateGroup", ctx, groupParams)
+	ret0, _ := ret[0].(*db.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateGroup indicates an expected call of CreateGroup.
+func (mr *MockDBConnectorMockRecorder) CreateGroup(ctx, groupParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateGroup", reflect.TypeOf((*MockDBConnector)(nil).CreateGroup), ctx, groupParams)
+}
+
+// CreateImpersonation mocks base method.
+func (m *MockDBConnector) CreateImpersonation(ctx context.Context, impersonationParams db.CreateImpersonationParams) (*db.Impersonation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateImpersonation", ctx, impersonationParams)
+	ret0, _ := ret[0].(*db.Impersonation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateImpersonation indicates an expected call of CreateImpersonation.
+func (mr *MockDBConnectorMockRecorder) CreateImpersonation(ctx, impersonationParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateImpersonation", reflect.TypeOf((*MockDBConnector)(nil).CreateImpersonation), ctx, impersonationParams)
+}
+
+// CreateInvitation mocks base method.
+func (m *MockDBConnector) CreateInvitation(ctx context.Context, invitationParams db.CreateInvitationParams) (*db.Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvitation", ctx, invitationParams)
+	ret0, _ := ret[0].(*db.Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateInvitation indicates an expected call of CreateInvitation.
+func (mr *MockDBConnectorMockRecorder) CreateInvitation(ctx, invitationParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvitation", reflect.TypeOf((*MockDBConnector)(nil).CreateInvitation), ctx, invitationParams)
+}
+
+// CreateLoginAttempt mocks base method.
+func (m *MockDBConnector) CreateLoginAttempt(ctx context.Context, loginParams db.CreateLoginAttemptParams) (*db.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLoginAttempt", ctx, loginParams)
+	ret0, _ := ret[0].(*db.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLoginAttempt indicates an expected call of CreateLoginAttempt.
+func (mr *MockDBConnectorMockRecorder) CreateLoginAttempt(ctx, loginParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLoginAttempt", reflect.TypeOf((*MockDBConnector)(nil).CreateLoginAttempt), ctx, loginParams)
+}
+
+// CreateOrganization mocks base method.
+func (m *MockDBConnector) CreateOrganization(ctx context.Context, organizationParams db.CreateOrganizationParams) (*db.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrganization", ctx, organizationParams)
+	ret0, _ := ret[0].(*db.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrganization indicates an expected call of CreateOrganization.
+func (mr *MockDBConnectorMockRecorder) CreateOrganization(ctx, organizationParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrganization", reflect.TypeOf((*MockDBConnector)(nil).CreateOrganization), ctx, organizationParams)
+}
+
+// CreatePhoneVerification mocks base method.
+func (m *MockDBConnector) CreatePhoneVerification(ctx context.Context, verificationParams db.CreatePhoneVerificationParams) (*db.PhoneVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePhoneVerification", ctx, verificationParams)
+	ret0, _ := ret[0].(*db.PhoneVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePhoneVerification indicates an expected call of CreatePhoneVerification.
+func (mr *MockDBConnectorMockRecorder) CreatePhoneVerification(ctx, verificationParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePhoneVerification", reflect.TypeOf((*MockDBConnector)(nil).CreatePhoneVerification), ctx, verificationParams)
+}
+
 // CreateUser mocks base method.
-func (m *MockDBConnector) CreateUser(userParams db.CreateUserParams) (*db.User, error) {
+func (m *MockDBConnector) CreateUser(ctx context.Context, userParams db.CreateUserParams) (*db.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", userParams)
+	ret := m.ctrl.Call(m, "CreateUser", ctx, userParams)
 	ret0, _ := ret[0].(*db.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateUser indicates an expected call of CreateUser.
-func (mr *MockDBConnectorMockRecorder) CreateUser(userParams interface{}) *gomock.Call {
+func (mr *MockDBConnectorMockRecorder) CreateUser(ctx, userParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockDBConnector)(nil).CreateUser), ctx, userParams)
+}
+
+// CreateUserChange mocks base method.
+func (m *MockDBConnector) CreateUserChange(ctx context.Context, changeParams db.CreateUserChangeParams) (*db.UserChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserChange", ctx, changeParams)
+	ret0, _ := ret[0].(*db.UserChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateUserChange indicates an expected call of CreateUserChange.
+func (mr *MockDBConnectorMockRecorder) CreateUserChange(ctx, changeParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserChange", reflect.TypeOf((*MockDBConnector)(nil).CreateUserChange), ctx, changeParams)
+}
+
+// DeleteAttributeDefinition mocks base method.
+func (m *MockDBConnector) DeleteAttributeDefinition(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAttributeDefinition", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAttributeDefinition indicates an expected call of DeleteAttributeDefinition.
+func (mr *MockDBConnectorMockRecorder) DeleteAttributeDefinition(ctx, name interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockDBConnector)(nil).CreateUser), userParams)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAttributeDefinition", reflect.TypeOf((*MockDBConnector)(nil).DeleteAttributeDefinition), ctx, name)
 }
 
 // DeleteUser mocks base method.
-func (m *MockDBConnector) DeleteUser(userName string) error {
+func (m *MockDBConnector) DeleteUser(ctx context.Context, userName string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteUser", userName)
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, userName)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteUser indicates an expected call of DeleteUser.
-func (mr *MockDBConnectorMockRecorder) DeleteUser(userName interface{}) *gomock.Call {
+func (mr *MockDBConnectorMockRecorder) DeleteUser(ctx, userName interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockDBConnector)(nil).DeleteUser), userName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockDBConnector)(nil).DeleteUser), ctx, userName)
+}
+
+// EndImpersonation mocks base method.
+func (m *MockDBConnector) EndImpersonation(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EndImpersonation", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EndImpersonation indicates an expected call of EndImpersonation.
+func (mr *MockDBConnectorMockRecorder) EndImpersonation(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndImpersonation", reflect.TypeOf((*MockDBConnector)(nil).EndImpersonation), ctx, id)
+}
+
+// EraseUser mocks base method.
+func (m *MockDBConnector) EraseUser(ctx context.Context, id uint) (*db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EraseUser", ctx, id)
+	ret0, _ := ret[0].(*db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EraseUser indicates an expected call of EraseUser.
+func (mr *MockDBConnectorMockRecorder) EraseUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EraseUser", reflect.TypeOf((*MockDBConnector)(nil).EraseUser), ctx, id)
+}
+
+// FailPhoneVerification mocks base method.
+func (m *MockDBConnector) FailPhoneVerification(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailPhoneVerification", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailPhoneVerification indicates an expected call of FailPhoneVerification.
+func (mr *MockDBConnectorMockRecorder) FailPhoneVerification(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailPhoneVerification", reflect.TypeOf((*MockDBConnector)(nil).FailPhoneVerification), ctx, id)
+}
+
+// GetAPIKey mocks base method.
+func (m *MockDBConnector) GetAPIKey(ctx context.Context, prefix string) (*db.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", ctx, prefix)
+	ret0, _ := ret[0].(*db.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey.
+func (mr *MockDBConnectorMockRecorder) GetAPIKey(ctx, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockDBConnector)(nil).GetAPIKey), ctx, prefix)
+}
+
+// GetAPIKeys mocks base method.
+func (m *MockDBConnector) GetAPIKeys(ctx context.Context, userID uint) ([]db.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeys", ctx, userID)
+	ret0, _ := ret[0].([]db.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeys indicates an expected call of GetAPIKeys.
+func (mr *MockDBConnectorMockRecorder) GetAPIKeys(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeys", reflect.TypeOf((*MockDBConnector)(nil).GetAPIKeys), ctx, userID)
+}
+
+// GetAttributeDefinitions mocks base method.
+func (m *MockDBConnector) GetAttributeDefinitions(ctx context.Context) ([]db.AttributeDefinition, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttributeDefinitions", ctx)
+	ret0, _ := ret[0].([]db.AttributeDefinition)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttributeDefinitions indicates an expected call of GetAttributeDefinitions.
+func (mr *MockDBConnectorMockRecorder) GetAttributeDefinitions(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttributeDefinitions", reflect.TypeOf((*MockDBConnector)(nil).GetAttributeDefinitions), ctx)
+}
+
+// GetAuditEvents mocks base method.
+func (m *MockDBConnector) GetAuditEvents(ctx context.Context, searchParams db.GetAuditEventsParams) ([]db.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEvents", ctx, searchParams)
+	ret0, _ := ret[0].([]db.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEvents indicates an expected call of GetAuditEvents.
+func (mr *MockDBConnectorMockRecorder) GetAuditEvents(ctx, searchParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEvents", reflect.TypeOf((*MockDBConnector)(nil).GetAuditEvents), ctx, searchParams)
+}
+
+// GetGroup mocks base method.
+func (m *MockDBConnector) GetGroup(ctx context.Context, name string) (*db.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroup", ctx, name)
+	ret0, _ := ret[0].(*db.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroup indicates an expected call of GetGroup.
+func (mr *MockDBConnectorMockRecorder) GetGroup(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroup", reflect.TypeOf((*MockDBConnector)(nil).GetGroup), ctx, name)
+}
+
+// GetGroupMembers mocks base method.
+func (m *MockDBConnector) GetGroupMembers(ctx context.Context, groupID uint) (*db.GroupMembers, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupMembers", ctx, groupID)
+	ret0, _ := ret[0].(*db.GroupMembers)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupMembers indicates an expected call of GetGroupMembers.
+func (mr *MockDBConnectorMockRecorder) GetGroupMembers(ctx, groupID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupMembers", reflect.TypeOf((*MockDBConnector)(nil).GetGroupMembers), ctx, groupID)
+}
+
+// GetGroups mocks base method.
+func (m *MockDBConnector) GetGroups(ctx context.Context) ([]db.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroups", ctx)
+	ret0, _ := ret[0].([]db.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroups indicates an expected call of GetGroups.
+func (mr *MockDBConnectorMockRecorder) GetGroups(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroups", reflect.TypeOf((*MockDBConnector)(nil).GetGroups), ctx)
+}
+
+// GetImpersonation mocks base method.
+func (m *MockDBConnector) GetImpersonation(ctx context.Context, id uint) (*db.Impersonation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImpersonation", ctx, id)
+	ret0, _ := ret[0].(*db.Impersonation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImpersonation indicates an expected call of GetImpersonation.
+func (mr *MockDBConnectorMockRecorder) GetImpersonation(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImpersonation", reflect.TypeOf((*MockDBConnector)(nil).GetImpersonation), ctx, id)
+}
+
+// GetImpersonations mocks base method.
+func (m *MockDBConnector) GetImpersonations(ctx context.Context, userID uint) ([]db.Impersonation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImpersonations", ctx, userID)
+	ret0, _ := ret[0].([]db.Impersonation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImpersonations indicates an expected call of GetImpersonations.
+func (mr *MockDBConnectorMockRecorder) GetImpersonations(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImpersonations", reflect.TypeOf((*MockDBConnector)(nil).GetImpersonations), ctx, userID)
+}
+
+// GetInvitation mocks base method.
+func (m *MockDBConnector) GetInvitation(ctx context.Context, id uint) (*db.Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInvitation", ctx, id)
+	ret0, _ := ret[0].(*db.Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInvitation indicates an expected call of GetInvitation.
+func (mr *MockDBConnectorMockRecorder) GetInvitation(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInvitation", reflect.TypeOf((*MockDBConnector)(nil).GetInvitation), ctx, id)
+}
+
+// GetInvitationByCode mocks base method.
+func (m *MockDBConnector) GetInvitationByCode(ctx context.Context, codeHash string) (*db.Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInvitationByCode", ctx, codeHash)
+	ret0, _ := ret[0].(*db.Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInvitationByCode indicates an expected call of GetInvitationByCode.
+func (mr *MockDBConnectorMockRecorder) GetInvitationByCode(ctx, codeHash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInvitationByCode", reflect.TypeOf((*MockDBConnector)(nil).GetInvitationByCode), ctx, codeHash)
+}
+
+// GetInvitations mocks base method.
+func (m *MockDBConnector) GetInvitations(ctx context.Context) ([]db.Invitation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInvitations", ctx)
+	ret0, _ := ret[0].([]db.Invitation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInvitations indicates an expected call of GetInvitations.
+func (mr *MockDBConnectorMockRecorder) GetInvitations(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInvitations", reflect.TypeOf((*MockDBConnector)(nil).GetInvitations), ctx)
+}
+
+// GetLoginAttempts mocks base method.
+func (m *MockDBConnector) GetLoginAttempts(ctx context.Context, searchParams db.GetLoginAttemptsParams) ([]db.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempts", ctx, searchParams)
+	ret0, _ := ret[0].([]db.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempts indicates an expected call of GetLoginAttempts.
+func (mr *MockDBConnectorMockRecorder) GetLoginAttempts(ctx, searchParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempts", reflect.TypeOf((*MockDBConnector)(nil).GetLoginAttempts), ctx, searchParams)
+}
+
+// GetOrganization mocks base method.
+func (m *MockDBConnector) GetOrganization(ctx context.Context, name string) (*db.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganization", ctx, name)
+	ret0, _ := ret[0].(*db.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganization indicates an expected call of GetOrganization.
+func (mr *MockDBConnectorMockRecorder) GetOrganization(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganization", reflect.TypeOf((*MockDBConnector)(nil).GetOrganization), ctx, name)
+}
+
+// GetOrganizations mocks base method.
+func (m *MockDBConnector) GetOrganizations(ctx context.Context) ([]db.Organization, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrganizations", ctx)
+	ret0, _ := ret[0].([]db.Organization)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrganizations indicates an expected call of GetOrganizations.
+func (mr *MockDBConnectorMockRecorder) GetOrganizations(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrganizations", reflect.TypeOf((*MockDBConnector)(nil).GetOrganizations), ctx)
+}
+
+// GetPendingRegistrations mocks base method.
+func (m *MockDBConnector) GetPendingRegistrations(ctx context.Context, registeredBefore time.Time) ([]db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingRegistrations", ctx, registeredBefore)
+	ret0, _ := ret[0].([]db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPendingRegistrations indicates an expected call of GetPendingRegistrations.
+func (mr *MockDBConnectorMockRecorder) GetPendingRegistrations(ctx, registeredBefore interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingRegistrations", reflect.TypeOf((*MockDBConnector)(nil).GetPendingRegistrations), ctx, registeredBefore)
+}
+
+// GetPhoneVerification mocks base method.
+func (m *MockDBConnector) GetPhoneVerification(ctx context.Context, userID uint) (*db.PhoneVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPhoneVerification", ctx, userID)
+	ret0, _ := ret[0].(*db.PhoneVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPhoneVerification indicates an expected call of GetPhoneVerification.
+func (mr *MockDBConnectorMockRecorder) GetPhoneVerification(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPhoneVerification", reflect.TypeOf((*MockDBConnector)(nil).GetPhoneVerification), ctx, userID)
 }
 
 // GetUser mocks base method.
-func (m *MockDBConnector) GetUser(userName string) (*db.User, error) {
+func (m *MockDBConnector) GetUser(ctx context.Context, userName string) (*db.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUser", userName)
+	ret := m.ctrl.Call(m, "GetUser", ctx, userName)
 	ret0, _ := ret[0].(*db.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUser indicates an expected call of GetUser.
-func (mr *MockDBConnectorMockRecorder) GetUser(userName interface{}) *gomock.Call {
+func (mr *MockDBConnectorMockRecorder) GetUser(ctx, userName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockDBConnector)(nil).GetUser), ctx, userName)
+}
+
+// GetUserByID mocks base method.
+func (m *MockDBConnector) GetUserByID(ctx context.Context, id uint) (*db.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", ctx, id)
+	ret0, _ := ret[0].(*db.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockDBConnectorMockRecorder) GetUserByID(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockDBConnector)(nil).GetUserByID), ctx, id)
+}
+
+// GetUserChanges mocks base method.
+func (m *MockDBConnector) GetUserChanges(ctx context.Context, userID uint) ([]db.UserChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserChanges", ctx, userID)
+	ret0, _ := ret[0].([]db.UserChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserChanges indicates an expected call of GetUserChanges.
+func (mr *MockDBConnectorMockRecorder) GetUserChanges(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserChanges", reflect.TypeOf((*MockDBConnector)(nil).GetUserChanges), ctx, userID)
+}
+
+// GetUserGroups mocks base method.
+func (m *MockDBConnector) GetUserGroups(ctx context.Context, userID uint) ([]db.Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserGroups", ctx, userID)
+	ret0, _ := ret[0].([]db.Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserGroups indicates an expected call of GetUserGroups.
+func (mr *MockDBConnectorMockRecorder) GetUserGroups(ctx, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockDBConnector)(nil).GetUser), userName)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserGroups", reflect.TypeOf((*MockDBConnector)(nil).GetUserGroups), ctx, userID)
 }
 
 // GetUsers mocks base method.
-func (m *MockDBConnector) GetUsers(searchParams db.GetUsersParams) ([]db.User, error) {
+func (m *MockDBConnector) GetUsers(ctx context.Context, searchParams db.GetUsersParams) ([]db.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUsers", searchParams)
+	ret := m.ctrl.Call(m, "GetUsers", ctx, searchParams)
 	ret0, _ := ret[0].([]db.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUsers indicates an expected call of GetUsers.
-func (mr *MockDBConnectorMockRecorder) GetUsers(searchParams interface{}) *gomock.Call {
+func (mr *MockDBConnectorMockRecorder) GetUsers(ctx, searchParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockDBConnector)(nil).GetUsers), ctx, searchParams)
+}
+
+// IsAttributeValueTaken mocks base method.
+func (m *MockDBConnector) IsAttributeValueTaken(ctx context.Context, name string, value any, exceptUserID uint) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsAttributeValueTaken", ctx, name, value, exceptUserID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsAttributeValueTaken indicates an expected call of IsAttributeValueTaken.
+func (mr *MockDBConnectorMockRecorder) IsAttributeValueTaken(ctx, name, value, exceptUserID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAttributeValueTaken", reflect.TypeOf((*MockDBConnector)(nil).IsAttributeValueTaken), ctx, name, value, exceptUserID)
+}
+
+// IsUserNameReserved mocks base method.
+func (m *MockDBConnector) IsUserNameReserved(ctx context.Context, userName string, exceptUserID uint) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsUserNameReserved", ctx, userName, exceptUserID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsUserNameReserved indicates an expected call of IsUserNameReserved.
+func (mr *MockDBConnectorMockRecorder) IsUserNameReserved(ctx, userName, exceptUserID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsUserNameReserved", reflect.TypeOf((*MockDBConnector)(nil).IsUserNameReserved), ctx, userName, exceptUserID)
+}
+
+// PurgeDeletedUsers mocks base method.
+func (m *MockDBConnector) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeletedUsers", ctx, deletedBefore)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeletedUsers indicates an expected call of PurgeDeletedUsers.
+func (mr *MockDBConnectorMockRecorder) PurgeDeletedUsers(ctx, deletedBefore interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockDBConnector)(nil).GetUsers), searchParams)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeletedUsers", reflect.TypeOf((*MockDBConnector)(nil).PurgeDeletedUsers), ctx, deletedBefore)
+}
+
+// PurgeUser mocks base method.
+func (m *MockDBConnector) PurgeUser(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeUser indicates an expected call of PurgeUser.
+func (mr *MockDBConnectorMockRecorder) PurgeUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUser", reflect.TypeOf((*MockDBConnector)(nil).PurgeUser), ctx, id)
+}
+
+// RejectRegistration mocks base method.
+func (m *MockDBConnector) RejectRegistration(ctx context.Context, id uint, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RejectRegistration", ctx, id, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RejectRegistration indicates an expected call of RejectRegistration.
+func (mr *MockDBConnectorMockRecorder) RejectRegistration(ctx, id, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RejectRegistration", reflect.TypeOf((*MockDBConnector)(nil).RejectRegistration), ctx, id, reason)
+}
+
+// RemoveGroupMember mocks base method.
+func (m *MockDBConnector) RemoveGroupMember(ctx context.Context, memberParams db.GroupMemberParams) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveGroupMember", ctx, memberParams)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveGroupMember indicates an expected call of RemoveGroupMember.
+func (mr *MockDBConnectorMockRecorder) RemoveGroupMember(ctx, memberParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveGroupMember", reflect.TypeOf((*MockDBConnector)(nil).RemoveGroupMember), ctx, memberParams)
+}
+
+// RenewInvitation mocks base method.
+func (m *MockDBConnector) RenewInvitation(ctx context.Context, id uint, codeHash string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewInvitation", ctx, id, codeHash, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenewInvitation indicates an expected call of RenewInvitation.
+func (mr *MockDBConnectorMockRecorder) RenewInvitation(ctx, id, codeHash, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewInvitation", reflect.TypeOf((*MockDBConnector)(nil).RenewInvitation), ctx, id, codeHash, expiresAt)
+}
+
+// RestoreUser mocks base method.
+func (m *MockDBConnector) RestoreUser(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUser indicates an expected call of RestoreUser.
+func (mr *MockDBConnectorMockRecorder) RestoreUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockDBConnector)(nil).RestoreUser), ctx, id)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockDBConnector) RevokeAPIKey(ctx context.Context, userID uint, prefix string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, userID, prefix)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockDBConnectorMockRecorder) RevokeAPIKey(ctx, userID, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockDBConnector)(nil).RevokeAPIKey), ctx, userID, prefix)
+}
+
+// RevokeInvitation mocks base method.
+func (m *MockDBConnector) RevokeInvitation(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeInvitation", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeInvitation indicates an expected call of RevokeInvitation.
+func (mr *MockDBConnectorMockRecorder) RevokeInvitation(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeInvitation", reflect.TypeOf((*MockDBConnector)(nil).RevokeInvitation), ctx, id)
+}
+
+// SearchUsers mocks base method.
+func (m *MockDBConnector) SearchUsers(ctx context.Context, searchParams db.SearchUsersParams) ([]db.UserSearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, searchParams)
+	ret0, _ := ret[0].([]db.UserSearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockDBConnectorMockRecorder) SearchUsers(ctx, searchParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockDBConnector)(nil).SearchUsers), ctx, searchParams)
+}
+
+// SetLoginToken mocks base method.
+func (m *MockDBConnector) SetLoginToken(ctx context.Context, id uint, loginToken string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLoginToken", ctx, id, loginToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLoginToken indicates an expected call of SetLoginToken.
+func (mr *MockDBConnectorMockRecorder) SetLoginToken(ctx, id, loginToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLoginToken", reflect.TypeOf((*MockDBConnector)(nil).SetLoginToken), ctx, id, loginToken)
+}
+
+// SetOrgAdmin mocks base method.
+func (m *MockDBConnector) SetOrgAdmin(ctx context.Context, id uint, orgAdmin bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOrgAdmin", ctx, id, orgAdmin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOrgAdmin indicates an expected call of SetOrgAdmin.
+func (mr *MockDBConnectorMockRecorder) SetOrgAdmin(ctx, id, orgAdmin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrgAdmin", reflect.TypeOf((*MockDBConnector)(nil).SetOrgAdmin), ctx, id, orgAdmin)
+}
+
+// SetUserAttributes mocks base method.
+func (m *MockDBConnector) SetUserAttributes(ctx context.Context, id uint, attributes db.Attributes) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserAttributes", ctx, id, attributes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserAttributes indicates an expected call of SetUserAttributes.
+func (mr *MockDBConnectorMockRecorder) SetUserAttributes(ctx, id, attributes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserAttributes", reflect.TypeOf((*MockDBConnector)(nil).SetUserAttributes), ctx, id, attributes)
+}
+
+// SetUserName mocks base method.
+func (m *MockDBConnector) SetUserName(ctx context.Context, id uint, userName string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserName", ctx, id, userName)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserName indicates an expected call of SetUserName.
+func (mr *MockDBConnectorMockRecorder) SetUserName(ctx, id, userName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserName", reflect.TypeOf((*MockDBConnector)(nil).SetUserName), ctx, id, userName)
+}
+
+// TouchAPIKey mocks base method.
+func (m *MockDBConnector) TouchAPIKey(ctx context.Context, id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAPIKey", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAPIKey indicates an expected call of TouchAPIKey.
+func (mr *MockDBConnectorMockRecorder) TouchAPIKey(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAPIKey", reflect.TypeOf((*MockDBConnector)(nil).TouchAPIKey), ctx, id)
 }
 
 // UpdateUser mocks base method.
-func (m *MockDBConnector) UpdateUser(updateParams db.UpdateUserParams) error {
+func (m *MockDBConnector) UpdateUser(ctx context.Context, updateParams db.UpdateUserParams) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateUser", updateParams)
+	ret := m.ctrl.Call(m, "UpdateUser", ctx, updateParams)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateUser indicates an expected call of UpdateUser.
-func (mr *MockDBConnectorMockRecorder) UpdateUser(updateParams interface{}) *gomock.Call {
+func (mr *MockDBConnectorMockRecorder) UpdateUser(ctx, updateParams interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockDBConnector)(nil).UpdateUser), ctx, updateParams)
+}
+
+// WithTx mocks base method.
+func (m *MockDBConnector) WithTx(ctx context.Context, fn func(db.DBConnector) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTx", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTx indicates an expected call of WithTx.
+func (mr *MockDBConnectorMockRecorder) WithTx(ctx, fn interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockDBConnector)(nil).UpdateUser), updateParams)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTx", reflect.TypeOf((*MockDBConnector)(nil).WithTx), ctx, fn)
 }
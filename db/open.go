@@ -0,0 +1,68 @@
+package db
+
+import (
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const sqliteSourcePrefix = "sqlite://"
+
+// postgresDialector keeps driver errors untouched. gorm would otherwise translate every
+// unique violation into ErrDuplicatedKey, losing the name of the violated constraint
+type postgresDialector struct {
+	*postgres.Dialector
+}
+
+func (postgresDialector) Translate(err error) error {
+	return err
+}
+
+// NewPostgresDialector creates the Postgres dialector used for DBManager connections
+func NewPostgresDialector(config postgres.Config) gorm.Dialector {
+	return postgresDialector{
+		Dialector: &postgres.Dialector{Config: &config},
+	}
+}
+
+// IsInMemorySource reports whether source describes an in-memory database, which starts empty
+// every time it is opened and cannot be migrated by another process
+func IsInMemorySource(source string) bool {
+	return source == sqliteSourcePrefix+":memory:"
+}
+
+// Open connects to the database described by source. Sources starting with sqlite:// open
+// the SQLite file following the prefix (or an in-memory database for sqlite://:memory:),
+// any other source is handled as a Postgres connection string
+func Open(source string) (*gorm.DB, error) {
+	if !strings.HasPrefix(source, sqliteSourcePrefix) {
+		return gorm.Open(NewPostgresDialector(postgres.Config{DSN: source}), &gorm.Config{})
+	}
+
+	path := strings.TrimPrefix(source, sqliteSourcePrefix)
+	if IsInMemorySource(source) {
+		path = "file::memory:"
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	db, err := gorm.Open(sqlite.Open(path+separator+"_foreign_keys=on&_busy_timeout=5000"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, and every connection to an in-memory database
+	// sees its own empty database, so all work goes through one connection
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return db, nil
+}
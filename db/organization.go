@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultOrganizationID identifies the organization created along with the organizations table,
+// which holds every user registered before organizations existed and the users registered
+// outside of any organization
+const DefaultOrganizationID uint = 1
+
+const tenantScopeCallback = "registry:tenant_scope"
+
+var organizationNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// IsValidOrganizationName reports whether name can name an organization: lowercase letters,
+// digits and dashes, starting with a letter or a digit
+func IsValidOrganizationName(name string) bool {
+	return organizationNameRegexp.MatchString(name)
+}
+
+// Organization is a tenant of the registry. Users, groups and attribute definitions belong to a
+// single organization and their names only have to be unique within it
+type Organization struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string `gorm:"unique"`
+	DisplayName string
+}
+
+type CreateOrganizationParams struct {
+	Name        string
+	DisplayName string
+}
+
+type tenantContextKey struct{}
+
+// WithTenant scopes the data read and written with the returned context to the organization
+// with organizationID. A zero organizationID lifts the scope
+func WithTenant(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, organizationID)
+}
+
+// TenantFromContext returns the organization ctx is scoped to, or zero when it is not scoped
+func TenantFromContext(ctx context.Context) uint {
+	organizationID, _ := ctx.Value(tenantContextKey{}).(uint)
+
+	return organizationID
+}
+
+// tenantOf returns the organization rows created with ctx belong to
+func tenantOf(ctx context.Context) uint {
+	if organizationID := TenantFromContext(ctx); organizationID != 0 {
+		return organizationID
+	}
+
+	return DefaultOrganizationID
+}
+
+// tenantField returns the organization field of the model the statement works on, if any
+func tenantField(db *gorm.DB) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+
+	return db.Statement.Schema.LookUpField("OrganizationID")
+}
+
+// scopeToTenant restricts queries, updates and deletes of organization owned rows to the
+// organization of the statement context. Raw SQL is left as written
+func scopeToTenant(db *gorm.DB) {
+	organizationID := TenantFromContext(db.Statement.Context)
+
+	field := tenantField(db)
+	if field == nil || organizationID == 0 {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: field.DBName}, Value: organizationID},
+	}})
+}
+
+// assignTenant places organization owned rows being created in the organization of the
+// statement context, unless they name one already
+func assignTenant(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if _, zero := field.ValueOf(ctx, db.Statement.ReflectValue); zero {
+		db.AddError(field.Set(ctx, db.Statement.ReflectValue, tenantOf(ctx)))
+	}
+}
+
+// registerTenantScope makes every statement run through db follow the organization of its
+// context. It is safe to call more than once on the same connection
+func registerTenantScope(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Query().Get(tenantScopeCallback) != nil {
+		return
+	}
+
+	callbacks.Create().Before("gorm:create").Register(tenantScopeCallback, assignTenant)
+	callbacks.Query().Before("gorm:query").Register(tenantScopeCallback, scopeToTenant)
+	callbacks.Row().Before("gorm:row").Register(tenantScopeCallback, scopeToTenant)
+	callbacks.Update().Before("gorm:update").Register(tenantScopeCallback, scopeToTenant)
+	callbacks.Delete().Before("gorm:delete").Register(tenantScopeCallback, scopeToTenant)
+}
+
+func (dbManager *DBManager) CreateOrganization(ctx context.Context, organizationParams CreateOrganizationParams) (*Organization, error) {
+	organization := &Organization{
+		Name:        organizationParams.Name,
+		DisplayName: organizationParams.DisplayName,
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Create(organization)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, &BadInputError{
+				Err: fmt.Errorf("An organization with the provided name already exists"),
+			}
+		}
+
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func (dbManager *DBManager) GetOrganization(ctx context.Context, name string) (*Organization, error) {
+	var organization Organization
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("name = ?", name).First(&organization)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "organization",
+			}
+		}
+
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+func (dbManager *DBManager) GetOrganizations(ctx context.Context) ([]Organization, error) {
+	var organizations []Organization
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Order("name").Find(&organizations)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	return organizations, nil
+}
+
+// SetOrgAdmin grants or revokes the right of the user with id to administer its organization
+func (dbManager *DBManager) SetOrgAdmin(ctx context.Context, id uint, orgAdmin bool) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id = ?", id).Update("org_admin", orgAdmin)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	return nil
+}
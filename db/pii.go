@@ -0,0 +1,274 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// encryptedValuePrefix marks the values written by PIICipher. Encrypted values look like
+// pii1:<key id>:<wrapped data key>:<ciphertext>, with both binary parts base64 encoded
+const encryptedValuePrefix = "pii1:"
+
+const (
+	piiKeySize      = 32
+	minIndexKeySize = 32
+)
+
+// encryptableUserFields lists the user columns PIICipher can encrypt
+var encryptableUserFields = map[string]bool{
+	"full_name": true,
+	"phone":     true,
+}
+
+// PIIKey is a key-encryption key. Its ID is stored along every value it protects, so that
+// values keep being readable after the current key is replaced
+type PIIKey struct {
+	ID  string
+	Key []byte
+}
+
+// ParsePIIKeys parses a comma separated list of <id>:<base64 encoded 32 byte key> pairs
+func ParsePIIKeys(spec string) ([]PIIKey, error) {
+	keys := []PIIKey{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("PII key %q is not in the <id>:<key> format", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("PII key %s is not base64 encoded: %w", id, err)
+		}
+
+		keys = append(keys, PIIKey{
+			ID:  id,
+			Key: key,
+		})
+	}
+
+	return keys, nil
+}
+
+// PIICipher transparently protects the full names and phones stored for users and invitees, in
+// the phone changes and verifications of users and in the values named by audit events.
+// Configured fields are envelope encrypted: each value is sealed with its own random data key,
+// which is in turn sealed with the current key-encryption key. Phones are also given a blind
+// index, a keyed hash that keeps phone lookups and uniqueness working on encrypted data.
+// A nil PIICipher stores every field in plaintext and indexes phones by their value
+type PIICipher struct {
+	current  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+	fields   map[string]bool
+}
+
+// NewPIICipher creates a cipher encrypting fields with keys, the first of which is the current
+// one. The other keys are only used to read values written before they were replaced
+func NewPIICipher(keys []PIIKey, indexKey []byte, fields []string) (*PIICipher, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("At least one PII key is required")
+	}
+
+	if len(indexKey) < minIndexKeySize {
+		return nil, fmt.Errorf("The blind index key must be at least %d bytes long", minIndexKeySize)
+	}
+
+	piiCipher := &PIICipher{
+		current:  keys[0].ID,
+		keys:     map[string]cipher.AEAD{},
+		indexKey: indexKey,
+		fields:   map[string]bool{},
+	}
+
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ":") {
+			return nil, fmt.Errorf("PII key IDs must be non empty and cannot contain colons")
+		}
+
+		if _, ok := piiCipher.keys[key.ID]; ok {
+			return nil, fmt.Errorf("PII key %s is configured more than once", key.ID)
+		}
+
+		if len(key.Key) != piiKeySize {
+			return nil, fmt.Errorf("PII key %s must be %d bytes long", key.ID, piiKeySize)
+		}
+
+		aead, err := newAEAD(key.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		piiCipher.keys[key.ID] = aead
+	}
+
+	for _, field := range fields {
+		if !encryptableUserFields[field] {
+			return nil, fmt.Errorf("User field %s cannot be encrypted", field)
+		}
+
+		piiCipher.fields[field] = true
+	}
+
+	return piiCipher, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealValue encrypts plaintext with aead, prepending the random nonce to the ciphertext
+func sealValue(aead cipher.AEAD, plaintext []byte, additionalData string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(additionalData)), nil
+}
+
+func openValue(aead cipher.AEAD, sealed []byte, additionalData string) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("Encrypted value is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(additionalData))
+}
+
+// Encrypts reports whether field is stored encrypted
+func (piiCipher *PIICipher) Encrypts(field string) bool {
+	return piiCipher != nil && piiCipher.fields[field]
+}
+
+// isEncrypted reports whether stored was written by PIICipher
+func isEncrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedValuePrefix)
+}
+
+// rowAdditionalData is the data authenticated along a value of field stored in the row of table
+// with id, so that values can be moved neither between columns nor between rows
+func rowAdditionalData(table string, id uint, field string) string {
+	return fmt.Sprintf("%s:%d:%s", table, id, field)
+}
+
+// Encrypt returns the value to store for field in the row of table with id. Values of fields
+// which are not configured, as well as empty values, are stored as they are
+func (piiCipher *PIICipher) Encrypt(table string, id uint, field string, value string) (string, error) {
+	if !piiCipher.Encrypts(field) || value == "" {
+		return value, nil
+	}
+
+	dataKey := make([]byte, piiKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := sealValue(dataAEAD, []byte(value), rowAdditionalData(table, id, field))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := sealValue(piiCipher.keys[piiCipher.current], dataKey, piiCipher.current)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedValuePrefix + piiCipher.current + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt returns the plaintext of a value of field stored in the row of table with id.
+// Plaintext values, written before the field was encrypted, are returned as they are
+func (piiCipher *PIICipher) Decrypt(table string, id uint, field string, stored string) (string, error) {
+	if !isEncrypted(stored) {
+		return stored, nil
+	}
+
+	_, encrypted, _ := strings.Cut(stored, ":")
+	parts := strings.Split(encrypted, ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("Encrypted %s value is malformed", field)
+	}
+
+	if piiCipher == nil {
+		return "", fmt.Errorf("Cannot decrypt %s value without PII keys", field)
+	}
+
+	keyAEAD, ok := piiCipher.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("Unknown PII key %s", parts[0])
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := openValue(keyAEAD, wrappedKey, parts[0])
+	if err != nil {
+		return "", fmt.Errorf("Cannot unwrap %s data key: %w", field, err)
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := openValue(dataAEAD, ciphertext, rowAdditionalData(table, id, field))
+	if err != nil {
+		return "", fmt.Errorf("Cannot decrypt %s value: %w", field, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// IsCurrent reports whether a stored value of field is already in the form Encrypt would
+// write it: encrypted with the current key when the field is encrypted, in plaintext otherwise
+func (piiCipher *PIICipher) IsCurrent(field string, stored string) bool {
+	if !piiCipher.Encrypts(field) {
+		return !isEncrypted(stored)
+	}
+
+	return stored == "" || strings.HasPrefix(stored, encryptedValuePrefix+piiCipher.current+":")
+}
+
+// BlindIndex returns the deterministic index of a phone, an HMAC-SHA256 of the phone which
+// cannot be reversed without the index key
+func (piiCipher *PIICipher) BlindIndex(phone string) string {
+	if piiCipher == nil {
+		return phone
+	}
+
+	mac := hmac.New(sha256.New, piiCipher.indexKey)
+	mac.Write([]byte(phone))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
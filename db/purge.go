@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunUserPurge permanently removes the users soft deleted longer than retention ago. It runs
+// right away and then once every interval, until ctx is done
+func RunUserPurge(ctx context.Context, connector DBConnector, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := connector.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Cannot purge deleted users: %v\n", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d user(s) deleted more than %s ago\n", purged, retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+const defaultReencryptBatchSize = 100
+
+// userNeedsReencryption reports whether the stored personal data of user is not in the form the
+// current PII configuration would write it
+func (dbManager *DBManager) userNeedsReencryption(user *User) (bool, error) {
+	if !dbManager.pii.IsCurrent("full_name", user.FullName) || !dbManager.pii.IsCurrent("phone", user.Phone) {
+		return true, nil
+	}
+
+	phone, err := dbManager.pii.Decrypt("users", user.ID, "phone", user.Phone)
+	if err != nil {
+		return false, err
+	}
+
+	return user.PhoneIndex != dbManager.pii.BlindIndex(phone), nil
+}
+
+// ReencryptUsers rewrites the personal data of every user, deleted ones included, which was
+// stored in plaintext, with a replaced key or with a different blind index key. Users are read
+// batchSize at a time and rows changed since they were read are left for a later run.
+// It returns how many users were rewritten
+func (dbManager *DBManager) ReencryptUsers(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultReencryptBatchSize
+	}
+
+	var rewritten int64
+	var lastID uint
+
+	for {
+		var users []User
+
+		conn, cancel := dbManager.readConn(ctx)
+		result := conn.Unscoped().Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&users)
+		cancel()
+
+		if err := result.Error; err != nil {
+			return rewritten, err
+		}
+
+		for i := range users {
+			stale, err := dbManager.userNeedsReencryption(&users[i])
+			if err != nil {
+				return rewritten, err
+			}
+
+			if !stale {
+				continue
+			}
+
+			sealed := users[i]
+			if err := dbManager.openUser(&sealed); err != nil {
+				return rewritten, err
+			}
+
+			if err := dbManager.sealUser(&sealed); err != nil {
+				return rewritten, err
+			}
+
+			conn, cancel := dbManager.writeConn(ctx)
+			result := conn.Unscoped().Model(&User{}).
+				Where("id = ? AND full_name = ? AND phone = ?", users[i].ID, users[i].FullName, users[i].Phone).
+				UpdateColumns(map[string]any{
+					"full_name":   sealed.FullName,
+					"phone":       sealed.Phone,
+					"phone_index": sealed.PhoneIndex,
+				})
+			cancel()
+
+			if err := result.Error; err != nil {
+				return rewritten, err
+			}
+
+			rewritten += result.RowsAffected
+		}
+
+		if len(users) < batchSize {
+			return rewritten, nil
+		}
+
+		lastID = users[len(users)-1].ID
+	}
+}
+
+// IndexUserPhones sets the blind index of every user, deleted ones included, whose phone is not
+// indexed yet, that is users stored before phones were indexed. Phone lookups and uniqueness
+// rely on the index, so it has to run before serving. Phones indexed with another index key are
+// left to the re-encryption. Users are read batchSize at a time. It returns how many users were
+// indexed
+func (dbManager *DBManager) IndexUserPhones(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultReencryptBatchSize
+	}
+
+	var indexed int64
+	var lastID uint
+
+	for {
+		var users []User
+
+		conn, cancel := dbManager.readConn(ctx)
+		result := conn.Unscoped().Select("id", "phone").Where("id > ? AND phone_index IS NULL", lastID).Order("id").Limit(batchSize).Find(&users)
+		cancel()
+
+		if err := result.Error; err != nil {
+			return indexed, err
+		}
+
+		for _, user := range users {
+			phone, err := dbManager.pii.Decrypt("users", user.ID, "phone", user.Phone)
+			if err != nil {
+				return indexed, err
+			}
+
+			conn, cancel := dbManager.writeConn(ctx)
+			result := conn.Unscoped().Model(&User{}).
+				Where("id = ? AND phone = ? AND phone_index IS NULL", user.ID, user.Phone).
+				UpdateColumn("phone_index", dbManager.pii.BlindIndex(phone))
+			cancel()
+
+			if err := result.Error; err != nil {
+				return indexed, err
+			}
+
+			indexed += result.RowsAffected
+		}
+
+		if len(users) < batchSize {
+			return indexed, nil
+		}
+
+		lastID = users[len(users)-1].ID
+	}
+}
+
+// personalColumn is a column of a stored row holding a value of one of the personal data fields
+type personalColumn struct {
+	name   string
+	field  string
+	stored string
+}
+
+// reencryptRows rewrites the personal columns of the rows of T stored in table and selected by
+// scope, batchSize at a time, whenever one of them is not in the form the current PII
+// configuration would write it. Rows changed since they were read are left for a later run.
+// It returns how many rows were rewritten
+func reencryptRows[T any](ctx context.Context, dbManager *DBManager, table string, batchSize int, scope func(*gorm.DB) *gorm.DB, rowID func(*T) uint, columns func(*T) []personalColumn) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = defaultReencryptBatchSize
+	}
+
+	var rewritten int64
+	var lastID uint
+
+	for {
+		var rows []T
+
+		conn, cancel := dbManager.readConn(ctx)
+		result := conn.Scopes(scope).Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&rows)
+		cancel()
+
+		if err := result.Error; err != nil {
+			return rewritten, err
+		}
+
+		for i := range rows {
+			stale := false
+			for _, column := range columns(&rows[i]) {
+				if !dbManager.pii.IsCurrent(column.field, column.stored) {
+					stale = true
+				}
+			}
+
+			if !stale {
+				continue
+			}
+
+			sealed := map[string]any{}
+			for _, column := range columns(&rows[i]) {
+				value, err := dbManager.pii.Decrypt(table, rowID(&rows[i]), column.field, column.stored)
+				if err != nil {
+					return rewritten, err
+				}
+
+				if sealed[column.name], err = dbManager.pii.Encrypt(table, rowID(&rows[i]), column.field, value); err != nil {
+					return rewritten, err
+				}
+			}
+
+			conn, cancel := dbManager.writeConn(ctx)
+			update := conn.Model(new(T)).Where("id = ?", rowID(&rows[i]))
+			for _, column := range columns(&rows[i]) {
+				update = update.Where(column.name+" = ?", column.stored)
+			}
+			result := update.UpdateColumns(sealed)
+			cancel()
+
+			if err := result.Error; err != nil {
+				return rewritten, err
+			}
+
+			rewritten += result.RowsAffected
+		}
+
+		if len(rows) < batchSize {
+			return rewritten, nil
+		}
+
+		lastID = rowID(&rows[len(rows)-1])
+	}
+}
+
+// ReencryptPersonalData rewrites, like ReencryptUsers, the personal data stored for users, for
+// invitees, in the phone changes and verifications of users and in the values named by audit
+// events. It returns how many rows were rewritten
+func (dbManager *DBManager) ReencryptPersonalData(ctx context.Context, batchSize int) (int64, error) {
+	rewritten, err := dbManager.ReencryptUsers(ctx, batchSize)
+	if err != nil {
+		return rewritten, err
+	}
+
+	tables := []func() (int64, error){
+		func() (int64, error) {
+			return reencryptRows(ctx, dbManager, "invitations", batchSize,
+				func(conn *gorm.DB) *gorm.DB { return conn },
+				func(invitation *Invitation) uint { return invitation.ID },
+				func(invitation *Invitation) []personalColumn {
+					return []personalColumn{
+						{name: "full_name", field: "full_name", stored: invitation.FullName},
+						{name: "phone", field: "phone", stored: invitation.Phone},
+					}
+				})
+		},
+		func() (int64, error) {
+			return reencryptRows(ctx, dbManager, "user_changes", batchSize,
+				func(conn *gorm.DB) *gorm.DB { return conn.Where("field = ?", UserChangePhone) },
+				func(change *UserChange) uint { return change.ID },
+				func(change *UserChange) []personalColumn {
+					return []personalColumn{
+						{name: "old_value", field: "phone", stored: change.OldValue},
+						{name: "new_value", field: "phone", stored: change.NewValue},
+					}
+				})
+		},
+		func() (int64, error) {
+			return reencryptRows(ctx, dbManager, "phone_verifications", batchSize,
+				func(conn *gorm.DB) *gorm.DB { return conn },
+				func(verification *PhoneVerification) uint { return verification.ID },
+				func(verification *PhoneVerification) []personalColumn {
+					return []personalColumn{
+						{name: "phone", field: "phone", stored: verification.Phone},
+					}
+				})
+		},
+		func() (int64, error) {
+			return reencryptRows(ctx, dbManager, "audit_personal_values", batchSize,
+				func(conn *gorm.DB) *gorm.DB { return conn.Where("field IN ?", []string{"full_name", "phone"}) },
+				func(value *AuditPersonalValue) uint { return value.ID },
+				func(value *AuditPersonalValue) []personalColumn {
+					return []personalColumn{
+						{name: "value", field: value.Field, stored: value.Value},
+					}
+				})
+		},
+	}
+
+	for _, reencrypt := range tables {
+		count, err := reencrypt()
+		rewritten += count
+
+		if err != nil {
+			return rewritten, err
+		}
+	}
+
+	return rewritten, nil
+}
+
+// RunPIIReencryption re-encrypts the stored personal data in the background after the PII keys
+// or encrypted fields change
+func RunPIIReencryption(ctx context.Context, dbManager *DBManager, batchSize int) {
+	rewritten, err := dbManager.ReencryptPersonalData(ctx, batchSize)
+	if err != nil {
+		log.Printf("Cannot re-encrypt personal data: %v\n", err)
+		return
+	}
+
+	if rewritten > 0 {
+		log.Printf("Re-encrypted %d row(s) of personal data\n", rewritten)
+	}
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	RegistrationActive   = "active"
+	RegistrationPending  = "pending"
+	RegistrationRejected = "rejected"
+)
+
+// registrationStatusOf returns the registration status a user created with userParams starts in
+func registrationStatusOf(userParams CreateUserParams) string {
+	if userParams.PendingApproval {
+		return RegistrationPending
+	}
+
+	return RegistrationActive
+}
+
+// IsRegistrationApproved reports whether user may log in. Users stored before registrations
+// needed approval have no status and are active
+func (user *User) IsRegistrationApproved() bool {
+	return user.RegistrationStatus == "" || user.RegistrationStatus == RegistrationActive
+}
+
+// GetPendingRegistrations returns the users waiting for approval which registered before
+// registeredBefore, oldest first. A zero registeredBefore returns every pending registration
+func (dbManager *DBManager) GetPendingRegistrations(ctx context.Context, registeredBefore time.Time) ([]User, error) {
+	var users []User
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	query := conn.Where("registration_status = ?", RegistrationPending)
+	if !registeredBefore.IsZero() {
+		query = query.Where("created_at < ?", registeredBefore)
+	}
+
+	result := query.Order("created_at, id").Find(&users)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if err := dbManager.openUser(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// updatePendingRegistration applies values to the user with id, as long as its registration
+// is still pending
+func (dbManager *DBManager) updatePendingRegistration(ctx context.Context, id uint, values map[string]any) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id = ? AND registration_status = ?", id, RegistrationPending).Updates(values)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "pending registration",
+		}
+	}
+
+	return nil
+}
+
+// ApproveRegistration activates the pending user with id
+func (dbManager *DBManager) ApproveRegistration(ctx context.Context, id uint) error {
+	return dbManager.updatePendingRegistration(ctx, id, map[string]any{
+		"registration_status": RegistrationActive,
+	})
+}
+
+// RejectRegistration rejects the pending user with id for reason. The user is soft deleted,
+// which frees its username and phone, and is purged along with the other deleted users
+func (dbManager *DBManager) RejectRegistration(ctx context.Context, id uint, reason string) error {
+	return dbManager.updatePendingRegistration(ctx, id, map[string]any{
+		"registration_status": RegistrationRejected,
+		"registration_reason": reason,
+		"deleted_at":          time.Now(),
+	})
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchSimilarityThreshold is the minimum trigram word similarity for a fuzzy match
+const searchSimilarityThreshold = 0.3
+
+type SearchUsersParams struct {
+	Query string
+	Limit int
+}
+
+// UserSearchResult is a user matching a search, along with how relevant the match is.
+// Higher ranks are better matches and ranks are only comparable within the same search
+type UserSearchResult struct {
+	User
+	Rank float64
+}
+
+// SearchTerms splits a search query into the lower case terms it is made of
+func SearchTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// SearchUsers finds the approved regular users whose full name or username match the query.
+// Postgres combines trigram similarity, which tolerates typos, with full-text matching. Other
+// databases fall back to matching each term as a substring. Encrypted full names are not searched
+func (dbManager *DBManager) SearchUsers(ctx context.Context, searchParams SearchUsersParams) ([]UserSearchResult, error) {
+	terms := SearchTerms(searchParams.Query)
+	if len(terms) == 0 {
+		return []UserSearchResult{}, nil
+	}
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	searchFullName := !dbManager.pii.Encrypts("full_name")
+
+	if dbManager.db.Dialector.Name() == "postgres" {
+		results, err := searchUsersPostgres(conn, strings.Join(terms, " "), searchParams.Limit, searchFullName)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range results {
+			if err := dbManager.openUser(&results[i].User); err != nil {
+				return nil, err
+			}
+		}
+
+		return results, nil
+	}
+
+	var users []User
+
+	query := conn.Omit("LoginToken").Where("admin = ? OR admin IS NULL", false).Where("registration_status = ?", RegistrationActive)
+
+	conditions := conn.Session(&gorm.Session{NewDB: true})
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		if searchFullName {
+			conditions = conditions.Or(`LOWER(full_name) LIKE ? ESCAPE '\'`, pattern)
+		}
+		conditions = conditions.Or(`LOWER(user_name) LIKE ? ESCAPE '\'`, pattern)
+	}
+
+	result := query.Where(conditions).Find(&users)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	if err := dbManager.openUsers(users); err != nil {
+		return nil, err
+	}
+
+	return rankUsers(users, terms, searchParams.Limit), nil
+}
+
+func searchUsersPostgres(conn *gorm.DB, query string, limit int, searchFullName bool) ([]UserSearchResult, error) {
+	var results []UserSearchResult
+
+	document := "to_tsvector('simple', coalesce(full_name, '') || ' ' || coalesce(user_name, ''))"
+	rank := "GREATEST(word_similarity(@query, full_name), word_similarity(@query, user_name), ts_rank(" + document + ", plainto_tsquery('simple', @query)))"
+	matches := "word_similarity(@query, full_name) > @threshold OR word_similarity(@query, user_name) > @threshold OR " + document + " @@ plainto_tsquery('simple', @query)"
+
+	if !searchFullName {
+		document = "to_tsvector('simple', coalesce(user_name, ''))"
+		rank = "GREATEST(word_similarity(@query, user_name), ts_rank(" + document + ", plainto_tsquery('simple', @query)))"
+		matches = "word_similarity(@query, user_name) > @threshold OR " + document + " @@ plainto_tsquery('simple', @query)"
+	}
+
+	result := conn.Model(&User{}).
+		Select("users.*, "+rank+" AS rank", map[string]any{"query": query}).
+		Where("(admin = @admin OR admin IS NULL) AND registration_status = @status AND ("+matches+")", map[string]any{
+			"admin":     false,
+			"status":    RegistrationActive,
+			"query":     query,
+			"threshold": searchSimilarityThreshold,
+		}).
+		Order("rank DESC").
+		Order("id").
+		Limit(limit).
+		Scan(&results)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].LoginToken = ""
+	}
+
+	return results, nil
+}
+
+// termRank scores how well a single term matches text: exact words score the highest,
+// followed by word prefixes and then by any other substring
+func termRank(text string, term string) float64 {
+	text = strings.ToLower(text)
+	if !strings.Contains(text, term) {
+		return 0
+	}
+
+	best := 0.5
+	for _, word := range strings.Fields(text) {
+		if word == term {
+			return 1
+		}
+
+		if strings.HasPrefix(word, term) {
+			best = 0.75
+		}
+	}
+
+	return best
+}
+
+// rankUsers ranks users by the average of their best rank for each term and returns the best
+// limit matches. It is the substring based fallback used when trigram search is unavailable
+func rankUsers(users []User, terms []string, limit int) []UserSearchResult {
+	results := []UserSearchResult{}
+	for _, user := range users {
+		var rank float64
+		for _, term := range terms {
+			fullNameRank := termRank(user.FullName, term)
+			userNameRank := termRank(user.UserName, term)
+
+			if fullNameRank > userNameRank {
+				rank += fullNameRank
+			} else {
+				rank += userNameRank
+			}
+		}
+
+		if rank > 0 {
+			results = append(results, UserSearchResult{
+				User: user,
+				Rank: rank / float64(len(terms)),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+
+		return results[i].ID < results[j].ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
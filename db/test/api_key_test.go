@@ -0,0 +1,113 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestCreateAPIKey() {
+	apiKeyMockRows := sqlmock.NewRows([]string{"id"}).AddRow("1")
+	expiresAt := time.Now().Add(time.Hour)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "api_keys" ("created_at","updated_at","deleted_at","user_id","name","prefix","key_hash","scopes","expires_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		1,
+		"batch",
+		"abcdef012345",
+		"hash",
+		"user:read user:write",
+		expiresAt,
+	).WillReturnRows(apiKeyMockRows)
+	dbms.mock.ExpectCommit()
+
+	apiKeyParams := db.CreateAPIKeyParams{
+		UserID:    1,
+		Name:      "batch",
+		Prefix:    "abcdef012345",
+		KeyHash:   "hash",
+		Scopes:    []string{"user:read", "user:write"},
+		ExpiresAt: &expiresAt,
+	}
+
+	apiKey, err := dbms.manager.CreateAPIKey(context.Background(), apiKeyParams)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(1), apiKey.ID)
+	assert.Equal(dbms.T(), "abcdef012345", apiKey.Prefix)
+	assert.Equal(dbms.T(), []string{"user:read", "user:write"}, apiKey.ScopeList())
+}
+
+func (dbms *DBManagerSuite) TestGetAPIKey() {
+	apiKeyMockRow := sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "scopes"}).AddRow("1", "2", "batch", "abcdef012345", "hash", "user:read")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE prefix = $1 AND "api_keys"."deleted_at" IS NULL ORDER BY "api_keys"."id" LIMIT 1`),
+	).WithArgs(
+		"abcdef012345",
+	).WillReturnRows(apiKeyMockRow)
+
+	apiKey, err := dbms.manager.GetAPIKey(context.Background(), "abcdef012345")
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), apiKey.UserID)
+	assert.Equal(dbms.T(), "hash", apiKey.KeyHash)
+	assert.Equal(dbms.T(), []string{"user:read"}, apiKey.ScopeList())
+}
+
+func (dbms *DBManagerSuite) TestGetAPIKeys() {
+	apiKeyMockRows := sqlmock.NewRows([]string{"id", "user_id", "name", "prefix"}).
+		AddRow("1", "2", "first", "abcdef012345").
+		AddRow("2", "2", "second", "abcdef543210")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE user_id = $1 AND "api_keys"."deleted_at" IS NULL ORDER BY id`),
+	).WithArgs(
+		2,
+	).WillReturnRows(apiKeyMockRows)
+
+	apiKeys, err := dbms.manager.GetAPIKeys(context.Background(), 2)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 2, len(apiKeys))
+	assert.Equal(dbms.T(), "first", apiKeys[0].Name)
+	assert.Equal(dbms.T(), "second", apiKeys[1].Name)
+}
+
+func (dbms *DBManagerSuite) TestRevokeAPIKey() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1,"updated_at"=$2 WHERE (user_id = $3 AND prefix = $4 AND revoked_at IS NULL) AND "api_keys"."deleted_at" IS NULL`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		2,
+		"abcdef012345",
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.RevokeAPIKey(context.Background(), 2, "abcdef012345")
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestRevokeAPIKeyNotFound() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "api_keys" SET "revoked_at"=$1,"updated_at"=$2 WHERE (user_id = $3 AND prefix = $4 AND revoked_at IS NULL) AND "api_keys"."deleted_at" IS NULL`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		2,
+		"abcdef012345",
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.RevokeAPIKey(context.Background(), 2, "abcdef012345")
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
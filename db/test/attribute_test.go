@@ -0,0 +1,68 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAttributeDefinitions = []db.AttributeDefinition{
+	{Name: "birthdate", Type: db.AttributeTypeDate, Required: true},
+	{Name: "department", Type: db.AttributeTypeString, Pattern: "[a-z]+"},
+	{Name: "level", Type: db.AttributeTypeNumber},
+	{Name: "manager", Type: db.AttributeTypeBoolean},
+}
+
+func TestIsValidAttributeName(t *testing.T) {
+	assert.True(t, db.IsValidAttributeName("department"))
+	assert.True(t, db.IsValidAttributeName("cost_center2"))
+	assert.False(t, db.IsValidAttributeName("2fa"))
+	assert.False(t, db.IsValidAttributeName("Department"))
+	assert.False(t, db.IsValidAttributeName("cost-center"))
+	assert.False(t, db.IsValidAttributeName(""))
+}
+
+func TestValidateAttributes(t *testing.T) {
+	validated, err := db.ValidateAttributes(testAttributeDefinitions, db.Attributes{
+		"birthdate":  "1990-05-17",
+		"department": "sales",
+		"level":      3,
+		"manager":    nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, db.Attributes{"birthdate": "1990-05-17", "department": "sales", "level": float64(3)}, validated)
+
+	invalid := []db.Attributes{
+		{"department": "sales"},
+		{"birthdate": "17/05/1990"},
+		{"birthdate": "1990-05-17", "department": "Sales"},
+		{"birthdate": "1990-05-17", "level": "3"},
+		{"birthdate": "1990-05-17", "manager": "yes"},
+		{"birthdate": "1990-05-17", "locale": "en"},
+	}
+	for _, attributes := range invalid {
+		_, err := db.ValidateAttributes(testAttributeDefinitions, attributes)
+		assert.Error(t, err, attributes)
+	}
+}
+
+func TestParseAttributeValue(t *testing.T) {
+	value, err := testAttributeDefinitions[2].ParseAttributeValue("2.5")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, value)
+
+	value, err = testAttributeDefinitions[3].ParseAttributeValue("false")
+	require.NoError(t, err)
+	assert.Equal(t, false, value)
+
+	_, err = testAttributeDefinitions[2].ParseAttributeValue("2.5 levels")
+	assert.Error(t, err)
+
+	_, err = testAttributeDefinitions[3].ParseAttributeValue("no")
+	assert.Error(t, err)
+
+	_, err = testAttributeDefinitions[1].ParseAttributeValue("Sales")
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (dbms *DBManagerSuite) TestCreateAuditEvent() {
+	latestMockRows := sqlmock.NewRows([]string{"hash"}).AddRow("prevhash")
+	auditMockRows := sqlmock.NewRows([]string{"id"}).AddRow("2")
+	actorID := uint(2)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`),
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "hash" FROM "audit_events" ORDER BY id DESC LIMIT 1`),
+	).WillReturnRows(latestMockRows)
+
+	// The personal data named by the event is stored apart from it
+	for i, value := range []string{`"test"`, `"test"`, `"99999999"`, `"99999998"`} {
+		field := "user_name"
+		if i >= 2 {
+			field = "phone"
+		}
+
+		dbms.mock.ExpectQuery(
+			regexp.QuoteMeta(`INSERT INTO "audit_personal_values" ("organization_id","user_id","invitation_id","field","value") VALUES ($1,$2,$3,$4,$5) RETURNING "id"`),
+		).WithArgs(
+			db.DefaultOrganizationID,
+			actorID,
+			nil,
+			field,
+			value,
+		).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10 + i))
+	}
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "audit_events" ("created_at","action","actor_id","actor_user_name","impersonator_user_name","target_id","target_user_name","ip","user_agent","before","after","prev_hash","hash") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13) RETURNING "id"`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		"user.update",
+		actorID,
+		"personal:10",
+		"",
+		actorID,
+		"personal:11",
+		"192.0.2.1",
+		"curl/8.0",
+		`{"phone":"personal:12"}`,
+		`{"phone":"personal:13"}`,
+		"prevhash",
+		sqlmock.AnyArg(),
+	).WillReturnRows(auditMockRows)
+	dbms.mock.ExpectCommit()
+
+	auditEvent, err := dbms.manager.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+		Action:         "user.update",
+		ActorID:        &actorID,
+		ActorUserName:  "test",
+		TargetID:       &actorID,
+		TargetUserName: "test",
+		IP:             "192.0.2.1",
+		UserAgent:      "curl/8.0",
+		Before:         `{"phone":"99999999"}`,
+		After:          `{"phone":"99999998"}`,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), auditEvent.ID)
+	assert.Equal(dbms.T(), "prevhash", auditEvent.PrevHash)
+	assert.Equal(dbms.T(), auditEvent.ComputeHash(), auditEvent.Hash)
+}
+
+func (dbms *DBManagerSuite) TestGetAuditEvents() {
+	since := time.Now().Add(-time.Hour)
+	auditMockRows := sqlmock.NewRows([]string{"id", "action", "actor_user_name"}).AddRow(4, "user.login", "personal:3")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "audit_events" WHERE (actor_user_name = $1 OR actor_user_name IN (SELECT 'personal:' || id FROM "audit_personal_values" WHERE field = $2 AND value = $3)) AND action = $4 AND created_at >= $5 AND id < $6 ORDER BY id DESC LIMIT 10`),
+	).WithArgs(
+		"test",
+		"user_name",
+		`"test"`,
+		"user.login",
+		since,
+		5,
+	).WillReturnRows(auditMockRows)
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "audit_personal_values" WHERE id IN ($1)`),
+	).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"id", "field", "value"}).AddRow(3, "user_name", `"test"`))
+
+	auditEvents, err := dbms.manager.GetAuditEvents(context.Background(), db.GetAuditEventsParams{
+		ActorUserName: "test",
+		Action:        "user.login",
+		Since:         &since,
+		BeforeID:      5,
+		Limit:         10,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 1, len(auditEvents))
+	assert.Equal(dbms.T(), uint(4), auditEvents[0].ID)
+	assert.Equal(dbms.T(), "test", auditEvents[0].Resolved().ActorUserName)
+}
+
+func TestSQLiteAuditEventsAreAppendOnly(t *testing.T) {
+	conn := openMigratedDB(t, "sqlite://:memory:")
+	manager := db.NewDBManager(conn, db.Timeouts{})
+
+	_, err := manager.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+		Action: "user.create",
+	})
+	require.NoError(t, err)
+
+	assert.Error(t, conn.Exec(`UPDATE audit_events SET action = 'user.delete'`).Error)
+	assert.Error(t, conn.Exec(`DELETE FROM audit_events`).Error)
+
+	auditEvents, err := manager.GetAuditEvents(context.Background(), db.GetAuditEventsParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(auditEvents))
+	assert.Equal(t, "user.create", auditEvents[0].Action)
+}
+
+func TestSQLiteAuditChainDetectsTampering(t *testing.T) {
+	conn := openMigratedDB(t, "sqlite://:memory:")
+	manager := db.NewDBManager(conn, db.Timeouts{})
+
+	// An event written before the log was chained
+	require.NoError(t, conn.Exec(`INSERT INTO audit_events (created_at, action) VALUES (CURRENT_TIMESTAMP, 'user.create')`).Error)
+
+	auditEvents := []*db.AuditEvent{}
+	for _, action := range []string{"user.login", "user.update", "user.delete"} {
+		auditEvent, err := manager.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+			Action:        action,
+			ActorUserName: "test",
+			After:         `{"full_name":"Test User"}`,
+		})
+		require.NoError(t, err)
+
+		auditEvents = append(auditEvents, auditEvent)
+	}
+
+	report, err := db.VerifyAuditChain(context.Background(), manager)
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+	assert.Equal(t, 1, report.Unchained)
+	assert.Equal(t, 3, report.Verified)
+	assert.Equal(t, auditEvents[2].Hash, report.LastHash)
+
+	require.NoError(t, conn.Exec(`DROP TRIGGER audit_events_no_update`).Error)
+	require.NoError(t, conn.Exec(`UPDATE audit_events SET after = '{"full_name":"Someone Else"}' WHERE id = ?`, auditEvents[1].ID).Error)
+
+	report, err = db.VerifyAuditChain(context.Background(), manager)
+	require.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.Equal(t, auditEvents[1].ID, *report.BrokenAt)
+	assert.Equal(t, "Event does not match its hash", report.Reason)
+	assert.Equal(t, 1, report.Verified)
+
+	require.NoError(t, conn.Exec(`DROP TRIGGER audit_events_no_delete`).Error)
+	require.NoError(t, conn.Exec(`DELETE FROM audit_events WHERE id = ?`, auditEvents[1].ID).Error)
+
+	report, err = db.VerifyAuditChain(context.Background(), manager)
+	require.NoError(t, err)
+	assert.Equal(t, auditEvents[2].ID, *report.BrokenAt)
+	assert.Equal(t, "Event is not linked to the event before it", report.Reason)
+}
@@ -0,0 +1,1836 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// ConformanceSuite describes the behavior every DBConnector implementation must follow.
+// newConnector is called before each test and must return a connector without any data.
+// Backends keeping their data in a database set openDB instead, which lets tests look at
+// the stored rows
+type ConformanceSuite struct {
+	suite.Suite
+	newConnector func(t *testing.T) db.DBConnector
+	openDB       func(t *testing.T) *gorm.DB
+
+	connector db.DBConnector
+	conn      *gorm.DB
+}
+
+func (cs *ConformanceSuite) SetupTest() {
+	if cs.openDB != nil {
+		cs.conn = cs.openDB(cs.T())
+		cs.connector = db.NewDBManager(cs.conn, db.Timeouts{})
+		return
+	}
+
+	cs.connector = cs.newConnector(cs.T())
+}
+
+func (cs *ConformanceSuite) createUser(suffix string) *db.User {
+	user, err := cs.connector.CreateUser(context.Background(), numberedUserFixture(suffix))
+	require.NoError(cs.T(), err)
+
+	return user
+}
+
+func (cs *ConformanceSuite) TestCreateAndGetUser() {
+	created := cs.createUser("0")
+	assert.NotZero(cs.T(), created.ID)
+
+	user, err := cs.connector.GetUser(context.Background(), "test0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), created.ID, user.ID)
+	assert.Equal(cs.T(), "Test User 0", user.FullName)
+	assert.Equal(cs.T(), "99999990", user.Phone)
+	assert.False(cs.T(), user.Admin)
+
+	user, err = cs.connector.GetUserByID(context.Background(), created.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), "test0", user.UserName)
+}
+
+func (cs *ConformanceSuite) TestCreateUserDuplicate() {
+	cs.createUser("0")
+
+	_, err := cs.connector.CreateUser(context.Background(), db.CreateUserParams{
+		FullName: "Other User",
+		Phone:    "99999990",
+		UserName: "other0",
+		Password: "secret",
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+	assert.Equal(cs.T(), "An user with the provided phone number already exists", err.Error())
+
+	_, err = cs.connector.CreateUser(context.Background(), db.CreateUserParams{
+		FullName: "Other User",
+		Phone:    "88888888",
+		UserName: "test0",
+		Password: "secret",
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+	assert.Equal(cs.T(), "An user with the provided username already exists", err.Error())
+}
+
+func (cs *ConformanceSuite) TestGetUserNotFound() {
+	_, err := cs.connector.GetUser(context.Background(), "missing")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestGetUsers() {
+	for i := 0; i < numUsers; i++ {
+		cs.createUser(fmt.Sprint(i))
+	}
+
+	users, err := cs.connector.GetUsers(context.Background(), db.GetUsersParams{PageIndex: 0, Offset: 3})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 3, len(users))
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{PageIndex: 1, Offset: 3})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), numUsers-3, len(users))
+}
+
+func (cs *ConformanceSuite) TestGetUsersFilters() {
+	for i := 0; i < numUsers; i++ {
+		cs.createUser(fmt.Sprint(i))
+	}
+	cs.createUser("_a")
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test1"))
+
+	users, err := cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, UserNamePrefix: "TEST_"})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(users))
+	assert.Equal(cs.T(), "test_a", users[0].UserName)
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, FullNamePrefix: "test user 2"})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(users))
+	assert.Equal(cs.T(), "test2", users[0].UserName)
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Phone: "99999993"})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(users))
+	assert.Equal(cs.T(), "test3", users[0].UserName)
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Deleted: db.DeletedOnly})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(users))
+	assert.Equal(cs.T(), "test1", users[0].UserName)
+	assert.True(cs.T(), users[0].DeletedAt.Valid)
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Deleted: db.DeletedInclude})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), numUsers+1, len(users))
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), numUsers, len(users))
+
+	future := time.Now().Add(time.Hour)
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, CreatedAfter: &future})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), users)
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, UpdatedBefore: &future})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), numUsers, len(users))
+
+	admin := true
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Admin: &admin})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), users)
+}
+
+func (cs *ConformanceSuite) TestGetUsersSort() {
+	for _, suffix := range []string{"2", "0", "1"} {
+		cs.createUser(suffix)
+	}
+
+	users, err := cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), []string{"test2", "test0", "test1"}, userNames(users))
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, SortBy: "user_name"})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), []string{"test0", "test1", "test2"}, userNames(users))
+
+	users, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 2, PageIndex: 0, SortBy: "phone", SortDesc: true})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), []string{"test2", "test1"}, userNames(users))
+
+	_, err = cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, SortBy: "password"})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+}
+
+// pageAll walks every keyset page forward and then backward, returning the user names seen
+func (cs *ConformanceSuite) pageAll(searchParams db.GetUsersParams) ([]string, []string) {
+	forward := []string{}
+	searchParams.Cursor = nil
+
+	var last db.User
+	for {
+		users, err := cs.connector.GetUsers(context.Background(), searchParams)
+		require.NoError(cs.T(), err)
+
+		if len(users) == 0 {
+			break
+		}
+
+		forward = append(forward, userNames(users)...)
+		last = users[len(users)-1]
+
+		cursor, err := db.DecodeUsersCursor(db.NewUsersCursor(last, searchParams.SortBy, searchParams.SortDesc, false).Encode())
+		require.NoError(cs.T(), err)
+		searchParams.Cursor = cursor
+	}
+
+	backward := []string{}
+	searchParams.Cursor = db.NewUsersCursor(last, searchParams.SortBy, searchParams.SortDesc, true)
+	backward = append(backward, last.UserName)
+	for {
+		users, err := cs.connector.GetUsers(context.Background(), searchParams)
+		require.NoError(cs.T(), err)
+
+		if len(users) == 0 {
+			break
+		}
+
+		backward = append(userNames(users), backward...)
+
+		cursor, err := db.DecodeUsersCursor(db.NewUsersCursor(users[0], searchParams.SortBy, searchParams.SortDesc, true).Encode())
+		require.NoError(cs.T(), err)
+		searchParams.Cursor = cursor
+	}
+
+	return forward, backward
+}
+
+func (cs *ConformanceSuite) TestGetUsersCursor() {
+	for _, suffix := range []string{"3", "0", "4", "1", "2"} {
+		cs.createUser(suffix)
+	}
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test4"))
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test2"))
+
+	forward, backward := cs.pageAll(db.GetUsersParams{Offset: 2})
+	assert.Equal(cs.T(), []string{"test3", "test0", "test1"}, forward)
+	assert.Equal(cs.T(), forward, backward)
+
+	forward, backward = cs.pageAll(db.GetUsersParams{Offset: 2, SortBy: "user_name", SortDesc: true})
+	assert.Equal(cs.T(), []string{"test3", "test1", "test0"}, forward)
+	assert.Equal(cs.T(), forward, backward)
+
+	forward, backward = cs.pageAll(db.GetUsersParams{Offset: 2, SortBy: "deleted_at", Deleted: db.DeletedInclude})
+	assert.Equal(cs.T(), []string{"test3", "test0", "test1", "test4", "test2"}, forward)
+	assert.Equal(cs.T(), forward, backward)
+
+	forward, backward = cs.pageAll(db.GetUsersParams{Offset: 2, SortBy: "deleted_at", SortDesc: true, Deleted: db.DeletedInclude})
+	assert.Equal(cs.T(), []string{"test2", "test4", "test1", "test0", "test3"}, forward)
+	assert.Equal(cs.T(), forward, backward)
+
+	forward, backward = cs.pageAll(db.GetUsersParams{Offset: 3, SortBy: "created_at", SortDesc: true})
+	assert.Equal(cs.T(), []string{"test1", "test0", "test3"}, forward)
+	assert.Equal(cs.T(), forward, backward)
+
+	_, err := cs.connector.GetUsers(context.Background(), db.GetUsersParams{
+		Offset: 2,
+		SortBy: "phone",
+		Cursor: db.NewUsersCursor(db.User{UserName: "test0"}, "user_name", false, false),
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+}
+
+func (cs *ConformanceSuite) TestCountUsers() {
+	for i := 0; i < numUsers; i++ {
+		cs.createUser(fmt.Sprint(i))
+	}
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test1"))
+
+	count, err := cs.connector.CountUsers(context.Background(), db.GetUsersParams{Offset: 1})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(numUsers-1), count)
+
+	count, err = cs.connector.CountUsers(context.Background(), db.GetUsersParams{Offset: 1, Deleted: db.DeletedInclude})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(numUsers), count)
+
+	count, err = cs.connector.CountUsers(context.Background(), db.GetUsersParams{Offset: 1, UserNamePrefix: "test2"})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(1), count)
+}
+
+func (cs *ConformanceSuite) TestSearchUsers() {
+	for i, fullName := range []string{"Mary Johnson", "John Smith", "Johnny Walker", "Peter Parker"} {
+		_, err := cs.connector.CreateUser(context.Background(), db.CreateUserParams{
+			FullName: fullName,
+			Phone:    "9999999" + fmt.Sprint(i),
+			UserName: strings.ToLower(strings.Fields(fullName)[0]) + "user",
+			Password: "secret",
+		})
+		require.NoError(cs.T(), err)
+	}
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "peteruser"))
+
+	results, err := cs.connector.SearchUsers(context.Background(), db.SearchUsersParams{Query: "john", Limit: 10})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 3, len(results))
+	assert.Equal(cs.T(), "John Smith", results[0].FullName)
+	for i := 1; i < len(results); i++ {
+		assert.GreaterOrEqual(cs.T(), results[i-1].Rank, results[i].Rank)
+	}
+
+	results, err = cs.connector.SearchUsers(context.Background(), db.SearchUsersParams{Query: "john", Limit: 1})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(results))
+
+	results, err = cs.connector.SearchUsers(context.Background(), db.SearchUsersParams{Query: "parker", Limit: 10})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), results)
+
+	results, err = cs.connector.SearchUsers(context.Background(), db.SearchUsersParams{Query: "  ", Limit: 10})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), results)
+}
+
+func userNames(users []db.User) []string {
+	names := []string{}
+	for _, user := range users {
+		names = append(names, user.UserName)
+	}
+
+	return names
+}
+
+func (cs *ConformanceSuite) TestUpdateUser() {
+	created := cs.createUser("0")
+
+	err := cs.connector.UpdateUser(context.Background(), db.UpdateUserParams{
+		ID:         created.ID,
+		FullName:   "Updated User",
+		Phone:      "88888888",
+		Password:   created.Password,
+		LoginToken: "token",
+		Version:    created.Version,
+	})
+	assert.NoError(cs.T(), err)
+
+	user, err := cs.connector.GetUser(context.Background(), "test0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), "Updated User", user.FullName)
+	assert.Equal(cs.T(), "88888888", user.Phone)
+	assert.Equal(cs.T(), "token", user.LoginToken)
+}
+
+func (cs *ConformanceSuite) TestDeleteUser() {
+	cs.createUser("0")
+
+	err := cs.connector.DeleteUser(context.Background(), "test0")
+	assert.NoError(cs.T(), err)
+
+	_, err = cs.connector.GetUser(context.Background(), "test0")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestAPIKeys() {
+	user := cs.createUser("0")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	_, err := cs.connector.CreateAPIKey(context.Background(), db.CreateAPIKeyParams{
+		UserID:    user.ID,
+		Name:      "batch",
+		Prefix:    "abcdef012345",
+		KeyHash:   "hash",
+		Scopes:    []string{"user:read"},
+		ExpiresAt: &expiresAt,
+	})
+	assert.NoError(cs.T(), err)
+
+	_, err = cs.connector.CreateAPIKey(context.Background(), db.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "duplicate",
+		Prefix:  "abcdef012345",
+		KeyHash: "hash",
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	apiKey, err := cs.connector.GetAPIKey(context.Background(), "abcdef012345")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), user.ID, apiKey.UserID)
+	assert.Equal(cs.T(), []string{"user:read"}, apiKey.ScopeList())
+	assert.True(cs.T(), expiresAt.Equal(*apiKey.ExpiresAt))
+	assert.Nil(cs.T(), apiKey.RevokedAt)
+
+	assert.NoError(cs.T(), cs.connector.TouchAPIKey(context.Background(), apiKey.ID))
+	assert.NoError(cs.T(), cs.connector.RevokeAPIKey(context.Background(), user.ID, "abcdef012345"))
+
+	err = cs.connector.RevokeAPIKey(context.Background(), user.ID, "abcdef012345")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	apiKeys, err := cs.connector.GetAPIKeys(context.Background(), user.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, len(apiKeys))
+	assert.NotNil(cs.T(), apiKeys[0].RevokedAt)
+	assert.NotNil(cs.T(), apiKeys[0].LastUsedAt)
+}
+
+func (cs *ConformanceSuite) TestWithTx() {
+	err := cs.connector.WithTx(context.Background(), func(tx db.DBConnector) error {
+		_, err := tx.CreateUser(context.Background(), userFixture())
+
+		return err
+	})
+	assert.NoError(cs.T(), err)
+
+	_, err = cs.connector.GetUser(context.Background(), "test")
+	assert.NoError(cs.T(), err)
+}
+
+func (cs *ConformanceSuite) TestWithTxRollback() {
+	expectedErr := fmt.Errorf("Operation failed")
+
+	err := cs.connector.WithTx(context.Background(), func(tx db.DBConnector) error {
+		if _, err := tx.CreateUser(context.Background(), userFixture()); err != nil {
+			return err
+		}
+
+		return expectedErr
+	})
+	assert.Equal(cs.T(), expectedErr, err)
+
+	_, err = cs.connector.GetUser(context.Background(), "test")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestUpdateUserDuplicatePhone() {
+	cs.createUser("0")
+	other := cs.createUser("1")
+
+	err := cs.connector.UpdateUser(context.Background(), db.UpdateUserParams{
+		ID:       other.ID,
+		FullName: other.FullName,
+		Phone:    "99999990",
+		Password: other.Password,
+		Version:  other.Version,
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+	assert.Equal(cs.T(), "An user with the provided phone number already exists", err.Error())
+}
+
+func (cs *ConformanceSuite) TestDeletedUserReleasesUniqueFields() {
+	cs.createUser("0")
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test0"))
+
+	user, err := cs.connector.CreateUser(context.Background(), numberedUserFixture("0"))
+	assert.NoError(cs.T(), err)
+	assert.NotZero(cs.T(), user.ID)
+}
+
+func (cs *ConformanceSuite) TestRestoreUser() {
+	user := cs.createUser("0")
+
+	err := cs.connector.RestoreUser(context.Background(), user.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test0"))
+	assert.NoError(cs.T(), cs.connector.RestoreUser(context.Background(), user.ID))
+
+	restored, err := cs.connector.GetUser(context.Background(), "test0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), user.ID, restored.ID)
+
+	err = cs.connector.RestoreUser(context.Background(), 12345)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestRestoreUserConflict() {
+	user := cs.createUser("0")
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test0"))
+	cs.createUser("0")
+
+	err := cs.connector.RestoreUser(context.Background(), user.ID)
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+}
+
+func (cs *ConformanceSuite) TestPurgeUser() {
+	user := cs.createUser("0")
+
+	_, err := cs.connector.CreateAPIKey(context.Background(), db.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "batch",
+		Prefix:  "abcdef012345",
+		KeyHash: "hash",
+	})
+	require.NoError(cs.T(), err)
+
+	err = cs.connector.PurgeUser(context.Background(), user.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test0"))
+	assert.NoError(cs.T(), cs.connector.PurgeUser(context.Background(), user.ID))
+
+	err = cs.connector.RestoreUser(context.Background(), user.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	_, err = cs.connector.GetAPIKey(context.Background(), "abcdef012345")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestPurgeDeletedUsers() {
+	cs.createUser("0")
+	cs.createUser("1")
+	cs.createUser("2")
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test0"))
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), "test1"))
+
+	purged, err := cs.connector.PurgeDeletedUsers(context.Background(), time.Now().Add(-time.Hour))
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(0), purged)
+
+	purged, err = cs.connector.PurgeDeletedUsers(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(2), purged)
+
+	users, err := cs.connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Deleted: db.DeletedInclude})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), []string{"test2"}, userNames(users))
+}
+
+func (cs *ConformanceSuite) TestPurgeUserErasesAuditPersonalValues() {
+	ctx := context.Background()
+	users := []*db.User{cs.createUser("0"), cs.createUser("1")}
+
+	for _, user := range users {
+		for _, auditParams := range []db.CreateAuditEventParams{
+			{
+				Action:         "user.create",
+				TargetID:       &user.ID,
+				TargetUserName: user.UserName,
+				After:          fmt.Sprintf(`{"full_name":%q,"phone":%q}`, user.FullName, user.Phone),
+			},
+			{
+				Action:        "user.login",
+				ActorUserName: user.UserName,
+				After:         `{"reason":"wrong_password"}`,
+			},
+		} {
+			_, err := cs.connector.CreateAuditEvent(ctx, auditParams)
+			require.NoError(cs.T(), err)
+		}
+
+		require.NoError(cs.T(), cs.connector.DeleteUser(ctx, user.UserName))
+	}
+
+	// Somebody else registers with the name of the second user after it was deleted
+	cs.createUser("1")
+
+	require.NoError(cs.T(), cs.connector.PurgeUser(ctx, users[0].ID))
+
+	purged, err := cs.connector.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(1), purged)
+
+	auditEvents, err := cs.connector.GetAuditEvents(ctx, db.GetAuditEventsParams{Ascending: true})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), auditEvents, 4)
+
+	for i, user := range users {
+		created := auditEvents[2*i].Resolved()
+		assert.Equal(cs.T(), db.ErasedIdentity(user.ID), created.TargetUserName)
+		assert.Equal(cs.T(), fmt.Sprintf(`{"full_name":"Erased User","phone":"erased-%d"}`, user.ID), created.After)
+	}
+
+	assert.Equal(cs.T(), db.ErasedIdentity(users[0].ID), auditEvents[1].Resolved().ActorUserName)
+	// The failed login may be about the user now going by the name
+	assert.Equal(cs.T(), "test1", auditEvents[3].Resolved().ActorUserName)
+
+	if cs.conn == nil {
+		return
+	}
+
+	for _, value := range storedValues(cs.T(), cs.conn) {
+		for _, erased := range []string{"Test User 0", "99999990", "test0"} {
+			assert.NotContains(cs.T(), value, erased)
+		}
+	}
+}
+
+func (cs *ConformanceSuite) TestAuditEvents() {
+	actions := []string{"user.create", "user.login", "user.update", "user.login"}
+	for i, action := range actions {
+		actorID := uint(i + 1)
+		_, err := cs.connector.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+			Action:         action,
+			ActorID:        &actorID,
+			ActorUserName:  fmt.Sprintf("test%d", i%2),
+			TargetUserName: "target",
+			Before:         `{"phone":"99999990"}`,
+		})
+		require.NoError(cs.T(), err)
+	}
+
+	auditEvents, err := cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 4, len(auditEvents))
+	assert.Equal(cs.T(), "user.login", auditEvents[0].Action)
+	assert.Equal(cs.T(), uint(4), *auditEvents[0].ActorID)
+	assert.NotContains(cs.T(), auditEvents[0].Before, "99999990")
+	assert.NotEqual(cs.T(), "test1", auditEvents[0].ActorUserName)
+	assert.Equal(cs.T(), "user.create", auditEvents[3].Action)
+
+	// Events refer to the personal data they name, which is loaded along with them
+	resolved := auditEvents[0].Resolved()
+	assert.Equal(cs.T(), `{"phone":"99999990"}`, resolved.Before)
+	assert.Equal(cs.T(), "test1", resolved.ActorUserName)
+	assert.Equal(cs.T(), "target", resolved.TargetUserName)
+
+	auditEvents, err = cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{
+		ActorUserName: "test1",
+		Action:        "user.login",
+	})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 2, len(auditEvents))
+
+	page, err := cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{
+		BeforeID: auditEvents[0].ID,
+		Limit:    2,
+	})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 2, len(page))
+	assert.Equal(cs.T(), "user.update", page[0].Action)
+
+	future := time.Now().Add(time.Hour)
+	auditEvents, err = cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{
+		TargetUserName: "target",
+		Since:          &future,
+	})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), auditEvents)
+}
+
+func (cs *ConformanceSuite) TestAuditChain() {
+	report, err := db.VerifyAuditChain(context.Background(), cs.connector)
+	assert.NoError(cs.T(), err)
+	assert.True(cs.T(), report.Valid())
+	assert.Equal(cs.T(), 0, report.Verified)
+
+	var latest *db.AuditEvent
+	for i := 0; i < 3; i++ {
+		auditEvent, err := cs.connector.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+			Action:         "user.update",
+			TargetUserName: fmt.Sprintf("test%d", i),
+			After:          `{"full_name":"Test User"}`,
+		})
+		require.NoError(cs.T(), err)
+
+		if latest != nil {
+			assert.Equal(cs.T(), latest.Hash, auditEvent.PrevHash)
+		}
+		latest = auditEvent
+	}
+
+	report, err = db.VerifyAuditChain(context.Background(), cs.connector)
+	assert.NoError(cs.T(), err)
+	assert.True(cs.T(), report.Valid())
+	assert.Equal(cs.T(), 3, report.Verified)
+	assert.Equal(cs.T(), latest.Hash, report.LastHash)
+}
+
+func (cs *ConformanceSuite) TestConcurrentAuditEvents() {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := cs.connector.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+				Action:         "user.login",
+				TargetUserName: fmt.Sprintf("test%d", i),
+			})
+			assert.NoError(cs.T(), err)
+		}(i)
+	}
+	wg.Wait()
+
+	report, err := db.VerifyAuditChain(context.Background(), cs.connector)
+	assert.NoError(cs.T(), err)
+	assert.True(cs.T(), report.Valid())
+	assert.Equal(cs.T(), 10, report.Verified)
+}
+
+func (cs *ConformanceSuite) TestLoginAttempts() {
+	user := cs.createUser("0")
+	other := cs.createUser("1")
+
+	for i, userAgent := range []string{"Phone", "Laptop", "Phone"} {
+		_, err := cs.connector.CreateLoginAttempt(context.Background(), db.CreateLoginAttemptParams{
+			UserID:    &user.ID,
+			UserName:  user.UserName,
+			Success:   i != 1,
+			IP:        "192.0.2.1",
+			UserAgent: userAgent,
+			Country:   "US",
+			City:      "San Francisco",
+		})
+		require.NoError(cs.T(), err)
+	}
+
+	_, err := cs.connector.CreateLoginAttempt(context.Background(), db.CreateLoginAttemptParams{
+		UserID:    &other.ID,
+		UserName:  other.UserName,
+		Success:   true,
+		UserAgent: "Laptop",
+	})
+	require.NoError(cs.T(), err)
+
+	unknown, err := cs.connector.CreateLoginAttempt(context.Background(), db.CreateLoginAttemptParams{
+		UserName:      "unknown",
+		FailureReason: "unknown_user",
+	})
+	require.NoError(cs.T(), err)
+	assert.Nil(cs.T(), unknown.UserID)
+
+	loginAttempts, err := cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{UserID: user.ID})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), loginAttempts, 3)
+	assert.Equal(cs.T(), "Phone", loginAttempts[0].UserAgent)
+	assert.True(cs.T(), loginAttempts[0].Success)
+	assert.Equal(cs.T(), "San Francisco", loginAttempts[0].City)
+	assert.False(cs.T(), loginAttempts[1].Success)
+	assert.Equal(cs.T(), user.ID, *loginAttempts[2].UserID)
+
+	success := true
+	laptop := "Laptop"
+
+	loginAttempts, err = cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{
+		UserID:    user.ID,
+		Success:   &success,
+		UserAgent: &laptop,
+	})
+	require.NoError(cs.T(), err)
+	assert.Empty(cs.T(), loginAttempts)
+
+	loginAttempts, err = cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{
+		UserID:  user.ID,
+		Success: &success,
+		Limit:   1,
+	})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), loginAttempts, 1)
+
+	page, err := cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{
+		UserID:   user.ID,
+		BeforeID: loginAttempts[0].ID,
+	})
+	require.NoError(cs.T(), err)
+	assert.Len(cs.T(), page, 2)
+
+	assert.NoError(cs.T(), cs.connector.DeleteUser(context.Background(), user.UserName))
+	assert.NoError(cs.T(), cs.connector.PurgeUser(context.Background(), user.ID))
+
+	loginAttempts, err = cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{UserID: user.ID})
+	require.NoError(cs.T(), err)
+	assert.Empty(cs.T(), loginAttempts)
+}
+
+func (cs *ConformanceSuite) TestEraseUser() {
+	user := cs.createUser("0")
+	other := cs.createUser("1")
+
+	_, err := cs.connector.CreateAPIKey(context.Background(), db.CreateAPIKeyParams{
+		UserID:  user.ID,
+		Name:    "batch",
+		Prefix:  "abcdef012345",
+		KeyHash: "hash",
+	})
+	require.NoError(cs.T(), err)
+
+	for _, loginParams := range []db.CreateLoginAttemptParams{
+		{UserID: &user.ID, UserName: user.UserName, Success: true},
+		{UserName: user.UserName, FailureReason: "unknown_user"},
+		{UserID: &other.ID, UserName: other.UserName, Success: true},
+	} {
+		_, err := cs.connector.CreateLoginAttempt(context.Background(), loginParams)
+		require.NoError(cs.T(), err)
+	}
+
+	_, err = cs.connector.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+		Action:         "user.create",
+		TargetID:       &user.ID,
+		TargetUserName: user.UserName,
+	})
+	require.NoError(cs.T(), err)
+
+	_, err = cs.connector.CreateAuditEvent(context.Background(), db.CreateAuditEventParams{
+		Action:        "user.login",
+		ActorID:       &other.ID,
+		ActorUserName: other.UserName,
+	})
+	require.NoError(cs.T(), err)
+
+	erased, err := cs.connector.EraseUser(context.Background(), user.ID)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), user.ID, erased.ID)
+	assert.Equal(cs.T(), db.ErasedFullName, erased.FullName)
+	assert.Equal(cs.T(), db.ErasedIdentity(user.ID), erased.UserName)
+	assert.Equal(cs.T(), db.ErasedIdentity(user.ID), erased.Phone)
+	assert.Empty(cs.T(), erased.Password)
+
+	_, err = cs.connector.GetUser(context.Background(), "test0")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	found, err := cs.connector.GetUserByID(context.Background(), user.ID)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), erased.UserName, found.UserName)
+	assert.Equal(cs.T(), db.ErasedFullName, found.FullName)
+	assert.Empty(cs.T(), found.Password)
+	assert.False(cs.T(), found.DeletedAt.Valid)
+
+	_, err = cs.connector.GetAPIKey(context.Background(), "abcdef012345")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	loginAttempts, err := cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{UserID: user.ID})
+	require.NoError(cs.T(), err)
+	assert.Empty(cs.T(), loginAttempts)
+
+	loginAttempts, err = cs.connector.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{UserID: other.ID})
+	require.NoError(cs.T(), err)
+	assert.Len(cs.T(), loginAttempts, 1)
+
+	// Audit events keep referring to the erased user
+	auditEvents, err := cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{UserID: user.ID})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), auditEvents, 1)
+	assert.Equal(cs.T(), "user.create", auditEvents[0].Action)
+
+	// The freed username and phone can be registered again
+	cs.createUser("0")
+
+	_, err = cs.connector.EraseUser(context.Background(), 9999)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestEraseUserForgetsPersonalData() {
+	ctx := db.WithTenant(context.Background(), db.DefaultOrganizationID)
+	other := cs.createUser("1")
+
+	invitation, err := cs.connector.CreateInvitation(ctx, db.CreateInvitationParams{
+		InviterID: &other.ID,
+		FullName:  "Test User 0",
+		Phone:     "99999990",
+		CodeHash:  "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(cs.T(), err)
+
+	user := cs.createUser("0")
+	require.NoError(cs.T(), cs.connector.AcceptInvitation(ctx, invitation.ID, user.ID))
+
+	for _, auditParams := range []db.CreateAuditEventParams{
+		{
+			Action:        "invitation.create",
+			ActorID:       &other.ID,
+			ActorUserName: other.UserName,
+			InvitationID:  &invitation.ID,
+			After:         fmt.Sprintf(`{"full_name":"Test User 0","invitation_id":%d,"phone":"99999990"}`, invitation.ID),
+		},
+		{
+			Action:         "user.create",
+			TargetID:       &user.ID,
+			TargetUserName: user.UserName,
+			After:          `{"admin":false,"full_name":"Test User 0","phone":"99999990","user_name":"test0"}`,
+		},
+		{
+			Action:         "user.user_name_change",
+			ActorID:        &user.ID,
+			ActorUserName:  user.UserName,
+			TargetID:       &user.ID,
+			TargetUserName: user.UserName,
+			Before:         `{"user_name":"former0"}`,
+			After:          `{"user_name":"test0"}`,
+		},
+		{
+			Action:         "user.impersonate",
+			ActorID:        &other.ID,
+			ActorUserName:  other.UserName,
+			ImpersonatorID: &user.ID,
+			// The impersonator name is the one to erase here
+			ImpersonatorUserName: user.UserName,
+		},
+		{
+			Action:        "user.login",
+			ActorUserName: user.UserName,
+			After:         `{"reason":"wrong_password"}`,
+		},
+		{
+			Action:        "user.login",
+			ActorID:       &other.ID,
+			ActorUserName: other.UserName,
+		},
+	} {
+		_, err := cs.connector.CreateAuditEvent(ctx, auditParams)
+		require.NoError(cs.T(), err)
+	}
+
+	_, err = cs.connector.EraseUser(ctx, user.ID)
+	require.NoError(cs.T(), err)
+
+	erasedValues := []string{"Test User 0", "99999990", "test0", "former0"}
+
+	auditEvents, err := cs.connector.GetAuditEvents(ctx, db.GetAuditEventsParams{Ascending: true})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), auditEvents, 6)
+
+	for _, auditEvent := range auditEvents {
+		resolved := auditEvent.Resolved()
+		for _, erased := range erasedValues {
+			for _, value := range []string{resolved.ActorUserName, resolved.ImpersonatorUserName, resolved.TargetUserName, resolved.Before, resolved.After} {
+				assert.NotContains(cs.T(), value, erased, "Event %d still names the erased user", auditEvent.ID)
+			}
+		}
+	}
+
+	assert.Equal(cs.T(), fmt.Sprintf(`{"full_name":"Erased User","invitation_id":%d,"phone":"erased-%d"}`, invitation.ID, user.ID), auditEvents[0].Resolved().After)
+	assert.Equal(cs.T(), db.ErasedIdentity(user.ID), auditEvents[1].Resolved().TargetUserName)
+	assert.Equal(cs.T(), db.ErasedIdentity(user.ID), auditEvents[3].Resolved().ImpersonatorUserName)
+	assert.Equal(cs.T(), other.UserName, auditEvents[5].Resolved().ActorUserName)
+
+	// The erased user can still be looked up by the identity replacing their username
+	auditEvents, err = cs.connector.GetAuditEvents(ctx, db.GetAuditEventsParams{TargetUserName: db.ErasedIdentity(user.ID)})
+	require.NoError(cs.T(), err)
+	assert.Len(cs.T(), auditEvents, 2)
+
+	report, err := db.VerifyAuditChain(ctx, cs.connector)
+	require.NoError(cs.T(), err)
+	assert.True(cs.T(), report.Valid())
+	assert.Equal(cs.T(), 6, report.Verified)
+
+	_, err = cs.connector.GetInvitation(ctx, invitation.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	if cs.conn == nil {
+		return
+	}
+
+	for _, value := range storedValues(cs.T(), cs.conn) {
+		for _, erased := range erasedValues {
+			assert.NotContains(cs.T(), value, erased)
+		}
+	}
+}
+
+func (cs *ConformanceSuite) TestEraseUserKeepsOtherOrganizations() {
+	organization, err := cs.connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(cs.T(), err)
+
+	defaultCtx := db.WithTenant(context.Background(), db.DefaultOrganizationID)
+	acmeCtx := db.WithTenant(context.Background(), organization.ID)
+
+	user := cs.createUser("0")
+
+	// The other organization has a user with the same name
+	acmeUser, err := cs.connector.CreateUser(acmeCtx, numberedUserFixture("0"))
+	require.NoError(cs.T(), err)
+
+	for _, named := range []struct {
+		ctx  context.Context
+		user *db.User
+	}{
+		{defaultCtx, user},
+		{acmeCtx, acmeUser},
+	} {
+		for _, loginParams := range []db.CreateLoginAttemptParams{
+			{UserID: &named.user.ID, UserName: named.user.UserName, Success: true},
+			{UserName: named.user.UserName, FailureReason: "unknown_user"},
+		} {
+			_, err := cs.connector.CreateLoginAttempt(named.ctx, loginParams)
+			require.NoError(cs.T(), err)
+		}
+
+		_, err = cs.connector.CreateAuditEvent(named.ctx, db.CreateAuditEventParams{
+			Action:        "user.login",
+			ActorUserName: named.user.UserName,
+			After:         `{"reason":"unknown_user"}`,
+		})
+		require.NoError(cs.T(), err)
+	}
+
+	// Erasing outside of any organization only touches the one of the user
+	_, err = cs.connector.EraseUser(context.Background(), user.ID)
+	require.NoError(cs.T(), err)
+
+	loginAttempts, err := cs.connector.GetLoginAttempts(acmeCtx, db.GetLoginAttemptsParams{UserID: acmeUser.ID})
+	require.NoError(cs.T(), err)
+	assert.Len(cs.T(), loginAttempts, 1)
+
+	auditEvents, err := cs.connector.GetAuditEvents(context.Background(), db.GetAuditEventsParams{Ascending: true})
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), auditEvents, 2)
+	assert.Equal(cs.T(), db.ErasedIdentity(user.ID), auditEvents[0].Resolved().ActorUserName)
+	assert.Equal(cs.T(), acmeUser.UserName, auditEvents[1].Resolved().ActorUserName)
+
+	if cs.conn == nil {
+		return
+	}
+
+	var remaining []db.LoginAttempt
+	require.NoError(cs.T(), cs.conn.Order("id").Find(&remaining).Error)
+	require.Len(cs.T(), remaining, 2)
+
+	for _, loginAttempt := range remaining {
+		assert.Equal(cs.T(), organization.ID, loginAttempt.OrganizationID)
+	}
+}
+
+func (cs *ConformanceSuite) TestGetAPIKeyNotFound() {
+	_, err := cs.connector.GetAPIKey(context.Background(), "missing")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestCreateImpersonation() {
+	admin := cs.createUser("0")
+	user := cs.createUser("1")
+
+	impersonation, err := cs.connector.CreateImpersonation(context.Background(), db.CreateImpersonationParams{
+		AdminID:   admin.ID,
+		UserID:    user.ID,
+		Reason:    "Support ticket",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	assert.NoError(cs.T(), err)
+	assert.NotZero(cs.T(), impersonation.ID)
+	assert.Equal(cs.T(), "Support ticket", impersonation.Reason)
+
+	impersonations, err := cs.connector.GetImpersonations(context.Background(), user.ID)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), impersonations, 1)
+	assert.Equal(cs.T(), admin.ID, impersonations[0].AdminID)
+
+	impersonations, err = cs.connector.GetImpersonations(context.Background(), admin.ID)
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), impersonations)
+}
+
+func (cs *ConformanceSuite) TestAttributeDefinitions() {
+	ctx := context.Background()
+
+	definition, err := cs.connector.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Unique:     true,
+		Visibility: db.AttributeVisibilityPublic,
+	})
+	assert.NoError(cs.T(), err)
+	assert.NotZero(cs.T(), definition.ID)
+
+	_, err = cs.connector.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Name:       "birthdate",
+		Type:       db.AttributeTypeDate,
+		Required:   true,
+		Visibility: db.AttributeVisibilityPrivate,
+	})
+	assert.NoError(cs.T(), err)
+
+	_, err = cs.connector.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Name:       "department",
+		Type:       db.AttributeTypeNumber,
+		Visibility: db.AttributeVisibilityPublic,
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	definitions, err := cs.connector.GetAttributeDefinitions(ctx)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), definitions, 2)
+	assert.Equal(cs.T(), "birthdate", definitions[0].Name)
+	assert.True(cs.T(), definitions[0].Required)
+	assert.Equal(cs.T(), "department", definitions[1].Name)
+	assert.True(cs.T(), definitions[1].Unique)
+
+	assert.IsType(cs.T(), &db.NotFoundError{}, cs.connector.DeleteAttributeDefinition(ctx, "missing"))
+}
+
+func (cs *ConformanceSuite) TestUserAttributes() {
+	ctx := context.Background()
+
+	user, err := cs.connector.CreateUser(ctx, db.CreateUserParams{
+		FullName:   "Test User 0",
+		Phone:      "99999990",
+		UserName:   "test0",
+		Password:   "secret",
+		Attributes: db.Attributes{"department": "sales", "level": float64(3)},
+	})
+	require.NoError(cs.T(), err)
+	other := cs.createUser("1")
+
+	stored, err := cs.connector.GetUserByID(ctx, user.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), db.Attributes{"department": "sales", "level": float64(3)}, stored.Attributes)
+
+	users, err := cs.connector.GetUsers(ctx, db.GetUsersParams{Offset: 10, Attributes: db.Attributes{"department": "sales"}})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), users, 1)
+	assert.Equal(cs.T(), user.ID, users[0].ID)
+
+	count, err := cs.connector.CountUsers(ctx, db.GetUsersParams{Attributes: db.Attributes{"level": float64(3), "department": "support"}})
+	assert.NoError(cs.T(), err)
+	assert.Zero(cs.T(), count)
+
+	taken, err := cs.connector.IsAttributeValueTaken(ctx, "department", "sales", other.ID)
+	assert.NoError(cs.T(), err)
+	assert.True(cs.T(), taken)
+
+	taken, err = cs.connector.IsAttributeValueTaken(ctx, "department", "sales", user.ID)
+	assert.NoError(cs.T(), err)
+	assert.False(cs.T(), taken)
+
+	assert.NoError(cs.T(), cs.connector.SetUserAttributes(ctx, other.ID, db.Attributes{"department": "support"}))
+	assert.IsType(cs.T(), &db.NotFoundError{}, cs.connector.SetUserAttributes(ctx, 9999, db.Attributes{}))
+
+	stored, err = cs.connector.GetUserByID(ctx, other.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), db.Attributes{"department": "support"}, stored.Attributes)
+
+	// Deleting a definition strips its values from every user
+	_, err = cs.connector.CreateAttributeDefinition(ctx, db.CreateAttributeDefinitionParams{
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Visibility: db.AttributeVisibilityPublic,
+	})
+	require.NoError(cs.T(), err)
+	assert.NoError(cs.T(), cs.connector.DeleteAttributeDefinition(ctx, "department"))
+
+	stored, err = cs.connector.GetUserByID(ctx, user.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), db.Attributes{"level": float64(3)}, stored.Attributes)
+
+	stored, err = cs.connector.GetUserByID(ctx, other.ID)
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), stored.Attributes)
+}
+
+func (cs *ConformanceSuite) createGroup(name string) *db.Group {
+	group, err := cs.connector.CreateGroup(context.Background(), db.CreateGroupParams{
+		Name:        name,
+		Description: "The " + name + " group",
+	})
+	require.NoError(cs.T(), err)
+
+	return group
+}
+
+func (cs *ConformanceSuite) TestGroups() {
+	ctx := context.Background()
+
+	created := cs.createGroup("engineering")
+	assert.NotZero(cs.T(), created.ID)
+	cs.createGroup("backend")
+
+	_, err := cs.connector.CreateGroup(ctx, db.CreateGroupParams{Name: "engineering"})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	group, err := cs.connector.GetGroup(ctx, "engineering")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), created.ID, group.ID)
+	assert.Equal(cs.T(), "The engineering group", group.Description)
+
+	_, err = cs.connector.GetGroup(ctx, "missing")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	groups, err := cs.connector.GetGroups(ctx)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), groups, 2)
+	assert.Equal(cs.T(), "backend", groups[0].Name)
+	assert.Equal(cs.T(), "engineering", groups[1].Name)
+}
+
+func (cs *ConformanceSuite) TestNestedGroupMembership() {
+	ctx := context.Background()
+
+	user := cs.createUser("0")
+	other := cs.createUser("1")
+
+	company := cs.createGroup("company")
+	engineering := cs.createGroup("engineering")
+	backend := cs.createGroup("backend")
+	cs.createGroup("sales")
+
+	assert.NoError(cs.T(), cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: company.ID, MemberGroupID: engineering.ID}))
+	assert.NoError(cs.T(), cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: engineering.ID, MemberGroupID: backend.ID}))
+	assert.NoError(cs.T(), cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: backend.ID, UserID: user.ID}))
+	assert.NoError(cs.T(), cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: engineering.ID, UserID: user.ID}))
+	assert.NoError(cs.T(), cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: engineering.ID, UserID: other.ID}))
+
+	err := cs.connector.AddGroupMember(ctx, db.GroupMemberParams{GroupID: backend.ID, UserID: user.ID})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+	assert.Equal(cs.T(), "The member already belongs to the group", err.Error())
+
+	for _, memberParams := range []db.GroupMemberParams{
+		{GroupID: backend.ID, MemberGroupID: company.ID},
+		{GroupID: backend.ID, MemberGroupID: backend.ID},
+	} {
+		err = cs.connector.AddGroupMember(ctx, memberParams)
+		assert.IsType(cs.T(), &db.BadInputError{}, err)
+		assert.Equal(cs.T(), "A group cannot contain itself", err.Error())
+	}
+
+	groupNames := func(userID uint) []string {
+		groups, err := cs.connector.GetUserGroups(ctx, userID)
+		require.NoError(cs.T(), err)
+
+		names := []string{}
+		for _, group := range groups {
+			names = append(names, group.Name)
+		}
+
+		return names
+	}
+
+	assert.Equal(cs.T(), []string{"backend", "company", "engineering"}, groupNames(user.ID))
+	assert.Equal(cs.T(), []string{"company", "engineering"}, groupNames(other.ID))
+
+	members, err := cs.connector.GetGroupMembers(ctx, engineering.ID)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), members.Users, 2)
+	assert.Equal(cs.T(), "Test User 0", members.Users[0].FullName)
+	require.Len(cs.T(), members.Groups, 1)
+	assert.Equal(cs.T(), "backend", members.Groups[0].Name)
+
+	assert.NoError(cs.T(), cs.connector.RemoveGroupMember(ctx, db.GroupMemberParams{GroupID: company.ID, MemberGroupID: engineering.ID}))
+	assert.IsType(cs.T(), &db.NotFoundError{}, cs.connector.RemoveGroupMember(ctx, db.GroupMemberParams{GroupID: company.ID, MemberGroupID: engineering.ID}))
+	assert.IsType(cs.T(), &db.NotFoundError{}, cs.connector.RemoveGroupMember(ctx, db.GroupMemberParams{GroupID: company.ID, UserID: user.ID}))
+
+	assert.Equal(cs.T(), []string{"backend", "engineering"}, groupNames(user.ID))
+
+	// Deleted users are not listed as members and purged ones lose their memberships
+	require.NoError(cs.T(), cs.connector.DeleteUser(ctx, "test1"))
+
+	members, err = cs.connector.GetGroupMembers(ctx, engineering.ID)
+	assert.NoError(cs.T(), err)
+	assert.Len(cs.T(), members.Users, 1)
+
+	require.NoError(cs.T(), cs.connector.PurgeUser(ctx, other.ID))
+	assert.Empty(cs.T(), groupNames(other.ID))
+}
+
+func (cs *ConformanceSuite) TestOrganizations() {
+	ctx := context.Background()
+
+	organizations, err := cs.connector.GetOrganizations(ctx)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), organizations, 1)
+	assert.Equal(cs.T(), db.DefaultOrganizationID, organizations[0].ID)
+
+	created, err := cs.connector.CreateOrganization(ctx, db.CreateOrganizationParams{Name: "acme", DisplayName: "Acme"})
+	assert.NoError(cs.T(), err)
+	assert.NotEqual(cs.T(), db.DefaultOrganizationID, created.ID)
+
+	_, err = cs.connector.CreateOrganization(ctx, db.CreateOrganizationParams{Name: "acme"})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	organization, err := cs.connector.GetOrganization(ctx, "acme")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), created.ID, organization.ID)
+	assert.Equal(cs.T(), "Acme", organization.DisplayName)
+
+	_, err = cs.connector.GetOrganization(ctx, "missing")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestTenantIsolation() {
+	organization, err := cs.connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(cs.T(), err)
+
+	defaultCtx := db.WithTenant(context.Background(), db.DefaultOrganizationID)
+	acmeCtx := db.WithTenant(context.Background(), organization.ID)
+
+	defaultUser := cs.createUser("0")
+	assert.Equal(cs.T(), db.DefaultOrganizationID, defaultUser.OrganizationID)
+
+	// Usernames and phones only have to be unique within an organization
+	acmeUser, err := cs.connector.CreateUser(acmeCtx, db.CreateUserParams{
+		FullName: "Acme User",
+		Phone:    "99999990",
+		UserName: "test0",
+		Password: "secret",
+	})
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), organization.ID, acmeUser.OrganizationID)
+
+	_, err = cs.connector.CreateUser(acmeCtx, db.CreateUserParams{
+		FullName: "Other User",
+		Phone:    "88888888",
+		UserName: "test0",
+		Password: "secret",
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	user, err := cs.connector.GetUser(acmeCtx, "test0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), acmeUser.ID, user.ID)
+
+	user, err = cs.connector.GetUser(defaultCtx, "test0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), defaultUser.ID, user.ID)
+
+	_, err = cs.connector.GetUserByID(acmeCtx, defaultUser.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	users, err := cs.connector.GetUsers(acmeCtx, db.GetUsersParams{Offset: 10})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), users, 1)
+	assert.Equal(cs.T(), acmeUser.ID, users[0].ID)
+
+	count, err := cs.connector.CountUsers(context.Background(), db.GetUsersParams{})
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), int64(2), count)
+
+	// Rows of other organizations cannot be changed either
+	assert.NoError(cs.T(), cs.connector.DeleteUser(acmeCtx, "test0"))
+	_, err = cs.connector.GetUser(defaultCtx, "test0")
+	assert.NoError(cs.T(), err)
+
+	assert.IsType(cs.T(), &db.NotFoundError{}, cs.connector.SetOrgAdmin(acmeCtx, defaultUser.ID, true))
+	assert.NoError(cs.T(), cs.connector.SetOrgAdmin(defaultCtx, defaultUser.ID, true))
+
+	user, err = cs.connector.GetUserByID(defaultCtx, defaultUser.ID)
+	assert.NoError(cs.T(), err)
+	assert.True(cs.T(), user.OrgAdmin)
+
+	_, err = cs.connector.CreateGroup(acmeCtx, db.CreateGroupParams{Name: "engineering"})
+	assert.NoError(cs.T(), err)
+	_, err = cs.connector.CreateGroup(defaultCtx, db.CreateGroupParams{Name: "engineering"})
+	assert.NoError(cs.T(), err)
+
+	groups, err := cs.connector.GetGroups(acmeCtx)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), groups, 1)
+	assert.Equal(cs.T(), organization.ID, groups[0].OrganizationID)
+
+	_, err = cs.connector.CreateAttributeDefinition(acmeCtx, db.CreateAttributeDefinitionParams{
+		Name:       "department",
+		Type:       db.AttributeTypeString,
+		Visibility: db.AttributeVisibilityPublic,
+	})
+	assert.NoError(cs.T(), err)
+
+	definitions, err := cs.connector.GetAttributeDefinitions(defaultCtx)
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), definitions)
+}
+
+func (cs *ConformanceSuite) TestInvitations() {
+	organization, err := cs.connector.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	require.NoError(cs.T(), err)
+
+	acmeCtx := db.WithTenant(context.Background(), organization.ID)
+	inviter := cs.createUser("0")
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	invitation, err := cs.connector.CreateInvitation(acmeCtx, db.CreateInvitationParams{
+		InviterID: &inviter.ID,
+		FullName:  "Invited User",
+		Phone:     "99999990",
+		OrgAdmin:  true,
+		CodeHash:  "hash0",
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), organization.ID, invitation.OrganizationID)
+	assert.Equal(cs.T(), db.InvitationPending, invitation.Status(time.Now()))
+
+	_, err = cs.connector.CreateInvitation(acmeCtx, db.CreateInvitationParams{Phone: "99999991", CodeHash: "hash0", ExpiresAt: expiresAt})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	found, err := cs.connector.GetInvitationByCode(acmeCtx, "hash0")
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), invitation.ID, found.ID)
+	assert.Equal(cs.T(), "99999990", found.Phone)
+	assert.True(cs.T(), found.OrgAdmin)
+
+	// Invitations of other organizations are out of reach
+	_, err = cs.connector.GetInvitation(context.Background(), invitation.ID)
+	assert.NoError(cs.T(), err)
+	_, err = cs.connector.GetInvitation(db.WithTenant(context.Background(), db.DefaultOrganizationID), invitation.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	require.NoError(cs.T(), cs.connector.RenewInvitation(acmeCtx, invitation.ID, "hash1", expiresAt.Add(time.Hour)))
+
+	_, err = cs.connector.GetInvitationByCode(acmeCtx, "hash0")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	user := cs.createUser("1")
+	require.NoError(cs.T(), cs.connector.AcceptInvitation(acmeCtx, invitation.ID, user.ID))
+
+	accepted, err := cs.connector.GetInvitation(acmeCtx, invitation.ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), db.InvitationAccepted, accepted.Status(time.Now()))
+	require.NotNil(cs.T(), accepted.UserID)
+	assert.Equal(cs.T(), user.ID, *accepted.UserID)
+
+	// Accepted invitations cannot be renewed, revoked or accepted again
+	err = cs.connector.RevokeInvitation(acmeCtx, invitation.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+	err = cs.connector.RenewInvitation(acmeCtx, invitation.ID, "hash2", expiresAt)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	revoked, err := cs.connector.CreateInvitation(acmeCtx, db.CreateInvitationParams{Phone: "99999992", CodeHash: "hash3", ExpiresAt: expiresAt})
+	require.NoError(cs.T(), err)
+	require.NoError(cs.T(), cs.connector.RevokeInvitation(acmeCtx, revoked.ID))
+
+	invitations, err := cs.connector.GetInvitations(acmeCtx)
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), invitations, 2)
+	assert.Equal(cs.T(), db.InvitationRevoked, invitations[1].Status(time.Now()))
+
+	invitations, err = cs.connector.GetInvitations(db.WithTenant(context.Background(), db.DefaultOrganizationID))
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), invitations)
+}
+
+func (cs *ConformanceSuite) TestRegistrationApproval() {
+	ctx := context.Background()
+
+	active := cs.createUser("0")
+	assert.Equal(cs.T(), db.RegistrationActive, active.RegistrationStatus)
+	assert.True(cs.T(), active.IsRegistrationApproved())
+
+	pending := make([]*db.User, 0, 3)
+	for _, i := range []string{"1", "2", "3"} {
+		user, err := cs.connector.CreateUser(ctx, db.CreateUserParams{
+			FullName:        "Pending User " + i,
+			Phone:           "9999999" + i,
+			UserName:        "pending" + i,
+			Password:        "secret",
+			PendingApproval: true,
+		})
+		require.NoError(cs.T(), err)
+		assert.False(cs.T(), user.IsRegistrationApproved())
+
+		pending = append(pending, user)
+	}
+
+	registrations, err := cs.connector.GetPendingRegistrations(ctx, time.Time{})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), registrations, 3)
+	assert.Equal(cs.T(), "pending1", registrations[0].UserName)
+
+	registrations, err = cs.connector.GetPendingRegistrations(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), registrations)
+
+	require.NoError(cs.T(), cs.connector.ApproveRegistration(ctx, pending[0].ID))
+
+	approved, err := cs.connector.GetUserByID(ctx, pending[0].ID)
+	assert.NoError(cs.T(), err)
+	assert.Equal(cs.T(), db.RegistrationActive, approved.RegistrationStatus)
+
+	err = cs.connector.ApproveRegistration(ctx, pending[0].ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	// Rejected users are deleted, so their username and phone can be registered again
+	require.NoError(cs.T(), cs.connector.RejectRegistration(ctx, pending[1].ID, "Unknown applicant"))
+
+	_, err = cs.connector.GetUser(ctx, "pending2")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	err = cs.connector.RejectRegistration(ctx, pending[1].ID, "Unknown applicant")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	_, err = cs.connector.CreateUser(ctx, db.CreateUserParams{
+		FullName: "Pending User 2",
+		Phone:    "99999992",
+		UserName: "pending2",
+		Password: "secret",
+	})
+	assert.NoError(cs.T(), err)
+
+	registrations, err = cs.connector.GetPendingRegistrations(ctx, time.Time{})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), registrations, 1)
+	assert.Equal(cs.T(), pending[2].ID, registrations[0].ID)
+}
+
+func (cs *ConformanceSuite) TestUnapprovedUsersNotListed() {
+	ctx := context.Background()
+
+	active := cs.createUser("0")
+
+	unapproved := make([]*db.User, 0, 2)
+	for _, i := range []string{"1", "2"} {
+		user, err := cs.connector.CreateUser(ctx, db.CreateUserParams{
+			FullName:        "Pending User " + i,
+			Phone:           "9999999" + i,
+			UserName:        "pending" + i,
+			Password:        "secret",
+			PendingApproval: true,
+		})
+		require.NoError(cs.T(), err)
+
+		unapproved = append(unapproved, user)
+	}
+
+	require.NoError(cs.T(), cs.connector.RejectRegistration(ctx, unapproved[1].ID, "Unknown applicant"))
+
+	for _, deleted := range []db.DeletedFilter{db.DeletedExclude, db.DeletedInclude} {
+		users, err := cs.connector.GetUsers(ctx, db.GetUsersParams{Offset: 10, Deleted: deleted})
+		assert.NoError(cs.T(), err)
+		require.Len(cs.T(), users, 1)
+		assert.Equal(cs.T(), active.ID, users[0].ID)
+
+		count, err := cs.connector.CountUsers(ctx, db.GetUsersParams{Deleted: deleted})
+		assert.NoError(cs.T(), err)
+		assert.Equal(cs.T(), int64(1), count)
+	}
+
+	results, err := cs.connector.SearchUsers(ctx, db.SearchUsersParams{Query: "pending1", Limit: 10})
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), results)
+
+	// The approval queue still lists them
+	registrations, err := cs.connector.GetPendingRegistrations(ctx, time.Time{})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), registrations, 1)
+	assert.Equal(cs.T(), unapproved[0].ID, registrations[0].ID)
+
+	require.NoError(cs.T(), cs.connector.ApproveRegistration(ctx, unapproved[0].ID))
+
+	results, err = cs.connector.SearchUsers(ctx, db.SearchUsersParams{Query: "pending1", Limit: 10})
+	assert.NoError(cs.T(), err)
+	require.Len(cs.T(), results, 1)
+	assert.Equal(cs.T(), unapproved[0].ID, results[0].User.ID)
+}
+
+func (cs *ConformanceSuite) TestUserChanges() {
+	ctx := context.Background()
+
+	user := cs.createUser("0")
+	other := cs.createUser("1")
+
+	require.NoError(cs.T(), cs.connector.SetUserName(ctx, user.ID, "renamed0"))
+
+	err := cs.connector.SetUserName(ctx, other.ID, "renamed0")
+	assert.Equal(cs.T(), "An user with the provided username already exists", err.Error())
+
+	reservedUntil := time.Now().Add(time.Hour)
+	_, err = cs.connector.CreateUserChange(ctx, db.CreateUserChangeParams{
+		UserID:        user.ID,
+		Field:         db.UserChangeUserName,
+		OldValue:      "test0",
+		NewValue:      "renamed0",
+		ReservedUntil: &reservedUntil,
+	})
+	require.NoError(cs.T(), err)
+
+	// The former username is reserved to its owner
+	err = cs.connector.SetUserName(ctx, other.ID, "test0")
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+	assert.Equal(cs.T(), "The provided username is reserved", err.Error())
+
+	_, err = cs.connector.CreateUser(ctx, db.CreateUserParams{
+		FullName: "Test User 2",
+		Phone:    "99999992",
+		UserName: "test0",
+		Password: "secret2",
+	})
+	assert.IsType(cs.T(), &db.BadInputError{}, err)
+
+	require.NoError(cs.T(), cs.connector.SetUserName(ctx, user.ID, "test0"))
+
+	err = cs.connector.SetUserName(ctx, 1000, "missing0")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	_, err = cs.connector.GetPhoneVerification(ctx, user.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	for _, phone := range []string{"99999993", "99999994"} {
+		_, err = cs.connector.CreatePhoneVerification(ctx, db.CreatePhoneVerificationParams{
+			UserID:    user.ID,
+			Phone:     phone,
+			CodeHash:  "hash" + phone,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.NoError(cs.T(), err)
+	}
+
+	// The last verification started supersedes the previous ones
+	verification, err := cs.connector.GetPhoneVerification(ctx, user.ID)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), "99999994", verification.Phone)
+	assert.Equal(cs.T(), 0, verification.Attempts)
+
+	require.NoError(cs.T(), cs.connector.FailPhoneVerification(ctx, verification.ID))
+
+	verification, err = cs.connector.GetPhoneVerification(ctx, user.ID)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), 1, verification.Attempts)
+
+	require.NoError(cs.T(), cs.connector.CompletePhoneVerification(ctx, verification.ID))
+
+	err = cs.connector.CompletePhoneVerification(ctx, verification.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	_, err = cs.connector.CreateUserChange(ctx, db.CreateUserChangeParams{
+		UserID:   user.ID,
+		Field:    db.UserChangePhone,
+		OldValue: "99999990",
+		NewValue: "99999994",
+	})
+	require.NoError(cs.T(), err)
+
+	changes, err := cs.connector.GetUserChanges(ctx, user.ID)
+	require.NoError(cs.T(), err)
+	require.Len(cs.T(), changes, 2)
+	assert.Equal(cs.T(), db.UserChangeUserName, changes[0].Field)
+	assert.NotNil(cs.T(), changes[0].ReservedUntil)
+	assert.Equal(cs.T(), db.UserChangePhone, changes[1].Field)
+	assert.Equal(cs.T(), "99999990", changes[1].OldValue)
+	assert.Equal(cs.T(), "99999994", changes[1].NewValue)
+	assert.Nil(cs.T(), changes[1].ReservedUntil)
+
+	changes, err = cs.connector.GetUserChanges(ctx, other.ID)
+	assert.NoError(cs.T(), err)
+	assert.Empty(cs.T(), changes)
+}
+
+func (cs *ConformanceSuite) TestUpdateUserVersion() {
+	ctx := context.Background()
+
+	user := cs.createUser("0")
+	assert.Equal(cs.T(), uint(1), user.Version)
+
+	updateParams := db.UpdateUserParams{
+		ID:         user.ID,
+		FullName:   "Updated User",
+		Phone:      user.Phone,
+		Password:   user.Password,
+		LoginToken: user.LoginToken,
+		Version:    user.Version,
+	}
+	require.NoError(cs.T(), cs.connector.UpdateUser(ctx, updateParams))
+
+	got, err := cs.connector.GetUser(ctx, user.UserName)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), uint(2), got.Version)
+
+	// An update based on the version read before is refused
+	updateParams.FullName = "Stale User"
+	err = cs.connector.UpdateUser(ctx, updateParams)
+	assert.IsType(cs.T(), &db.VersionConflictError{}, err)
+
+	// Refreshing the login token leaves the version as it is
+	require.NoError(cs.T(), cs.connector.SetLoginToken(ctx, user.ID, "token"))
+
+	got, err = cs.connector.GetUser(ctx, user.UserName)
+	require.NoError(cs.T(), err)
+	assert.Equal(cs.T(), uint(2), got.Version)
+	assert.Equal(cs.T(), "Updated User", got.FullName)
+	assert.Equal(cs.T(), "token", got.LoginToken)
+}
+
+func (cs *ConformanceSuite) TestSetLoginTokenNotFound() {
+	err := cs.connector.SetLoginToken(context.Background(), 999, "token")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestEndImpersonation() {
+	ctx := context.Background()
+
+	admin := cs.createUser("0")
+	user := cs.createUser("1")
+
+	impersonation, err := cs.connector.CreateImpersonation(ctx, db.CreateImpersonationParams{
+		AdminID:   admin.ID,
+		UserID:    user.ID,
+		Reason:    "Support ticket",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(cs.T(), err)
+
+	got, err := cs.connector.GetImpersonation(ctx, impersonation.ID)
+	require.NoError(cs.T(), err)
+	assert.True(cs.T(), got.Active())
+
+	require.NoError(cs.T(), cs.connector.EndImpersonation(ctx, impersonation.ID))
+
+	got, err = cs.connector.GetImpersonation(ctx, impersonation.ID)
+	require.NoError(cs.T(), err)
+	assert.NotNil(cs.T(), got.EndedAt)
+	assert.False(cs.T(), got.Active())
+
+	err = cs.connector.EndImpersonation(ctx, impersonation.ID)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+
+	_, err = cs.connector.GetImpersonation(ctx, 1000)
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestNestedWithTx() {
+	expectedErr := fmt.Errorf("Operation failed")
+
+	err := cs.connector.WithTx(context.Background(), func(tx db.DBConnector) error {
+		if err := tx.WithTx(context.Background(), func(nested db.DBConnector) error {
+			_, err := nested.CreateUser(context.Background(), userFixture())
+
+			return err
+		}); err != nil {
+			return err
+		}
+
+		return expectedErr
+	})
+	assert.Equal(cs.T(), expectedErr, err)
+
+	_, err = cs.connector.GetUser(context.Background(), "test")
+	assert.IsType(cs.T(), &db.NotFoundError{}, err)
+}
+
+func (cs *ConformanceSuite) TestCanceledContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cs.connector.GetUser(ctx, "test")
+	assert.ErrorIs(cs.T(), err, context.Canceled)
+}
+
+func (cs *ConformanceSuite) TestConcurrentCreateUser() {
+	const workers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := cs.connector.CreateUser(context.Background(), userFixture())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.IsType(cs.T(), &db.BadInputError{}, err)
+		}
+	}
+	assert.Equal(cs.T(), 1, created)
+}
+
+// openMigratedDB opens the database in source and applies every migration. The migrations
+// are reverted and the connection closed once the test finishes
+func openMigratedDB(t *testing.T, source string) *gorm.DB {
+	conn, err := db.Open(source)
+	require.NoError(t, err)
+
+	migrator, err := db.NewMigrator(conn)
+	require.NoError(t, err)
+
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		for {
+			migration, err := migrator.Down(context.Background())
+			require.NoError(t, err)
+
+			if migration == nil {
+				break
+			}
+		}
+
+		sqlDB, err := conn.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+	})
+
+	return conn
+}
+
+// storedValues returns every value stored in the tables of conn as text
+func storedValues(t *testing.T, conn *gorm.DB) []string {
+	tablesQuery := `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()`
+	if conn.Dialector.Name() == "sqlite" {
+		tablesQuery = `SELECT name FROM sqlite_master WHERE type = 'table'`
+	}
+
+	var tables []string
+	require.NoError(t, conn.Raw(tablesQuery).Scan(&tables).Error)
+
+	values := []string{}
+	for _, table := range tables {
+		rows, err := conn.Table(table).Rows()
+		require.NoError(t, err)
+
+		columns, err := rows.Columns()
+		require.NoError(t, err)
+
+		for rows.Next() {
+			row := make([]any, len(columns))
+			for i := range row {
+				row[i] = new(any)
+			}
+			require.NoError(t, rows.Scan(row...))
+
+			for _, value := range row {
+				switch value := (*value.(*any)).(type) {
+				case []byte:
+					values = append(values, string(value))
+				default:
+					values = append(values, fmt.Sprint(value))
+				}
+			}
+		}
+
+		require.NoError(t, rows.Err())
+		require.NoError(t, rows.Close())
+	}
+
+	return values
+}
+
+func TestMemoryConformance(t *testing.T) {
+	suite.Run(t, &ConformanceSuite{
+		newConnector: func(t *testing.T) db.DBConnector {
+			return db.NewMemoryConnector()
+		},
+	})
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	suite.Run(t, &ConformanceSuite{
+		openDB: func(t *testing.T) *gorm.DB {
+			return openMigratedDB(t, "sqlite://:memory:")
+		},
+	})
+}
+
+// TestPostgresConformance runs against the database in TEST_POSTGRES_SOURCE. Every test
+// reverts all migrations when it finishes, so it must point to a disposable database
+func TestPostgresConformance(t *testing.T) {
+	source := os.Getenv("TEST_POSTGRES_SOURCE")
+	if source == "" {
+		t.Skip("TEST_POSTGRES_SOURCE is not set")
+	}
+
+	suite.Run(t, &ConformanceSuite{
+		openDB: func(t *testing.T) *gorm.DB {
+			return openMigratedDB(t, source)
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) expectLoginTokenUpdate() *sqlmock.ExpectedExec {
+	return dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "login_token"=$1,"updated_at"=$2 WHERE id = $3 AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		dbms.user.LoginToken,
+		sqlmock.AnyArg(),
+		dbms.user.ID,
+	)
+}
+
+func (dbms *DBManagerSuite) updateParams() db.UpdateUserParams {
+	return db.UpdateUserParams{
+		ID:         dbms.user.ID,
+		FullName:   dbms.user.FullName,
+		Phone:      dbms.user.Phone,
+		Password:   dbms.user.Password,
+		LoginToken: dbms.user.LoginToken,
+	}
+}
+
+func (dbms *DBManagerSuite) TestWithTx() {
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(1, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.WithTx(context.Background(), func(tx db.DBConnector) error {
+		return tx.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken)
+	})
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestWithTxRollback() {
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(1, 1))
+	dbms.mock.ExpectRollback()
+
+	expectedErr := fmt.Errorf("Operation failed")
+	err := dbms.manager.WithTx(context.Background(), func(tx db.DBConnector) error {
+		if err := tx.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken); err != nil {
+			return err
+		}
+
+		return expectedErr
+	})
+	assert.ErrorIs(dbms.T(), err, expectedErr)
+}
+
+func (dbms *DBManagerSuite) TestWithTxRetriesSerializationFailure() {
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnError(&pgconn.PgError{Code: "40001"})
+	dbms.mock.ExpectRollback()
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(1, 1))
+	dbms.mock.ExpectCommit()
+
+	attempts := 0
+	err := dbms.manager.WithTx(context.Background(), func(tx db.DBConnector) error {
+		attempts++
+
+		return tx.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken)
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 2, attempts)
+}
+
+func (dbms *DBManagerSuite) TestNestedWithTx() {
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(1, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.WithTx(context.Background(), func(tx db.DBConnector) error {
+		return tx.WithTx(context.Background(), func(nestedTx db.DBConnector) error {
+			return nestedTx.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken)
+		})
+	})
+	assert.NoError(dbms.T(), err)
+}
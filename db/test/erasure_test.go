@@ -0,0 +1,97 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestEraseUser() {
+	userMockRows := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "password", "organization_id"}).AddRow(2, "Test User", "99999999", "test", "secret", 1)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(2).WillReturnRows(userMockRows)
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "login_attempts" WHERE organization_id = $1 AND (user_id = $2 OR (user_id IS NULL AND user_name = $3))`),
+	).WithArgs(1, 2, "test").WillReturnResult(sqlmock.NewResult(0, 3))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "api_keys" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "user_changes" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "phone_verifications" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "id" FROM "invitations" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "audit_personal_values" WHERE organization_id = $1 AND (user_id = $2 OR (user_id IS NULL AND field = $3 AND value = $4) OR invitation_id IN ($5))`),
+	).WithArgs(1, 2, "user_name", `"test"`, 7).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "invitation_id", "field", "value"}).
+			AddRow(10, 2, nil, "user_name", `"test"`).
+			AddRow(11, nil, 7, "full_name", `"Test User"`),
+	)
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "audit_personal_values" SET "value"=$1 WHERE id = $2`),
+	).WithArgs(`"erased-2"`, 10).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "audit_personal_values" SET "value"=$1 WHERE id = $2`),
+	).WithArgs(`"Erased User"`, 11).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "invitations" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "updated_at"=$1,"full_name"=$2,"phone"=$3,"phone_index"=$4,"user_name"=$5,"password"=$6,"login_token"=$7,"attributes"=$8 WHERE "users"."deleted_at" IS NULL AND "id" = $9`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		db.ErasedFullName,
+		"erased-2",
+		"erased-2",
+		"erased-2",
+		"",
+		"",
+		"{}",
+		2,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	erased, err := dbms.manager.EraseUser(context.Background(), 2)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), erased.ID)
+	assert.Equal(dbms.T(), "erased-2", erased.UserName)
+	assert.Equal(dbms.T(), "erased-2", erased.Phone)
+	assert.Empty(dbms.T(), erased.Password)
+}
+
+func (dbms *DBManagerSuite) TestEraseUserNotFound() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbms.mock.ExpectRollback()
+
+	_, err := dbms.manager.EraseUser(context.Background(), 2)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
+
+func (dbms *DBManagerSuite) TestGetAuditEventsOfUser() {
+	auditMockRows := sqlmock.NewRows([]string{"id", "action"}).AddRow(4, "user.login")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "audit_events" WHERE (actor_id = $1 OR target_id = $2) ORDER BY id DESC LIMIT 500`),
+	).WithArgs(2, 2).WillReturnRows(auditMockRows)
+
+	auditEvents, err := dbms.manager.GetAuditEvents(context.Background(), db.GetAuditEventsParams{
+		UserID: 2,
+		Limit:  500,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Len(dbms.T(), auditEvents, 1)
+}
@@ -0,0 +1,56 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestCreateImpersonation() {
+	impersonationMockRows := sqlmock.NewRows([]string{"id"}).AddRow("1")
+	expiresAt := time.Now().Add(15 * time.Minute)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "impersonations" ("created_at","updated_at","deleted_at","admin_id","user_id","reason","expires_at") VALUES ($1,$2,$3,$4,$5,$6,$7)`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		1,
+		2,
+		"Ticket 42",
+		expiresAt,
+	).WillReturnRows(impersonationMockRows)
+	dbms.mock.ExpectCommit()
+
+	impersonationParams := db.CreateImpersonationParams{
+		AdminID:   1,
+		UserID:    2,
+		Reason:    "Ticket 42",
+		ExpiresAt: expiresAt,
+	}
+
+	impersonation, err := dbms.manager.CreateImpersonation(context.Background(), impersonationParams)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(1), impersonation.ID)
+	assert.Equal(dbms.T(), uint(1), impersonation.AdminID)
+	assert.Equal(dbms.T(), uint(2), impersonation.UserID)
+}
+
+func (dbms *DBManagerSuite) TestGetImpersonations() {
+	impersonationMockRows := sqlmock.NewRows([]string{"id", "admin_id", "user_id", "reason"}).AddRow(1, 1, 2, "Support ticket")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "impersonations" WHERE user_id = $1 AND "impersonations"."deleted_at" IS NULL ORDER BY id`),
+	).WithArgs(2).WillReturnRows(impersonationMockRows)
+
+	impersonations, err := dbms.manager.GetImpersonations(context.Background(), 2)
+	assert.NoError(dbms.T(), err)
+	assert.Len(dbms.T(), impersonations, 1)
+	assert.Equal(dbms.T(), "Support ticket", impersonations[0].Reason)
+}
@@ -0,0 +1,77 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestCreateInvitation() {
+	invitationMockRows := sqlmock.NewRows([]string{"id"}).AddRow("1")
+	inviterID := uint(3)
+	expiresAt := time.Now().Add(time.Hour)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "invitations" ("created_at","updated_at","organization_id","inviter_id","full_name","phone","org_admin","code_hash","expires_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		2,
+		inviterID,
+		dbms.user.FullName,
+		dbms.user.Phone,
+		true,
+		"hash",
+		expiresAt,
+	).WillReturnRows(invitationMockRows)
+	dbms.mock.ExpectCommit()
+
+	invitation, err := dbms.manager.CreateInvitation(db.WithTenant(context.Background(), 2), db.CreateInvitationParams{
+		InviterID: &inviterID,
+		FullName:  dbms.user.FullName,
+		Phone:     dbms.user.Phone,
+		OrgAdmin:  true,
+		CodeHash:  "hash",
+		ExpiresAt: expiresAt,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(1), invitation.ID)
+	assert.Equal(dbms.T(), uint(2), invitation.OrganizationID)
+}
+
+func (dbms *DBManagerSuite) TestAcceptInvitation() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "invitations" SET "accepted_at"=$1,"user_id"=$2,"updated_at"=$3 WHERE (id = $4 AND accepted_at IS NULL AND revoked_at IS NULL) AND "invitations"."organization_id" = $5`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		4,
+		sqlmock.AnyArg(),
+		1,
+		2,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.AcceptInvitation(db.WithTenant(context.Background(), 2), 1, 4)
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestRevokeInvitationNotPending() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "invitations" SET "revoked_at"=$1,"updated_at"=$2 WHERE id = $3 AND accepted_at IS NULL AND revoked_at IS NULL`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		1,
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.RevokeInvitation(context.Background(), 1)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
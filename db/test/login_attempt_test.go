@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestCreateLoginAttempt() {
+	loginMockRows := sqlmock.NewRows([]string{"id"}).AddRow("3")
+	userID := uint(2)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "login_attempts" ("created_at","organization_id","user_id","user_name","success","failure_reason","ip","user_agent","country","region","city","new_device") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING "id"`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		db.DefaultOrganizationID,
+		userID,
+		"test",
+		false,
+		"wrong_password",
+		"192.0.2.1",
+		"curl/8.0",
+		"US",
+		"California",
+		"San Francisco",
+		false,
+	).WillReturnRows(loginMockRows)
+	dbms.mock.ExpectCommit()
+
+	loginAttempt, err := dbms.manager.CreateLoginAttempt(context.Background(), db.CreateLoginAttemptParams{
+		UserID:        &userID,
+		UserName:      "test",
+		FailureReason: "wrong_password",
+		IP:            "192.0.2.1",
+		UserAgent:     "curl/8.0",
+		Country:       "US",
+		Region:        "California",
+		City:          "San Francisco",
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(3), loginAttempt.ID)
+	assert.False(dbms.T(), loginAttempt.CreatedAt.IsZero())
+}
+
+func (dbms *DBManagerSuite) TestGetLoginAttempts() {
+	loginMockRows := sqlmock.NewRows([]string{"id", "user_name", "success", "user_agent"}).AddRow(4, "test", true, "curl/8.0")
+	success := true
+	userAgent := "curl/8.0"
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "login_attempts" WHERE user_id = $1 AND success = $2 AND user_agent = $3 AND id < $4 ORDER BY id DESC LIMIT 1`),
+	).WithArgs(
+		2,
+		true,
+		"curl/8.0",
+		5,
+	).WillReturnRows(loginMockRows)
+
+	loginAttempts, err := dbms.manager.GetLoginAttempts(context.Background(), db.GetLoginAttemptsParams{
+		UserID:    2,
+		Success:   &success,
+		UserAgent: &userAgent,
+		BeforeID:  5,
+		Limit:     1,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Len(dbms.T(), loginAttempts, 1)
+	assert.Equal(dbms.T(), uint(4), loginAttempts[0].ID)
+	assert.True(dbms.T(), loginAttempts[0].Success)
+}
@@ -32,7 +32,7 @@ func (dbms *DBManagerSuite) SetupSuite() {
 	dbms.conn, dbms.mock, err = sqlmock.New()
 	assert.NoError(dbms.T(), err)
 
-	dialector := postgres.New(postgres.Config{
+	dialector := db.NewPostgresDialector(postgres.Config{
 		DSN:                  "sqlmock_db_0",
 		DriverName:           "postgres",
 		Conn:                 dbms.conn,
@@ -42,34 +42,52 @@ func (dbms *DBManagerSuite) SetupSuite() {
 	dbms.DB, err = gorm.Open(dialector, &gorm.Config{})
 	assert.NoError(dbms.T(), err)
 
-	dbms.manager = db.NewDBManager(dbms.DB)
+	dbms.manager = db.NewDBManager(dbms.DB, db.Timeouts{})
 	assert.IsType(dbms.T(), &db.DBManager{}, dbms.manager)
 
+	userParams := userFixture()
 	dbms.user = &db.User{
-		FullName:   "Test User",
-		Phone:      "99999999",
-		UserName:   "test",
-		Password:   "secret",
+		FullName:   userParams.FullName,
+		Phone:      userParams.Phone,
+		UserName:   userParams.UserName,
+		Password:   userParams.Password,
 		LoginToken: "token",
 	}
 	dbms.user.ID = 0
 
 	for i := 0; i < numUsers; i++ {
-		userFullName := "Test User " + strconv.Itoa(i)
-		userPhone := "9999999" + strconv.Itoa(i)
-		userUserName := "test" + strconv.Itoa(i)
-		userPassword := "secret" + strconv.Itoa(i)
+		userParams := numberedUserFixture(strconv.Itoa(i))
 
 		dbms.users = append(dbms.users, &db.User{
-			FullName: userFullName,
-			Phone:    userPhone,
-			UserName: userUserName,
-			Password: userPassword,
+			FullName: userParams.FullName,
+			Phone:    userParams.Phone,
+			UserName: userParams.UserName,
+			Password: userParams.Password,
 			Admin:    false,
 		})
 	}
 }
 
+// userFixture returns the parameters creating the fixture user
+func userFixture() db.CreateUserParams {
+	return db.CreateUserParams{
+		FullName: "Test User",
+		Phone:    "99999999",
+		UserName: "test",
+		Password: "secret",
+	}
+}
+
+// numberedUserFixture returns the parameters creating the fixture user numbered suffix
+func numberedUserFixture(suffix string) db.CreateUserParams {
+	return db.CreateUserParams{
+		FullName: "Test User " + suffix,
+		Phone:    "9999999" + suffix,
+		UserName: "test" + suffix,
+		Password: "secret" + suffix,
+	}
+}
+
 func (dbms *DBManagerSuite) AfterTest(_, _ string) {
 	assert.NoError(dbms.T(), dbms.mock.ExpectationsWereMet())
 }
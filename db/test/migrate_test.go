@@ -0,0 +1,125 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) newMigrator() *db.Migrator {
+	migrator, err := db.NewMigrator(dbms.DB)
+	assert.NoError(dbms.T(), err)
+
+	return migrator
+}
+
+func (dbms *DBManagerSuite) expectAppliedMigrations(migrations []db.Migration) {
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`),
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	appliedMockRows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, migration := range migrations {
+		appliedMockRows.AddRow(migration.Version, migration.Name, time.Now())
+	}
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "schema_migrations" ORDER BY version`),
+	).WillReturnRows(appliedMockRows)
+}
+
+func (dbms *DBManagerSuite) TestMigrationsAreOrdered() {
+	migrations := dbms.newMigrator().Migrations()
+	assert.NotEmpty(dbms.T(), migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(dbms.T(), uint(i+1), migration.Version)
+		assert.NotEmpty(dbms.T(), migration.Up)
+		assert.NotEmpty(dbms.T(), migration.Down)
+	}
+}
+
+func (dbms *DBManagerSuite) TestMigrationStatus() {
+	migrator := dbms.newMigrator()
+	migrations := migrator.Migrations()
+
+	dbms.expectAppliedMigrations(migrations[:1])
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), len(migrations), len(statuses))
+	assert.NotNil(dbms.T(), statuses[0].AppliedAt)
+	for _, status := range statuses[1:] {
+		assert.Nil(dbms.T(), status.AppliedAt)
+	}
+}
+
+func (dbms *DBManagerSuite) TestMigrateUp() {
+	migrator := dbms.newMigrator()
+	migrations := migrator.Migrations()
+
+	dbms.expectAppliedMigrations(migrations[:1])
+
+	for _, migration := range migrations[1:] {
+		dbms.mock.ExpectBegin()
+		dbms.mock.ExpectExec(
+			regexp.QuoteMeta(migration.Up),
+		).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbms.mock.ExpectExec(
+			regexp.QuoteMeta(`INSERT INTO "schema_migrations" ("version","name","applied_at") VALUES ($1,$2,$3)`),
+		).WithArgs(
+			migration.Version,
+			migration.Name,
+			sqlmock.AnyArg(),
+		).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbms.mock.ExpectCommit()
+	}
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), migrations[1:], applied)
+}
+
+func (dbms *DBManagerSuite) TestMigrateUpUpToDate() {
+	migrator := dbms.newMigrator()
+
+	dbms.expectAppliedMigrations(migrator.Migrations())
+
+	applied, err := migrator.Up(context.Background())
+	assert.NoError(dbms.T(), err)
+	assert.Empty(dbms.T(), applied)
+}
+
+func (dbms *DBManagerSuite) TestMigrateDown() {
+	migrator := dbms.newMigrator()
+	migrations := migrator.Migrations()
+	latest := migrations[len(migrations)-1]
+
+	dbms.expectAppliedMigrations(migrations)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(latest.Down),
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "schema_migrations" WHERE "schema_migrations"."version" = $1`),
+	).WithArgs(
+		latest.Version,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	reverted, err := migrator.Down(context.Background())
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), latest, *reverted)
+}
+
+func TestIsInMemorySource(t *testing.T) {
+	assert.True(t, db.IsInMemorySource("sqlite://:memory:"))
+	assert.False(t, db.IsInMemorySource("sqlite://registry.db"))
+	assert.False(t, db.IsInMemorySource("postgres://localhost:5432/registry"))
+}
@@ -0,0 +1,115 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestCreateOrganization() {
+	organizationMockRows := sqlmock.NewRows([]string{"id"}).AddRow("2")
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "organizations" ("created_at","updated_at","name","display_name") VALUES ($1,$2,$3,$4)`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		"acme",
+		"Acme",
+	).WillReturnRows(organizationMockRows)
+	dbms.mock.ExpectCommit()
+
+	organization, err := dbms.manager.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme", DisplayName: "Acme"})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), organization.ID)
+}
+
+func (dbms *DBManagerSuite) TestCreateOrganizationDuplicate() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "organizations" ("created_at","updated_at","name","display_name") VALUES ($1,$2,$3,$4)`),
+	).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "organizations_name_key"})
+	dbms.mock.ExpectRollback()
+
+	_, err := dbms.manager.CreateOrganization(context.Background(), db.CreateOrganizationParams{Name: "acme"})
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+	assert.Equal(dbms.T(), "An organization with the provided name already exists", err.Error())
+}
+
+func (dbms *DBManagerSuite) TestGetUserInTenant() {
+	userMockRow := sqlmock.NewRows([]string{"id", "user_name", "organization_id"}).AddRow("1", dbms.user.UserName, 2)
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE user_name = $1 AND "users"."organization_id" = $2 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(
+		dbms.user.UserName,
+		2,
+	).WillReturnRows(userMockRow)
+
+	user, err := dbms.manager.GetUser(db.WithTenant(context.Background(), 2), dbms.user.UserName)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), user.OrganizationID)
+}
+
+func (dbms *DBManagerSuite) TestCreateUserInTenant() {
+	userMockRows := sqlmock.NewRows([]string{"id"}).AddRow("1")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT count(*) FROM "user_changes" WHERE (field = $1 AND old_value = $2 AND user_id <> $3 AND reserved_until > $4) AND "user_changes"."organization_id" = $5`),
+	).WithArgs(
+		db.UserChangeUserName,
+		dbms.user.UserName,
+		0,
+		sqlmock.AnyArg(),
+		2,
+	).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","full_name","phone","phone_index","user_name","password","admin","service_account","attributes","organization_id","org_admin","registration_status","registration_reason","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		dbms.user.FullName,
+		dbms.user.Phone,
+		dbms.user.Phone,
+		dbms.user.UserName,
+		dbms.user.Password,
+		false,
+		false,
+		"{}",
+		2,
+		false,
+		db.RegistrationActive,
+		"",
+		1,
+	).WillReturnRows(userMockRows)
+	dbms.mock.ExpectCommit()
+
+	userParams := userFixture()
+
+	user, err := dbms.manager.CreateUser(db.WithTenant(context.Background(), 2), userParams)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(2), user.OrganizationID)
+}
+
+func (dbms *DBManagerSuite) TestSetOrgAdmin() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "org_admin"=$1,"updated_at"=$2 WHERE id = $3 AND "users"."organization_id" = $4 AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		true,
+		sqlmock.AnyArg(),
+		1,
+		2,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.SetOrgAdmin(db.WithTenant(context.Background(), 2), 1, true)
+	assert.NoError(dbms.T(), err)
+}
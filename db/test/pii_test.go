@@ -0,0 +1,536 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var (
+	oldPIIKey   = db.PIIKey{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+	newPIIKey   = db.PIIKey{ID: "new", Key: bytes.Repeat([]byte{2}, 32)}
+	piiIndexKey = bytes.Repeat([]byte{3}, 32)
+)
+
+func newTestPIICipher(t *testing.T, keys ...db.PIIKey) *db.PIICipher {
+	piiCipher, err := db.NewPIICipher(keys, piiIndexKey, []string{"full_name", "phone"})
+	require.NoError(t, err)
+
+	return piiCipher
+}
+
+// storedUser reads the user named userName as it is stored, bypassing decryption
+func storedUser(t *testing.T, conn *gorm.DB, userName string) db.User {
+	var user db.User
+	require.NoError(t, conn.Unscoped().Where("user_name = ?", userName).First(&user).Error)
+
+	return user
+}
+
+func TestParsePIIKeys(t *testing.T) {
+	keys, err := db.ParsePIIKeys("new:AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=, old:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	require.NoError(t, err)
+	assert.Equal(t, []db.PIIKey{newPIIKey, oldPIIKey}, keys)
+
+	_, err = db.ParsePIIKeys("AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI=")
+	assert.Error(t, err)
+
+	_, err = db.ParsePIIKeys("new:not base64")
+	assert.Error(t, err)
+}
+
+func TestNewPIICipherInvalid(t *testing.T) {
+	_, err := db.NewPIICipher(nil, piiIndexKey, []string{"phone"})
+	assert.Error(t, err)
+
+	_, err = db.NewPIICipher([]db.PIIKey{{ID: "short", Key: []byte("short")}}, piiIndexKey, []string{"phone"})
+	assert.Error(t, err)
+
+	_, err = db.NewPIICipher([]db.PIIKey{newPIIKey, newPIIKey}, piiIndexKey, []string{"phone"})
+	assert.Error(t, err)
+
+	_, err = db.NewPIICipher([]db.PIIKey{newPIIKey}, []byte("short"), []string{"phone"})
+	assert.Error(t, err)
+
+	_, err = db.NewPIICipher([]db.PIIKey{newPIIKey}, piiIndexKey, []string{"password"})
+	assert.Error(t, err)
+}
+
+func TestPIICipherRoundTrip(t *testing.T) {
+	piiCipher := newTestPIICipher(t, newPIIKey)
+
+	encrypted, err := piiCipher.Encrypt("users", 1, "phone", "99999999")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "pii1:new:"))
+	assert.NotContains(t, encrypted, "99999999")
+	assert.True(t, piiCipher.IsCurrent("phone", encrypted))
+
+	again, err := piiCipher.Encrypt("users", 1, "phone", "99999999")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	decrypted, err := piiCipher.Decrypt("users", 1, "phone", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "99999999", decrypted)
+
+	// Values are bound to their field and to their row
+	_, err = piiCipher.Decrypt("users", 1, "full_name", encrypted)
+	assert.Error(t, err)
+
+	_, err = piiCipher.Decrypt("users", 2, "phone", encrypted)
+	assert.Error(t, err)
+
+	_, err = piiCipher.Decrypt("invitations", 1, "phone", encrypted)
+	assert.Error(t, err)
+
+	empty, err := piiCipher.Encrypt("users", 1, "phone", "")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	plaintext, err := piiCipher.Decrypt("users", 1, "phone", "99999999")
+	require.NoError(t, err)
+	assert.Equal(t, "99999999", plaintext)
+	assert.False(t, piiCipher.IsCurrent("phone", "99999999"))
+}
+
+func TestPIICipherKeyRotation(t *testing.T) {
+	encrypted, err := newTestPIICipher(t, oldPIIKey).Encrypt("users", 1, "full_name", "Test User")
+	require.NoError(t, err)
+
+	rotated := newTestPIICipher(t, newPIIKey, oldPIIKey)
+	assert.False(t, rotated.IsCurrent("full_name", encrypted))
+
+	decrypted, err := rotated.Decrypt("users", 1, "full_name", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", decrypted)
+
+	_, err = newTestPIICipher(t, newPIIKey).Decrypt("users", 1, "full_name", encrypted)
+	assert.Error(t, err)
+
+	var unconfigured *db.PIICipher
+	_, err = unconfigured.Decrypt("users", 1, "full_name", encrypted)
+	assert.Error(t, err)
+	assert.False(t, unconfigured.IsCurrent("full_name", encrypted))
+}
+
+func TestPIICipherBlindIndex(t *testing.T) {
+	piiCipher := newTestPIICipher(t, newPIIKey)
+
+	index := piiCipher.BlindIndex("99999999")
+	assert.Equal(t, index, newTestPIICipher(t, oldPIIKey).BlindIndex("99999999"))
+	assert.NotEqual(t, index, piiCipher.BlindIndex("99999998"))
+	assert.NotContains(t, index, "99999999")
+
+	var unconfigured *db.PIICipher
+	assert.Equal(t, "99999999", unconfigured.BlindIndex("99999999"))
+}
+
+func TestEncryptedUsers(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey))
+
+	created, err := manager.CreateUser(ctx, userFixture())
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", created.FullName)
+	assert.Equal(t, "99999999", created.Phone)
+
+	stored := storedUser(t, conn, "test")
+	assert.True(t, strings.HasPrefix(stored.FullName, "pii1:new:"))
+	assert.True(t, strings.HasPrefix(stored.Phone, "pii1:new:"))
+	assert.NotEqual(t, "99999999", stored.PhoneIndex)
+
+	user, err := manager.GetUser(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", user.FullName)
+	assert.Equal(t, "99999999", user.Phone)
+
+	_, err = manager.CreateUser(ctx, db.CreateUserParams{
+		FullName: "Other User",
+		Phone:    "99999999",
+		UserName: "other",
+		Password: "secret",
+	})
+	assert.IsType(t, &db.BadInputError{}, err)
+	assert.Equal(t, "An user with the provided phone number already exists", err.Error())
+
+	users, err := manager.GetUsers(ctx, db.GetUsersParams{Offset: 10, Phone: "99999999"})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "Test User", users[0].FullName)
+
+	count, err := manager.CountUsers(ctx, db.GetUsersParams{Phone: "99999998"})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	_, err = manager.GetUsers(ctx, db.GetUsersParams{Offset: 10, FullNamePrefix: "Test"})
+	assert.IsType(t, &db.BadInputError{}, err)
+
+	_, err = manager.GetUsers(ctx, db.GetUsersParams{Offset: 10, SortBy: "phone"})
+	assert.IsType(t, &db.BadInputError{}, err)
+
+	require.NoError(t, manager.UpdateUser(ctx, db.UpdateUserParams{
+		ID:       created.ID,
+		FullName: "Updated User",
+		Phone:    "99999998",
+		Password: "secret",
+		Version:  created.Version,
+	}))
+
+	user, err = manager.GetUserByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated User", user.FullName)
+	assert.Equal(t, "99999998", user.Phone)
+
+	results, err := manager.SearchUsers(ctx, db.SearchUsersParams{Query: "test", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Updated User", results[0].User.FullName)
+}
+
+func TestEncryptedAuditPersonalValues(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey))
+
+	created, err := manager.CreateUser(ctx, userFixture())
+	require.NoError(t, err)
+
+	_, err = manager.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Action:         "user.update",
+		ActorID:        &created.ID,
+		ActorUserName:  created.UserName,
+		TargetID:       &created.ID,
+		TargetUserName: created.UserName,
+		Before:         `{"full_name":"Test User","phone":"99999999"}`,
+		After:          `{"full_name":"Updated User","phone":"99999998"}`,
+	})
+	require.NoError(t, err)
+
+	var values []db.AuditPersonalValue
+	require.NoError(t, conn.Order("id").Find(&values).Error)
+	require.NotEmpty(t, values)
+	for _, value := range values {
+		if value.Field == "full_name" || value.Field == "phone" {
+			assert.True(t, strings.HasPrefix(value.Value, "pii1:new:"))
+		} else {
+			assert.False(t, strings.HasPrefix(value.Value, "pii1:"))
+		}
+	}
+
+	auditEvents, err := manager.GetAuditEvents(ctx, db.GetAuditEventsParams{TargetUserName: "test"})
+	require.NoError(t, err)
+	require.Len(t, auditEvents, 1)
+	resolved := auditEvents[0].Resolved()
+	assert.Equal(t, `{"full_name":"Test User","phone":"99999999"}`, resolved.Before)
+	assert.Equal(t, `{"full_name":"Updated User","phone":"99999998"}`, resolved.After)
+
+	_, err = manager.EraseUser(ctx, created.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.Where("field IN ?", []string{"full_name", "phone"}).Find(&values).Error)
+	for _, value := range values {
+		assert.True(t, strings.HasPrefix(value.Value, "pii1:new:"))
+	}
+
+	auditEvents, err = manager.GetAuditEvents(ctx, db.GetAuditEventsParams{})
+	require.NoError(t, err)
+	require.Len(t, auditEvents, 1)
+	assert.NotContains(t, auditEvents[0].Resolved().Before, "99999999")
+}
+
+func TestReencryptUsers(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	// Users stored before encryption was enabled
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	for _, suffix := range []string{"0", "1", "2"} {
+		_, err := plain.CreateUser(ctx, numberedUserFixture(suffix))
+		require.NoError(t, err)
+	}
+	require.NoError(t, plain.DeleteUser(ctx, "test2"))
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, oldPIIKey))
+
+	rewritten, err := manager.ReencryptUsers(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rewritten)
+
+	stored := storedUser(t, conn, "test2")
+	assert.True(t, strings.HasPrefix(stored.Phone, "pii1:old:"))
+
+	rewritten, err = manager.ReencryptUsers(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, rewritten)
+
+	// The old key is kept around to read the values until they are rewritten
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey, oldPIIKey))
+
+	user, err := manager.GetUser(ctx, "test0")
+	require.NoError(t, err)
+	assert.Equal(t, "99999990", user.Phone)
+
+	rewritten, err = manager.ReencryptUsers(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rewritten)
+
+	stored = storedUser(t, conn, "test0")
+	assert.True(t, strings.HasPrefix(stored.FullName, "pii1:new:"))
+	assert.True(t, strings.HasPrefix(stored.Phone, "pii1:new:"))
+
+	// Disabling encryption brings the data back to plaintext
+	manager.EnablePIIEncryption(nil)
+	_, err = manager.GetUser(ctx, "test0")
+	assert.Error(t, err)
+
+	// Keys without encrypted fields are used to decrypt the stored data
+	unencrypted, err := db.NewPIICipher([]db.PIIKey{newPIIKey}, piiIndexKey, nil)
+	require.NoError(t, err)
+
+	decrypter := db.NewDBManager(conn, db.Timeouts{})
+	decrypter.EnablePIIEncryption(unencrypted)
+
+	rewritten, err = decrypter.ReencryptUsers(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rewritten)
+
+	stored = storedUser(t, conn, "test1")
+	assert.Equal(t, "Test User 1", stored.FullName)
+	assert.Equal(t, "99999991", stored.Phone)
+}
+
+// reencryptPersonalData encrypts every stored personal value with the new key, checking that
+// rewritten rows were stale and that nothing is left to rewrite afterwards
+func reencryptPersonalData(t *testing.T, conn *gorm.DB, rewritten int64) *db.DBManager {
+	ctx := context.Background()
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey))
+
+	count, err := manager.ReencryptPersonalData(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, rewritten, count)
+
+	count, err = manager.ReencryptPersonalData(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	return manager
+}
+
+func TestReencryptInvitations(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	for _, code := range []string{"code0", "code1", "code2"} {
+		_, err := plain.CreateInvitation(ctx, db.CreateInvitationParams{
+			FullName:  "Invited User",
+			Phone:     "99999990",
+			CodeHash:  code,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+	}
+
+	manager := reencryptPersonalData(t, conn, 3)
+
+	var stored []db.Invitation
+	require.NoError(t, conn.Find(&stored).Error)
+	require.Len(t, stored, 3)
+	for _, invitation := range stored {
+		assert.True(t, strings.HasPrefix(invitation.FullName, "pii1:new:"))
+		assert.True(t, strings.HasPrefix(invitation.Phone, "pii1:new:"))
+	}
+
+	invitation, err := manager.GetInvitation(ctx, stored[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Invited User", invitation.FullName)
+	assert.Equal(t, "99999990", invitation.Phone)
+}
+
+func TestReencryptUserChanges(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	user, err := plain.CreateUser(ctx, userFixture())
+	require.NoError(t, err)
+
+	for _, changeParams := range []db.CreateUserChangeParams{
+		{UserID: user.ID, Field: db.UserChangePhone, OldValue: "99999999", NewValue: "99999998"},
+		{UserID: user.ID, Field: db.UserChangePhone, OldValue: "99999998", NewValue: "99999997"},
+		{UserID: user.ID, Field: db.UserChangeUserName, OldValue: "test", NewValue: "renamed"},
+	} {
+		_, err := plain.CreateUserChange(ctx, changeParams)
+		require.NoError(t, err)
+	}
+
+	// The user and its two phone changes
+	manager := reencryptPersonalData(t, conn, 3)
+
+	var stored []db.UserChange
+	require.NoError(t, conn.Order("id").Find(&stored).Error)
+	require.Len(t, stored, 3)
+	assert.True(t, strings.HasPrefix(stored[0].OldValue, "pii1:new:"))
+	assert.True(t, strings.HasPrefix(stored[1].NewValue, "pii1:new:"))
+	assert.Equal(t, "test", stored[2].OldValue)
+	assert.Equal(t, "renamed", stored[2].NewValue)
+
+	changes, err := manager.GetUserChanges(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "99999999", changes[0].OldValue)
+	assert.Equal(t, "99999997", changes[1].NewValue)
+}
+
+func TestReencryptPhoneVerifications(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	user, err := plain.CreateUser(ctx, userFixture())
+	require.NoError(t, err)
+
+	_, err = plain.CreatePhoneVerification(ctx, db.CreatePhoneVerificationParams{
+		UserID:    user.ID,
+		Phone:     "99999998",
+		CodeHash:  "code",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	manager := reencryptPersonalData(t, conn, 2)
+
+	var stored db.PhoneVerification
+	require.NoError(t, conn.First(&stored).Error)
+	assert.True(t, strings.HasPrefix(stored.Phone, "pii1:new:"))
+
+	verification, err := manager.GetPhoneVerification(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "99999998", verification.Phone)
+}
+
+func TestReencryptAuditPersonalValues(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	user, err := plain.CreateUser(ctx, userFixture())
+	require.NoError(t, err)
+
+	_, err = plain.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		Action:         "user.update",
+		TargetID:       &user.ID,
+		TargetUserName: user.UserName,
+		Before:         `{"full_name":"Test User","phone":"99999999"}`,
+		After:          `{"full_name":"Updated User","phone":"99999998"}`,
+	})
+	require.NoError(t, err)
+
+	// The user and the four names and phones of the event
+	manager := reencryptPersonalData(t, conn, 5)
+
+	var stored []db.AuditPersonalValue
+	require.NoError(t, conn.Order("id").Find(&stored).Error)
+	for _, value := range stored {
+		assert.Equal(t, value.Field != "user_name", strings.HasPrefix(value.Value, "pii1:new:"))
+	}
+
+	auditEvents, err := manager.GetAuditEvents(ctx, db.GetAuditEventsParams{})
+	require.NoError(t, err)
+	require.Len(t, auditEvents, 1)
+	assert.Equal(t, `{"full_name":"Test User","phone":"99999999"}`, auditEvents[0].Resolved().Before)
+}
+
+func TestEncryptedValuesBoundToRow(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey))
+
+	for _, suffix := range []string{"0", "1"} {
+		_, err := manager.CreateUser(ctx, numberedUserFixture(suffix))
+		require.NoError(t, err)
+	}
+
+	// A value copied to another row cannot be read there
+	stored := storedUser(t, conn, "test0")
+	require.NoError(t, conn.Exec("UPDATE users SET full_name = ? WHERE user_name = ?", stored.FullName, "test1").Error)
+
+	_, err := manager.GetUser(ctx, "test1")
+	assert.Error(t, err)
+
+	user, err := manager.GetUser(ctx, "test0")
+	require.NoError(t, err)
+	assert.Equal(t, "Test User 0", user.FullName)
+}
+
+func TestIndexUserPhones(t *testing.T) {
+	ctx := context.Background()
+	conn := openMigratedDB(t, "sqlite://:memory:")
+
+	plain := db.NewDBManager(conn, db.Timeouts{})
+	for _, suffix := range []string{"0", "1", "2"} {
+		_, err := plain.CreateUser(ctx, numberedUserFixture(suffix))
+		require.NoError(t, err)
+	}
+
+	// Users stored before phones were indexed
+	require.NoError(t, conn.Exec("UPDATE users SET phone_index = NULL").Error)
+
+	indexed, err := plain.IndexUserPhones(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), indexed)
+	assert.Equal(t, "99999990", storedUser(t, conn, "test0").PhoneIndex)
+
+	// Indexed users are not read again
+	indexed, err = plain.IndexUserPhones(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, indexed)
+
+	// With encryption enabled, phones are indexed with the index key
+	require.NoError(t, conn.Exec("UPDATE users SET phone_index = NULL").Error)
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+	manager.EnablePIIEncryption(newTestPIICipher(t, newPIIKey))
+
+	indexed, err = manager.IndexUserPhones(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), indexed)
+
+	indexed, err = manager.IndexUserPhones(ctx, 2)
+	require.NoError(t, err)
+	assert.Zero(t, indexed)
+
+	stored := storedUser(t, conn, "test1")
+	assert.Equal(t, "99999991", stored.Phone)
+	assert.Equal(t, newTestPIICipher(t, newPIIKey).BlindIndex("99999991"), stored.PhoneIndex)
+
+	users, err := manager.GetUsers(ctx, db.GetUsersParams{Offset: 10, Phone: "99999991"})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "test1", users[0].UserName)
+
+	_, err = manager.CreateUser(ctx, db.CreateUserParams{
+		FullName: "Other User",
+		Phone:    "99999992",
+		UserName: "other",
+		Password: "secret",
+	})
+	assert.IsType(t, &db.BadInputError{}, err)
+}
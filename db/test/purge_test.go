@@ -0,0 +1,40 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunUserPurge(t *testing.T) {
+	connector := db.NewMemoryConnector()
+
+	for _, suffix := range []string{"0", "1"} {
+		_, err := connector.CreateUser(context.Background(), numberedUserFixture(suffix))
+		require.NoError(t, err)
+	}
+	require.NoError(t, connector.DeleteUser(context.Background(), "test0"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		db.RunUserPurge(ctx, connector, 0, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		users, err := connector.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Deleted: db.DeletedInclude})
+		return err == nil && len(users) == 1 && users[0].UserName == "test1"
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunUserPurge did not stop after its context was canceled")
+	}
+}
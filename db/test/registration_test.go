@@ -0,0 +1,44 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestRejectRegistration() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1,"registration_reason"=$2,"registration_status"=$3,"updated_at"=$4 WHERE (id = $5 AND registration_status = $6) AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		"Unknown applicant",
+		db.RegistrationRejected,
+		sqlmock.AnyArg(),
+		1,
+		db.RegistrationPending,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.RejectRegistration(context.Background(), 1, "Unknown applicant")
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestApproveRegistrationNotPending() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "registration_status"=$1,"updated_at"=$2 WHERE (id = $3 AND registration_status = $4) AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		db.RegistrationActive,
+		sqlmock.AnyArg(),
+		1,
+		db.RegistrationPending,
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.ApproveRegistration(context.Background(), 1)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
@@ -0,0 +1,52 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestSearchUsers() {
+	searchMockRows := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "login_token", "rank"}).
+		AddRow("2", "John Smith", "99999991", "jsmith", "token", 0.8).
+		AddRow("1", "Jon Smyth", "99999990", "jsmyth", "token", 0.4)
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT users.*, GREATEST(word_similarity($1, full_name), word_similarity($2, user_name), ts_rank(to_tsvector('simple', coalesce(full_name, '') || ' ' || coalesce(user_name, '')), plainto_tsquery('simple', $3))) AS rank FROM "users" WHERE ((admin = $4 OR admin IS NULL) AND registration_status = $5 AND (word_similarity($6, full_name) > $7 OR word_similarity($8, user_name) > $9 OR to_tsvector('simple', coalesce(full_name, '') || ' ' || coalesce(user_name, '')) @@ plainto_tsquery('simple', $10))) AND "users"."deleted_at" IS NULL ORDER BY rank DESC,id LIMIT 10`),
+	).WithArgs(
+		"john smith",
+		"john smith",
+		"john smith",
+		false,
+		db.RegistrationActive,
+		"john smith",
+		0.3,
+		"john smith",
+		0.3,
+		"john smith",
+	).WillReturnRows(searchMockRows)
+
+	results, err := dbms.manager.SearchUsers(context.Background(), db.SearchUsersParams{
+		Query: "  John SMITH ",
+		Limit: 10,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 2, len(results))
+	assert.Equal(dbms.T(), uint(2), results[0].ID)
+	assert.Equal(dbms.T(), "John Smith", results[0].FullName)
+	assert.Equal(dbms.T(), 0.8, results[0].Rank)
+	assert.Empty(dbms.T(), results[0].LoginToken)
+	assert.Equal(dbms.T(), "jsmyth", results[1].UserName)
+}
+
+func (dbms *DBManagerSuite) TestSearchUsersEmptyQuery() {
+	results, err := dbms.manager.SearchUsers(context.Background(), db.SearchUsersParams{
+		Query: "   ",
+		Limit: 10,
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Empty(dbms.T(), results)
+}
@@ -0,0 +1,63 @@
+package db_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func (dbms *DBManagerSuite) TestSetUserName() {
+	dbms.expectUserNameReservationCheck(1, 0)
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "user_name"=$1,"updated_at"=$2 WHERE id = $3 AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		dbms.user.UserName,
+		sqlmock.AnyArg(),
+		1,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.SetUserName(context.Background(), 1, dbms.user.UserName)
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestSetUserNameReserved() {
+	dbms.expectUserNameReservationCheck(1, 1)
+
+	err := dbms.manager.SetUserName(context.Background(), 1, dbms.user.UserName)
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+	assert.Equal(dbms.T(), "The provided username is reserved", err.Error())
+}
+
+func (dbms *DBManagerSuite) TestFailPhoneVerification() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "phone_verifications" SET "attempts"=attempts + 1,"updated_at"=$1 WHERE id = $2`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		1,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.FailPhoneVerification(context.Background(), 1)
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestCompletePhoneVerificationDone() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "phone_verifications" SET "verified_at"=$1,"updated_at"=$2 WHERE id = $3 AND verified_at IS NULL`),
+	).WithArgs(
+		sqlmock.AnyArg(),
+		sqlmock.AnyArg(),
+		1,
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.CompletePhoneVerification(context.Background(), 1)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
@@ -1,41 +1,64 @@
 package db_test
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
+	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ericbg27/RegistryAPI/db"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
+// expectUserNameReservationCheck expects the lookup of reservations of the test username held
+// by users other than the one with exceptUserID
+func (dbms *DBManagerSuite) expectUserNameReservationCheck(exceptUserID uint, reserved int) {
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT count(*) FROM "user_changes" WHERE field = $1 AND old_value = $2 AND user_id <> $3 AND reserved_until > $4`),
+	).WithArgs(
+		db.UserChangeUserName,
+		dbms.user.UserName,
+		exceptUserID,
+		sqlmock.AnyArg(),
+	).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(reserved))
+}
+
 func (dbms *DBManagerSuite) TestCreateUser() {
 	userMockRows := sqlmock.NewRows([]string{"id"}).AddRow("0")
 
+	dbms.expectUserNameReservationCheck(0, 0)
 	dbms.mock.ExpectBegin()
 	dbms.mock.ExpectQuery(
-		regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","full_name","phone","user_name","password","admin") VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`),
+		regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","full_name","phone","phone_index","user_name","password","admin","service_account","attributes","organization_id","org_admin","registration_status","registration_reason","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`),
 	).WithArgs(
 		sqlmock.AnyArg(),
 		sqlmock.AnyArg(),
 		sqlmock.AnyArg(),
 		dbms.user.FullName,
 		dbms.user.Phone,
+		dbms.user.Phone,
 		dbms.user.UserName,
 		dbms.user.Password,
 		false,
+		false,
+		"{}",
+		db.DefaultOrganizationID,
+		false,
+		db.RegistrationActive,
+		"",
+		1,
 	).WillReturnRows(userMockRows)
 	dbms.mock.ExpectCommit()
 
-	userParams := db.CreateUserParams{
-		FullName: dbms.user.FullName,
-		Phone:    dbms.user.Phone,
-		UserName: dbms.user.UserName,
-		Password: dbms.user.Password,
-	}
+	userParams := userFixture()
 
-	user, err := dbms.manager.CreateUser(userParams)
+	user, err := dbms.manager.CreateUser(context.Background(), userParams)
 	assert.NoError(dbms.T(), err)
 	assert.Equal(dbms.T(), dbms.user.FullName, user.FullName)
 	assert.Equal(dbms.T(), dbms.user.Phone, user.Phone)
@@ -53,7 +76,7 @@ func (dbms *DBManagerSuite) TestGetUser() {
 		dbms.user.UserName,
 	).WillReturnRows(userMockRow)
 
-	user, err := dbms.manager.GetUser(dbms.user.UserName)
+	user, err := dbms.manager.GetUser(context.Background(), dbms.user.UserName)
 	assert.NoError(dbms.T(), err)
 	assert.Equal(dbms.T(), dbms.user.FullName, user.FullName)
 	assert.Equal(dbms.T(), dbms.user.Phone, user.Phone)
@@ -62,6 +85,34 @@ func (dbms *DBManagerSuite) TestGetUser() {
 	assert.Equal(dbms.T(), dbms.user.Admin, false)
 }
 
+func (dbms *DBManagerSuite) TestGetUserByID() {
+	userMockRow := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "password", "service_account"}).AddRow("1", dbms.user.FullName, dbms.user.Phone, dbms.user.UserName, dbms.user.Password, true)
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(
+		1,
+	).WillReturnRows(userMockRow)
+
+	user, err := dbms.manager.GetUserByID(context.Background(), 1)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), uint(1), user.ID)
+	assert.Equal(dbms.T(), dbms.user.UserName, user.UserName)
+	assert.Equal(dbms.T(), true, user.ServiceAccount)
+}
+
+func (dbms *DBManagerSuite) TestGetUserByIDNotFound() {
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(
+		2,
+	).WillReturnError(gorm.ErrRecordNotFound)
+
+	user, err := dbms.manager.GetUserByID(context.Background(), 2)
+	assert.Nil(dbms.T(), user)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
+
 func (dbms *DBManagerSuite) TestGetUsers() {
 	userMockRows := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "password"})
 
@@ -72,15 +123,15 @@ func (dbms *DBManagerSuite) TestGetUsers() {
 	}
 
 	dbms.mock.ExpectQuery(
-		regexp.QuoteMeta(fmt.Sprintf(`SELECT "users"."created_at","users"."updated_at","users"."deleted_at","users"."full_name","users"."phone","users"."user_name","users"."password","users"."admin" FROM "users" WHERE (admin <> $1 OR admin IS NULL) AND "users"."deleted_at" IS NULL LIMIT %d OFFSET %d`, consideredNumUsers, 1*(consideredNumUsers))),
-	).WithArgs().WillReturnRows(userMockRows)
+		regexp.QuoteMeta(fmt.Sprintf(`SELECT "users"."id","users"."created_at","users"."updated_at","users"."deleted_at","users"."full_name","users"."phone","users"."phone_index","users"."user_name","users"."password","users"."admin","users"."service_account","users"."attributes","users"."organization_id","users"."org_admin","users"."registration_status","users"."registration_reason","users"."version" FROM "users" WHERE (admin = $1 OR admin IS NULL) AND registration_status = $2 AND "users"."deleted_at" IS NULL ORDER BY id ASC NULLS FIRST LIMIT %d OFFSET %d`, consideredNumUsers, 1*(consideredNumUsers))),
+	).WithArgs(false, db.RegistrationActive).WillReturnRows(userMockRows)
 
 	searchParams := db.GetUsersParams{
 		PageIndex: 1,
 		Offset:    numUsers - 3,
 	}
 
-	users, err := dbms.manager.GetUsers(searchParams)
+	users, err := dbms.manager.GetUsers(context.Background(), searchParams)
 	assert.NoError(dbms.T(), err)
 	assert.Equal(dbms.T(), consideredNumUsers, len(users))
 	for i := 0; i < consideredNumUsers; i++ {
@@ -91,32 +142,170 @@ func (dbms *DBManagerSuite) TestGetUsers() {
 	}
 }
 
-func (dbms *DBManagerSuite) TestUpdateUser() {
+func (dbms *DBManagerSuite) TestGetUsersFilteredAndSorted() {
+	userMockRows := sqlmock.NewRows([]string{"full_name", "phone", "user_name", "password"}).AddRow(dbms.users[0].FullName, dbms.users[0].Phone, dbms.users[0].UserName, dbms.users[0].Password)
+	createdAfter := time.Now().Add(-time.Hour)
+	admin := true
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "users"."id","users"."created_at","users"."updated_at","users"."deleted_at","users"."full_name","users"."phone","users"."phone_index","users"."user_name","users"."password","users"."admin","users"."service_account","users"."attributes","users"."organization_id","users"."org_admin","users"."registration_status","users"."registration_reason","users"."version" FROM "users" WHERE deleted_at IS NOT NULL AND admin = $1 AND registration_status = $2 AND LOWER(user_name) LIKE $3 ESCAPE '\' AND created_at >= $4 ORDER BY created_at DESC NULLS LAST,id DESC NULLS LAST LIMIT 5`),
+	).WithArgs(
+		true,
+		db.RegistrationActive,
+		`te\_st%`,
+		createdAfter,
+	).WillReturnRows(userMockRows)
+
+	searchParams := db.GetUsersParams{
+		Offset:         5,
+		UserNamePrefix: "TE_st",
+		Admin:          &admin,
+		CreatedAfter:   &createdAfter,
+		Deleted:        db.DeletedOnly,
+		SortBy:         "created_at",
+		SortDesc:       true,
+	}
+
+	users, err := dbms.manager.GetUsers(context.Background(), searchParams)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 1, len(users))
+	assert.Equal(dbms.T(), dbms.users[0].UserName, users[0].UserName)
+}
+
+func (dbms *DBManagerSuite) TestGetUsersCursor() {
+	userMockRows := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "password"}).
+		AddRow("4", dbms.users[4].FullName, dbms.users[4].Phone, dbms.users[4].UserName, dbms.users[4].Password).
+		AddRow("3", dbms.users[3].FullName, dbms.users[3].Phone, dbms.users[3].UserName, dbms.users[3].Password)
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "users"."id","users"."created_at","users"."updated_at","users"."deleted_at","users"."full_name","users"."phone","users"."phone_index","users"."user_name","users"."password","users"."admin","users"."service_account","users"."attributes","users"."organization_id","users"."org_admin","users"."registration_status","users"."registration_reason","users"."version" FROM "users" WHERE (admin = $1 OR admin IS NULL) AND registration_status = $2 AND (user_name < $3 OR (user_name = $4 AND id < $5) OR user_name IS NULL) AND "users"."deleted_at" IS NULL ORDER BY user_name DESC NULLS LAST,id DESC NULLS LAST LIMIT 2`),
+	).WithArgs(
+		false,
+		db.RegistrationActive,
+		"test5",
+		"test5",
+		6,
+	).WillReturnRows(userMockRows)
+
+	cursor := &db.UsersCursor{
+		SortBy:   "user_name",
+		ID:       6,
+		Value:    "test5",
+		Backward: true,
+	}
+
+	users, err := dbms.manager.GetUsers(context.Background(), db.GetUsersParams{
+		Offset: 2,
+		Cursor: cursor,
+		SortBy: "user_name",
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), 2, len(users))
+	assert.Equal(dbms.T(), dbms.users[3].UserName, users[0].UserName)
+	assert.Equal(dbms.T(), dbms.users[4].UserName, users[1].UserName)
+}
+
+func (dbms *DBManagerSuite) TestGetUsersCursorSortMismatch() {
+	cursor := &db.UsersCursor{
+		SortBy: "user_name",
+		ID:     6,
+		Value:  "test5",
+	}
+
+	_, err := dbms.manager.GetUsers(context.Background(), db.GetUsersParams{
+		Offset: 2,
+		Cursor: cursor,
+		SortBy: "phone",
+	})
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+}
+
+func (dbms *DBManagerSuite) TestCountUsers() {
+	countMockRow := sqlmock.NewRows([]string{"count"}).AddRow("3")
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE (admin = $1 OR admin IS NULL) AND registration_status = $2 AND phone_index = $3 AND "users"."deleted_at" IS NULL`),
+	).WithArgs(
+		false,
+		db.RegistrationActive,
+		"99999990",
+	).WillReturnRows(countMockRow)
+
+	count, err := dbms.manager.CountUsers(context.Background(), db.GetUsersParams{
+		Offset: 2,
+		Phone:  "99999990",
+		SortBy: "user_name",
+	})
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), int64(3), count)
+}
+
+func (dbms *DBManagerSuite) TestGetUsersInvalidSort() {
+	_, err := dbms.manager.GetUsers(context.Background(), db.GetUsersParams{
+		Offset: 5,
+		SortBy: "password",
+	})
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+}
+
+func (dbms *DBManagerSuite) TestSetLoginToken() {
 	dbms.mock.ExpectBegin()
-	dbms.mock.ExpectExec(
-		regexp.QuoteMeta(`UPDATE "users" SET "updated_at"=$1,"full_name"=$2,"phone"=$3,"password"=$4,"login_token"=$5 WHERE id = $6 AND "users"."deleted_at" IS NULL`),
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(1, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken)
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestSetLoginTokenNotFound() {
+	dbms.mock.ExpectBegin()
+	dbms.expectLoginTokenUpdate().WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.SetLoginToken(context.Background(), dbms.user.ID, dbms.user.LoginToken)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
+
+func (dbms *DBManagerSuite) expectVersionedUserUpdate(version uint) *sqlmock.ExpectedExec {
+	return dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "updated_at"=$1,"full_name"=$2,"phone"=$3,"phone_index"=$4,"password"=$5,"login_token"=$6,"version"=$7 WHERE id = $8 AND version = $9 AND "users"."deleted_at" IS NULL`),
 	).WithArgs(
 		sqlmock.AnyArg(),
 		dbms.user.FullName,
 		dbms.user.Phone,
+		dbms.user.Phone,
 		dbms.user.Password,
 		dbms.user.LoginToken,
+		version+1,
 		dbms.user.ID,
-	).WillReturnResult(sqlmock.NewResult(1, 1))
+		version,
+	)
+}
+
+func (dbms *DBManagerSuite) TestUpdateUserVersion() {
+	dbms.mock.ExpectBegin()
+	dbms.expectVersionedUserUpdate(3).WillReturnResult(sqlmock.NewResult(1, 1))
 	dbms.mock.ExpectCommit()
 
-	updateParams := db.UpdateUserParams{
-		ID:         dbms.user.ID,
-		FullName:   dbms.user.FullName,
-		Phone:      dbms.user.Phone,
-		Password:   dbms.user.Password,
-		LoginToken: dbms.user.LoginToken,
-	}
+	updateParams := dbms.updateParams()
+	updateParams.Version = 3
 
-	err := dbms.manager.UpdateUser(updateParams)
+	err := dbms.manager.UpdateUser(context.Background(), updateParams)
 	assert.NoError(dbms.T(), err)
 }
 
+func (dbms *DBManagerSuite) TestUpdateUserVersionConflict() {
+	dbms.mock.ExpectBegin()
+	dbms.expectVersionedUserUpdate(3).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbms.mock.ExpectCommit()
+
+	updateParams := dbms.updateParams()
+	updateParams.Version = 3
+
+	err := dbms.manager.UpdateUser(context.Background(), updateParams)
+	assert.IsType(dbms.T(), &db.VersionConflictError{}, err)
+}
+
 func (dbms *DBManagerSuite) TestDeleteUser() {
 	dbms.mock.ExpectBegin()
 	dbms.mock.ExpectExec(
@@ -127,6 +316,208 @@ func (dbms *DBManagerSuite) TestDeleteUser() {
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	dbms.mock.ExpectCommit()
 
-	err := dbms.manager.DeleteUser(dbms.user.UserName)
+	err := dbms.manager.DeleteUser(context.Background(), dbms.user.UserName)
+	assert.NoError(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestGetUserCanceledContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	user, err := dbms.manager.GetUser(ctx, dbms.user.UserName)
+	assert.Nil(dbms.T(), user)
+	assert.ErrorIs(dbms.T(), err, context.Canceled)
+}
+
+func (dbms *DBManagerSuite) TestGetUserTimeout() {
+	manager := db.NewDBManager(dbms.DB, db.Timeouts{
+		Read: 10 * time.Millisecond,
+	})
+
+	userMockRow := sqlmock.NewRows([]string{"id", "full_name", "phone", "user_name", "password"}).AddRow("0", dbms.user.FullName, dbms.user.Phone, dbms.user.UserName, dbms.user.Password)
+
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE user_name = $1 AND "users"."deleted_at" IS NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(
+		dbms.user.UserName,
+	).WillDelayFor(time.Second).WillReturnRows(userMockRow)
+
+	user, err := manager.GetUser(context.Background(), dbms.user.UserName)
+	assert.Nil(dbms.T(), user)
+	assert.Error(dbms.T(), err)
+}
+
+func (dbms *DBManagerSuite) TestCreateUserDuplicatePhone() {
+	dbms.expectUserNameReservationCheck(0, 0)
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`INSERT INTO "users" ("created_at","updated_at","deleted_at","full_name","phone","phone_index","user_name","password","admin","service_account","attributes","organization_id","org_admin","registration_status","registration_reason","version") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`),
+	).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_phone_key"})
+	dbms.mock.ExpectRollback()
+
+	userParams := userFixture()
+
+	_, err := dbms.manager.CreateUser(context.Background(), userParams)
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+	assert.Equal(dbms.T(), "An user with the provided phone number already exists", err.Error())
+}
+
+func (dbms *DBManagerSuite) TestRestoreUser() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1,"updated_at"=$2 WHERE id = $3 AND deleted_at IS NOT NULL`),
+	).WithArgs(
+		nil,
+		sqlmock.AnyArg(),
+		1,
+	).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	err := dbms.manager.RestoreUser(context.Background(), 1)
 	assert.NoError(dbms.T(), err)
 }
+
+func (dbms *DBManagerSuite) TestRestoreUserDuplicateUserName() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "users" SET "deleted_at"=$1,"updated_at"=$2 WHERE id = $3 AND deleted_at IS NOT NULL`),
+	).WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_user_name_key"})
+	dbms.mock.ExpectRollback()
+
+	err := dbms.manager.RestoreUser(context.Background(), 1)
+	assert.IsType(dbms.T(), &db.BadInputError{}, err)
+	assert.Equal(dbms.T(), "An user with the provided username already exists", err.Error())
+}
+
+func (dbms *DBManagerSuite) TestPurgeUserNotFound() {
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 AND deleted_at IS NOT NULL ORDER BY "users"."id" LIMIT 1`),
+	).WithArgs(
+		1,
+	).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbms.mock.ExpectRollback()
+
+	err := dbms.manager.PurgeUser(context.Background(), 1)
+	assert.IsType(dbms.T(), &db.NotFoundError{}, err)
+}
+
+func (dbms *DBManagerSuite) TestPurgeDeletedUsers() {
+	deletedBefore := time.Now().Add(-time.Hour)
+
+	dbms.mock.ExpectBegin()
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "users" WHERE deleted_at IS NOT NULL AND deleted_at < $1`),
+	).WithArgs(
+		deletedBefore,
+	).WillReturnRows(sqlmock.NewRows([]string{"id", "user_name", "organization_id"}).AddRow(2, "test", 1))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "id" FROM "invitations" WHERE user_id = $1`),
+	).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE organization_id = $1 AND user_name = $2 AND id <> $3`),
+	).WithArgs(1, "test", 2).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	dbms.mock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT * FROM "audit_personal_values" WHERE organization_id = $1 AND (user_id = $2 OR (user_id IS NULL AND field = $3 AND value = $4))`),
+	).WithArgs(1, 2, "user_name", `"test"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "invitation_id", "field", "value"}).
+			AddRow(10, 2, nil, "user_name", `"test"`),
+	)
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`UPDATE "audit_personal_values" SET "value"=$1 WHERE id = $2`),
+	).WithArgs(`"erased-2"`, 10).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectExec(
+		regexp.QuoteMeta(`DELETE FROM "users" WHERE id = $1`),
+	).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbms.mock.ExpectCommit()
+
+	purged, err := dbms.manager.PurgeDeletedUsers(context.Background(), deletedBefore)
+	assert.NoError(dbms.T(), err)
+	assert.Equal(dbms.T(), int64(1), purged)
+}
+
+func TestGetUsersWithoutAdminValue(t *testing.T) {
+	// Tables created before admin was required leave it NULL for existing users
+	conn, err := db.Open("sqlite://:memory:")
+	require.NoError(t, err)
+	require.NoError(t, conn.AutoMigrate(&db.User{}))
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+
+	user := userFixture()
+	require.NoError(t, conn.Exec(
+		`INSERT INTO users (full_name, phone, user_name, password, admin, registration_status) VALUES (?, ?, ?, ?, NULL, 'active')`,
+		user.FullName, user.Phone, user.UserName, user.Password,
+	).Error)
+
+	users, err := manager.GetUsers(context.Background(), db.GetUsersParams{Offset: 10})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "test", users[0].UserName)
+	assert.False(t, users[0].Admin)
+
+	count, err := manager.CountUsers(context.Background(), db.GetUsersParams{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	results, err := manager.SearchUsers(context.Background(), db.SearchUsersParams{Query: "test", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "test", results[0].User.UserName)
+
+	admin := true
+	users, err = manager.GetUsers(context.Background(), db.GetUsersParams{Offset: 10, Admin: &admin})
+	require.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestGetUsersPagesWithoutAdminValue(t *testing.T) {
+	conn, err := db.Open("sqlite://:memory:")
+	require.NoError(t, err)
+	require.NoError(t, conn.AutoMigrate(&db.User{}))
+
+	manager := db.NewDBManager(conn, db.Timeouts{})
+
+	// Users without an admin value are interleaved with regular users
+	for i := 0; i < 5; i++ {
+		user := numberedUserFixture(fmt.Sprint(i))
+
+		var admin any
+		if i%2 == 1 {
+			admin = false
+		}
+
+		require.NoError(t, conn.Exec(
+			`INSERT INTO users (full_name, phone, user_name, password, admin, registration_status) VALUES (?, ?, ?, ?, ?, 'active')`,
+			user.FullName, user.Phone, user.UserName, user.Password, admin,
+		).Error)
+	}
+
+	for _, sortDesc := range []bool{false, true} {
+		var userNames []string
+
+		// Three pages hold every user, so that a cursor which does not move cannot loop forever
+		searchParams := db.GetUsersParams{Offset: 2, SortBy: "admin", SortDesc: sortDesc}
+		for page := 0; page < 3; page++ {
+			users, err := manager.GetUsers(context.Background(), searchParams)
+			require.NoError(t, err)
+
+			for _, user := range users {
+				userNames = append(userNames, user.UserName)
+			}
+
+			if len(users) < searchParams.Offset {
+				break
+			}
+
+			searchParams.Cursor = db.NewUsersCursor(users[len(users)-1], "admin", sortDesc, false)
+		}
+
+		expected := []string{"test0", "test1", "test2", "test3", "test4"}
+		if sortDesc {
+			expected = []string{"test4", "test3", "test2", "test1", "test0"}
+		}
+
+		assert.Equal(t, expected, userNames)
+	}
+}
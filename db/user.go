@@ -1,63 +1,233 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
+// User is an account. FullName and Phone may be stored encrypted, in which case PhoneIndex,
+// the blind index of the phone, is what keeps phones unique. Attributes holds the values of
+// the custom attributes declared by attribute definitions
 type User struct {
 	gorm.Model
-	FullName   string
-	Phone      string `gorm:"unique"`
-	UserName   string `gorm:"unique"`
-	Password   string
-	LoginToken string
-	Admin      bool
+	FullName           string
+	Phone              string
+	PhoneIndex         string `gorm:"unique"`
+	UserName           string `gorm:"unique"`
+	Password           string
+	LoginToken         string
+	Admin              bool
+	ServiceAccount     bool
+	Attributes         Attributes
+	OrganizationID     uint
+	OrgAdmin           bool
+	RegistrationStatus string
+	RegistrationReason string
+	Version            uint
 }
 
+// CreateUserParams describes a new user. Users created with PendingApproval cannot log in until
+// an admin approves their registration
 type CreateUserParams struct {
-	FullName string
-	Phone    string
-	UserName string
-	Password string
+	FullName        string
+	Phone           string
+	UserName        string
+	Password        string
+	ServiceAccount  bool
+	Attributes      Attributes
+	PendingApproval bool
 }
 
-func (dbManager *DBManager) CreateUser(userParams CreateUserParams) (*User, error) {
-	user := &User{
-		FullName: userParams.FullName,
-		Phone:    userParams.Phone,
-		UserName: userParams.UserName,
-		Password: userParams.Password,
-		Admin:    false,
+// sealUser prepares user to be stored, encrypting its personal data and indexing its phone
+func (dbManager *DBManager) sealUser(user *User) error {
+	var err error
+
+	user.PhoneIndex = dbManager.pii.BlindIndex(user.Phone)
+
+	if user.FullName, err = dbManager.pii.Encrypt("users", user.ID, "full_name", user.FullName); err != nil {
+		return err
 	}
 
-	result := dbManager.db.Omit("LoginToken").Create(user)
+	user.Phone, err = dbManager.pii.Encrypt("users", user.ID, "phone", user.Phone)
 
-	if err := result.Error; err != nil {
-		if IsUniqueConstraintViolationError(err) {
-			pqErr, _ := err.(*pq.Error)
-			if pqErr.Column == "phone" {
-				return nil, fmt.Errorf("An user with the provided phone number already exists")
-			} else if pqErr.Column == "user_name" {
-				return nil, fmt.Errorf("An user with the provided username already exists")
+	return err
+}
+
+// openUser decrypts the personal data of a stored user
+func (dbManager *DBManager) openUser(user *User) error {
+	var err error
+
+	if user.FullName, err = dbManager.pii.Decrypt("users", user.ID, "full_name", user.FullName); err != nil {
+		return err
+	}
+
+	user.Phone, err = dbManager.pii.Decrypt("users", user.ID, "phone", user.Phone)
+
+	return err
+}
+
+func (dbManager *DBManager) openUsers(users []User) error {
+	for i := range users {
+		if err := dbManager.openUser(&users[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sealedColumn is a personal data column of a row about to be created
+type sealedColumn struct {
+	name  string
+	field string
+	value *string
+}
+
+// createSealed creates a row of table with create, which returns its id, encrypting its personal
+// data columns. Encrypted values are bound to the id of their row, so while any of the columns
+// is encrypted the row is created with them empty, then updated with the encrypted values in the
+// same transaction
+func (dbManager *DBManager) createSealed(conn *gorm.DB, table string, create func(conn *gorm.DB) (uint, error), columns ...sealedColumn) error {
+	encrypted := false
+	for _, column := range columns {
+		encrypted = encrypted || dbManager.pii.Encrypts(column.field)
+	}
+
+	if !encrypted {
+		_, err := create(conn)
+		return err
+	}
+
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = *column.value
+		*column.value = ""
+	}
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		id, err := create(tx)
+		if err != nil {
+			return err
+		}
+
+		sealed := map[string]any{}
+		for i, column := range columns {
+			if *column.value, err = dbManager.pii.Encrypt(table, id, column.field, values[i]); err != nil {
+				return err
 			}
 
-			return nil, fmt.Errorf("An user with the provided information already exists")
+			sealed[column.name] = *column.value
+		}
+
+		return tx.Table(table).Where("id = ?", id).UpdateColumns(sealed).Error
+	})
+}
+
+// duplicateUserError describes which unique user field the violated constraint refers to
+func duplicateUserError(constraint string) error {
+	if strings.Contains(constraint, "phone") {
+		return &BadInputError{
+			Err: fmt.Errorf("An user with the provided phone number already exists"),
 		}
+	} else if strings.Contains(constraint, "user_name") {
+		return &BadInputError{
+			Err: fmt.Errorf("An user with the provided username already exists"),
+		}
+	}
+
+	return &BadInputError{
+		Err: fmt.Errorf("An user with the provided information already exists"),
+	}
+}
+
+func (dbManager *DBManager) CreateUser(ctx context.Context, userParams CreateUserParams) (*User, error) {
+	user := &User{
+		FullName:       userParams.FullName,
+		Phone:          userParams.Phone,
+		UserName:       userParams.UserName,
+		Password:       userParams.Password,
+		Admin:          false,
+		ServiceAccount: userParams.ServiceAccount,
+		Attributes:     userParams.Attributes.clone(),
 
+		RegistrationStatus: registrationStatusOf(userParams),
+		Version:            1,
+	}
+
+	reserved, err := dbManager.IsUserNameReserved(ctx, user.UserName, 0)
+	if err != nil {
 		return nil, err
 	}
 
+	if reserved {
+		return nil, errReservedUserName
+	}
+
+	sealed := *user
+	sealed.PhoneIndex = dbManager.pii.BlindIndex(sealed.Phone)
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	err = dbManager.createSealed(conn, "users", func(conn *gorm.DB) (uint, error) {
+		err := conn.Omit("LoginToken").Create(&sealed).Error
+
+		return sealed.ID, err
+	}, sealedColumn{name: "full_name", field: "full_name", value: &sealed.FullName},
+		sealedColumn{name: "phone", field: "phone", value: &sealed.Phone})
+
+	if err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return nil, duplicateUserError(ViolatedConstraint(err))
+		}
+
+		return nil, err
+	}
+
+	user.Model = sealed.Model
+	user.PhoneIndex = sealed.PhoneIndex
+	user.OrganizationID = sealed.OrganizationID
+
 	return user, nil
 }
 
-func (dbManager *DBManager) GetUser(userName string) (*User, error) {
+func (dbManager *DBManager) GetUser(ctx context.Context, userName string) (*User, error) {
+	var user User
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_name = ?", userName).First(&user)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "user",
+			}
+		}
+
+		return nil, err
+	}
+
+	if err := dbManager.openUser(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (dbManager *DBManager) GetUserByID(ctx context.Context, id uint) (*User, error) {
 	var user User
 
-	result := dbManager.db.Where("user_name = ?", userName).First(&user)
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("id = ?", id).First(&user)
 
 	if err := result.Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -69,45 +239,307 @@ func (dbManager *DBManager) GetUser(userName string) (*User, error) {
 		return nil, err
 	}
 
+	if err := dbManager.openUser(&user); err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
 
+// DeletedFilter selects how soft deleted users are handled when listing users
+type DeletedFilter string
+
+const (
+	DeletedExclude DeletedFilter = "exclude"
+	DeletedInclude DeletedFilter = "include"
+	DeletedOnly    DeletedFilter = "only"
+)
+
+// sortableUserColumns whitelists the fields users can be sorted by, mapped to their columns.
+// Users left without an admin value are regular users, so they sort and page like them
+var sortableUserColumns = map[string]string{
+	"id":         "id",
+	"user_name":  "user_name",
+	"full_name":  "full_name",
+	"phone":      "phone",
+	"admin":      "COALESCE(admin, false)",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"deleted_at": "deleted_at",
+}
+
+// IsSortableUserField reports whether users can be sorted by field
+func IsSortableUserField(field string) bool {
+	_, ok := sortableUserColumns[field]
+
+	return ok
+}
+
+// GetUsersParams filters, sorts and paginates the listed users, whose registration is approved.
+// Empty fields do not filter, except Admin, which lists only regular users when unset. Users are sorted by id by default.
+// When Cursor is set, Offset users are listed from the cursor position and PageIndex is ignored.
+// Attributes keeps the users holding exactly the given value for each attribute
 type GetUsersParams struct {
 	PageIndex int
 	Offset    int
+	Cursor    *UsersCursor
+
+	UserNamePrefix string
+	FullNamePrefix string
+	Phone          string
+	Admin          *bool
+	CreatedAfter   *time.Time
+	CreatedBefore  *time.Time
+	UpdatedAfter   *time.Time
+	UpdatedBefore  *time.Time
+	Deleted        DeletedFilter
+	Attributes     Attributes
+
+	SortBy   string
+	SortDesc bool
+}
+
+// escapeLike escapes the LIKE wildcards in value, using backslash as the escape character
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// filterUsers applies the filters of searchParams to query. Encrypted full names cannot be
+// matched by prefix, while encrypted phones are still found through their blind index
+func (dbManager *DBManager) filterUsers(query *gorm.DB, searchParams GetUsersParams) (*gorm.DB, error) {
+	if searchParams.FullNamePrefix != "" && dbManager.pii.Encrypts("full_name") {
+		return nil, &BadInputError{
+			Err: fmt.Errorf("Users cannot be filtered by full_name while it is encrypted"),
+		}
+	}
+
+	switch searchParams.Deleted {
+	case DeletedInclude:
+		query = query.Unscoped()
+	case DeletedOnly:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	// Users created before admin was required may have no value for it, and are not admins
+	if searchParams.Admin != nil && *searchParams.Admin {
+		query = query.Where("admin = ?", true)
+	} else {
+		query = query.Where("admin = ? OR admin IS NULL", false)
+	}
+
+	// Pending and rejected registrations are only listed by the approval queue
+	query = query.Where("registration_status = ?", RegistrationActive)
+
+	if searchParams.UserNamePrefix != "" {
+		query = query.Where(`LOWER(user_name) LIKE ? ESCAPE '\'`, escapeLike(strings.ToLower(searchParams.UserNamePrefix))+"%")
+	}
+
+	if searchParams.FullNamePrefix != "" {
+		query = query.Where(`LOWER(full_name) LIKE ? ESCAPE '\'`, escapeLike(strings.ToLower(searchParams.FullNamePrefix))+"%")
+	}
+
+	if searchParams.Phone != "" {
+		query = query.Where("phone_index = ?", dbManager.pii.BlindIndex(searchParams.Phone))
+	}
+
+	if searchParams.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *searchParams.CreatedAfter)
+	}
+
+	if searchParams.CreatedBefore != nil {
+		query = query.Where("created_at <= ?", *searchParams.CreatedBefore)
+	}
+
+	if searchParams.UpdatedAfter != nil {
+		query = query.Where("updated_at >= ?", *searchParams.UpdatedAfter)
+	}
+
+	if searchParams.UpdatedBefore != nil {
+		query = query.Where("updated_at <= ?", *searchParams.UpdatedBefore)
+	}
+
+	for _, name := range searchParams.Attributes.sortedNames() {
+		condition, args, err := dbManager.attributeCondition(name, searchParams.Attributes[name])
+		if err != nil {
+			return nil, err
+		}
+
+		query = query.Where(condition, args...)
+	}
+
+	return query, nil
 }
 
-func (dbManager *DBManager) GetUsers(searchParams GetUsersParams) ([]User, error) {
+// seekUsers restricts query to the users following the cursor in the given sort order.
+// NULL values sort first, so they follow every other value when sorting in descending order
+func seekUsers(query *gorm.DB, column string, sortDesc bool, cursor *UsersCursor) *gorm.DB {
+	if !sortDesc {
+		if cursor.Value == nil {
+			return query.Where(fmt.Sprintf("%s IS NOT NULL OR id > ?", column), cursor.ID)
+		}
+
+		return query.Where(fmt.Sprintf("%[1]s > ? OR (%[1]s = ? AND id > ?)", column), cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	if cursor.Value == nil {
+		return query.Where(fmt.Sprintf("%s IS NULL AND id < ?", column), cursor.ID)
+	}
+
+	return query.Where(fmt.Sprintf("%[1]s < ? OR (%[1]s = ? AND id < ?) OR %[1]s IS NULL", column), cursor.Value, cursor.Value, cursor.ID)
+}
+
+// checkUsersCursor validates that cursor was created for the sort order of searchParams
+func checkUsersCursor(sortBy string, searchParams GetUsersParams) error {
+	cursor := searchParams.Cursor
+	if cursor != nil && (cursor.SortBy != sortBy || cursor.SortDesc != searchParams.SortDesc) {
+		return &BadInputError{
+			Err: fmt.Errorf("The pagination cursor does not match the requested sort order"),
+		}
+	}
+
+	return nil
+}
+
+func (dbManager *DBManager) GetUsers(ctx context.Context, searchParams GetUsersParams) ([]User, error) {
 	var users []User
 
-	searchOffset := searchParams.PageIndex * searchParams.Offset
+	sortBy := searchParams.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	sortColumn, ok := sortableUserColumns[sortBy]
+	if !ok {
+		return nil, &BadInputError{
+			Err: fmt.Errorf("Users cannot be sorted by %s", sortBy),
+		}
+	}
+
+	// Ciphertexts do not sort like the values they hide
+	if dbManager.pii.Encrypts(sortColumn) {
+		return nil, &BadInputError{
+			Err: fmt.Errorf("Users cannot be sorted by %s while it is encrypted", sortBy),
+		}
+	}
+
+	if err := checkUsersCursor(sortBy, searchParams); err != nil {
+		return nil, err
+	}
 
-	result := dbManager.db.Omit("ID", "LoginToken").Limit(searchParams.Offset).Offset(searchOffset).Where("admin <> ?", true).Or("admin IS NULL").Find(&users)
+	// Backward pages are read in the reverse order and flipped afterwards
+	sortDesc := searchParams.SortDesc
+	backward := searchParams.Cursor != nil && searchParams.Cursor.Backward
+	if backward {
+		sortDesc = !sortDesc
+	}
+
+	// NULL values sort as the smallest ones, which is the SQLite default but not the Postgres one
+	sortDirection := "ASC NULLS FIRST"
+	if sortDesc {
+		sortDirection = "DESC NULLS LAST"
+	}
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	query, err := dbManager.filterUsers(conn.Omit("LoginToken"), searchParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if searchParams.Cursor != nil {
+		query = seekUsers(query, sortColumn, sortDesc, searchParams.Cursor)
+	} else {
+		query = query.Offset(searchParams.PageIndex * searchParams.Offset)
+	}
+
+	query = query.Order(sortColumn + " " + sortDirection)
+	if sortColumn != "id" {
+		query = query.Order("id " + sortDirection)
+	}
+
+	result := query.Limit(searchParams.Offset).Find(&users)
 
 	if err := result.Error; err != nil {
 		return nil, err
 	}
 
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	if err := dbManager.openUsers(users); err != nil {
+		return nil, err
+	}
+
 	return users, nil
 }
 
+// CountUsers returns how many users match the filters of searchParams, ignoring pagination
+func (dbManager *DBManager) CountUsers(ctx context.Context, searchParams GetUsersParams) (int64, error) {
+	var count int64
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	query, err := dbManager.filterUsers(conn.Model(&User{}), searchParams)
+	if err != nil {
+		return 0, err
+	}
+
+	result := query.Count(&count)
+
+	if err := result.Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// UpdateUserParams replaces the profile of a user. The update only applies while the user is
+// still at Version, and moves the user to the next one. Refreshing the login token alone does
+// not change the profile, and is done with SetLoginToken instead
 type UpdateUserParams struct {
 	ID         uint
 	FullName   string
 	Phone      string
 	Password   string
 	LoginToken string
+	Version    uint
 }
 
-func (dbManager *DBManager) UpdateUser(updateParams UpdateUserParams) error {
-	result := dbManager.db.Model(&User{}).Where("id = ?", updateParams.ID).Select("full_name", "phone", "password", "login_token").Updates(User{
+func (dbManager *DBManager) UpdateUser(ctx context.Context, updateParams UpdateUserParams) error {
+	user := User{
 		FullName:   updateParams.FullName,
 		Phone:      updateParams.Phone,
 		Password:   updateParams.Password,
 		LoginToken: updateParams.LoginToken,
-	})
+	}
+
+	// The personal data is bound to the user it belongs to
+	user.ID = updateParams.ID
+	if err := dbManager.sealUser(&user); err != nil {
+		return err
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	user.Version = updateParams.Version + 1
+
+	result := conn.Model(&User{}).
+		Where("id = ?", updateParams.ID).
+		Where("version = ?", updateParams.Version).
+		Select("full_name", "phone", "phone_index", "password", "login_token", "version").
+		Updates(user)
 
 	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return duplicateUserError(ViolatedConstraint(err))
+		}
+
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return &NotFoundError{
 				object: "user",
@@ -117,11 +549,40 @@ func (dbManager *DBManager) UpdateUser(updateParams UpdateUserParams) error {
 		return err
 	}
 
+	if result.RowsAffected == 0 {
+		return &VersionConflictError{
+			object: "user",
+		}
+	}
+
+	return nil
+}
+
+// SetLoginToken replaces the login token of a user, leaving its profile and version untouched
+func (dbManager *DBManager) SetLoginToken(ctx context.Context, id uint, loginToken string) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id = ?", id).Update("login_token", loginToken)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
 	return nil
 }
 
-func (dbManager *DBManager) DeleteUser(userName string) error {
-	result := dbManager.db.Where("user_name = ?", userName).Delete(&User{})
+func (dbManager *DBManager) DeleteUser(ctx context.Context, userName string) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_name = ?", userName).Delete(&User{})
 
 	if err := result.Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -135,3 +596,102 @@ func (dbManager *DBManager) DeleteUser(userName string) error {
 
 	return nil
 }
+
+// RestoreUser undoes the soft deletion of the user with the provided id, as long as no other
+// user took its username or phone number in the meantime
+func (dbManager *DBManager) RestoreUser(ctx context.Context, id uint) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return duplicateUserError(ViolatedConstraint(err))
+		}
+
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	return nil
+}
+
+// PurgeUser permanently removes a soft deleted user along with its API keys. The personal data
+// named by audit events is anonymized as when erasing the user
+func (dbManager *DBManager) PurgeUser(ctx context.Context, id uint) error {
+	return dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		var user User
+		if err := conn.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &NotFoundError{
+					object: "user",
+				}
+			}
+
+			return err
+		}
+
+		return dbManager.purgeUser(conn, &user)
+	})
+}
+
+// PurgeDeletedUsers permanently removes the users soft deleted before deletedBefore,
+// returning how many were removed
+func (dbManager *DBManager) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+
+	err := dbManager.WithTx(ctx, func(tx DBConnector) error {
+		conn, cancel := tx.(*DBManager).writeConn(ctx)
+		defer cancel()
+
+		var users []User
+		if err := conn.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).Find(&users).Error; err != nil {
+			return err
+		}
+
+		for i := range users {
+			if err := dbManager.purgeUser(conn, &users[i]); err != nil {
+				return err
+			}
+		}
+
+		purged = int64(len(users))
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// purgeUser anonymizes the personal data of user named by audit events, which no foreign key
+// removes, and deletes the user. Its username is only erased from events about nobody in
+// particular while no other user of its organization goes by it
+func (dbManager *DBManager) purgeUser(conn *gorm.DB, user *User) error {
+	var invitationIDs []uint
+	if err := conn.Model(&Invitation{}).Where("user_id = ?", user.ID).Pluck("id", &invitationIDs).Error; err != nil {
+		return err
+	}
+
+	var namesakes int64
+	if err := conn.Unscoped().Model(&User{}).Where("organization_id = ? AND user_name = ? AND id <> ?", user.OrganizationID, user.UserName, user.ID).Count(&namesakes).Error; err != nil {
+		return err
+	}
+
+	if err := dbManager.eraseAuditPersonalValues(conn, user, invitationIDs, namesakes == 0); err != nil {
+		return err
+	}
+
+	return conn.Unscoped().Where("id = ?", user.ID).Delete(&User{}).Error
+}
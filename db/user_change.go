@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	UserChangeUserName = "user_name"
+	UserChangePhone    = "phone"
+)
+
+var errReservedUserName = &BadInputError{
+	Err: fmt.Errorf("The provided username is reserved"),
+}
+
+// UserChange records a change of the username or phone of a user. A username given up stays
+// reserved to its former owner until ReservedUntil, so nobody else can take it over right away.
+// The phones recorded are encrypted like the phone of users
+type UserChange struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	OrganizationID uint
+	UserID         uint
+	Field          string
+	OldValue       string
+	NewValue       string
+	ReservedUntil  *time.Time
+}
+
+type CreateUserChangeParams struct {
+	UserID        uint
+	Field         string
+	OldValue      string
+	NewValue      string
+	ReservedUntil *time.Time
+}
+
+// PhoneVerification holds the code sent to the phone a user is moving to. The phone only
+// replaces the current one once the code is verified
+type PhoneVerification struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	OrganizationID uint
+	UserID         uint
+	Phone          string
+	CodeHash       string
+	ExpiresAt      time.Time
+	Attempts       int
+	VerifiedAt     *time.Time
+}
+
+type CreatePhoneVerificationParams struct {
+	UserID    uint
+	Phone     string
+	CodeHash  string
+	ExpiresAt time.Time
+}
+
+// IsUserNameReserved reports whether userName is reserved to a user other than the one with
+// exceptUserID, which is zero for users being created
+func (dbManager *DBManager) IsUserNameReserved(ctx context.Context, userName string, exceptUserID uint) (bool, error) {
+	var count int64
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&UserChange{}).
+		Where("field = ? AND old_value = ? AND user_id <> ? AND reserved_until > ?", UserChangeUserName, userName, exceptUserID, time.Now()).
+		Count(&count)
+
+	if err := result.Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// SetUserName renames the user with id. Usernames reserved to other users are refused
+func (dbManager *DBManager) SetUserName(ctx context.Context, id uint, userName string) error {
+	reserved, err := dbManager.IsUserNameReserved(ctx, userName, id)
+	if err != nil {
+		return err
+	}
+
+	if reserved {
+		return errReservedUserName
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&User{}).Where("id = ?", id).Update("user_name", userName)
+
+	if err := result.Error; err != nil {
+		if IsUniqueConstraintViolationError(err) {
+			return duplicateUserError(ViolatedConstraint(err))
+		}
+
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "user",
+		}
+	}
+
+	return nil
+}
+
+// openUserChange decrypts the phones recorded by change
+func (dbManager *DBManager) openUserChange(change *UserChange) error {
+	if change.Field != UserChangePhone {
+		return nil
+	}
+
+	var err error
+	if change.OldValue, err = dbManager.pii.Decrypt("user_changes", change.ID, "phone", change.OldValue); err != nil {
+		return err
+	}
+
+	change.NewValue, err = dbManager.pii.Decrypt("user_changes", change.ID, "phone", change.NewValue)
+
+	return err
+}
+
+func (dbManager *DBManager) CreateUserChange(ctx context.Context, changeParams CreateUserChangeParams) (*UserChange, error) {
+	change := &UserChange{
+		UserID:        changeParams.UserID,
+		Field:         changeParams.Field,
+		OldValue:      changeParams.OldValue,
+		NewValue:      changeParams.NewValue,
+		ReservedUntil: changeParams.ReservedUntil,
+	}
+
+	// Only the phones recorded by phone changes are encrypted
+	sealed := *change
+	columns := []sealedColumn{}
+	if change.Field == UserChangePhone {
+		columns = []sealedColumn{
+			{name: "old_value", field: "phone", value: &sealed.OldValue},
+			{name: "new_value", field: "phone", value: &sealed.NewValue},
+		}
+	}
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	err := dbManager.createSealed(conn, "user_changes", func(conn *gorm.DB) (uint, error) {
+		err := conn.Create(&sealed).Error
+
+		return sealed.ID, err
+	}, columns...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	change.ID = sealed.ID
+	change.CreatedAt = sealed.CreatedAt
+	change.OrganizationID = sealed.OrganizationID
+
+	return change, nil
+}
+
+// GetUserChanges returns the username and phone changes of the user with userID, oldest first
+func (dbManager *DBManager) GetUserChanges(ctx context.Context, userID uint) ([]UserChange, error) {
+	var changes []UserChange
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_id = ?", userID).Order("id").Find(&changes)
+
+	if err := result.Error; err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		if err := dbManager.openUserChange(&changes[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (dbManager *DBManager) CreatePhoneVerification(ctx context.Context, verificationParams CreatePhoneVerificationParams) (*PhoneVerification, error) {
+	verification := &PhoneVerification{
+		UserID:    verificationParams.UserID,
+		Phone:     verificationParams.Phone,
+		CodeHash:  verificationParams.CodeHash,
+		ExpiresAt: verificationParams.ExpiresAt,
+	}
+
+	sealed := *verification
+
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	err := dbManager.createSealed(conn, "phone_verifications", func(conn *gorm.DB) (uint, error) {
+		err := conn.Omit("VerifiedAt").Create(&sealed).Error
+
+		return sealed.ID, err
+	}, sealedColumn{name: "phone", field: "phone", value: &sealed.Phone})
+
+	if err != nil {
+		return nil, err
+	}
+
+	verification.ID = sealed.ID
+	verification.CreatedAt = sealed.CreatedAt
+	verification.UpdatedAt = sealed.UpdatedAt
+	verification.OrganizationID = sealed.OrganizationID
+
+	return verification, nil
+}
+
+// GetPhoneVerification returns the last phone verification the user with userID started and
+// did not complete. Starting a new one supersedes the previous ones
+func (dbManager *DBManager) GetPhoneVerification(ctx context.Context, userID uint) (*PhoneVerification, error) {
+	var verification PhoneVerification
+
+	conn, cancel := dbManager.readConn(ctx)
+	defer cancel()
+
+	result := conn.Where("user_id = ? AND verified_at IS NULL", userID).Order("id DESC").First(&verification)
+
+	if err := result.Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &NotFoundError{
+				object: "phone verification",
+			}
+		}
+
+		return nil, err
+	}
+
+	var err error
+	if verification.Phone, err = dbManager.pii.Decrypt("phone_verifications", verification.ID, "phone", verification.Phone); err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+// FailPhoneVerification counts a wrong code entered for the phone verification with id
+func (dbManager *DBManager) FailPhoneVerification(ctx context.Context, id uint) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&PhoneVerification{}).Where("id = ?", id).Update("attempts", gorm.Expr("attempts + 1"))
+
+	return result.Error
+}
+
+// CompletePhoneVerification marks the phone verification with id as verified
+func (dbManager *DBManager) CompletePhoneVerification(ctx context.Context, id uint) error {
+	conn, cancel := dbManager.writeConn(ctx)
+	defer cancel()
+
+	result := conn.Model(&PhoneVerification{}).Where("id = ? AND verified_at IS NULL", id).Update("verified_at", time.Now())
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return &NotFoundError{
+			object: "phone verification",
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UsersCursor marks the position of a user in a sorted users listing. Keyset pages start
+// right after that user or, when Backward is set, end right before it
+type UsersCursor struct {
+	SortBy   string `json:"s"`
+	SortDesc bool   `json:"d"`
+	ID       uint   `json:"i"`
+	Value    any    `json:"v"`
+	Backward bool   `json:"b"`
+}
+
+// userSortValue returns the value of the sort column for user, nil standing for NULL
+func userSortValue(user User, field string) any {
+	switch field {
+	case "user_name":
+		return user.UserName
+	case "full_name":
+		return user.FullName
+	case "phone":
+		return user.Phone
+	case "admin":
+		return user.Admin
+	case "created_at":
+		return user.CreatedAt
+	case "updated_at":
+		return user.UpdatedAt
+	case "deleted_at":
+		if user.DeletedAt.Valid {
+			return user.DeletedAt.Time
+		}
+
+		return nil
+	}
+
+	return user.ID
+}
+
+// NewUsersCursor creates the cursor pointing at user in a listing sorted by sortBy
+func NewUsersCursor(user User, sortBy string, sortDesc bool, backward bool) *UsersCursor {
+	if sortBy == "" {
+		sortBy = "id"
+	}
+
+	return &UsersCursor{
+		SortBy:   sortBy,
+		SortDesc: sortDesc,
+		ID:       user.ID,
+		Value:    userSortValue(user, sortBy),
+		Backward: backward,
+	}
+}
+
+// Encode serializes the cursor into an opaque URL safe string
+func (cursor *UsersCursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeUsersCursor parses a cursor created by Encode, restoring the type of its sort value
+func DecodeUsersCursor(encoded string) (*UsersCursor, error) {
+	invalidCursorErr := &BadInputError{
+		Err: fmt.Errorf("Invalid pagination cursor"),
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalidCursorErr
+	}
+
+	var cursor UsersCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, invalidCursorErr
+	}
+
+	if !IsSortableUserField(cursor.SortBy) {
+		return nil, invalidCursorErr
+	}
+
+	switch value := cursor.Value.(type) {
+	case nil:
+		if cursor.SortBy != "deleted_at" {
+			return nil, invalidCursorErr
+		}
+	case string:
+		switch cursor.SortBy {
+		case "created_at", "updated_at", "deleted_at":
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, invalidCursorErr
+			}
+
+			cursor.Value = parsed
+		case "user_name", "full_name", "phone":
+		default:
+			return nil, invalidCursorErr
+		}
+	case bool:
+		if cursor.SortBy != "admin" {
+			return nil, invalidCursorErr
+		}
+	case float64:
+		if cursor.SortBy != "id" {
+			return nil, invalidCursorErr
+		}
+
+		cursor.Value = uint(value)
+	default:
+		return nil, invalidCursorErr
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,135 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Location is the coarse geographical location of an IP address. Any of its fields may be empty
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// String joins the known parts of the location from the most to the least specific one
+func (location Location) String() string {
+	parts := []string{}
+	for _, part := range []string{location.City, location.Region, location.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+type Locator interface {
+	Lookup(ip string) (Location, bool)
+}
+
+// NoopLocator locates no address. It is used when no GeoIP database is configured
+type NoopLocator struct{}
+
+func (NoopLocator) Lookup(ip string) (Location, bool) {
+	return Location{}, false
+}
+
+type network struct {
+	prefix   netip.Prefix
+	location Location
+}
+
+// DatabaseLocator locates addresses using the networks of a local GeoIP database
+type DatabaseLocator struct {
+	networks []network
+}
+
+// NewDatabaseLocator loads the GeoIP database at path. The database is a CSV file with the
+// columns network, country, region and city, where network is an IPv4 or IPv6 CIDR block.
+// An optional header row starting with "network" and lines starting with # are skipped.
+// Networks must not overlap
+func NewDatabaseLocator(path string) (*DatabaseLocator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadDatabase(file)
+}
+
+// ReadDatabase loads a GeoIP database in the format described by NewDatabaseLocator
+func ReadDatabase(reader io.Reader) (*DatabaseLocator, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = 4
+	csvReader.TrimLeadingSpace = true
+
+	locator := &DatabaseLocator{}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if record[0] == "network" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid network %q: %w", record[0], err)
+		}
+
+		locator.networks = append(locator.networks, network{
+			prefix: prefix.Masked(),
+			location: Location{
+				Country: record[1],
+				Region:  record[2],
+				City:    record[3],
+			},
+		})
+	}
+
+	sort.Slice(locator.networks, func(i, j int) bool {
+		return locator.networks[i].prefix.Addr().Less(locator.networks[j].prefix.Addr())
+	})
+
+	for i := 1; i < len(locator.networks); i++ {
+		if locator.networks[i-1].prefix.Overlaps(locator.networks[i].prefix) {
+			return nil, fmt.Errorf("Network %s overlaps network %s", locator.networks[i].prefix, locator.networks[i-1].prefix)
+		}
+	}
+
+	return locator, nil
+}
+
+// Lookup finds the location of ip, which may be an IPv4, IPv6 or IPv4-mapped IPv6 address
+func (locator *DatabaseLocator) Lookup(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+
+	// The candidate is the last network starting at or before the address
+	i := sort.Search(len(locator.networks), func(i int) bool {
+		return addr.Less(locator.networks[i].prefix.Addr())
+	}) - 1
+
+	if i < 0 || !locator.networks[i].prefix.Contains(addr) {
+		return Location{}, false
+	}
+
+	return locator.networks[i].location, true
+}
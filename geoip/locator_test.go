@@ -0,0 +1,66 @@
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDatabase = `network,country,region,city
+# Documentation ranges
+192.0.2.0/24,US,California,San Francisco
+198.51.100.0/24,BR,Sao Paulo,
+2001:db8::/32,DE,,
+`
+
+func TestDatabaseLocator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	require.NoError(t, os.WriteFile(path, []byte(testDatabase), 0o600))
+
+	locator, err := NewDatabaseLocator(path)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		ip       string
+		found    bool
+		location string
+	}{
+		{ip: "192.0.2.10", found: true, location: "San Francisco, California, US"},
+		{ip: "::ffff:192.0.2.255", found: true, location: "San Francisco, California, US"},
+		{ip: "198.51.100.1", found: true, location: "Sao Paulo, BR"},
+		{ip: "2001:db8::1", found: true, location: "DE"},
+		{ip: "192.0.3.1", found: false},
+		{ip: "10.0.0.1", found: false},
+		{ip: "2001:db9::1", found: false},
+		{ip: "not an ip", found: false},
+	}
+
+	for _, tc := range testCases {
+		location, found := locator.Lookup(tc.ip)
+		require.Equal(t, tc.found, found, tc.ip)
+		require.Equal(t, tc.location, location.String(), tc.ip)
+	}
+}
+
+func TestReadDatabaseErrors(t *testing.T) {
+	_, err := ReadDatabase(strings.NewReader("192.0.2.0/33,US,,\n"))
+	require.Error(t, err)
+
+	_, err = ReadDatabase(strings.NewReader("192.0.2.0/24,US,\n"))
+	require.Error(t, err)
+
+	_, err = ReadDatabase(strings.NewReader("192.0.2.0/24,US,,\n192.0.2.128/25,BR,,\n"))
+	require.ErrorContains(t, err, "overlaps")
+
+	_, err = NewDatabaseLocator(filepath.Join(t.TempDir(), "missing.csv"))
+	require.Error(t, err)
+}
+
+func TestNoopLocator(t *testing.T) {
+	location, found := NoopLocator{}.Lookup("192.0.2.10")
+	require.False(t, found)
+	require.Empty(t, location.String())
+}
@@ -1,28 +1,102 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/ericbg27/RegistryAPI/api"
 	"github.com/ericbg27/RegistryAPI/db"
 	"github.com/ericbg27/RegistryAPI/token"
 	"github.com/ericbg27/RegistryAPI/util"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
+const (
+	defaultUserPurgeInterval          = time.Hour
+	defaultRegistrationExpiryInterval = time.Hour
+)
+
+const defaultPIIEncryptedFields = "full_name,phone"
+
 func main() {
 	config, err := util.LoadConfig(".")
 	if err != nil {
 		log.Fatalf("Cannot load config: %v\n", err)
 	}
 
-	dbConn, err := gorm.Open(postgres.Open(config.DBSource), &gorm.Config{})
+	dbConn, err := db.Open(config.DBSource)
 	if err != nil {
 		log.Fatalf("Cannot open DB connection: %v\n", err)
 	}
 
-	dbManager := db.NewDBManager(dbConn)
+	migrator, err := db.NewMigrator(dbConn)
+	if err != nil {
+		log.Fatalf("Cannot load migrations: %v\n", err)
+	}
+
+	dbManager := db.NewDBManager(dbConn, db.Timeouts{
+		Read:  config.DBReadTimeout,
+		Write: config.DBWriteTimeout,
+	})
+
+	// Personal data is stored in plaintext unless encryption keys are configured
+	if config.PIIEncryptionKeys != "" {
+		piiCipher, err := newPIICipher(config)
+		if err != nil {
+			log.Fatalf("Cannot configure PII encryption: %v\n", err)
+		}
+
+		dbManager.EnablePIIEncryption(piiCipher)
+	}
+
+	if len(os.Args) > 1 {
+		runCommand(migrator, dbManager, os.Args[1:])
+		return
+	}
+
+	// In-memory databases start empty, so nothing but the server itself can migrate them
+	if db.IsInMemorySource(config.DBSource) {
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("Cannot apply migrations: %v\n", err)
+		}
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		log.Fatalf("Cannot check DB schema version: %v\n", err)
+	}
+
+	if len(pending) > 0 {
+		log.Fatalf("DB schema is behind by %d migration(s). Run `migrate up` before starting the server\n", len(pending))
+	}
+
+	// Phones are looked up by their blind index, so users stored before phones were indexed are
+	// indexed before serving
+	indexed, err := dbManager.IndexUserPhones(context.Background(), 0)
+	if err != nil {
+		log.Fatalf("Cannot index user phones: %v\n", err)
+	}
+
+	if indexed > 0 {
+		log.Printf("Indexed the phones of %d user(s)\n", indexed)
+	}
+
+	// Personal data stored before the PII configuration last changed is rewritten while serving
+	go db.RunPIIReencryption(context.Background(), dbManager, 0)
+
+	// Deleted users are kept forever unless a retention period is configured
+	if config.DeletedUserRetention > 0 {
+		interval := config.UserPurgeInterval
+		if interval == 0 {
+			interval = defaultUserPurgeInterval
+		}
+
+		go db.RunUserPurge(context.Background(), dbManager, config.DeletedUserRetention, interval)
+	}
 
 	maker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
 	if err != nil {
@@ -34,5 +108,141 @@ func main() {
 		log.Fatalf("Cannot create server: %v\n", err)
 	}
 
+	// Pending registrations wait for an admin forever unless a TTL is configured
+	if config.RegistrationApproval && config.PendingRegistrationTTL > 0 {
+		go server.RunRegistrationExpiry(context.Background(), config.PendingRegistrationTTL, defaultRegistrationExpiryInterval)
+	}
+
 	server.Start()
 }
+
+// newPIICipher builds the cipher of personal data from config. Both the key-encryption keys
+// and the blind index key are base64 encoded
+func newPIICipher(config util.Config) (*db.PIICipher, error) {
+	keys, err := db.ParsePIIKeys(config.PIIEncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(config.PIIBlindIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("The blind index key is not base64 encoded: %w", err)
+	}
+
+	fields := config.PIIEncryptedFields
+	if fields == "" {
+		fields = defaultPIIEncryptedFields
+	}
+
+	// With no encrypted fields the keys are only used to decrypt the stored data
+	encrypted := []string{}
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" && field != "none" {
+			encrypted = append(encrypted, field)
+		}
+	}
+
+	return db.NewPIICipher(keys, indexKey, encrypted)
+}
+
+func runCommand(migrator *db.Migrator, dbManager *db.DBManager, args []string) {
+	if len(args) != 2 {
+		log.Fatalf("Usage: %s [migrate up|down|status] [audit verify] [pii reencrypt]\n", os.Args[0])
+	}
+
+	switch args[0] {
+	case "migrate":
+		runMigrateCommand(migrator, args[1])
+	case "audit":
+		runAuditCommand(dbManager, args[1])
+	case "pii":
+		runPIICommand(dbManager, args[1])
+	default:
+		log.Fatalf("Usage: %s [migrate up|down|status] [audit verify] [pii reencrypt]\n", os.Args[0])
+	}
+}
+
+func runMigrateCommand(migrator *db.Migrator, command string) {
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		if err != nil {
+			log.Fatalf("Cannot apply migrations: %v\n", err)
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("DB schema is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatalf("Cannot revert migration: %v\n", err)
+		}
+
+		if reverted == nil {
+			fmt.Println("No migration to revert")
+			return
+		}
+
+		fmt.Printf("Reverted %04d_%s\n", reverted.Version, reverted.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Cannot read migration status: %v\n", err)
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %s. Use up, down or status\n", command)
+	}
+}
+
+func runAuditCommand(dbManager *db.DBManager, command string) {
+	if command != "verify" {
+		log.Fatalf("Unknown audit command %s. Use verify\n", command)
+	}
+
+	report, err := db.VerifyAuditChain(context.Background(), dbManager)
+	if err != nil {
+		log.Fatalf("Cannot verify audit log: %v\n", err)
+	}
+
+	if !report.Valid() {
+		log.Fatalf("Audit log chain is broken at event %d: %s. %d event(s) were verified before it\n", *report.BrokenAt, report.Reason, report.Verified)
+	}
+
+	fmt.Printf("Verified %d audit event(s)\n", report.Verified)
+	if report.Unchained > 0 {
+		fmt.Printf("%d event(s) predate hash chaining and cannot be verified\n", report.Unchained)
+	}
+
+	if report.LastHash != "" {
+		fmt.Printf("Latest hash: %s\n", report.LastHash)
+	}
+}
+
+func runPIICommand(dbManager *db.DBManager, command string) {
+	if command != "reencrypt" {
+		log.Fatalf("Unknown pii command %s. Use reencrypt\n", command)
+	}
+
+	rewritten, err := dbManager.ReencryptPersonalData(context.Background(), 0)
+	if err != nil {
+		log.Fatalf("Cannot re-encrypt personal data: %v\n", err)
+	}
+
+	fmt.Printf("Re-encrypted %d row(s) of personal data\n", rewritten)
+}
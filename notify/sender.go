@@ -0,0 +1,35 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Notification is a message addressed to a user, or only to a phone when the recipient has no
+// account yet
+type Notification struct {
+	UserName string
+	Phone    string
+	Subject  string
+	Body     string
+}
+
+// Sender delivers notifications to users, for example through SMS or email
+type Sender interface {
+	Send(ctx context.Context, notification Notification) error
+}
+
+// LogSender writes notifications to the server log instead of delivering them.
+// It is the default Sender, meant for development and for deployments without a provider
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, notification Notification) error {
+	recipient := notification.UserName
+	if recipient == "" {
+		recipient = notification.Phone
+	}
+
+	log.Printf("Notification to %s: %s. %s\n", recipient, notification.Subject, notification.Body)
+
+	return nil
+}
@@ -3,6 +3,6 @@ package token
 import "time"
 
 type Maker interface {
-	CreateToken(username string, duration time.Duration) (string, error)
+	CreateToken(username string, duration time.Duration, options ...PayloadOption) (string, error)
 	VerifyToken(tokenToVerify string) (*Payload, error)
 }
@@ -36,18 +36,23 @@ func (m *MockMaker) EXPECT() *MockMakerMockRecorder {
 }
 
 // CreateToken mocks base method.
-func (m *MockMaker) CreateToken(username string, duration time.Duration) (string, error) {
+func (m *MockMaker) CreateToken(username string, duration time.Duration, options ...token.PayloadOption) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateToken", username, duration)
+	varargs := []interface{}{username, duration}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CreateToken", varargs...)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateToken indicates an expected call of CreateToken.
-func (mr *MockMakerMockRecorder) CreateToken(username, duration interface{}) *gomock.Call {
+func (mr *MockMakerMockRecorder) CreateToken(username, duration interface{}, options ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateToken", reflect.TypeOf((*MockMaker)(nil).CreateToken), username, duration)
+	varargs := append([]interface{}{username, duration}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateToken", reflect.TypeOf((*MockMaker)(nil).CreateToken), varargs...)
 }
 
 // VerifyToken mocks base method.
@@ -29,10 +29,48 @@ func TestPasetoMaker(t *testing.T) {
 
 	require.NotZero(t, payload.ID)
 	require.Equal(t, username, payload.Username)
+	require.Empty(t, payload.Impersonator)
 	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
 	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
 }
 
+func TestImpersonationPasetoToken(t *testing.T) {
+	maker, err := NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	username := util.RandomString(8)
+	impersonator := util.RandomString(8)
+
+	token, err := maker.CreateToken(username, time.Minute, WithTenant(2), WithImpersonator(impersonator, 1, 3))
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	payload, err := maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotEmpty(t, payload)
+
+	require.Equal(t, username, payload.Username)
+	require.Equal(t, uint(2), payload.TenantID)
+	require.Equal(t, impersonator, payload.Impersonator)
+	require.Equal(t, uint(1), payload.ImpersonatorTenantID)
+	require.Equal(t, uint(3), payload.ImpersonationID)
+}
+
+func TestGroupsPasetoToken(t *testing.T) {
+	maker, err := NewPasetoMaker(util.RandomString(32))
+	require.NoError(t, err)
+
+	groups := []string{"backend", "engineering"}
+
+	token, err := maker.CreateToken(util.RandomString(8), time.Minute, WithGroups(groups))
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	payload, err := maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.Equal(t, groups, payload.Groups)
+}
+
 func TestExpiredPasetoToken(t *testing.T) {
 	maker, err := NewPasetoMaker(util.RandomString(32))
 	require.NoError(t, err)
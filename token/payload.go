@@ -13,13 +13,47 @@ var (
 )
 
 type Payload struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	IssuedAt  time.Time `json:"issued_at"`
-	ExpiredAt time.Time `json:"expired_at"`
+	ID                   uuid.UUID `json:"id"`
+	Username             string    `json:"username"`
+	TenantID             uint      `json:"tenant_id,omitempty"`
+	Impersonator         string    `json:"impersonator,omitempty"`
+	ImpersonatorTenantID uint      `json:"impersonator_tenant_id,omitempty"`
+	ImpersonationID      uint      `json:"impersonation_id,omitempty"`
+	Groups               []string  `json:"groups,omitempty"`
+	IssuedAt             time.Time `json:"issued_at"`
+	ExpiredAt            time.Time `json:"expired_at"`
 }
 
-func NewPayload(username string, duration time.Duration) (*Payload, error) {
+// PayloadOption sets optional claims on a token payload
+type PayloadOption func(payload *Payload)
+
+// WithTenant places the token user in the organization with tenantID. Usernames are only unique
+// within an organization, so the token user is looked up there
+func WithTenant(tenantID uint) PayloadOption {
+	return func(payload *Payload) {
+		payload.TenantID = tenantID
+	}
+}
+
+// WithImpersonator marks the payload as issued to the given admin, of the organization with
+// tenantID, acting as the token user during the impersonation with impersonationID
+func WithImpersonator(impersonator string, tenantID uint, impersonationID uint) PayloadOption {
+	return func(payload *Payload) {
+		payload.Impersonator = impersonator
+		payload.ImpersonatorTenantID = tenantID
+		payload.ImpersonationID = impersonationID
+	}
+}
+
+// WithGroups lists the groups the token user belongs to, directly or through nested groups, as
+// of the moment the token is issued
+func WithGroups(groups []string) PayloadOption {
+	return func(payload *Payload) {
+		payload.Groups = groups
+	}
+}
+
+func NewPayload(username string, duration time.Duration, options ...PayloadOption) (*Payload, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
@@ -32,6 +66,10 @@ func NewPayload(username string, duration time.Duration) (*Payload, error) {
 		ExpiredAt: time.Now().Add(duration),
 	}
 
+	for _, option := range options {
+		option(payload)
+	}
+
 	return payload, nil
 }
 
@@ -0,0 +1,189 @@
+package username
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	RuleExact  = "exact"
+	RulePrefix = "prefix"
+	RuleRegex  = "regex"
+)
+
+// defaultReserved are the usernames which could be mistaken for the operators of the service
+var defaultReserved = []string{
+	"administrator",
+	"anonymous",
+	"helpdesk",
+	"hostmaster",
+	"moderator",
+	"official",
+	"postmaster",
+	"registry",
+	"security",
+	"superuser",
+	"support",
+	"sysadmin",
+	"system",
+	"webmaster",
+}
+
+// confusables maps characters to the ASCII letter they are easily mistaken for. Digits are
+// folded as well, so that names like adm1n1strator match the rules written for administrator
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'l': 'i', 'ı': 'i',
+
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x',
+}
+
+// confusableSequences are the letter pairs which read as a single letter
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// Normalize returns the skeleton of name compared against the rules of a blocklist. Names
+// which look alike share a skeleton: compatibility characters such as fullwidth letters are
+// decomposed, accents are dropped, letters are lowercased and confusable characters are
+// replaced by the letter they imitate
+func Normalize(name string) string {
+	var sb strings.Builder
+
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		r = unicode.ToLower(r)
+		if folded, ok := confusables[r]; ok {
+			r = folded
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return confusableSequences.Replace(sb.String())
+}
+
+// Blocklist holds the rules usernames must not match. Exact and prefix rules are compared
+// with the skeleton of usernames, as returned by Normalize. Regex rules are case insensitive
+// and match either the username itself or its skeleton
+type Blocklist struct {
+	exact    map[string]bool
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+// NewBlocklist creates a blocklist without rules
+func NewBlocklist() *Blocklist {
+	return &Blocklist{
+		exact: map[string]bool{},
+	}
+}
+
+// DefaultBlocklist creates a blocklist reserving the names of the operators of the service
+func DefaultBlocklist() *Blocklist {
+	blocklist := NewBlocklist()
+	for _, name := range defaultReserved {
+		blocklist.exact[Normalize(name)] = true
+	}
+
+	return blocklist
+}
+
+// Add adds a rule of kind, which is one of RuleExact, RulePrefix and RuleRegex
+func (blocklist *Blocklist) Add(kind string, value string) error {
+	if value == "" {
+		return fmt.Errorf("Empty %s rule", kind)
+	}
+
+	switch kind {
+	case RuleExact:
+		blocklist.exact[Normalize(value)] = true
+	case RulePrefix:
+		blocklist.prefixes = append(blocklist.prefixes, Normalize(value))
+	case RuleRegex:
+		pattern, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return fmt.Errorf("Invalid regex rule %q: %w", value, err)
+		}
+
+		blocklist.patterns = append(blocklist.patterns, pattern)
+	default:
+		return fmt.Errorf("Unknown rule kind %q. Use exact, prefix or regex", kind)
+	}
+
+	return nil
+}
+
+// Load adds the rules of the file at path to the blocklist. Each line of the file holds a rule
+// in the format <kind>:<value>, where kind is exact, prefix or regex. Lines without a kind are
+// exact rules, and blank lines and lines starting with # are skipped
+func (blocklist *Blocklist) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return blocklist.Read(file)
+}
+
+// Read adds the rules read from reader, in the format described by Load
+func (blocklist *Blocklist) Read(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kind, value, found := strings.Cut(line, ":")
+		if !found {
+			kind, value = RuleExact, line
+		}
+
+		if err := blocklist.Add(strings.TrimSpace(kind), strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("Line %d: %w", lineNumber, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Blocks reports whether name matches any of the rules
+func (blocklist *Blocklist) Blocks(name string) bool {
+	skeleton := Normalize(name)
+
+	if blocklist.exact[skeleton] {
+		return true
+	}
+
+	for _, prefix := range blocklist.prefixes {
+		if strings.HasPrefix(skeleton, prefix) {
+			return true
+		}
+	}
+
+	for _, pattern := range blocklist.patterns {
+		if pattern.MatchString(name) || pattern.MatchString(skeleton) {
+			return true
+		}
+	}
+
+	return false
+}
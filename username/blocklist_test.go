@@ -0,0 +1,85 @@
+package username
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBlocklist = `# Staff accounts
+exact:registryteam
+prefix:staff
+regex:^.*(crap|loser).*$
+nobodyhere
+`
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		name     string
+		skeleton string
+	}{
+		{name: "Administrator", skeleton: "administrator"},
+		{name: "adm1n1strat0r", skeleton: "administrator"},
+		{name: "аdministrator", skeleton: "administrator"},
+		{name: "ＡＤＭＩＮ", skeleton: "admin"},
+		{name: "ádmïn", skeleton: "admin"},
+		{name: "suppοrt", skeleton: "support"},
+		{name: "sysadrnin", skeleton: "sysadmin"},
+		{name: "official", skeleton: "officiai"},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.skeleton, Normalize(tc.name), tc.name)
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte(testBlocklist), 0o600))
+
+	blocklist := DefaultBlocklist()
+	require.NoError(t, blocklist.Load(path))
+
+	testCases := []struct {
+		name    string
+		blocked bool
+	}{
+		{name: "administrator", blocked: true},
+		{name: "ADMINISTRATOR", blocked: true},
+		{name: "adm1n1strator", blocked: true},
+		{name: "0fficial", blocked: true},
+		{name: "registryteam", blocked: true},
+		{name: "reg1stryteam", blocked: true},
+		{name: "staffmember", blocked: true},
+		{name: "5taffmember", blocked: true},
+		{name: "biglosertoo", blocked: true},
+		{name: "CrapName", blocked: true},
+		{name: "nobodyhere", blocked: true},
+		{name: "administrators", blocked: false},
+		{name: "testuser", blocked: false},
+		{name: "mystaffer", blocked: false},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.blocked, blocklist.Blocks(tc.name), tc.name)
+	}
+
+	require.False(t, NewBlocklist().Blocks("administrator"))
+}
+
+func TestBlocklistInvalidRules(t *testing.T) {
+	testCases := []string{
+		"regex:([a-z]",
+		"suffix:admin",
+		"prefix:",
+	}
+
+	for _, rules := range testCases {
+		err := NewBlocklist().Read(strings.NewReader("# rules\n" + rules))
+		require.Error(t, err, rules)
+		require.True(t, strings.HasPrefix(err.Error(), "Line 2: "), err.Error())
+	}
+}
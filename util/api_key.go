@@ -0,0 +1,56 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	apiKeyTag           = "rk"
+	apiKeyPrefixBytes   = 6
+	apiKeySecretBytes   = 24
+	apiKeyPartsCount    = 3
+	apiKeyPartSeparator = "_"
+)
+
+// GenerateAPIKey creates a new random API key in the format rk_<prefix>_<secret>,
+// returning the full key and its lookup prefix
+func GenerateAPIKey() (key string, prefix string, err error) {
+	prefixBytes := make([]byte, apiKeyPrefixBytes)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return
+	}
+
+	secretBytes := make([]byte, apiKeySecretBytes)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = strings.Join([]string{apiKeyTag, prefix, hex.EncodeToString(secretBytes)}, apiKeyPartSeparator)
+
+	return
+}
+
+// ParseAPIKeyPrefix extracts the lookup prefix from an API key
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	keyParts := strings.Split(key, apiKeyPartSeparator)
+	if len(keyParts) != apiKeyPartsCount || keyParts[0] != apiKeyTag {
+		return "", false
+	}
+
+	if len(keyParts[1]) != 2*apiKeyPrefixBytes || len(keyParts[2]) != 2*apiKeySecretBytes {
+		return "", false
+	}
+
+	return keyParts[1], true
+}
+
+// HashAPIKey returns the hash under which an API key is stored
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -12,6 +12,30 @@ type Config struct {
 	ServerAddress       string        `mapstructure:"SERVER_ADDRESS"`
 	TokenSymmetricKey   string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`
 	AccessTokenDuration time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+
+	ImpersonationTokenDuration time.Duration `mapstructure:"IMPERSONATION_TOKEN_DURATION"`
+	InvitationDuration         time.Duration `mapstructure:"INVITATION_DURATION"`
+
+	UserNameChangeCooldown time.Duration `mapstructure:"USER_NAME_CHANGE_COOLDOWN"`
+	UserNameReservation    time.Duration `mapstructure:"USER_NAME_RESERVATION"`
+	UserNameBlocklist      string        `mapstructure:"USER_NAME_BLOCKLIST"`
+
+	RequireIfMatch bool `mapstructure:"REQUIRE_IF_MATCH"`
+
+	DBReadTimeout  time.Duration `mapstructure:"DB_READ_TIMEOUT"`
+	DBWriteTimeout time.Duration `mapstructure:"DB_WRITE_TIMEOUT"`
+
+	DeletedUserRetention time.Duration `mapstructure:"DELETED_USER_RETENTION"`
+	UserPurgeInterval    time.Duration `mapstructure:"USER_PURGE_INTERVAL"`
+
+	RegistrationApproval   bool          `mapstructure:"REGISTRATION_APPROVAL"`
+	PendingRegistrationTTL time.Duration `mapstructure:"PENDING_REGISTRATION_TTL"`
+
+	GeoIPDatabase string `mapstructure:"GEOIP_DATABASE"`
+
+	PIIEncryptionKeys  string `mapstructure:"PII_ENCRYPTION_KEYS"`
+	PIIBlindIndexKey   string `mapstructure:"PII_BLIND_INDEX_KEY"`
+	PIIEncryptedFields string `mapstructure:"PII_ENCRYPTED_FIELDS"`
 }
 
 // LoadConfig created the config object based on environment variables
@@ -0,0 +1,83 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	invitationCodeTag           = "inv"
+	invitationNonceBytes        = 16
+	invitationCodePartsCount    = 4
+	invitationCodePartSeparator = "_"
+)
+
+var (
+	ErrInvalidInvitationCode = errors.New("invitation code is invalid")
+	ErrExpiredInvitationCode = errors.New("invitation code has expired")
+)
+
+// NewInvitationCode creates a random invitation code in the format inv_<expiry>_<nonce>_<signature>,
+// signed with key so that forged and expired codes are rejected before any lookup
+func NewInvitationCode(key []byte, expiresAt time.Time) (string, error) {
+	nonceBytes := make([]byte, invitationNonceBytes)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", err
+	}
+
+	payload := strings.Join([]string{
+		invitationCodeTag,
+		strconv.FormatInt(expiresAt.Unix(), 10),
+		hex.EncodeToString(nonceBytes),
+	}, invitationCodePartSeparator)
+
+	return payload + invitationCodePartSeparator + signInvitationPayload(key, payload), nil
+}
+
+// VerifyInvitationCode checks that code was signed with key and has not expired at now
+func VerifyInvitationCode(key []byte, code string, now time.Time) error {
+	codeParts := strings.Split(code, invitationCodePartSeparator)
+	if len(codeParts) != invitationCodePartsCount || codeParts[0] != invitationCodeTag {
+		return ErrInvalidInvitationCode
+	}
+
+	if len(codeParts[2]) != 2*invitationNonceBytes {
+		return ErrInvalidInvitationCode
+	}
+
+	payload := strings.Join(codeParts[:3], invitationCodePartSeparator)
+	if !hmac.Equal([]byte(codeParts[3]), []byte(signInvitationPayload(key, payload))) {
+		return ErrInvalidInvitationCode
+	}
+
+	expiresAt, err := strconv.ParseInt(codeParts[1], 10, 64)
+	if err != nil {
+		return ErrInvalidInvitationCode
+	}
+
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return ErrExpiredInvitationCode
+	}
+
+	return nil
+}
+
+// HashInvitationCode returns the hash under which an invitation code is stored
+func HashInvitationCode(code string) string {
+	hash := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func signInvitationPayload(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
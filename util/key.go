@@ -0,0 +1,27 @@
+package util
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const derivedKeyBytes = 32
+
+// Purposes of the keys derived from the token symmetric key
+const (
+	InvitationKeyPurpose        = "invitation"
+	PhoneVerificationKeyPurpose = "phone-verification"
+)
+
+// DeriveKey derives from secret the key used for purpose with HKDF-SHA256, so that a key
+// signing or hashing one kind of value never does it for another
+func DeriveKey(secret string, purpose string) ([]byte, error) {
+	key := make([]byte, derivedKeyBytes)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(purpose)), key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+const verificationCodeDigits = 6
+
+// NewVerificationCode creates a random numeric code short enough to be typed from a text message
+func NewVerificationCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < verificationCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", verificationCodeDigits, n), nil
+}
+
+// HashVerificationCode returns the hash under which a verification code is stored. The code is
+// keyed with key, as its few digits would otherwise be trivial to recover from the hash
+func HashVerificationCode(key []byte, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}